@@ -9,21 +9,13 @@ import (
 	"github.com/Yangiboev/golang-with-curiosity/pkg/jaegar"
 	"github.com/Yangiboev/golang-with-curiosity/pkg/kafka"
 	"github.com/Yangiboev/golang-with-curiosity/pkg/logger"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/messagebus"
 	"github.com/Yangiboev/golang-with-curiosity/pkg/mongodb"
 	"github.com/Yangiboev/golang-with-curiosity/pkg/redis"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/schemaregistry"
 	"github.com/opentracing/opentracing-go"
 )
 
-// @title Ecommerce template microservice
-// @version 1.0
-// @description storage management
-// @contact.name Dilmurod Yangiboev
-// @contact.url https://github.com/Yangiboev
-// @contact.email dimok.aka0771@gmail.com
-
-// @host localhost:5000
-// @BasePath /api/v1
-
 func main() {
 	log.Println("Starting storage project")
 	ctx, cancel := context.WithCancel(context.Background())
@@ -60,25 +52,43 @@ func main() {
 		}
 	}()
 	appLogger.Infof("MongoDB connected: %v", mongoDBConn.NumberSessionsInProgress())
-	conn, err := kafka.NewKafkaConn(ctx, cfg)
+	if cfg.MessageBus.Driver == messagebus.DriverKafka {
+		conn, err := kafka.NewKafkaConn(ctx, cfg)
+		if err != nil {
+			appLogger.Fatal("NewKafkaConn", err)
+		}
+		defer conn.Close()
+	}
+	messageBus, err := messagebus.NewMessageBus(cfg, appLogger)
 	if err != nil {
-		appLogger.Fatal("NewKafkaConn", err)
+		appLogger.Fatal("NewMessageBus", err)
 	}
-	defer conn.Close()
+	defer messageBus.Close()
+	appLogger.Infof("Message bus connected: %v", cfg.MessageBus.Driver)
 	// brokers, err := conn.Brokers()
 	// if err != nil {
 	// 	appLogger.Fatal("conn.Brokers", err)
 	// }
 	// appLogger.Infof("Kafka connected: %v", brokers)
-	redisClient := redis.NewRedisClient(cfg)
-	appLogger.Info("Redis connected")
+	redisClient, err := redis.NewRedisClient(ctx, cfg)
+	if err != nil {
+		appLogger.Fatal("NewRedisClient", err)
+	}
+	defer redisClient.Close()
+	appLogger.Infof("Redis connected: %v", cfg.Redis.Mode)
+	schemaRegistry, err := schemaregistry.NewSchemaRegistry(cfg)
+	if err != nil {
+		appLogger.Fatal("NewSchemaRegistry", err)
+	}
 
 	s := server.NewServer(&server.ServerOptions{
-		Log:     appLogger,
-		Config:  cfg,
-		Tracer:  tracer,
-		MongoDB: mongoDBConn,
-		Redis:   redisClient,
+		Log:            appLogger,
+		Config:         cfg,
+		Tracer:         tracer,
+		MongoDB:        mongoDBConn,
+		Redis:          redisClient,
+		SchemaRegistry: schemaRegistry,
+		MessageBus:     messageBus,
 	})
 	appLogger.Fatal(s.Run())
 }
@@ -0,0 +1,16 @@
+package config
+
+import "fmt"
+
+var defaultBatchConfig = map[string]interface{}{
+	"productBatch.maxGet":   100,
+	"productBatch.maxWrite": 100,
+}
+
+// Validate check product batch config
+func (b ProductBatch) Validate() error {
+	if b.MaxGet <= 0 || b.MaxWrite <= 0 {
+		return fmt.Errorf("productBatch: max get %d and max write %d must be positive", b.MaxGet, b.MaxWrite)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+var defaultCacheConfig = map[string]interface{}{
+	"searchCache.enabled":     true,
+	"searchCache.deepPage":    5,
+	"searchCache.ttl.browse":  30 * time.Second,
+	"searchCache.ttl.term":    5 * time.Minute,
+	"searchCache.ttl.pattern": time.Minute,
+	"searchCache.ttl.deep":    time.Minute,
+
+	"productCache.ttl":                                time.Hour,
+	"productCache.jitter":                             0.1,
+	"productCache.staleTTL":                           5 * time.Minute,
+	"productCache.negativeTTL":                        30 * time.Second,
+	"productCache.policies.http.coalesce":             true,
+	"productCache.policies.http.loadTimeout":          5 * time.Second,
+	"productCache.policies.http.earlyExpiration":      true,
+	"productCache.policies.http.beta":                 1.0,
+	"productCache.policies.http.staleWhileRevalidate": true,
+	"productCache.policies.http.refreshTimeout":       5 * time.Second,
+	"productCache.policies.grpc.coalesce":             true,
+	"productCache.policies.grpc.loadTimeout":          5 * time.Second,
+	"productCache.policies.grpc.earlyExpiration":      true,
+	"productCache.policies.grpc.beta":                 1.0,
+	"productCache.policies.grpc.staleWhileRevalidate": false,
+	"productCache.policies.grpc.refreshTimeout":       5 * time.Second,
+}
+
+// Validate check search cache config
+func (c SearchCache) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.DeepPage < 1 {
+		return fmt.Errorf("searchCache: deep page %d must be positive", c.DeepPage)
+	}
+	if c.TTL.Browse <= 0 || c.TTL.Term <= 0 || c.TTL.Pattern <= 0 || c.TTL.Deep <= 0 {
+		return fmt.Errorf("searchCache: query class TTLs %+v must be positive", c.TTL)
+	}
+	return nil
+}
+
+// Validate check product cache config
+func (c ProductCache) Validate() error {
+	switch {
+	case c.TTL <= 0:
+		return fmt.Errorf("productCache: ttl %v must be positive", c.TTL)
+	case c.Jitter < 0 || c.Jitter >= 1:
+		return fmt.Errorf("productCache: jitter %v must be in [0, 1)", c.Jitter)
+	case c.StaleTTL < 0:
+		return fmt.Errorf("productCache: stale ttl %v must not be negative", c.StaleTTL)
+	case c.NegativeTTL < 0:
+		return fmt.Errorf("productCache: negative ttl %v must not be negative", c.NegativeTTL)
+	case c.Local.Enabled && (c.Local.Size <= 0 || c.Local.TTL <= 0 || c.Local.Channel == ""):
+		return fmt.Errorf("productCache: local cache size %d, ttl %v and channel %q must be set", c.Local.Size, c.Local.TTL, c.Local.Channel)
+	}
+
+	policies := map[string]CachePolicy{"http": c.Policies.HTTP, "grpc": c.Policies.GRPC}
+	for path, policy := range policies {
+		if policy.Coalesce && policy.LoadTimeout <= 0 {
+			return fmt.Errorf("productCache: %s policy coalesced load requires positive load timeout", path)
+		}
+		if policy.EarlyExpiration && policy.Beta <= 0 {
+			return fmt.Errorf("productCache: %s policy beta %v must be positive", path, policy.Beta)
+		}
+		if policy.StaleWhileRevalidate && (policy.RefreshTimeout <= 0 || c.StaleTTL == 0) {
+			return fmt.Errorf("productCache: %s stale while revalidate requires positive refresh timeout and stale ttl", path)
+		}
+	}
+	return nil
+}
+
+// MaxTTL longest query class TTL
+func (t SearchCacheTTL) MaxTTL() time.Duration {
+	max := t.Browse
+	for _, ttl := range []time.Duration{t.Term, t.Pattern, t.Deep} {
+		if ttl > max {
+			max = ttl
+		}
+	}
+	return max
+}
@@ -9,22 +9,38 @@ import (
 )
 
 const (
-	GRPC_PORT = "GRPC_PORT"
-	HTTP_PORT = "HTTP_PORT"
+	GRPC_PORT   = "GRPC_PORT"
+	HTTP_PORT   = "HTTP_PORT"
+	ADMIN_TOKEN = "ADMIN_TOKEN"
 )
 
 type Config struct {
-	AppVersion string
-	Server     Server
-	Logger     Logger
-	Jaeger     Jaeger
-	Metrics    Metrics
-	MongoDB    MongoDB
-	Kafka      Kafka
-	Http       Http
-	Redis      Redis
+	AppVersion     string
+	Server         Server
+	Logger         Logger
+	Jaeger         Jaeger
+	Metrics        Metrics
+	MongoDB        MongoDB
+	Kafka          Kafka
+	MessageBus     MessageBus
+	Http           Http
+	Redis          Redis
+	SearchCache    SearchCache
+	ProductCache   ProductCache
+	RateLimit      RateLimit
+	ProductWatch   ProductWatch
+	ProductOutbox  ProductOutbox
+	ProductBatch   ProductBatch
+	Gateway        Gateway
+	Admin          Admin
+	GraphQL        GraphQL
+	Idempotency    Idempotency
+	HTTPCache      HTTPCache
+	SchemaRegistry SchemaRegistry
 }
 
+// Server HTTP and gRPC servers, client IP is read from X-Forwarded-For set by proxies of TrustedProxies CIDR ranges,
+// it is the connection peer address otherwise
 type Server struct {
 	Port              string
 	Development       bool
@@ -33,6 +49,7 @@ type Server struct {
 	ReadTimeout       time.Duration
 	MaxConnectionIdle time.Duration
 	MaxConnectionAge  time.Duration
+	TrustedProxies    []string
 	Kafka             Kafka
 }
 type Http struct {
@@ -58,7 +75,7 @@ type Metrics struct {
 	ServiceName string
 }
 
-//Jaeger config
+// Jaeger config
 type Jaeger struct {
 	Host        string
 	ServiceName string
@@ -73,21 +90,335 @@ type MongoDB struct {
 }
 
 type Kafka struct {
-	Brokers []string
+	Brokers      []string
+	GroupID      string
+	EventMode    string
+	WireFormat   string
+	Topics       KafkaTopics
+	Reader       KafkaReader
+	Writer       KafkaWriter
+	Retry        KafkaRetry
+	Consumers    KafkaConsumers
+	Provisioning KafkaProvisioning
 }
+
+// KafkaTopics topic names, ProductEvents carries product domain events and ProductCatalog compacted latest product states
+type KafkaTopics struct {
+	CreateProduct   string
+	UpdateProduct   string
+	DeadLetterQueue string
+	ProductEvents   string
+	ProductCatalog  string
+}
+
+// KafkaReader consumer group readers config
+type KafkaReader struct {
+	MinBytes               int
+	MaxBytes               int
+	QueueCapacity          int
+	HeartbeatInterval      time.Duration
+	CommitInterval         time.Duration
+	PartitionWatchInterval time.Duration
+	MaxAttempts            int
+	DialTimeout            time.Duration
+}
+
+// KafkaWriter producers config, Compression is one of none, gzip, snappy, lz4, zstd and RequiredAcks one of none, one, all
+type KafkaWriter struct {
+	BatchSize    int
+	BatchTimeout time.Duration
+	Compression  string
+	RequiredAcks string
+	MaxAttempts  int
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+}
+
+// KafkaRetry in-process retry policy and delayed retry topics
+type KafkaRetry struct {
+	Attempts uint
+	Delay    time.Duration
+	Tiers    []KafkaRetryTier
+}
+
+// KafkaRetryTier delayed retry topic config, topic name is "<source topic>.<Suffix>"
+type KafkaRetryTier struct {
+	Suffix string
+	Delay  time.Duration
+}
+
+// KafkaConsumers consumers config, retry consumer serves all retry tiers topics
+type KafkaConsumers struct {
+	CreateProduct KafkaConsumer
+	UpdateProduct KafkaConsumer
+	Retry         KafkaConsumer
+}
+
+// KafkaConsumer single topic consumer config, Workers is the number of partitions processed in parallel
+type KafkaConsumer struct {
+	Enabled       bool
+	GroupID       string
+	Workers       int
+	QueueCapacity int
+	Batch         KafkaBatch
+}
+
+// KafkaBatch batch consumption, each of consumer workers accumulates messages of its partitions up to size or timeout and
+// writes them with one bulk write
+type KafkaBatch struct {
+	Enabled bool
+	Size    int
+	Timeout time.Duration
+}
+
+// KafkaProvisioning topics provisioning at startup, missing topics are created and divergent existing topics
+// fail startup or are logged, OnDivergence is one of fail, warn
+type KafkaProvisioning struct {
+	Enabled      bool
+	OnDivergence string
+	Timeout      time.Duration
+	Topics       KafkaTopicSpecs
+}
+
+// KafkaTopicSpecs declared topics settings, retry spec applies to all retry tiers topics
+type KafkaTopicSpecs struct {
+	CreateProduct   KafkaTopicSpec
+	UpdateProduct   KafkaTopicSpec
+	DeadLetterQueue KafkaTopicSpec
+	Retry           KafkaTopicSpec
+	ProductEvents   KafkaTopicSpec
+	ProductCatalog  KafkaTopicSpec
+}
+
+// KafkaTopicSpec declared topic settings, zero Retention, CleanupPolicy and MinInSyncReplicas keep broker defaults,
+// negative Retention keeps messages forever, CleanupPolicy is one of delete, compact, compact,delete
+type KafkaTopicSpec struct {
+	Partitions        int
+	ReplicationFactor int
+	Retention         time.Duration
+	CleanupPolicy     string
+	MinInSyncReplicas int
+}
+
+// MessageBus config, kafka driver uses Kafka config, memory driver keeps topics in process
+type MessageBus struct {
+	Driver     string
+	Partitions int
+}
+
+// SchemaRegistry config, embedded file registry is used when URL is empty
+type SchemaRegistry struct {
+	URL           string
+	File          string
+	Compatibility string
+	Timeout       time.Duration
+}
+
+// SearchCache search result pages cache, DeepPage is the last page cached with query class TTL
+type SearchCache struct {
+	Enabled  bool
+	DeepPage int
+	TTL      SearchCacheTTL
+}
+
+// SearchCacheTTL search pages TTL by query class: empty search, plain text term, regex pattern and pages after DeepPage
+type SearchCacheTTL struct {
+	Browse  time.Duration
+	Term    time.Duration
+	Pattern time.Duration
+	Deep    time.Duration
+}
+
+// ProductCache product by id cache, entries are fresh for TTL spread by Jitter fraction and kept StaleTTL longer
+// to be served stale by call paths with stale while revalidate policy, ids of missing products are remembered
+// for NegativeTTL, zero disables negative caching
+type ProductCache struct {
+	TTL         time.Duration
+	Jitter      float64
+	StaleTTL    time.Duration
+	NegativeTTL time.Duration
+	Local       LocalCache
+	Policies    ProductCachePolicies
+}
+
+// LocalCache in process cache in front of redis holding up to Size entries for TTL, instances drop local entries
+// of products changed by other instances on invalidations published to Channel
+type LocalCache struct {
+	Enabled bool
+	Size    int
+	TTL     time.Duration
+	Channel string
+}
+
+// ProductCachePolicies product cache read policies by call path
+type ProductCachePolicies struct {
+	HTTP CachePolicy
+	GRPC CachePolicy
+}
+
+// CachePolicy product cache read behaviour. Coalesce shares one database load within LoadTimeout between concurrent
+// misses of a product, the load is not canceled with the caller that started it,
+// EarlyExpiration refreshes fresh entries with probability growing as expiration nears scaled by Beta,
+// StaleWhileRevalidate serves expired entries while one background load within RefreshTimeout refreshes them
+type CachePolicy struct {
+	Coalesce             bool
+	LoadTimeout          time.Duration
+	EarlyExpiration      bool
+	Beta                 float64
+	StaleWhileRevalidate bool
+	RefreshTimeout       time.Duration
+}
+
+// ProductWatch product changes watched over gRPC. Changes are appended to redis Stream trimmed to about MaxLen
+// changes, which bounds how far back watches can resume. Every instance reads ReadBatch changes at a time blocking
+// up to Block and fans them out to watches buffering up to Buffer changes, watches falling further behind are closed
+type ProductWatch struct {
+	Stream        string
+	MaxLen        int64
+	ReadBatch     int64
+	Block         time.Duration
+	Buffer        int
+	MaxProductIDs int
+}
+
+// ProductOutbox product changes stored with product writes in the same transaction. Instance holding relay Lease
+// publishes up to BatchSize changes at a time to product watches and product events topics every PollInterval
+// and right after its own writes
+type ProductOutbox struct {
+	PollInterval time.Duration
+	BatchSize    int
+	Lease        time.Duration
+}
+
+// Gateway grpc-gateway REST proxy mounted into echo server, proxied calls go to gRPC server at Endpoint,
+// empty Endpoint is gRPC server port on localhost
+type Gateway struct {
+	Enabled    bool
+	Endpoint   string
+	CAFile     string
+	ServerName string
+}
+
+// Admin consumer admin API of v1 REST routes, gRPC service and its gateway routes. Callers authenticate with Token
+// as bearer token, ADMIN_TOKEN environment variable overrides it. Admin API rejects every call while Token is empty
+type Admin struct {
+	Token string
+}
+
+// GraphQL /graphql endpoint. Operations deeper than MaxDepth or costlier than MaxComplexity are rejected, every
+// selected field costs one and selections of list fields cost list size times, DefaultListSize when the field has no
+// size or ids argument. Subscription sockets must send connection_init within InitTimeout and are pinged every KeepAlive,
+// they run at most MaxSubscriptions operations at once. Browser sockets are accepted from the same host or from
+// AllowedOrigins only
+type GraphQL struct {
+	Enabled          bool
+	MaxDepth         int
+	MaxComplexity    int
+	DefaultListSize  int
+	InitTimeout      time.Duration
+	KeepAlive        time.Duration
+	MaxSubscriptions int
+	AllowedOrigins   []string
+}
+
+// Idempotency Idempotency-Key handling of create and update requests. Keys are read from Header of HTTP requests and
+// MetadataKey of gRPC calls to Methods, responses of successful requests are replayed for Window to the same client
+// IP. Key is locked for LockTimeout while its first request is in flight
+type Idempotency struct {
+	Enabled      bool
+	Prefix       string
+	Header       string
+	MetadataKey  string
+	Window       time.Duration
+	LockTimeout  time.Duration
+	MaxKeyLength int
+	Methods      []string
+}
+
+// HTTPCache ETag and Last-Modified validators, conditional GETs and Cache-Control of HTTP catalog reads. Cache-Control
+// of first rule matching "METHOD /route" is sent, Default otherwise
+type HTTPCache struct {
+	Enabled bool
+	Default string
+	Rules   []HTTPCacheRule
+}
+
+// HTTPCacheRule Cache-Control header value of matching HTTP routes
+type HTTPCacheRule struct {
+	Match        []string
+	CacheControl string
+}
+
+// ProductBatch most products of single batch get and batch create or update
+type ProductBatch struct {
+	MaxGet   int
+	MaxWrite int
+}
+
+// RateLimitDefaultRule name of Default policy applied to requests no rule matches
+const RateLimitDefaultRule = "default"
+
+// RateLimit request rate limits shared by instances through redis, requests are limited by first rule matching
+// HTTP "METHOD /route" or gRPC full method, by Default policy otherwise. Instances limit locally, tracking up to LocalSize
+// keys, when redis does not answer within Timeout, and keep limiting locally for BreakerCooldown before trying
+// redis again. Clients are identified by IP
+type RateLimit struct {
+	Enabled         bool
+	Prefix          string
+	Timeout         time.Duration
+	LocalSize       int
+	BreakerCooldown time.Duration
+	Default         RateLimitPolicy
+	Rules           []RateLimitRule
+}
+
+// RateLimitRule named policy of matching HTTP routes and gRPC methods
+type RateLimitRule struct {
+	Name   string
+	Match  []string
+	Policy RateLimitPolicy
+}
+
+// RateLimitPolicy allows Limit requests per Window counted per key built from KeyBy parts. Token bucket allows bursts
+// of up to Burst requests, Limit by default
+type RateLimitPolicy struct {
+	Algorithm string
+	Limit     int
+	Window    time.Duration
+	Burst     int
+	KeyBy     []string
+}
+
+// Redis connection, Mode selects standalone node at Addrs, MasterName monitored by sentinels at Addrs
+// or cluster seeded by Addrs. Username and SentinelUsername authenticate with redis ACL
 type Redis struct {
-	RedisAddress   string
-	RedisPassword  string
-	RedisDB        string
-	RedisDefaultDB string
-	Password       string
-	MinIdleConn    int
-	PoolSize       int
-	PoolTimeout    int
-	DB             int
+	Mode             string
+	Addrs            []string
+	MasterName       string
+	Username         string
+	Password         string
+	SentinelUsername string
+	SentinelPassword string
+	DB               int
+	MinIdleConn      int
+	PoolSize         int
+	PoolTimeout      int
+	TLS              RedisTLS
+}
+
+// RedisTLS connection encryption, CAFile verifies servers in addition to system roots,
+// CertFile and KeyFile are client certificate for servers requiring one
+type RedisTLS struct {
+	Enabled            bool
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	ServerName         string
+	InsecureSkipVerify bool
 }
 
 func exportConfig() error {
+	setDefaults()
 	viper.SetConfigType("yaml")
 	viper.AddConfigPath("./config")
 	if os.Getenv("MODE") == "DOCKER" {
@@ -117,5 +448,50 @@ func LoadConfig() (Config, error) {
 	if grpcPort != "" {
 		c.Http.Port = httpPort
 	}
+	if adminToken := os.Getenv(ADMIN_TOKEN); adminToken != "" {
+		c.Admin.Token = adminToken
+	}
+	if err := c.GraphQL.Validate(); err != nil {
+		return c, err
+	}
+	if err := c.Idempotency.Validate(); err != nil {
+		return c, err
+	}
+	if err := c.HTTPCache.Validate(); err != nil {
+		return c, err
+	}
+	if err := c.Gateway.Validate(); err != nil {
+		return c, err
+	}
+	if err := c.ProductBatch.Validate(); err != nil {
+		return c, err
+	}
+	if err := c.ProductWatch.Validate(); err != nil {
+		return c, err
+	}
+	if err := c.ProductOutbox.Validate(); err != nil {
+		return c, err
+	}
+	if err := c.Server.Validate(); err != nil {
+		return c, err
+	}
+	if err := c.RateLimit.Validate(); err != nil {
+		return c, err
+	}
+	if err := c.Redis.Validate(); err != nil {
+		return c, err
+	}
+	if err := c.MessageBus.Validate(); err != nil {
+		return c, err
+	}
+	if err := c.Kafka.Validate(c.MessageBus.Driver); err != nil {
+		return c, err
+	}
+	if err := c.SearchCache.Validate(); err != nil {
+		return c, err
+	}
+	if err := c.ProductCache.Validate(); err != nil {
+		return c, err
+	}
 	return c, nil
 }
@@ -0,0 +1,18 @@
+package config
+
+import "fmt"
+
+var defaultGatewayConfig = map[string]interface{}{
+	"gateway.enabled":    true,
+	"gateway.endpoint":   "",
+	"gateway.caFile":     "ssl/ca.crt",
+	"gateway.serverName": "localhost",
+}
+
+// Validate check grpc-gateway config
+func (g Gateway) Validate() error {
+	if g.Enabled && (g.CAFile == "" || g.ServerName == "") {
+		return fmt.Errorf("gateway: ca file %q and server name %q must be set", g.CAFile, g.ServerName)
+	}
+	return nil
+}
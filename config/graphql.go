@@ -0,0 +1,30 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+var defaultGraphQLConfig = map[string]interface{}{
+	"graphQL.enabled":          true,
+	"graphQL.maxDepth":         8,
+	"graphQL.maxComplexity":    1000,
+	"graphQL.defaultListSize":  20,
+	"graphQL.initTimeout":      10 * time.Second,
+	"graphQL.keepAlive":        15 * time.Second,
+	"graphQL.maxSubscriptions": 10,
+}
+
+// Validate check graphql config
+func (g GraphQL) Validate() error {
+	switch {
+	case g.MaxDepth <= 0 || g.MaxComplexity <= 0 || g.DefaultListSize <= 0:
+		return fmt.Errorf("graphQL: max depth %d, max complexity %d and default list size %d must be positive",
+			g.MaxDepth, g.MaxComplexity, g.DefaultListSize)
+	case g.InitTimeout <= 0 || g.KeepAlive <= 0:
+		return fmt.Errorf("graphQL: init timeout %v and keep alive %v must be positive", g.InitTimeout, g.KeepAlive)
+	case g.MaxSubscriptions <= 0:
+		return fmt.Errorf("graphQL: max subscriptions %d must be positive", g.MaxSubscriptions)
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package config
+
+import (
+	"fmt"
+)
+
+var defaultHTTPCacheConfig = map[string]interface{}{
+	"httpCache.enabled": true,
+	"httpCache.default": "no-cache",
+}
+
+// Validate check http cache config
+func (h HTTPCache) Validate() error {
+	if !h.Enabled {
+		return nil
+	}
+	for i, rule := range h.Rules {
+		if len(rule.Match) == 0 {
+			return fmt.Errorf("httpCache: rule %d matches no routes", i)
+		}
+	}
+	return nil
+}
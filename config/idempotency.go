@@ -0,0 +1,40 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+var defaultIdempotencyConfig = map[string]interface{}{
+	"idempotency.enabled":      true,
+	"idempotency.prefix":       "idempotency",
+	"idempotency.header":       "Idempotency-Key",
+	"idempotency.metadataKey":  "idempotency-key",
+	"idempotency.window":       24 * time.Hour,
+	"idempotency.lockTimeout":  30 * time.Second,
+	"idempotency.maxKeyLength": 255,
+	"idempotency.methods": []string{
+		"/productsService.ProductsService/Create",
+		"/productsService.ProductsService/Update",
+		"/productsService.ProductsService/BatchCreate",
+		"/productsService.ProductsService/BatchUpdate",
+	},
+}
+
+// Validate check idempotency config
+func (i Idempotency) Validate() error {
+	if !i.Enabled {
+		return nil
+	}
+	switch {
+	case i.Prefix == "" || i.Header == "" || i.MetadataKey == "":
+		return fmt.Errorf("idempotency: prefix, header and metadata key are required")
+	case i.Window <= 0 || i.LockTimeout <= 0:
+		return fmt.Errorf("idempotency: window %v and lock timeout %v must be positive", i.Window, i.LockTimeout)
+	case i.LockTimeout > i.Window:
+		return fmt.Errorf("idempotency: lock timeout %v must not exceed window %v", i.LockTimeout, i.Window)
+	case i.MaxKeyLength <= 0:
+		return fmt.Errorf("idempotency: max key length %d must be positive", i.MaxKeyLength)
+	}
+	return nil
+}
@@ -0,0 +1,258 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+var (
+	kafkaCompressions  = map[string]bool{"none": true, "gzip": true, "snappy": true, "lz4": true, "zstd": true}
+	kafkaRequiredAcks  = map[string]bool{"none": true, "one": true, "all": true}
+	kafkaEventModes    = map[string]bool{"binary": true, "structured": true}
+	kafkaWireFormats   = map[string]bool{"json": true, "protobuf": true}
+	kafkaDivergences   = map[string]bool{"fail": true, "warn": true}
+	kafkaCleanups      = map[string]bool{"": true, "delete": true, "compact": true, "compact,delete": true}
+	messageBusDrivers  = map[string]bool{"kafka": true, "memory": true}
+	defaultKafkaConfig = map[string]interface{}{
+		"kafka.groupID":    "products_group",
+		"kafka.eventMode":  "binary",
+		"kafka.wireFormat": "json",
+
+		"kafka.topics.createProduct":   "create-product",
+		"kafka.topics.updateProduct":   "update-product",
+		"kafka.topics.deadLetterQueue": "dead-letter-queue",
+		"kafka.topics.productEvents":   "product-events",
+		"kafka.topics.productCatalog":  "product-catalog",
+
+		"kafka.reader.minBytes":               10e3, // 10KB
+		"kafka.reader.maxBytes":               10e6, // 10MB
+		"kafka.reader.queueCapacity":          100,
+		"kafka.reader.heartbeatInterval":      3 * time.Second,
+		"kafka.reader.commitInterval":         0,
+		"kafka.reader.partitionWatchInterval": 5 * time.Second,
+		"kafka.reader.maxAttempts":            3,
+		"kafka.reader.dialTimeout":            3 * time.Minute,
+
+		"kafka.writer.batchSize":    100,
+		"kafka.writer.batchTimeout": time.Second,
+		"kafka.writer.compression":  "snappy",
+		"kafka.writer.requiredAcks": "all",
+		"kafka.writer.maxAttempts":  3,
+		"kafka.writer.readTimeout":  10 * time.Second,
+		"kafka.writer.writeTimeout": 10 * time.Second,
+
+		"kafka.retry.attempts": 1,
+		"kafka.retry.delay":    time.Second,
+		"kafka.retry.tiers": []map[string]interface{}{
+			{"suffix": "retry.1m", "delay": time.Minute},
+			{"suffix": "retry.10m", "delay": 10 * time.Minute},
+			{"suffix": "retry.1h", "delay": time.Hour},
+		},
+
+		"kafka.consumers.createProduct.enabled":       true,
+		"kafka.consumers.createProduct.workers":       3,
+		"kafka.consumers.createProduct.queueCapacity": 100,
+		"kafka.consumers.createProduct.batch.enabled": false,
+		"kafka.consumers.createProduct.batch.size":    500,
+		"kafka.consumers.createProduct.batch.timeout": 500 * time.Millisecond,
+		"kafka.consumers.updateProduct.enabled":       true,
+		"kafka.consumers.updateProduct.workers":       3,
+		"kafka.consumers.updateProduct.queueCapacity": 100,
+		"kafka.consumers.updateProduct.batch.enabled": false,
+		"kafka.consumers.updateProduct.batch.size":    500,
+		"kafka.consumers.updateProduct.batch.timeout": 500 * time.Millisecond,
+		"kafka.consumers.retry.enabled":               true,
+		"kafka.consumers.retry.workers":               1,
+		"kafka.consumers.retry.queueCapacity":         100,
+
+		"kafka.provisioning.enabled":                                  true,
+		"kafka.provisioning.onDivergence":                             "warn",
+		"kafka.provisioning.timeout":                                  30 * time.Second,
+		"kafka.provisioning.topics.createProduct.partitions":          3,
+		"kafka.provisioning.topics.createProduct.replicationFactor":   1,
+		"kafka.provisioning.topics.createProduct.retention":           7 * 24 * time.Hour,
+		"kafka.provisioning.topics.createProduct.cleanupPolicy":       "delete",
+		"kafka.provisioning.topics.updateProduct.partitions":          3,
+		"kafka.provisioning.topics.updateProduct.replicationFactor":   1,
+		"kafka.provisioning.topics.updateProduct.retention":           7 * 24 * time.Hour,
+		"kafka.provisioning.topics.updateProduct.cleanupPolicy":       "delete",
+		"kafka.provisioning.topics.deadLetterQueue.partitions":        3,
+		"kafka.provisioning.topics.deadLetterQueue.replicationFactor": 1,
+		"kafka.provisioning.topics.deadLetterQueue.retention":         30 * 24 * time.Hour,
+		"kafka.provisioning.topics.deadLetterQueue.cleanupPolicy":     "delete",
+		"kafka.provisioning.topics.retry.partitions":                  3,
+		"kafka.provisioning.topics.retry.replicationFactor":           1,
+		"kafka.provisioning.topics.retry.retention":                   24 * time.Hour,
+		"kafka.provisioning.topics.retry.cleanupPolicy":               "delete",
+		"kafka.provisioning.topics.productEvents.partitions":          3,
+		"kafka.provisioning.topics.productEvents.replicationFactor":   1,
+		"kafka.provisioning.topics.productEvents.retention":           7 * 24 * time.Hour,
+		"kafka.provisioning.topics.productEvents.cleanupPolicy":       "delete",
+		"kafka.provisioning.topics.productCatalog.partitions":         3,
+		"kafka.provisioning.topics.productCatalog.replicationFactor":  1,
+		"kafka.provisioning.topics.productCatalog.retention":          -1,
+		"kafka.provisioning.topics.productCatalog.cleanupPolicy":      "compact",
+	}
+)
+
+func setDefaults() {
+	for key, value := range defaultKafkaConfig {
+		viper.SetDefault(key, value)
+	}
+	for key, value := range defaultCacheConfig {
+		viper.SetDefault(key, value)
+	}
+	for key, value := range defaultRedisConfig {
+		viper.SetDefault(key, value)
+	}
+	for key, value := range defaultRateLimitConfig {
+		viper.SetDefault(key, value)
+	}
+	for key, value := range defaultWatchConfig {
+		viper.SetDefault(key, value)
+	}
+	for key, value := range defaultOutboxConfig {
+		viper.SetDefault(key, value)
+	}
+	for key, value := range defaultBatchConfig {
+		viper.SetDefault(key, value)
+	}
+	for key, value := range defaultGatewayConfig {
+		viper.SetDefault(key, value)
+	}
+	for key, value := range defaultGraphQLConfig {
+		viper.SetDefault(key, value)
+	}
+	for key, value := range defaultIdempotencyConfig {
+		viper.SetDefault(key, value)
+	}
+	for key, value := range defaultHTTPCacheConfig {
+		viper.SetDefault(key, value)
+	}
+	viper.SetDefault("messageBus.driver", "kafka")
+	viper.SetDefault("messageBus.partitions", 3)
+}
+
+// Validate check kafka topology config, broker connection settings are checked only for the kafka message bus driver
+func (k Kafka) Validate(driver string) error {
+	if driver == "kafka" {
+		if err := k.validateConnection(); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case k.GroupID == "":
+		return fmt.Errorf("kafka: empty group id")
+	case !kafkaEventModes[k.EventMode]:
+		return fmt.Errorf("kafka: unknown event mode %q", k.EventMode)
+	case !kafkaWireFormats[k.WireFormat]:
+		return fmt.Errorf("kafka: unknown wire format %q", k.WireFormat)
+	case k.Topics.CreateProduct == "" || k.Topics.UpdateProduct == "" || k.Topics.DeadLetterQueue == "" ||
+		k.Topics.ProductEvents == "" || k.Topics.ProductCatalog == "":
+		return fmt.Errorf("kafka: empty topic name")
+	case k.Retry.Attempts == 0:
+		return fmt.Errorf("kafka: retry attempts must be at least 1")
+	}
+
+	var previous time.Duration
+	suffixes := make(map[string]bool, len(k.Retry.Tiers))
+	for _, tier := range k.Retry.Tiers {
+		switch {
+		case tier.Suffix == "" || suffixes[tier.Suffix]:
+			return fmt.Errorf("kafka: empty or duplicate retry tier suffix %q", tier.Suffix)
+		case tier.Delay <= previous:
+			return fmt.Errorf("kafka: retry tier %q delay %v must be greater than previous tier delay", tier.Suffix, tier.Delay)
+		}
+		suffixes[tier.Suffix] = true
+		previous = tier.Delay
+	}
+
+	consumers := map[string]KafkaConsumer{
+		"createProduct": k.Consumers.CreateProduct,
+		"updateProduct": k.Consumers.UpdateProduct,
+		"retry":         k.Consumers.Retry,
+	}
+	for name, consumer := range consumers {
+		if consumer.Enabled && (consumer.Workers <= 0 || consumer.QueueCapacity <= 0) {
+			return fmt.Errorf("kafka: consumer %s workers %d and queue capacity %d must be positive", name, consumer.Workers, consumer.QueueCapacity)
+		}
+		if consumer.Batch.Enabled && (consumer.Batch.Size <= 0 || consumer.Batch.Timeout <= 0) {
+			return fmt.Errorf("kafka: consumer %s batch size %d and timeout %v must be positive", name, consumer.Batch.Size, consumer.Batch.Timeout)
+		}
+	}
+	if k.Consumers.Retry.Batch.Enabled {
+		return fmt.Errorf("kafka: retry consumer does not support batch mode")
+	}
+	return k.Provisioning.validate(previous)
+}
+
+// validateConnection check broker, reader and writer config, only used by kafka message bus driver
+func (k Kafka) validateConnection() error {
+	switch {
+	case len(k.Brokers) == 0:
+		return fmt.Errorf("kafka: no brokers")
+	case k.Reader.MinBytes <= 0 || k.Reader.MaxBytes < k.Reader.MinBytes:
+		return fmt.Errorf("kafka: reader minBytes %d and maxBytes %d", k.Reader.MinBytes, k.Reader.MaxBytes)
+	case !kafkaCompressions[k.Writer.Compression]:
+		return fmt.Errorf("kafka: unknown writer compression %q", k.Writer.Compression)
+	case !kafkaRequiredAcks[k.Writer.RequiredAcks]:
+		return fmt.Errorf("kafka: unknown writer required acks %q", k.Writer.RequiredAcks)
+	case k.Writer.BatchSize <= 0:
+		return fmt.Errorf("kafka: writer batch size %d", k.Writer.BatchSize)
+	}
+	return nil
+}
+
+// Validate check message bus driver
+func (m MessageBus) Validate() error {
+	switch {
+	case !messageBusDrivers[m.Driver]:
+		return fmt.Errorf("messageBus: unknown driver %q", m.Driver)
+	case m.Driver == "memory" && m.Partitions <= 0:
+		return fmt.Errorf("messageBus: partitions %d must be positive", m.Partitions)
+	}
+	return nil
+}
+
+// validate check provisioning config, retry topics must retain messages longer than the longest retry tier delay
+func (p KafkaProvisioning) validate(maxRetryDelay time.Duration) error {
+	if !p.Enabled {
+		return nil
+	}
+	if !kafkaDivergences[p.OnDivergence] {
+		return fmt.Errorf("kafka: unknown provisioning onDivergence %q", p.OnDivergence)
+	}
+	if p.Timeout <= 0 {
+		return fmt.Errorf("kafka: provisioning timeout %v must be positive", p.Timeout)
+	}
+
+	specs := map[string]KafkaTopicSpec{
+		"createProduct":   p.Topics.CreateProduct,
+		"updateProduct":   p.Topics.UpdateProduct,
+		"deadLetterQueue": p.Topics.DeadLetterQueue,
+		"retry":           p.Topics.Retry,
+		"productEvents":   p.Topics.ProductEvents,
+		"productCatalog":  p.Topics.ProductCatalog,
+	}
+	for name, spec := range specs {
+		switch {
+		case spec.Partitions <= 0 || spec.ReplicationFactor <= 0:
+			return fmt.Errorf("kafka: topic %s partitions %d and replication factor %d must be positive", name, spec.Partitions, spec.ReplicationFactor)
+		case spec.MinInSyncReplicas < 0 || spec.MinInSyncReplicas > spec.ReplicationFactor:
+			return fmt.Errorf("kafka: topic %s min in-sync replicas %d must not exceed replication factor %d", name, spec.MinInSyncReplicas, spec.ReplicationFactor)
+		case !kafkaCleanups[spec.CleanupPolicy]:
+			return fmt.Errorf("kafka: topic %s unknown cleanup policy %q", name, spec.CleanupPolicy)
+		}
+	}
+	if !strings.Contains(p.Topics.ProductCatalog.CleanupPolicy, "compact") {
+		return fmt.Errorf("kafka: product catalog topic cleanup policy %q must be compacted", p.Topics.ProductCatalog.CleanupPolicy)
+	}
+	if retention := p.Topics.Retry.Retention; retention > 0 && retention <= maxRetryDelay {
+		return fmt.Errorf("kafka: retry topics retention %v must be greater than retry tier delay %v", retention, maxRetryDelay)
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+var defaultOutboxConfig = map[string]interface{}{
+	"productOutbox.pollInterval": 500 * time.Millisecond,
+	"productOutbox.batchSize":    100,
+	"productOutbox.lease":        10 * time.Second,
+}
+
+// Validate check product outbox config
+func (o ProductOutbox) Validate() error {
+	switch {
+	case o.PollInterval <= 0:
+		return fmt.Errorf("productOutbox: poll interval %v must be positive", o.PollInterval)
+	case o.BatchSize <= 0:
+		return fmt.Errorf("productOutbox: batch size %d must be positive", o.BatchSize)
+	case o.Lease <= o.PollInterval:
+		return fmt.Errorf("productOutbox: lease %v must be greater than poll interval %v", o.Lease, o.PollInterval)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Rate limit algorithms and key parts
+const (
+	RateLimitSlidingWindow = "sliding_window"
+	RateLimitTokenBucket   = "token_bucket"
+
+	RateLimitKeyIP     = "ip"
+	RateLimitKeyRoute  = "route"
+	RateLimitKeyMethod = "method"
+)
+
+var (
+	rateLimitAlgorithms = map[string]bool{RateLimitSlidingWindow: true, RateLimitTokenBucket: true}
+	rateLimitKeyParts   = map[string]bool{
+		RateLimitKeyIP: true, RateLimitKeyRoute: true, RateLimitKeyMethod: true,
+	}
+	defaultRateLimitConfig = map[string]interface{}{
+		"rateLimit.enabled":           true,
+		"rateLimit.prefix":            "ratelimit",
+		"rateLimit.timeout":           50 * time.Millisecond,
+		"rateLimit.localSize":         100000,
+		"rateLimit.breakerCooldown":   5 * time.Second,
+		"rateLimit.default.algorithm": RateLimitSlidingWindow,
+		"rateLimit.default.limit":     100,
+		"rateLimit.default.window":    time.Second,
+		"rateLimit.default.keyBy":     []string{RateLimitKeyIP, RateLimitKeyRoute},
+	}
+)
+
+// Validate check rate limit config
+func (r RateLimit) Validate() error {
+	if !r.Enabled {
+		return nil
+	}
+	switch {
+	case r.Prefix == "":
+		return fmt.Errorf("rateLimit: empty prefix")
+	case r.Timeout <= 0:
+		return fmt.Errorf("rateLimit: timeout %v must be positive", r.Timeout)
+	case r.LocalSize <= 0:
+		return fmt.Errorf("rateLimit: local size %d must be positive", r.LocalSize)
+	case r.BreakerCooldown <= 0:
+		return fmt.Errorf("rateLimit: breaker cooldown %v must be positive", r.BreakerCooldown)
+	}
+	if err := r.Default.Validate(); err != nil {
+		return fmt.Errorf("rateLimit: default policy: %w", err)
+	}
+
+	names := make(map[string]bool, len(r.Rules))
+	for _, rule := range r.Rules {
+		switch {
+		case rule.Name == "" || rule.Name == RateLimitDefaultRule:
+			return fmt.Errorf("rateLimit: rule name %q is empty or reserved", rule.Name)
+		case names[rule.Name]:
+			return fmt.Errorf("rateLimit: duplicate rule %q", rule.Name)
+		case len(rule.Match) == 0:
+			return fmt.Errorf("rateLimit: rule %q matches nothing", rule.Name)
+		}
+		names[rule.Name] = true
+		if err := rule.Policy.Validate(); err != nil {
+			return fmt.Errorf("rateLimit: rule %q: %w", rule.Name, err)
+		}
+	}
+	return nil
+}
+
+// Validate check rate limit policy, zero limit disables limiting
+func (p RateLimitPolicy) Validate() error {
+	if p.Limit == 0 {
+		return nil
+	}
+	switch {
+	case p.Limit < 0:
+		return fmt.Errorf("limit %d must not be negative", p.Limit)
+	case !rateLimitAlgorithms[p.Algorithm]:
+		return fmt.Errorf("unknown algorithm %q", p.Algorithm)
+	case p.Window < time.Millisecond:
+		return fmt.Errorf("window %v must be at least 1ms", p.Window)
+	case p.Burst < 0:
+		return fmt.Errorf("burst %d must not be negative", p.Burst)
+	}
+	for _, part := range p.KeyBy {
+		if !rateLimitKeyParts[part] {
+			return fmt.Errorf("unknown key part %q", part)
+		}
+	}
+	return nil
+}
+
+// Capacity most requests allowed at once, token bucket burst or sliding window limit
+func (p RateLimitPolicy) Capacity() int {
+	if p.Algorithm == RateLimitTokenBucket && p.Burst > 0 {
+		return p.Burst
+	}
+	return p.Limit
+}
+
+// MaxWindow longest window of default policy and rules
+func (r RateLimit) MaxWindow() time.Duration {
+	max := r.Default.Window
+	for _, rule := range r.Rules {
+		if rule.Policy.Window > max {
+			max = rule.Policy.Window
+		}
+	}
+	return max
+}
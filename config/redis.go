@@ -0,0 +1,40 @@
+package config
+
+import "fmt"
+
+// Redis topologies
+const (
+	RedisStandalone = "standalone"
+	RedisSentinel   = "sentinel"
+	RedisCluster    = "cluster"
+)
+
+var (
+	redisModes         = map[string]bool{RedisStandalone: true, RedisSentinel: true, RedisCluster: true}
+	defaultRedisConfig = map[string]interface{}{
+		"redis.mode":        RedisStandalone,
+		"redis.addrs":       []string{"localhost:6379"},
+		"redis.minIdleConn": 200,
+		"redis.poolSize":    12000,
+		"redis.poolTimeout": 240,
+	}
+)
+
+// Validate check redis topology config
+func (r Redis) Validate() error {
+	switch {
+	case !redisModes[r.Mode]:
+		return fmt.Errorf("redis: unknown mode %q", r.Mode)
+	case len(r.Addrs) == 0:
+		return fmt.Errorf("redis: no addrs")
+	case r.Mode == RedisStandalone && len(r.Addrs) > 1:
+		return fmt.Errorf("redis: standalone mode takes one addr, got %d", len(r.Addrs))
+	case r.Mode == RedisSentinel && r.MasterName == "":
+		return fmt.Errorf("redis: sentinel mode requires master name")
+	case r.Mode == RedisCluster && r.DB != 0:
+		return fmt.Errorf("redis: cluster mode supports only db 0, got %d", r.DB)
+	case r.TLS.Enabled && (r.TLS.CertFile == "") != (r.TLS.KeyFile == ""):
+		return fmt.Errorf("redis: tls cert file and key file must be set together")
+	}
+	return nil
+}
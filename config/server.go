@@ -0,0 +1,27 @@
+package config
+
+import (
+	"fmt"
+	"net"
+)
+
+// Validate check server config
+func (s Server) Validate() error {
+	if _, err := s.TrustedProxyNets(); err != nil {
+		return fmt.Errorf("server: %w", err)
+	}
+	return nil
+}
+
+// TrustedProxyNets parsed TrustedProxies CIDR ranges
+func (s Server) TrustedProxyNets() ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(s.TrustedProxies))
+	for _, cidr := range s.TrustedProxies {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q: %w", cidr, err)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
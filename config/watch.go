@@ -0,0 +1,29 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+var defaultWatchConfig = map[string]interface{}{
+	"productWatch.stream":        "products:changes",
+	"productWatch.maxLen":        100000,
+	"productWatch.readBatch":     100,
+	"productWatch.block":         5 * time.Second,
+	"productWatch.buffer":        256,
+	"productWatch.maxProductIDs": 100,
+}
+
+// Validate check product watch config
+func (w ProductWatch) Validate() error {
+	switch {
+	case w.Stream == "":
+		return fmt.Errorf("productWatch: empty stream")
+	case w.MaxLen <= 0 || w.ReadBatch <= 0 || w.Buffer <= 0 || w.MaxProductIDs <= 0:
+		return fmt.Errorf("productWatch: max len %d, read batch %d, buffer %d and max product ids %d must be positive",
+			w.MaxLen, w.ReadBatch, w.Buffer, w.MaxProductIDs)
+	case w.Block <= 0:
+		return fmt.Errorf("productWatch: block %v must be positive", w.Block)
+	}
+	return nil
+}
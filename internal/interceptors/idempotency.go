@@ -0,0 +1,178 @@
+package interceptors
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	grpcErrors "github.com/Yangiboev/golang-with-curiosity/pkg/grpc_errors"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/idempotency"
+	productErrors "github.com/Yangiboev/golang-with-curiosity/pkg/product_errors"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// grpcIdempotencyScope scope of gRPC idempotency keys, keys of HTTP and gRPC requests do not collide
+const grpcIdempotencyScope = "grpc:"
+
+// Idempotency replay responses and replayable header metadata of calls to idempotent methods repeated with idempotency
+// key metadata by the same client IP. Calls reusing key with other method or request fail with InvalidArgument, calls
+// while key is in flight with Aborted. Only successful responses are stored, key of failed call is released so call
+// may be retried. Calls are let through when store fails
+func (im *InterceptorManager) Idempotency(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (resp interface{}, err error) {
+	if !im.cfg.Idempotency.Enabled || !im.idempotentMethods[info.FullMethod] {
+		return handler(ctx, req)
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(im.cfg.Idempotency.MetadataKey)
+	if len(values) == 0 || values[0] == "" {
+		return handler(ctx, req)
+	}
+	if err := idempotency.CheckKey(values[0], im.cfg.Idempotency.MaxKeyLength); err != nil {
+		return nil, grpcErrors.ErrorResponse(err)
+	}
+	msg, ok := req.(proto.Message)
+	if !ok {
+		return handler(ctx, req)
+	}
+
+	body, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+	if err != nil {
+		im.logger.Errorf("proto.Marshal: %v", err)
+		return handler(ctx, req)
+	}
+	key := idempotency.ScopedKey(grpcIdempotencyScope, im.clientIP(ctx), values[0])
+	record, err := im.idempotency.Begin(ctx, key, idempotency.Fingerprint([]byte(info.FullMethod), body))
+	switch {
+	case errors.Is(err, productErrors.ErrIdempotencyKeyReused), errors.Is(err, productErrors.ErrIdempotencyKeyInFlight):
+		return nil, grpcErrors.ErrorResponse(err)
+	case err != nil:
+		im.logger.Errorf("idempotency.Begin: %v", err)
+		return handler(ctx, req)
+	case record.Completed:
+		return im.replay(ctx, info.FullMethod, record)
+	}
+
+	recorder := newHeaderRecorder(ctx)
+	if recorder != nil {
+		ctx = grpc.NewContextWithServerTransportStream(ctx, recorder)
+	}
+	resp, err = handler(ctx, req)
+	// call context may already be cancelled by client giving up, key must be completed or released anyway
+	storeCtx := context.Background()
+	out, ok := resp.(proto.Message)
+	if err != nil || !ok {
+		if err := im.idempotency.Release(storeCtx, key, record); err != nil {
+			im.logger.Errorf("idempotency.Release: %v", err)
+		}
+		return resp, err
+	}
+
+	record.Status = int(codes.OK)
+	if recorder != nil {
+		record.Header = recorder.replayable()
+	}
+	if record.Body, err = proto.Marshal(out); err != nil {
+		im.logger.Errorf("proto.Marshal: %v", err)
+		if err := im.idempotency.Release(storeCtx, key, record); err != nil {
+			im.logger.Errorf("idempotency.Release: %v", err)
+		}
+		return resp, nil
+	}
+	if err := im.idempotency.Complete(storeCtx, key, record); err != nil {
+		im.logger.Errorf("idempotency.Complete: %v", err)
+	}
+	return resp, nil
+}
+
+// replay stored response of method marking it replayed in header metadata
+func (im *InterceptorManager) replay(ctx context.Context, fullMethod string, record *idempotency.Record) (interface{}, error) {
+	resp, err := responseMessage(fullMethod)
+	if err != nil {
+		return nil, grpcErrors.ErrorResponse(err)
+	}
+	if err := proto.Unmarshal(record.Body, resp); err != nil {
+		return nil, grpcErrors.ErrorResponse(err)
+	}
+	header := metadata.MD(record.Header).Copy()
+	header.Set(strings.ToLower(idempotency.ReplayedHeader), "true")
+	if err := grpc.SetHeader(ctx, header); err != nil {
+		im.logger.Errorf("grpc.SetHeader: %v", err)
+	}
+	return resp, nil
+}
+
+// headerRecorder server transport stream recording header metadata set by handler
+type headerRecorder struct {
+	grpc.ServerTransportStream
+	mu     sync.Mutex
+	header metadata.MD
+}
+
+// newHeaderRecorder recorder of transport stream of call context, nil when context has no stream
+func newHeaderRecorder(ctx context.Context) *headerRecorder {
+	stream := grpc.ServerTransportStreamFromContext(ctx)
+	if stream == nil {
+		return nil
+	}
+	return &headerRecorder{ServerTransportStream: stream, header: metadata.MD{}}
+}
+
+func (r *headerRecorder) SetHeader(md metadata.MD) error {
+	r.record(md)
+	return r.ServerTransportStream.SetHeader(md)
+}
+
+func (r *headerRecorder) SendHeader(md metadata.MD) error {
+	r.record(md)
+	return r.ServerTransportStream.SendHeader(md)
+}
+
+func (r *headerRecorder) record(md metadata.MD) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key, values := range md {
+		r.header[key] = append(r.header[key], values...)
+	}
+}
+
+// replayable recorded header metadata to store with response
+func (r *headerRecorder) replayable() map[string][]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	header := make(map[string][]string, len(r.header))
+	for key, values := range r.header {
+		if idempotency.Replayable(key) {
+			header[key] = values
+		}
+	}
+	return header
+}
+
+// responseMessage new response message of registered unary method
+func responseMessage(fullMethod string) (proto.Message, error) {
+	name := protoreflect.FullName(strings.Replace(strings.TrimPrefix(fullMethod, "/"), "/", ".", 1))
+	desc, err := protoregistry.GlobalFiles.FindDescriptorByName(name)
+	if err != nil {
+		return nil, errors.Wrap(err, "protoregistry.GlobalFiles.FindDescriptorByName")
+	}
+	method, ok := desc.(protoreflect.MethodDescriptor)
+	if !ok {
+		return nil, errors.Errorf("%s is not a method", name)
+	}
+	messageType, err := protoregistry.GlobalTypes.FindMessageByName(method.Output().FullName())
+	if err != nil {
+		return nil, errors.Wrap(err, "protoregistry.GlobalTypes.FindMessageByName")
+	}
+	return messageType.New().Interface(), nil
+}
@@ -0,0 +1,147 @@
+package interceptors
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/Yangiboev/golang-with-curiosity/config"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/idempotency"
+	productsService "github.com/Yangiboev/golang-with-curiosity/proto/product"
+)
+
+const createMethod = "/productsService.ProductsService/Create"
+
+// fakeTransportStream server transport stream keeping header metadata set by calls
+type fakeTransportStream struct {
+	grpc.ServerTransportStream
+
+	header metadata.MD
+}
+
+func (s *fakeTransportStream) Method() string {
+	return createMethod
+}
+
+func (s *fakeTransportStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func (s *fakeTransportStream) SendHeader(md metadata.MD) error {
+	return s.SetHeader(md)
+}
+
+func newTestIdempotencyManager(t *testing.T) *InterceptorManager {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	cfg := config.Config{}
+	cfg.Logger.Level = "fatal"
+	cfg.Logger.Encoding = "console"
+	cfg.Idempotency = config.Idempotency{
+		Enabled:      true,
+		Prefix:       "idempotency",
+		MetadataKey:  "idempotency-key",
+		Window:       time.Hour,
+		LockTimeout:  time.Minute,
+		MaxKeyLength: 64,
+		Methods:      []string{createMethod},
+	}
+	im := newTestInterceptorManager(cfg)
+	im.idempotency = idempotency.NewRedisStore(client, cfg)
+	return im
+}
+
+// idempotentCall context of call with idempotency key from peer and its transport stream
+func idempotentCall(peerAddr, key string) (context.Context, *fakeTransportStream) {
+	stream := &fakeTransportStream{}
+	ctx := callContext(peerAddr, metadata.Pairs("idempotency-key", key))
+	return grpc.NewContextWithServerTransportStream(ctx, stream), stream
+}
+
+func TestIdempotencyReplaysResponseWithHeaderMetadata(t *testing.T) {
+	im := newTestIdempotencyManager(t)
+	info := &grpc.UnaryServerInfo{FullMethod: createMethod}
+	req := &productsService.CreateReq{Name: "product"}
+	var calls int
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		calls++
+		if err := grpc.SetHeader(ctx, metadata.Pairs("x-product-location", "products/1")); err != nil {
+			return nil, err
+		}
+		return &productsService.CreateRes{Product: &productsService.Product{ProductID: "1"}}, nil
+	}
+
+	ctx, _ := idempotentCall("198.51.100.1:1234", "key-1")
+	if _, err := im.Idempotency(ctx, req, info, handler); err != nil {
+		t.Fatalf("Idempotency: %v", err)
+	}
+	ctx, stream := idempotentCall("198.51.100.1:1234", "key-1")
+	resp, err := im.Idempotency(ctx, req, info, handler)
+	if err != nil {
+		t.Fatalf("Idempotency: %v", err)
+	}
+
+	if calls != 1 {
+		t.Fatalf("handler called %d times, want 1", calls)
+	}
+	if got := resp.(*productsService.CreateRes).GetProduct().GetProductID(); got != "1" {
+		t.Fatalf("replayed product id %q, want 1", got)
+	}
+	if got := stream.header.Get("x-product-location"); len(got) != 1 || got[0] != "products/1" {
+		t.Fatalf("replayed x-product-location %v, want products/1", got)
+	}
+	if got := stream.header.Get("idempotent-replayed"); len(got) != 1 || got[0] != "true" {
+		t.Fatalf("replayed idempotent-replayed %v, want true", got)
+	}
+
+	ctx, _ = idempotentCall("203.0.113.7:1234", "key-1")
+	if _, err := im.Idempotency(ctx, req, info, handler); err != nil {
+		t.Fatalf("Idempotency: %v", err)
+	}
+	if calls != 2 {
+		t.Fatalf("handler called %d times after call of other client, want 2", calls)
+	}
+}
+
+func TestIdempotencyRejectsReusedAndInFlightKeys(t *testing.T) {
+	im := newTestIdempotencyManager(t)
+	info := &grpc.UnaryServerInfo{FullMethod: createMethod}
+	created := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return &productsService.CreateRes{Product: &productsService.Product{ProductID: "1"}}, nil
+	}
+
+	ctx, _ := idempotentCall("198.51.100.1:1234", "key-1")
+	if _, err := im.Idempotency(ctx, &productsService.CreateReq{Name: "product"}, info, created); err != nil {
+		t.Fatalf("Idempotency: %v", err)
+	}
+	ctx, _ = idempotentCall("198.51.100.1:1234", "key-1")
+	_, err := im.Idempotency(ctx, &productsService.CreateReq{Name: "other"}, info, created)
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("reused key error %v, want InvalidArgument", err)
+	}
+
+	var inFlightErr error
+	inFlight := func(ctx context.Context, req interface{}) (interface{}, error) {
+		callCtx, _ := idempotentCall("198.51.100.1:1234", "key-2")
+		_, inFlightErr = im.Idempotency(callCtx, req, info, created)
+		return created(ctx, req)
+	}
+	ctx, _ = idempotentCall("198.51.100.1:1234", "key-2")
+	if _, err := im.Idempotency(ctx, &productsService.CreateReq{Name: "product"}, info, inFlight); err != nil {
+		t.Fatalf("Idempotency: %v", err)
+	}
+	if status.Code(inFlightErr) != codes.Aborted {
+		t.Fatalf("in flight key error %v, want Aborted", inFlightErr)
+	}
+}
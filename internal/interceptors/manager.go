@@ -2,14 +2,24 @@ package interceptors
 
 import (
 	"context"
+	"net"
+	"path"
+	"strings"
 	"time"
 
 	"github.com/Yangiboev/golang-with-curiosity/config"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/auth"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/cache"
+	grpcErrors "github.com/Yangiboev/golang-with-curiosity/pkg/grpc_errors"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/idempotency"
 	"github.com/Yangiboev/golang-with-curiosity/pkg/logger"
+	productErrors "github.com/Yangiboev/golang-with-curiosity/pkg/product_errors"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/ratelimit"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 )
 
 var (
@@ -19,15 +29,46 @@ var (
 	})
 )
 
+// ClientIPMetadataKey metadata key of client IP the gateway read through trusted proxies, trusted only in calls
+// from loopback or trusted proxy peers
+const ClientIPMetadataKey = "x-gateway-client-ip"
+
+// adminServicePrefix full method prefix of consumer admin service
+const adminServicePrefix = "/productsService.ConsumerAdminService/"
+
 // InterceptorManager struct
 type InterceptorManager struct {
-	logger logger.Logger
-	cfg    config.Config
+	logger            logger.Logger
+	cfg               config.Config
+	limiter           ratelimit.Limiter
+	idempotency       idempotency.Store
+	idempotentMethods map[string]bool
+	trustedProxies    []*net.IPNet
 }
 
 // NewInterceptorManager InterceptorManager constructor
-func NewInterceptorManager(logger logger.Logger, cfg config.Config) *InterceptorManager {
-	return &InterceptorManager{logger: logger, cfg: cfg}
+func NewInterceptorManager(
+	logger logger.Logger,
+	cfg config.Config,
+	limiter ratelimit.Limiter,
+	idempotency idempotency.Store,
+) *InterceptorManager {
+	idempotentMethods := make(map[string]bool, len(cfg.Idempotency.Methods))
+	for _, method := range cfg.Idempotency.Methods {
+		idempotentMethods[method] = true
+	}
+	trustedProxies, err := cfg.Server.TrustedProxyNets()
+	if err != nil {
+		logger.Errorf("cfg.Server.TrustedProxyNets: %v", err)
+	}
+	return &InterceptorManager{
+		logger:            logger,
+		cfg:               cfg,
+		limiter:           limiter,
+		idempotency:       idempotency,
+		idempotentMethods: idempotentMethods,
+		trustedProxies:    trustedProxies,
+	}
 }
 
 // Logger Interceptor
@@ -39,9 +80,183 @@ func (im *InterceptorManager) Logger(
 ) (resp interface{}, err error) {
 	totalRequests.Inc()
 	start := time.Now()
-	md, _ := metadata.FromIncomingContext(ctx)
+	md := loggedMetadata(ctx)
 	reply, err := handler(ctx, req)
 	im.logger.Infof("Method: %s, Time: %v, Metadata: %v, Err: %v", info.FullMethod, time.Since(start), md, err)
 
 	return reply, err
 }
+
+// AdminAuth reject consumer admin calls without admin bearer token with Unauthenticated
+func (im *InterceptorManager) AdminAuth(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (resp interface{}, err error) {
+	if err := im.authorizeAdmin(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// StreamAdminAuth reject consumer admin streams without admin bearer token with Unauthenticated
+func (im *InterceptorManager) StreamAdminAuth(
+	srv interface{},
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	if err := im.authorizeAdmin(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+// authorizeAdmin check admin bearer token of calls of consumer admin service
+func (im *InterceptorManager) authorizeAdmin(ctx context.Context, fullMethod string) error {
+	if !strings.HasPrefix(fullMethod, adminServicePrefix) {
+		return nil
+	}
+	var authorization string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			authorization = values[0]
+		}
+	}
+	if !auth.ValidBearer(authorization, im.cfg.Admin.Token) {
+		return grpcErrors.ErrorResponse(productErrors.ErrUnauthenticated)
+	}
+	return nil
+}
+
+// CachePolicy put gRPC product cache read policy into request context
+func (im *InterceptorManager) CachePolicy(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (resp interface{}, err error) {
+	return handler(cache.WithPolicy(ctx, im.cfg.ProductCache.Policies.GRPC), req)
+}
+
+// RateLimit limit requests by rate limit rule matching full method, limited requests fail with ResourceExhausted.
+// Requests are let through when limiter fails
+func (im *InterceptorManager) RateLimit(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (resp interface{}, err error) {
+	if err := im.limit(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// StreamLogger Interceptor
+func (im *InterceptorManager) StreamLogger(
+	srv interface{},
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	totalRequests.Inc()
+	start := time.Now()
+	md := loggedMetadata(ss.Context())
+	err := handler(srv, ss)
+	im.logger.Infof("Method: %s, Time: %v, Metadata: %v, Err: %v", info.FullMethod, time.Since(start), md, err)
+
+	return err
+}
+
+// StreamRateLimit limit stream opening by rate limit rule matching full method
+func (im *InterceptorManager) StreamRateLimit(
+	srv interface{},
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	if err := im.limit(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+// limit apply rate limit to call of full method, sets RateLimit-* headers and returns ResourceExhausted when limited
+func (im *InterceptorManager) limit(ctx context.Context, fullMethod string) error {
+	res, err := im.limiter.Allow(ctx, ratelimit.Request{
+		Match:  fullMethod,
+		IP:     im.clientIP(ctx),
+		Route:  strings.TrimPrefix(path.Dir(fullMethod), "/"),
+		Method: fullMethod,
+	})
+	if err != nil {
+		im.logger.Errorf("limiter.Allow: %v", err)
+		return nil
+	}
+	if res == nil {
+		return nil
+	}
+
+	if err := grpc.SetHeader(ctx, metadata.New(ratelimit.Headers(res))); err != nil {
+		im.logger.Errorf("grpc.SetHeader: %v", err)
+	}
+	if !res.Allowed {
+		err := productErrors.NewRateLimitError(res.Rule, res.RetryAfter)
+		return grpcErrors.ErrorResponse(err)
+	}
+	return nil
+}
+
+// clientIP client IP set by gateway in calls proxied through it from loopback or trusted proxy peers,
+// calling peer host otherwise
+func (im *InterceptorManager) clientIP(ctx context.Context) string {
+	ip := peerIP(ctx)
+	if !im.trustedPeer(net.ParseIP(ip)) {
+		return ip
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(ClientIPMetadataKey); len(values) > 0 {
+			return values[len(values)-1]
+		}
+	}
+	return ip
+}
+
+// trustedPeer peer is local gateway or trusted proxy
+func (im *InterceptorManager) trustedPeer(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	if ip.IsLoopback() {
+		return true
+	}
+	for _, ipNet := range im.trustedProxies {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// loggedMetadata incoming metadata without credentials
+func loggedMetadata(ctx context.Context) metadata.MD {
+	md, _ := metadata.FromIncomingContext(ctx)
+	md = md.Copy()
+	delete(md, "authorization")
+	return md
+}
+
+// peerIP host of calling peer address
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
@@ -0,0 +1,92 @@
+package interceptors
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/Yangiboev/golang-with-curiosity/config"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/logger"
+)
+
+func newTestInterceptorManager(cfg config.Config) *InterceptorManager {
+	cfg.Logger.Level = "fatal"
+	cfg.Logger.Encoding = "console"
+	appLogger := logger.NewApiLogger(cfg)
+	appLogger.InitLogger()
+	return NewInterceptorManager(appLogger, cfg, nil, nil)
+}
+
+func callContext(peerAddr string, md metadata.MD) context.Context {
+	addr, err := net.ResolveTCPAddr("tcp", peerAddr)
+	if err != nil {
+		panic(err)
+	}
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: addr})
+	return metadata.NewIncomingContext(ctx, md)
+}
+
+func TestClientIPTrustsGatewayMetadataOfTrustedPeersOnly(t *testing.T) {
+	cfg := config.Config{}
+	cfg.Server.TrustedProxies = []string{"10.0.0.0/8"}
+	im := newTestInterceptorManager(cfg)
+
+	tests := []struct {
+		name string
+		peer string
+		md   metadata.MD
+		want string
+	}{
+		{name: "gateway", peer: "127.0.0.1:1234", md: metadata.Pairs(ClientIPMetadataKey, "198.51.100.1"), want: "198.51.100.1"},
+		{name: "trusted proxy", peer: "10.0.0.1:1234", md: metadata.Pairs(ClientIPMetadataKey, "198.51.100.1"), want: "198.51.100.1"},
+		{name: "spoofed by client", peer: "203.0.113.7:1234", md: metadata.Pairs(ClientIPMetadataKey, "198.51.100.1"), want: "203.0.113.7"},
+		{name: "forwarded for ignored", peer: "127.0.0.1:1234", md: metadata.Pairs("x-forwarded-for", "198.51.100.1"), want: "127.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := im.clientIP(callContext(tt.peer, tt.md)); got != tt.want {
+				t.Fatalf("client IP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdminAuthRequiresAdminToken(t *testing.T) {
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+	adminMethod := &grpc.UnaryServerInfo{FullMethod: adminServicePrefix + "ResetOffsets"}
+	productMethod := &grpc.UnaryServerInfo{FullMethod: "/productsService.ProductsService/GetByID"}
+
+	tests := []struct {
+		name  string
+		token string
+		info  *grpc.UnaryServerInfo
+		md    metadata.MD
+		want  codes.Code
+	}{
+		{name: "valid token", token: "secret", info: adminMethod, md: metadata.Pairs("authorization", "Bearer secret"), want: codes.OK},
+		{name: "wrong token", token: "secret", info: adminMethod, md: metadata.Pairs("authorization", "Bearer guess"), want: codes.Unauthenticated},
+		{name: "missing token", token: "secret", info: adminMethod, md: metadata.MD{}, want: codes.Unauthenticated},
+		{name: "token not configured", info: adminMethod, md: metadata.Pairs("authorization", "Bearer "), want: codes.Unauthenticated},
+		{name: "products service", token: "secret", info: productMethod, md: metadata.MD{}, want: codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Config{}
+			cfg.Admin.Token = tt.token
+			im := newTestInterceptorManager(cfg)
+
+			_, err := im.AdminAuth(callContext("127.0.0.1:1234", tt.md), nil, tt.info, handler)
+			if status.Code(err) != tt.want {
+				t.Fatalf("AdminAuth error %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
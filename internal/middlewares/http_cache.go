@@ -0,0 +1,111 @@
+package middlewares
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	headerIfNoneMatch     = "If-None-Match"
+	headerIfModifiedSince = "If-Modified-Since"
+	headerCacheControl    = "Cache-Control"
+	headerETag            = "ETag"
+)
+
+// bufferedResponse response status and body held back until conditional request is evaluated
+type bufferedResponse struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	b.status = status
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	return b.body.Write(p)
+}
+
+// ConditionalGet tag successful responses with strong ETag of body and Cache-Control of route, answer requests whose
+// If-None-Match matches ETag or, without If-None-Match, whose If-Modified-Since is not before Last-Modified set by
+// handler with 304. Other responses are passed through unchanged
+func (m *middlewareManager) ConditionalGet(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if !m.cfg.HTTPCache.Enabled {
+			return next(c)
+		}
+
+		res := c.Response()
+		buffer := &bufferedResponse{ResponseWriter: res.Writer, status: http.StatusOK}
+		res.Writer = buffer
+		err := next(c)
+		res.Writer = buffer.ResponseWriter
+		if !res.Committed {
+			return err
+		}
+		res.Committed = false
+
+		if err != nil || buffer.status != http.StatusOK {
+			res.WriteHeader(buffer.status)
+			if _, writeErr := res.Write(buffer.body.Bytes()); err == nil {
+				err = writeErr
+			}
+			return err
+		}
+
+		hash := sha256.Sum256(buffer.body.Bytes())
+		etag := `"` + hex.EncodeToString(hash[:16]) + `"`
+		res.Header().Set(headerETag, etag)
+		if cacheControl := m.cacheControl(c); cacheControl != "" {
+			res.Header().Set(headerCacheControl, cacheControl)
+		}
+
+		if notModified(c.Request(), etag, res.Header().Get(echo.HeaderLastModified)) {
+			res.Header().Del(echo.HeaderContentType)
+			res.Header().Del(echo.HeaderContentLength)
+			res.WriteHeader(http.StatusNotModified)
+			return nil
+		}
+		res.WriteHeader(http.StatusOK)
+		_, err = res.Write(buffer.body.Bytes())
+		return err
+	}
+}
+
+// cacheControl Cache-Control of first rule matching request route, default otherwise
+func (m *middlewareManager) cacheControl(c echo.Context) string {
+	if cacheControl, ok := m.cacheControls[c.Request().Method+" "+c.Path()]; ok {
+		return cacheControl
+	}
+	return m.cfg.HTTPCache.Default
+}
+
+// notModified evaluate If-None-Match with weak comparison, If-Modified-Since only when If-None-Match is absent
+func notModified(req *http.Request, etag string, lastModified string) bool {
+	if ifNoneMatch := req.Header.Get(headerIfNoneMatch); ifNoneMatch != "" {
+		for _, candidate := range strings.Split(ifNoneMatch, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	ifModifiedSince, err := http.ParseTime(req.Header.Get(headerIfModifiedSince))
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(lastModified)
+	if err != nil {
+		return false
+	}
+	return !modified.Truncate(time.Second).After(ifModifiedSince)
+}
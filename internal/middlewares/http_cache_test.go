@@ -0,0 +1,123 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/Yangiboev/golang-with-curiosity/config"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/logger"
+)
+
+var testLastModified = time.Date(2021, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+func newTestHTTPCacheServer(t *testing.T) *echo.Echo {
+	t.Helper()
+	cfg := config.Config{}
+	cfg.Logger.Level = "fatal"
+	cfg.Logger.Encoding = "console"
+	cfg.HTTPCache = config.HTTPCache{
+		Enabled: true,
+		Default: "no-cache",
+		Rules:   []config.HTTPCacheRule{{Match: []string{"GET /products/:product_id"}, CacheControl: "public, max-age=60"}},
+	}
+	appLogger := logger.NewApiLogger(cfg)
+	appLogger.InitLogger()
+	mw := NewMiddlewareManager(appLogger, cfg, nil, nil)
+
+	e := echo.New()
+	e.GET("/products/:product_id", func(c echo.Context) error {
+		if c.Param("product_id") == "missing" {
+			return c.JSON(http.StatusNotFound, map[string]string{"reason": "PRODUCT_NOT_FOUND"})
+		}
+		c.Response().Header().Set(echo.HeaderLastModified, testLastModified.Format(http.TimeFormat))
+		return c.JSON(http.StatusOK, map[string]string{"productId": c.Param("product_id")})
+	}, mw.ConditionalGet)
+	return e
+}
+
+func getProduct(e *echo.Echo, productID string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/products/"+productID, nil)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestConditionalGetTagsResponses(t *testing.T) {
+	e := newTestHTTPCacheServer(t)
+
+	rec := getProduct(e, "1", nil)
+	if rec.Code != http.StatusOK || rec.Body.Len() == 0 {
+		t.Fatalf("status %d body %q, want 200 with body", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get(headerETag) == "" {
+		t.Fatalf("ETag missing")
+	}
+	if got := rec.Header().Get(headerCacheControl); got != "public, max-age=60" {
+		t.Fatalf("Cache-Control = %q, want cache control of route rule", got)
+	}
+
+	missing := getProduct(e, "missing", nil)
+	if missing.Code != http.StatusNotFound || missing.Header().Get(headerETag) != "" || missing.Body.Len() == 0 {
+		t.Fatalf("missing product status %d ETag %q, want 404 with body and without ETag", missing.Code, missing.Header().Get(headerETag))
+	}
+}
+
+func TestConditionalGetAnswersNotModified(t *testing.T) {
+	e := newTestHTTPCacheServer(t)
+	etag := getProduct(e, "1", nil).Header().Get(headerETag)
+
+	tests := []struct {
+		name      string
+		productID string
+		header    http.Header
+		want      int
+	}{
+		{name: "matching etag", header: http.Header{headerIfNoneMatch: {etag}}, want: http.StatusNotModified},
+		{name: "weak matching etag in list", header: http.Header{headerIfNoneMatch: {`"other", W/` + etag}}, want: http.StatusNotModified},
+		{name: "other etag", header: http.Header{headerIfNoneMatch: {`"other"`}}, want: http.StatusOK},
+		{name: "etag of other product", productID: "2", header: http.Header{headerIfNoneMatch: {etag}}, want: http.StatusOK},
+		{
+			name:   "not modified since",
+			header: http.Header{headerIfModifiedSince: {testLastModified.Format(http.TimeFormat)}},
+			want:   http.StatusNotModified,
+		},
+		{
+			name:   "modified since",
+			header: http.Header{headerIfModifiedSince: {testLastModified.Add(-time.Second).Format(http.TimeFormat)}},
+			want:   http.StatusOK,
+		},
+		{
+			name: "if none match takes precedence",
+			header: http.Header{
+				headerIfNoneMatch:     {`"other"`},
+				headerIfModifiedSince: {testLastModified.Format(http.TimeFormat)},
+			},
+			want: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			productID := tt.productID
+			if productID == "" {
+				productID = "1"
+			}
+			rec := getProduct(e, productID, tt.header)
+			if rec.Code != tt.want {
+				t.Fatalf("status %d, want %d", rec.Code, tt.want)
+			}
+			if tt.want == http.StatusNotModified && (rec.Body.Len() != 0 || rec.Header().Get(headerETag) != etag) {
+				t.Fatalf("304 body %q ETag %q, want empty body and ETag %s", rec.Body.String(), rec.Header().Get(headerETag), etag)
+			}
+			if tt.want == http.StatusOK && rec.Body.Len() == 0 {
+				t.Fatalf("200 without body")
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package middlewares
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+
+	httpErrors "github.com/Yangiboev/golang-with-curiosity/pkg/http_errors"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/idempotency"
+	productErrors "github.com/Yangiboev/golang-with-curiosity/pkg/product_errors"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+)
+
+// httpIdempotencyScope scope of HTTP idempotency keys, keys of HTTP and gRPC requests do not collide
+const httpIdempotencyScope = "http:"
+
+// responseRecorder copy of response body written through it
+type responseRecorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// Idempotency replay responses of requests repeated with idempotency key header by the same client IP, status, body
+// and replayable headers are replayed. Requests reusing key with other method, path or body are rejected with 422,
+// requests while key is in flight with 409. Only successful responses are stored, key of failed request is released
+// so request may be retried. Requests are let through when store fails
+func (m *middlewareManager) Idempotency(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		key := req.Header.Get(m.cfg.Idempotency.Header)
+		if !m.cfg.Idempotency.Enabled || key == "" {
+			return next(c)
+		}
+		if err := idempotency.CheckKey(key, m.cfg.Idempotency.MaxKeyLength); err != nil {
+			return httpErrors.ErrorCtxResponse(c, err)
+		}
+
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return httpErrors.ErrorCtxResponse(c, err)
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		key = idempotency.ScopedKey(httpIdempotencyScope, c.RealIP(), key)
+		record, err := m.idempotency.Begin(req.Context(), key, idempotency.Fingerprint([]byte(req.Method), []byte(req.URL.Path), body))
+		switch {
+		case errors.Is(err, productErrors.ErrIdempotencyKeyReused), errors.Is(err, productErrors.ErrIdempotencyKeyInFlight):
+			return httpErrors.ErrorCtxResponse(c, err)
+		case err != nil:
+			m.log.Errorf("idempotency.Begin: %v", err)
+			return next(c)
+		case record.Completed:
+			header := c.Response().Header()
+			for name, values := range record.Header {
+				header[name] = values
+			}
+			header.Set(idempotency.ReplayedHeader, "true")
+			if len(record.Body) == 0 {
+				return c.NoContent(record.Status)
+			}
+			return c.Blob(record.Status, record.ContentType, record.Body)
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Response().Writer}
+		c.Response().Writer = recorder
+		err = next(c)
+		c.Response().Writer = recorder.ResponseWriter
+
+		// request context may already be cancelled by client giving up, key must be completed or released anyway
+		ctx := context.Background()
+		res := c.Response()
+		if err != nil || !res.Committed || res.Status < http.StatusOK || res.Status >= http.StatusMultipleChoices {
+			if err := m.idempotency.Release(ctx, key, record); err != nil {
+				m.log.Errorf("idempotency.Release: %v", err)
+			}
+			return err
+		}
+
+		record.Status = res.Status
+		record.ContentType = res.Header().Get(echo.HeaderContentType)
+		record.Header = make(map[string][]string)
+		for name, values := range res.Header() {
+			if idempotency.Replayable(name) {
+				record.Header[name] = values
+			}
+		}
+		record.Body = recorder.body.Bytes()
+		if err := m.idempotency.Complete(ctx, key, record); err != nil {
+			m.log.Errorf("idempotency.Complete: %v", err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,135 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/labstack/echo/v4"
+
+	"github.com/Yangiboev/golang-with-curiosity/config"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/idempotency"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/logger"
+)
+
+// newTestIdempotencyServer echo server creating product with idempotency middleware, handler signals started and
+// waits for release when release channel is given
+func newTestIdempotencyServer(t *testing.T, started chan<- struct{}, release <-chan struct{}) (*echo.Echo, *int) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	cfg := config.Config{}
+	cfg.Logger.Level = "fatal"
+	cfg.Logger.Encoding = "console"
+	cfg.Idempotency = config.Idempotency{
+		Enabled:      true,
+		Prefix:       "idempotency",
+		Header:       "Idempotency-Key",
+		Window:       time.Hour,
+		LockTimeout:  time.Minute,
+		MaxKeyLength: 64,
+	}
+	appLogger := logger.NewApiLogger(cfg)
+	appLogger.InitLogger()
+	mw := NewMiddlewareManager(appLogger, cfg, nil, idempotency.NewRedisStore(client, cfg))
+
+	calls := new(int)
+	e := echo.New()
+	e.IPExtractor = echo.ExtractIPDirect()
+	e.POST("/api/v1/products", func(c echo.Context) error {
+		*calls++
+		if started != nil {
+			started <- struct{}{}
+			<-release
+		}
+		c.Response().Header().Set(echo.HeaderLocation, "/api/v1/products/1")
+		c.Response().Header().Set(echo.HeaderXRequestID, "request-1")
+		return c.JSON(http.StatusCreated, map[string]string{"productId": "1"})
+	}, mw.Idempotency)
+	return e, calls
+}
+
+func postProduct(e *echo.Echo, remoteAddr, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/products", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set("Idempotency-Key", key)
+	req.RemoteAddr = remoteAddr
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestIdempotencyReplaysResponseWithHeaders(t *testing.T) {
+	e, calls := newTestIdempotencyServer(t, nil, nil)
+
+	first := postProduct(e, "198.51.100.1:1234", "key-1", `{"name":"product"}`)
+	replayed := postProduct(e, "198.51.100.1:1234", "key-1", `{"name":"product"}`)
+
+	if *calls != 1 {
+		t.Fatalf("handler called %d times, want 1", *calls)
+	}
+	if replayed.Code != http.StatusCreated || replayed.Body.String() != first.Body.String() {
+		t.Fatalf("replayed %d %q, want %d %q", replayed.Code, replayed.Body.String(), first.Code, first.Body.String())
+	}
+	if got := replayed.Header().Get(echo.HeaderLocation); got != "/api/v1/products/1" {
+		t.Fatalf("replayed Location = %q, want /api/v1/products/1", got)
+	}
+	if got := replayed.Header().Get(idempotency.ReplayedHeader); got != "true" {
+		t.Fatalf("replayed %s = %q, want true", idempotency.ReplayedHeader, got)
+	}
+	if got := replayed.Header().Get(echo.HeaderXRequestID); got != "" {
+		t.Fatalf("replayed request id %q, want request id of first request not replayed", got)
+	}
+}
+
+func TestIdempotencyKeysAreScopedToClient(t *testing.T) {
+	e, calls := newTestIdempotencyServer(t, nil, nil)
+
+	postProduct(e, "198.51.100.1:1234", "key-1", `{"name":"product"}`)
+	other := postProduct(e, "203.0.113.7:1234", "key-1", `{"name":"other"}`)
+
+	if other.Code != http.StatusCreated || other.Header().Get(idempotency.ReplayedHeader) != "" {
+		t.Fatalf("other client got %d replayed %q, want its own response", other.Code, other.Header().Get(idempotency.ReplayedHeader))
+	}
+	if *calls != 2 {
+		t.Fatalf("handler called %d times, want 2", *calls)
+	}
+}
+
+func TestIdempotencyRejectsKeyReusedWithOtherBody(t *testing.T) {
+	e, _ := newTestIdempotencyServer(t, nil, nil)
+
+	postProduct(e, "198.51.100.1:1234", "key-1", `{"name":"product"}`)
+	reused := postProduct(e, "198.51.100.1:1234", "key-1", `{"name":"other"}`)
+
+	if reused.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("reused key status %d, want %d", reused.Code, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestIdempotencyRejectsKeyInFlight(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	e, _ := newTestIdempotencyServer(t, started, release)
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		done <- postProduct(e, "198.51.100.1:1234", "key-1", `{"name":"product"}`)
+	}()
+	<-started
+
+	inFlight := postProduct(e, "198.51.100.1:1234", "key-1", `{"name":"product"}`)
+	close(release)
+	if first := <-done; first.Code != http.StatusCreated {
+		t.Fatalf("first request status %d, want %d", first.Code, http.StatusCreated)
+	}
+	if inFlight.Code != http.StatusConflict {
+		t.Fatalf("in flight key status %d, want %d", inFlight.Code, http.StatusConflict)
+	}
+}
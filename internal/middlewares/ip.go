@@ -0,0 +1,21 @@
+package middlewares
+
+import (
+	"net"
+
+	"github.com/labstack/echo/v4"
+)
+
+// NewIPExtractor client IP of requests, X-Forwarded-For entries are trusted only when appended by proxies
+// of trusted ranges, so client is the nearest address not in them. Without trusted ranges it is the peer address
+func NewIPExtractor(trusted []*net.IPNet) echo.IPExtractor {
+	if len(trusted) == 0 {
+		return echo.ExtractIPDirect()
+	}
+
+	opts := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, ipNet := range trusted {
+		opts = append(opts, echo.TrustIPRange(ipNet))
+	}
+	return echo.ExtractIPFromXFFHeader(opts...)
+}
@@ -0,0 +1,41 @@
+package middlewares
+
+import (
+	"net"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestIPExtractorTrustsForwardedForOfTrustedProxiesOnly(t *testing.T) {
+	_, proxies, err := net.ParseCIDR("10.0.0.0/8")
+	if err != nil {
+		t.Fatalf("ParseCIDR: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		trusted []*net.IPNet
+		peer    string
+		xff     string
+		want    string
+	}{
+		{name: "no trusted proxies", peer: "10.0.0.1:1234", xff: "198.51.100.1", want: "10.0.0.1"},
+		{name: "untrusted peer", trusted: []*net.IPNet{proxies}, peer: "203.0.113.7:1234", xff: "198.51.100.1", want: "203.0.113.7"},
+		{name: "trusted proxy", trusted: []*net.IPNet{proxies}, peer: "10.0.0.1:1234", xff: "198.51.100.1", want: "198.51.100.1"},
+		{name: "spoofed entry before proxy", trusted: []*net.IPNet{proxies}, peer: "10.0.0.1:1234", xff: "192.0.2.9, 198.51.100.1", want: "198.51.100.1"},
+		{name: "loopback peer", trusted: []*net.IPNet{proxies}, peer: "127.0.0.1:1234", xff: "198.51.100.1", want: "127.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/v1/products/search", nil)
+			req.RemoteAddr = tt.peer
+			req.Header.Set(echo.HeaderXForwardedFor, tt.xff)
+
+			if got := NewIPExtractor(tt.trusted)(req); got != tt.want {
+				t.Fatalf("client IP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,7 +2,13 @@ package middlewares
 
 import (
 	"github.com/Yangiboev/golang-with-curiosity/config"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/auth"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/cache"
+	httpErrors "github.com/Yangiboev/golang-with-curiosity/pkg/http_errors"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/idempotency"
 	"github.com/Yangiboev/golang-with-curiosity/pkg/logger"
+	productErrors "github.com/Yangiboev/golang-with-curiosity/pkg/product_errors"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/ratelimit"
 	"github.com/labstack/echo/v4"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -18,18 +24,43 @@ var (
 
 // MiddlewareManager http middlewares
 type middlewareManager struct {
-	log logger.Logger
-	cfg config.Config
+	log           logger.Logger
+	cfg           config.Config
+	limiter       ratelimit.Limiter
+	idempotency   idempotency.Store
+	cacheControls map[string]string
 }
 
 // MiddlewareManager interface
 type MiddlewareManager interface {
 	Metrics(next echo.HandlerFunc) echo.HandlerFunc
+	CachePolicy(next echo.HandlerFunc) echo.HandlerFunc
+	RateLimit(next echo.HandlerFunc) echo.HandlerFunc
+	Idempotency(next echo.HandlerFunc) echo.HandlerFunc
+	ConditionalGet(next echo.HandlerFunc) echo.HandlerFunc
+	AdminAuth(next echo.HandlerFunc) echo.HandlerFunc
 }
 
 // NewMiddlewareManager constructor
-func NewMiddlewareManager(log logger.Logger, cfg config.Config) *middlewareManager {
-	return &middlewareManager{log: log, cfg: cfg}
+func NewMiddlewareManager(
+	log logger.Logger,
+	cfg config.Config,
+	limiter ratelimit.Limiter,
+	idempotency idempotency.Store,
+) *middlewareManager {
+	cacheControls := make(map[string]string)
+	for i := len(cfg.HTTPCache.Rules) - 1; i >= 0; i-- {
+		for _, match := range cfg.HTTPCache.Rules[i].Match {
+			cacheControls[match] = cfg.HTTPCache.Rules[i].CacheControl
+		}
+	}
+	return &middlewareManager{
+		log:           log,
+		cfg:           cfg,
+		limiter:       limiter,
+		idempotency:   idempotency,
+		cacheControls: cacheControls,
+	}
 }
 
 // Metrics prometheus metrics
@@ -39,3 +70,51 @@ func (m *middlewareManager) Metrics(next echo.HandlerFunc) echo.HandlerFunc {
 		return next(c)
 	}
 }
+
+// AdminAuth reject requests without admin bearer token with 401
+func (m *middlewareManager) AdminAuth(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if !auth.ValidBearer(c.Request().Header.Get(echo.HeaderAuthorization), m.cfg.Admin.Token) {
+			return httpErrors.ErrorCtxResponse(c, productErrors.ErrUnauthenticated)
+		}
+		return next(c)
+	}
+}
+
+// CachePolicy put HTTP product cache read policy into request context
+func (m *middlewareManager) CachePolicy(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ctx := cache.WithPolicy(c.Request().Context(), m.cfg.ProductCache.Policies.HTTP)
+		c.SetRequest(c.Request().WithContext(ctx))
+		return next(c)
+	}
+}
+
+// RateLimit limit requests by rate limit rule matching method and route, limited requests are rejected with 429.
+// Requests are let through when limiter fails
+func (m *middlewareManager) RateLimit(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		res, err := m.limiter.Allow(req.Context(), ratelimit.Request{
+			Match:  req.Method + " " + c.Path(),
+			IP:     c.RealIP(),
+			Route:  c.Path(),
+			Method: req.Method,
+		})
+		if err != nil {
+			m.log.Errorf("limiter.Allow: %v", err)
+			return next(c)
+		}
+		if res == nil {
+			return next(c)
+		}
+
+		for key, value := range ratelimit.Headers(res) {
+			c.Response().Header().Set(key, value)
+		}
+		if !res.Allowed {
+			return httpErrors.ErrorCtxResponse(c, productErrors.NewRateLimitError(res.Rule, res.RetryAfter))
+		}
+		return next(c)
+	}
+}
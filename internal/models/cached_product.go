@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// CachedProduct cached product with soft expiration, Delta is how long loading the product from database took.
+// NotFound entries remember that product does not exist and carry no product. Version orders entries of a product,
+// it is product update time or product deletion time in milliseconds, not found entries of products read missing
+// have zero version
+type CachedProduct struct {
+	Product   *Product      `json:"product,omitempty"`
+	NotFound  bool          `json:"notFound,omitempty"`
+	ExpiresAt time.Time     `json:"expiresAt"`
+	Delta     time.Duration `json:"delta"`
+	Version   int64         `json:"version,omitempty"`
+}
+
+// Expired entry is past its soft expiration
+func (c *CachedProduct) Expired(now time.Time) bool {
+	return !now.Before(c.ExpiresAt)
+}
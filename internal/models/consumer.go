@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	productsService "github.com/Yangiboev/golang-with-curiosity/proto/product"
+)
+
+// Consumer group offset reset targets
+const (
+	OffsetResetEarliest  = "earliest"
+	OffsetResetLatest    = "latest"
+	OffsetResetTimestamp = "timestamp"
+)
+
+// OffsetReset consumer group offsets reset target, timestamp is used only for timestamp target
+type OffsetReset struct {
+	To        string    `json:"to" validate:"required,oneof=earliest latest timestamp"`
+	Timestamp time.Time `json:"timestamp,omitempty" validate:"required_if=To timestamp"`
+}
+
+// ConsumerGroupStatus consumer group state on this instance
+type ConsumerGroupStatus struct {
+	GroupID string   `json:"groupId"`
+	Topics  []string `json:"topics"`
+	Paused  bool     `json:"paused"`
+}
+
+// PartitionOffset committed consumer group offset of topic partition
+type PartitionOffset struct {
+	Topic     string `json:"topic"`
+	Partition int    `json:"partition"`
+	Offset    int64  `json:"offset"`
+}
+
+// ToProto convert consumer group status to proto
+func (s *ConsumerGroupStatus) ToProto() *productsService.ConsumerGroup {
+	return &productsService.ConsumerGroup{
+		GroupID: s.GroupID,
+		Topics:  s.Topics,
+		Paused:  s.Paused,
+	}
+}
+
+// PartitionOffsetsToProto convert partition offsets to proto
+func PartitionOffsetsToProto(offsets []*PartitionOffset) []*productsService.PartitionOffset {
+	res := make([]*productsService.PartitionOffset, 0, len(offsets))
+	for _, o := range offsets {
+		res = append(res, &productsService.PartitionOffset{
+			Topic:     o.Topic,
+			Partition: int64(o.Partition),
+			Offset:    o.Offset,
+		})
+	}
+	return res
+}
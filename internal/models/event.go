@@ -0,0 +1,25 @@
+package models
+
+// Product command event types, schema versions and source
+const (
+	ProductEventSource = "/products_microservice"
+
+	ProductCreateEventType = "com.products.product.create"
+	ProductUpdateEventType = "com.products.product.update"
+
+	// ProductEventSchemaVersion current product command events data schema version
+	ProductEventSchemaVersion = 1
+)
+
+// Product domain event types published to product events topic and catalog state type of product catalog topic
+const (
+	ProductCreatedEventType      = "com.products.product.created"
+	ProductUpdatedEventType      = "com.products.product.updated"
+	ProductDeletedEventType      = "com.products.product.deleted"
+	ProductStockChangedEventType = "com.products.product.stock_changed"
+	ProductPriceChangedEventType = "com.products.product.price_changed"
+	ProductCatalogEventType      = "com.products.product.state"
+
+	// ProductDomainEventSchemaVersion current product domain events data schema version
+	ProductDomainEventSchemaVersion = 1
+)
@@ -9,5 +9,26 @@ type ErrorMessage struct {
 	Partition int       `json:"partition"`
 	Topic     string    `json:"topic"`
 	Error     string    `json:"error"`
+	Attempts  int       `json:"attempts"`
+	Value     []byte    `json:"value,omitempty"`
 	Time      time.Time `json:"time"`
 }
+
+// MessageClaimStatus outcome of claiming message idempotency key before processing
+type MessageClaimStatus int
+
+const (
+	// MessageClaimed message is claimed by caller and must be marked processed or released
+	MessageClaimed MessageClaimStatus = iota
+	// MessageProcessed message was already processed
+	MessageProcessed
+	// MessageInFlight message is being processed by another consumer
+	MessageInFlight
+)
+
+// MessageClaim claim of message idempotency key, Token identifies claim holder
+type MessageClaim struct {
+	Key    string
+	Token  string
+	Status MessageClaimStatus
+}
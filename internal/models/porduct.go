@@ -35,8 +35,8 @@ func (p *Product) GetImage() string {
 // ToProto Convert product to proto
 func (p *Product) ToProto() *productsService.Product {
 	return &productsService.Product{
-		ProductID:   p.ProductID.String(),
-		CategoryID:  p.CategoryID.String(),
+		ProductID:   p.ProductID.Hex(),
+		CategoryID:  p.CategoryID.Hex(),
 		Name:        p.Name,
 		Description: p.Description,
 		Price:       p.Price,
@@ -51,15 +51,23 @@ func (p *Product) ToProto() *productsService.Product {
 
 // ProductFromProto Get Product from proto
 func ProductFromProto(product *productsService.Product) (*Product, error) {
-	prodID, err := primitive.ObjectIDFromHex(product.GetCategoryID())
+	prodID, err := objectIDFromHex(product.GetProductID())
 	if err != nil {
 		return nil, err
 	}
-	catID, err := primitive.ObjectIDFromHex(product.GetCategoryID())
+	catID, err := objectIDFromHex(product.GetCategoryID())
 	if err != nil {
 		return nil, err
 	}
 
+	var createdAt, updatedAt time.Time
+	if product.GetCreatedAt() != nil {
+		createdAt = product.GetCreatedAt().AsTime()
+	}
+	if product.GetUpdatedAt() != nil {
+		updatedAt = product.GetUpdatedAt().AsTime()
+	}
+
 	return &Product{
 		ProductID:   prodID,
 		CategoryID:  catID,
@@ -70,11 +78,19 @@ func ProductFromProto(product *productsService.Product) (*Product, error) {
 		Photos:      product.GetPhotos(),
 		Quantity:    product.GetQuantity(),
 		Rating:      int(product.GetRating()),
-		CreatedAt:   product.GetCreatedAt().AsTime(),
-		UpdatedAt:   product.GetUpdatedAt().AsTime(),
+		CreatedAt:   createdAt,
+		UpdatedAt:   updatedAt,
 	}, nil
 }
 
+// objectIDFromHex empty id of not yet created product is nil object id
+func objectIDFromHex(id string) (primitive.ObjectID, error) {
+	if id == "" {
+		return primitive.NilObjectID, nil
+	}
+	return primitive.ObjectIDFromHex(id)
+}
+
 // ProductsList All Products response with pagination
 type ProductsList struct {
 	TotalCount int64      `json:"totalCount"`
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ProductChange product state before and after write, before is nil for created and after is nil for deleted products
+type ProductChange struct {
+	Before *Product
+	After  *Product
+}
+
+// ProductID id of changed product
+func (c *ProductChange) ProductID() primitive.ObjectID {
+	if c.After != nil {
+		return c.After.ProductID
+	}
+	return c.Before.ProductID
+}
+
+// ProductOutboxEntry product change stored in outbox with product write, published by outbox relay in ID order
+type ProductOutboxEntry struct {
+	ID        primitive.ObjectID `bson:"_id"`
+	Before    *Product           `bson:"before,omitempty"`
+	After     *Product           `bson:"after,omitempty"`
+	CreatedAt time.Time          `bson:"createdAt"`
+}
+
+// Change product change of outbox entry
+func (e *ProductOutboxEntry) Change() *ProductChange {
+	return &ProductChange{Before: e.Before, After: e.After}
+}
+
+// ProductDeleted deleted product event data
+type ProductDeleted struct {
+	ProductID primitive.ObjectID `json:"productId"`
+}
+
+// StockChanged product quantity change event data
+type StockChanged struct {
+	ProductID   primitive.ObjectID `json:"productId"`
+	OldQuantity int64              `json:"oldQuantity"`
+	NewQuantity int64              `json:"newQuantity"`
+}
+
+// PriceChanged product price change event data
+type PriceChanged struct {
+	ProductID primitive.ObjectID `json:"productId"`
+	OldPrice  float64            `json:"oldPrice"`
+	NewPrice  float64            `json:"newPrice"`
+}
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"time"
+
+	productsService "github.com/Yangiboev/golang-with-curiosity/proto/product"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Product change types of watched product changes
+const (
+	ProductChangeCreated = "created"
+	ProductChangeUpdated = "updated"
+	ProductChangeDeleted = "deleted"
+)
+
+var productChangeTypesProto = map[string]productsService.ProductChangeType{
+	ProductChangeCreated: productsService.ProductChangeType_PRODUCT_CHANGE_TYPE_CREATED,
+	ProductChangeUpdated: productsService.ProductChangeType_PRODUCT_CHANGE_TYPE_UPDATED,
+	ProductChangeDeleted: productsService.ProductChangeType_PRODUCT_CHANGE_TYPE_DELETED,
+}
+
+// ProductChangeEvent product change delivered to watches, Token orders changes and resumes watches after the change
+type ProductChangeEvent struct {
+	Token     string             `json:"-"`
+	Type      string             `json:"type"`
+	ProductID primitive.ObjectID `json:"productId"`
+	Before    *Product           `json:"before,omitempty"`
+	After     *Product           `json:"after,omitempty"`
+	Time      time.Time          `json:"time"`
+}
+
+// NewProductChangeEvent change event of product change
+func NewProductChangeEvent(change *ProductChange, now time.Time) *ProductChangeEvent {
+	changeType := ProductChangeUpdated
+	switch {
+	case change.Before == nil:
+		changeType = ProductChangeCreated
+	case change.After == nil:
+		changeType = ProductChangeDeleted
+	}
+	return &ProductChangeEvent{
+		Type:      changeType,
+		ProductID: change.ProductID(),
+		Before:    change.Before,
+		After:     change.After,
+		Time:      now,
+	}
+}
+
+// ToProto convert change event to proto, deleted products are sent without product
+func (e *ProductChangeEvent) ToProto() *productsService.WatchProductsRes {
+	res := &productsService.WatchProductsRes{
+		ResumeToken: e.Token,
+		Type:        productChangeTypesProto[e.Type],
+		ProductID:   e.ProductID.Hex(),
+		Time:        timestamppb.New(e.Time),
+	}
+	if e.After != nil {
+		res.Product = e.After.ToProto()
+	}
+	return res
+}
+
+// WatchFilter watched products, changes match listed products or products in category before or after the change
+type WatchFilter struct {
+	ProductIDs map[primitive.ObjectID]bool
+	CategoryID primitive.ObjectID
+}
+
+// Matches change event is of watched product
+func (f *WatchFilter) Matches(e *ProductChangeEvent) bool {
+	if f.ProductIDs[e.ProductID] {
+		return true
+	}
+	if f.CategoryID.IsZero() {
+		return false
+	}
+	for _, prod := range []*Product{e.Before, e.After} {
+		if prod != nil && prod.CategoryID == f.CategoryID {
+			return true
+		}
+	}
+	return false
+}
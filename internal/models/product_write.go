@@ -0,0 +1,39 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Product bulk write operations
+const (
+	ProductWriteCreate = "create"
+	ProductWriteUpdate = "update"
+)
+
+// ProductWrite single product write of bulk write
+type ProductWrite struct {
+	Op      string
+	Product *Product
+}
+
+// ProductResult product or error of single product of batch
+type ProductResult struct {
+	ProductID primitive.ObjectID
+	Product   *Product
+	Err       error
+}
+
+// ProductsBatch products of batch create or update request
+type ProductsBatch struct {
+	Products []*Product `json:"products"`
+}
+
+// ProductBatchResult product or error body of single product of batch response
+type ProductBatchResult struct {
+	ProductID string      `json:"productId,omitempty"`
+	Product   *Product    `json:"product,omitempty"`
+	Error     interface{} `json:"error,omitempty"`
+}
+
+// ProductBatchResults results of batch response in request order
+type ProductBatchResults struct {
+	Results []*ProductBatchResult `json:"results"`
+}
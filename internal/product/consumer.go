@@ -0,0 +1,15 @@
+package product
+
+import (
+	"context"
+
+	"github.com/Yangiboev/golang-with-curiosity/internal/models"
+)
+
+// ConsumerAdmin kafka consumer groups administration
+type ConsumerAdmin interface {
+	ConsumerGroups(ctx context.Context) ([]*models.ConsumerGroupStatus, error)
+	PauseConsumerGroup(ctx context.Context, groupID string) (*models.ConsumerGroupStatus, error)
+	ResumeConsumerGroup(ctx context.Context, groupID string) (*models.ConsumerGroupStatus, error)
+	ResetConsumerGroupOffsets(ctx context.Context, groupID string, reset models.OffsetReset) ([]*models.PartitionOffset, error)
+}
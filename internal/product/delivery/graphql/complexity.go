@@ -0,0 +1,164 @@
+package graphql
+
+import (
+	"strconv"
+	"strings"
+
+	gql "github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/pkg/errors"
+)
+
+// complexity cost of operation selections, every selected field costs one and selections of list fields cost list
+// size times. List size is the size or longest list argument of the list field or of its parent field
+type complexity struct {
+	fragments       map[string]*ast.FragmentDefinition
+	variables       map[string]interface{}
+	maxDepth        int
+	defaultListSize int
+}
+
+// checkComplexity reject operation deeper than max depth or costlier than max complexity
+func (h *productGraphQLHandlers) checkComplexity(doc *ast.Document, op *ast.OperationDefinition, variables map[string]interface{}) error {
+	c := &complexity{
+		fragments:       make(map[string]*ast.FragmentDefinition),
+		variables:       variables,
+		maxDepth:        h.cfg.MaxDepth,
+		defaultListSize: h.cfg.DefaultListSize,
+	}
+	for _, def := range doc.Definitions {
+		if fragment, ok := def.(*ast.FragmentDefinition); ok {
+			c.fragments[fragment.Name.Value] = fragment
+		}
+	}
+
+	cost, err := c.selectionSet(h.rootType(op), op.SelectionSet, 1, 0)
+	if err != nil {
+		return err
+	}
+	if cost > h.cfg.MaxComplexity {
+		return errors.Errorf("operation complexity %d exceeds max complexity %d", cost, h.cfg.MaxComplexity)
+	}
+	return nil
+}
+
+func (h *productGraphQLHandlers) rootType(op *ast.OperationDefinition) *gql.Object {
+	switch op.Operation {
+	case ast.OperationTypeMutation:
+		return h.schema.MutationType()
+	case ast.OperationTypeSubscription:
+		return h.schema.SubscriptionType()
+	default:
+		return h.schema.QueryType()
+	}
+}
+
+// selectionSet cost of selections of parent type at depth, sizeHint is list size given by parent field arguments
+func (c *complexity) selectionSet(parent *gql.Object, set *ast.SelectionSet, depth, sizeHint int) (int, error) {
+	if set == nil {
+		return 0, nil
+	}
+	if depth > c.maxDepth {
+		return 0, errors.Errorf("operation depth exceeds max depth %d", c.maxDepth)
+	}
+
+	var cost int
+	for _, selection := range set.Selections {
+		var selectionCost int
+		var err error
+		switch sel := selection.(type) {
+		case *ast.Field:
+			selectionCost, err = c.field(parent, sel, depth, sizeHint)
+		case *ast.InlineFragment:
+			selectionCost, err = c.selectionSet(parent, sel.SelectionSet, depth, sizeHint)
+		case *ast.FragmentSpread:
+			if fragment, ok := c.fragments[sel.Name.Value]; ok {
+				selectionCost, err = c.selectionSet(parent, fragment.SelectionSet, depth, sizeHint)
+			}
+		}
+		if err != nil {
+			return 0, err
+		}
+		cost += selectionCost
+	}
+	return cost, nil
+}
+
+// field cost of field and its selections, introspection fields are free
+func (c *complexity) field(parent *gql.Object, field *ast.Field, depth, sizeHint int) (int, error) {
+	def, ok := parent.Fields()[field.Name.Value]
+	if !ok || strings.HasPrefix(field.Name.Value, "__") {
+		return 0, nil
+	}
+
+	size := c.listSize(field)
+	fieldType, isList := namedType(def.Type)
+	object, ok := fieldType.(*gql.Object)
+	if !ok {
+		return 1, nil
+	}
+	if !isList {
+		childCost, err := c.selectionSet(object, field.SelectionSet, depth+1, size)
+		return 1 + childCost, err
+	}
+
+	if size == 0 {
+		size = sizeHint
+	}
+	if size == 0 {
+		size = c.defaultListSize
+	}
+	childCost, err := c.selectionSet(object, field.SelectionSet, depth+1, 0)
+	return 1 + size*childCost, err
+}
+
+// listSize size argument or length of longest list argument of field, zero when field has neither
+func (c *complexity) listSize(field *ast.Field) int {
+	var size int
+	for _, arg := range field.Arguments {
+		value := arg.Value
+		if variable, ok := value.(*ast.Variable); ok {
+			switch v := c.variables[variable.Name.Value].(type) {
+			case []interface{}:
+				size = maxInt(size, len(v))
+			case float64:
+				if arg.Name.Value == "size" {
+					size = maxInt(size, int(v))
+				}
+			}
+			continue
+		}
+		switch v := value.(type) {
+		case *ast.ListValue:
+			size = maxInt(size, len(v.Values))
+		case *ast.IntValue:
+			if n, err := strconv.Atoi(v.Value); err == nil && arg.Name.Value == "size" {
+				size = maxInt(size, n)
+			}
+		}
+	}
+	return size
+}
+
+// namedType type under list and non null wrappers and whether it is wrapped in list
+func namedType(t gql.Type) (gql.Type, bool) {
+	var isList bool
+	for {
+		switch wrapped := t.(type) {
+		case *gql.NonNull:
+			t = wrapped.OfType
+		case *gql.List:
+			isList = true
+			t = wrapped.OfType
+		default:
+			return t, isList
+		}
+	}
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
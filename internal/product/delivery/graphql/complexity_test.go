@@ -0,0 +1,89 @@
+package graphql
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckComplexity(t *testing.T) {
+	ids := make([]interface{}, 30)
+	for i := range ids {
+		ids[i] = "5f0c8a7f0000000000000000"
+	}
+
+	tests := []struct {
+		name          string
+		maxDepth      int
+		maxComplexity int
+		req           *graphQLRequest
+		wantErr       string
+	}{
+		{
+			name:     "too deep",
+			maxDepth: 2,
+			req:      &graphQLRequest{Query: `{ product(id: "5f0c8a7f0000000000000000") { category { id } } }`},
+			wantErr:  "max depth",
+		},
+		{
+			name:     "within depth",
+			maxDepth: 3,
+			req:      &graphQLRequest{Query: `{ product(id: "5f0c8a7f0000000000000000") { category { id } } }`},
+		},
+		{
+			// searchProducts 1 + products 1 + 50 * (id, name, price 3 + category 2)
+			name:          "fragment selections cost size of parent list",
+			maxComplexity: 251,
+			req: &graphQLRequest{Query: `{ searchProducts(size: 50) { products { ...fields } } }
+				fragment fields on Product { id name price category { id } }`},
+			wantErr: "operation complexity 252",
+		},
+		{
+			name:          "fragment within complexity",
+			maxComplexity: 252,
+			req: &graphQLRequest{Query: `{ searchProducts(size: 50) { products { ...fields } } }
+				fragment fields on Product { id name price category { id } }`},
+		},
+		{
+			// products 1 + 30 ids * (id, name 2), default list size would cost 41
+			name:          "list sized by variable",
+			maxComplexity: 60,
+			req: &graphQLRequest{
+				Query:     `query($ids: [ID!]!) { products(ids: $ids) { id name } }`,
+				Variables: map[string]interface{}{"ids": ids},
+			},
+			wantErr: "operation complexity 61",
+		},
+		{
+			name:          "size of variable",
+			maxComplexity: 60,
+			req: &graphQLRequest{
+				Query:     `query($size: Int) { searchProducts(size: $size) { products { id name } } }`,
+				Variables: map[string]interface{}{"size": float64(30)},
+			},
+			wantErr: "operation complexity 62",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := newTestConfig()
+			if tt.maxDepth > 0 {
+				cfg.GraphQL.MaxDepth = tt.maxDepth
+			}
+			if tt.maxComplexity > 0 {
+				cfg.GraphQL.MaxComplexity = tt.maxComplexity
+			}
+			h := newTestHandlers(t, nil, cfg)
+
+			_, _, errs := h.prepare(tt.req)
+			if tt.wantErr == "" {
+				if errs != nil {
+					t.Fatalf("prepare errors %v, want none", errs)
+				}
+				return
+			}
+			if len(errs) != 1 || !strings.Contains(errs[0].Message, tt.wantErr) {
+				t.Fatalf("prepare errors %v, want %q", errs, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package graphql
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	successRequests = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "graphql_products_success_incoming_requests_total",
+		Help: "The total number of success incoming GraphQL operations",
+	})
+	errorRequests = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "graphql_products_error_incoming_requests_total",
+		Help: "The total number of error incoming GraphQL operations",
+	})
+	operationRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "graphql_products_operation_incoming_requests_total",
+		Help: "The total number of incoming GraphQL operations by operation type",
+	}, []string{"operation"})
+	activeSubscriptions = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "graphql_products_active_subscriptions",
+		Help: "The number of active GraphQL subscriptions",
+	})
+	loaderBatches = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "graphql_products_loader_batches_total",
+		Help: "The total number of batch get calls of GraphQL product loader",
+	})
+)
@@ -0,0 +1,232 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Yangiboev/golang-with-curiosity/config"
+	"github.com/Yangiboev/golang-with-curiosity/internal/product"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/events"
+	httpErrors "github.com/Yangiboev/golang-with-curiosity/pkg/http_errors"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/logger"
+	productErrors "github.com/Yangiboev/golang-with-curiosity/pkg/product_errors"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/websocket"
+	gql "github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"github.com/labstack/echo/v4"
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+)
+
+// graphQLRequest graphql operation request of HTTP body, GET query or subscribe message payload
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+type productGraphQLHandlers struct {
+	log         logger.Logger
+	productUC   product.UseCase
+	validate    *validator.Validate
+	group       *echo.Group
+	cfg         config.GraphQL
+	batch       config.ProductBatch
+	maxWatchIDs int
+	schema      gql.Schema
+	upgrader    websocket.Upgrader
+}
+
+// NewProductGraphQLHandlers constructor
+func NewProductGraphQLHandlers(
+	log logger.Logger,
+	productUC product.UseCase,
+	validate *validator.Validate,
+	group *echo.Group,
+	cfg config.Config,
+) (*productGraphQLHandlers, error) {
+	h := &productGraphQLHandlers{
+		log:         log,
+		productUC:   productUC,
+		validate:    validate,
+		group:       group,
+		cfg:         cfg.GraphQL,
+		batch:       cfg.ProductBatch,
+		maxWatchIDs: cfg.ProductWatch.MaxProductIDs,
+	}
+	h.upgrader = websocket.Upgrader{
+		Subprotocols: []string{graphQLTransportWS},
+		CheckOrigin:  h.checkOrigin,
+	}
+	schema, err := h.newSchema()
+	if err != nil {
+		return nil, err
+	}
+	h.schema = schema
+	return h, nil
+}
+
+// MapRoutes graphql routes, queries and mutations over HTTP, subscriptions over websocket
+func (h *productGraphQLHandlers) MapRoutes() {
+	h.group.GET("", h.GraphQL())
+	h.group.POST("", h.GraphQL())
+}
+
+// checkOrigin accept websocket upgrades without Origin header of non browser clients, from the same host or from
+// allowed origins
+func (h *productGraphQLHandlers) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get(echo.HeaderOrigin)
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range h.cfg.AllowedOrigins {
+		if strings.EqualFold(origin, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// GraphQL execute queries and mutations posted as json or queries of GET query params, websocket upgrade requests
+// start graphql-transport-ws subscription connections
+func (h *productGraphQLHandlers) GraphQL() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if websocket.IsWebSocketUpgrade(c.Request()) {
+			return h.serveWebSocket(c)
+		}
+
+		span, ctx := opentracing.StartSpanFromContext(c.Request().Context(), "productGraphQLHandlers.GraphQL")
+		defer span.Finish()
+		ctx = events.WithCorrelationID(ctx, c.Response().Header().Get(echo.HeaderXRequestID))
+
+		req, err := h.bindRequest(c)
+		if err != nil {
+			h.log.Errorf("bindRequest: %v", err)
+			errorRequests.Inc()
+			return httpErrors.ErrorCtxResponse(c, err)
+		}
+
+		doc, op, errs := h.prepare(req)
+		if errs != nil {
+			errorRequests.Inc()
+			return c.JSON(http.StatusOK, &gql.Result{Errors: errs})
+		}
+		switch {
+		case op.Operation == ast.OperationTypeSubscription:
+			errorRequests.Inc()
+			return httpErrors.ErrorCtxResponse(c, productErrors.NewValidationError("subscriptions are served over websocket"))
+		case op.Operation == ast.OperationTypeMutation && c.Request().Method == http.MethodGet:
+			errorRequests.Inc()
+			return httpErrors.ErrorCtxResponse(c, echo.NewHTTPError(http.StatusMethodNotAllowed, "mutations must be posted"))
+		}
+
+		result := h.execute(ctx, doc, req)
+		if result.HasErrors() {
+			errorRequests.Inc()
+		} else {
+			successRequests.Inc()
+		}
+		return c.JSON(http.StatusOK, result)
+	}
+}
+
+// bindRequest request of GET query params or json body
+func (h *productGraphQLHandlers) bindRequest(c echo.Context) (*graphQLRequest, error) {
+	req := &graphQLRequest{}
+	if c.Request().Method == http.MethodGet {
+		req.Query = c.QueryParam("query")
+		req.OperationName = c.QueryParam("operationName")
+		if variables := c.QueryParam("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+				return nil, productErrors.NewValidationError("invalid variables", productErrors.FieldViolation{
+					Field:       "variables",
+					Description: err.Error(),
+				})
+			}
+		}
+	} else if err := c.Bind(req); err != nil {
+		return nil, err
+	}
+
+	if req.Query == "" {
+		return nil, productErrors.NewValidationError("query is required", productErrors.FieldViolation{
+			Field:       "query",
+			Description: "is required",
+		})
+	}
+	return req, nil
+}
+
+// prepare parse and validate request document and check complexity of requested operation
+func (h *productGraphQLHandlers) prepare(req *graphQLRequest) (*ast.Document, *ast.OperationDefinition, []gqlerrors.FormattedError) {
+	doc, err := parser.Parse(parser.ParseParams{
+		Source: source.NewSource(&source.Source{Body: []byte(req.Query), Name: "GraphQL request"}),
+	})
+	if err != nil {
+		return nil, nil, gqlerrors.FormatErrors(err)
+	}
+	if res := gql.ValidateDocument(&h.schema, doc, nil); !res.IsValid {
+		return nil, nil, res.Errors
+	}
+
+	op, err := operation(doc, req.OperationName)
+	if err != nil {
+		return nil, nil, gqlerrors.FormatErrors(err)
+	}
+	if err := h.checkComplexity(doc, op, req.Variables); err != nil {
+		return nil, nil, gqlerrors.FormatErrors(err)
+	}
+	operationRequests.WithLabelValues(op.Operation).Inc()
+	return doc, op, nil
+}
+
+// execute query or mutation of prepared document
+func (h *productGraphQLHandlers) execute(ctx context.Context, doc *ast.Document, req *graphQLRequest) *gql.Result {
+	return gql.Execute(gql.ExecuteParams{
+		Schema:        h.schema,
+		AST:           doc,
+		OperationName: req.OperationName,
+		Args:          req.Variables,
+		Context:       withLoader(ctx, newProductLoader(h.productUC, h.batch.MaxGet)),
+	})
+}
+
+// operation definition of document named name, name may be empty when document has single operation
+func operation(doc *ast.Document, name string) (*ast.OperationDefinition, error) {
+	var found *ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if name == "" {
+			if found != nil {
+				return nil, errors.New("operation name is required for documents with several operations")
+			}
+			found = op
+			continue
+		}
+		if op.Name != nil && op.Name.Value == name {
+			return op, nil
+		}
+	}
+	if found == nil {
+		return nil, errors.Errorf("unknown operation %q", name)
+	}
+	return found, nil
+}
@@ -0,0 +1,61 @@
+package graphql
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+
+	"github.com/Yangiboev/golang-with-curiosity/config"
+	"github.com/Yangiboev/golang-with-curiosity/internal/product"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/logger"
+)
+
+func newTestConfig() config.Config {
+	cfg := config.Config{}
+	cfg.Logger.Level = "fatal"
+	cfg.Logger.Encoding = "console"
+	cfg.GraphQL = config.GraphQL{MaxDepth: 8, MaxComplexity: 1000, DefaultListSize: 20, MaxSubscriptions: 10}
+	cfg.ProductBatch = config.ProductBatch{MaxGet: 10, MaxWrite: 10}
+	return cfg
+}
+
+func newTestHandlers(t *testing.T, uc product.UseCase, cfg config.Config) *productGraphQLHandlers {
+	t.Helper()
+	appLogger := logger.NewApiLogger(cfg)
+	appLogger.InitLogger()
+	h, err := NewProductGraphQLHandlers(appLogger, uc, validator.New(), nil, cfg)
+	if err != nil {
+		t.Fatalf("NewProductGraphQLHandlers: %v", err)
+	}
+	return h
+}
+
+func TestCheckOriginAcceptsSameHostAndAllowedOrigins(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.GraphQL.AllowedOrigins = []string{"https://shop.example.com"}
+	h := newTestHandlers(t, nil, cfg)
+
+	tests := []struct {
+		name   string
+		origin string
+		want   bool
+	}{
+		{name: "no origin", want: true},
+		{name: "same host", origin: "https://api.example.com", want: true},
+		{name: "allowed origin", origin: "https://shop.example.com", want: true},
+		{name: "other origin", origin: "https://evil.example.net", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "https://api.example.com/graphql", nil)
+			if tt.origin != "" {
+				req.Header.Set(echo.HeaderOrigin, tt.origin)
+			}
+			if got := h.checkOrigin(req); got != tt.want {
+				t.Fatalf("checkOrigin(%q) = %v, want %v", tt.origin, got, tt.want)
+			}
+		})
+	}
+}
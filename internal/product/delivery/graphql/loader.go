@@ -0,0 +1,112 @@
+package graphql
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Yangiboev/golang-with-curiosity/internal/models"
+	"github.com/Yangiboev/golang-with-curiosity/internal/product"
+	productErrors "github.com/Yangiboev/golang-with-curiosity/pkg/product_errors"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type loaderKey struct{}
+
+// productLoader batch product lookups of one operation into BatchGet calls. Resolvers load products as thunks which
+// graphql resolves after sibling fields registered their ids, first resolved thunk loads all registered ids
+type productLoader struct {
+	productUC product.UseCase
+	maxBatch  int
+	mu        sync.Mutex
+	pending   []primitive.ObjectID
+	queued    map[primitive.ObjectID]bool
+	results   map[primitive.ObjectID]*models.ProductResult
+}
+
+func newProductLoader(productUC product.UseCase, maxBatch int) *productLoader {
+	return &productLoader{
+		productUC: productUC,
+		maxBatch:  maxBatch,
+		queued:    make(map[primitive.ObjectID]bool),
+		results:   make(map[primitive.ObjectID]*models.ProductResult),
+	}
+}
+
+// withLoader context of operation with new product loader
+func withLoader(ctx context.Context, loader *productLoader) context.Context {
+	return context.WithValue(ctx, loaderKey{}, loader)
+}
+
+func loaderFromContext(ctx context.Context) *productLoader {
+	return ctx.Value(loaderKey{}).(*productLoader)
+}
+
+// Load register product id and return thunk resolving product, missing products resolve to null
+func (l *productLoader) Load(ctx context.Context, productID primitive.ObjectID) func() (interface{}, error) {
+	l.mu.Lock()
+	l.queue(productID)
+	l.mu.Unlock()
+
+	return func() (interface{}, error) {
+		res := l.result(ctx, productID)
+		if errors.Is(res.Err, productErrors.ErrProductNotFound) {
+			return nil, nil
+		}
+		if res.Err != nil {
+			return nil, resolverError{res.Err}
+		}
+		return res.Product, nil
+	}
+}
+
+func (l *productLoader) queue(productID primitive.ObjectID) {
+	if _, ok := l.results[productID]; ok || l.queued[productID] {
+		return
+	}
+	l.queued[productID] = true
+	l.pending = append(l.pending, productID)
+}
+
+// result of product, loads pending products when product is not loaded yet
+func (l *productLoader) result(ctx context.Context, productID primitive.ObjectID) *models.ProductResult {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if res, ok := l.results[productID]; ok {
+		return res
+	}
+	l.queue(productID)
+	pending := l.pending
+	l.pending = nil
+	l.queued = make(map[primitive.ObjectID]bool)
+
+	for start := 0; start < len(pending); start += l.maxBatch {
+		end := start + l.maxBatch
+		if end > len(pending) {
+			end = len(pending)
+		}
+		l.load(ctx, pending[start:end])
+	}
+	return l.results[productID]
+}
+
+// load products by ids, failed batch fails all its products
+func (l *productLoader) load(ctx context.Context, productIDs []primitive.ObjectID) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "productLoader.load")
+	defer span.Finish()
+	loaderBatches.Inc()
+
+	results, err := l.productUC.BatchGet(ctx, productIDs)
+	if err != nil {
+		for _, productID := range productIDs {
+			l.results[productID] = &models.ProductResult{ProductID: productID, Err: err}
+		}
+		return
+	}
+	for i, res := range results {
+		l.results[productIDs[i]] = res
+	}
+}
@@ -0,0 +1,77 @@
+package graphql
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/Yangiboev/golang-with-curiosity/internal/models"
+	"github.com/Yangiboev/golang-with-curiosity/internal/product"
+	productErrors "github.com/Yangiboev/golang-with-curiosity/pkg/product_errors"
+)
+
+// fakeUseCase records BatchGet calls, products of known ids are found
+type fakeUseCase struct {
+	product.UseCase
+
+	products map[primitive.ObjectID]*models.Product
+	batches  [][]primitive.ObjectID
+}
+
+func (f *fakeUseCase) BatchGet(ctx context.Context, productIDs []primitive.ObjectID) ([]*models.ProductResult, error) {
+	f.batches = append(f.batches, productIDs)
+	results := make([]*models.ProductResult, 0, len(productIDs))
+	for _, productID := range productIDs {
+		if prod, ok := f.products[productID]; ok {
+			results = append(results, &models.ProductResult{ProductID: productID, Product: prod})
+			continue
+		}
+		results = append(results, &models.ProductResult{ProductID: productID, Err: productErrors.ErrProductNotFound})
+	}
+	return results, nil
+}
+
+func TestLoaderBatchesProductLookupsOntoBatchGet(t *testing.T) {
+	uc := &fakeUseCase{products: make(map[primitive.ObjectID]*models.Product)}
+	ids := make([]primitive.ObjectID, 3)
+	for i := range ids {
+		ids[i] = primitive.NewObjectID()
+		uc.products[ids[i]] = &models.Product{ProductID: ids[i], Name: fmt.Sprintf("product %d", i)}
+	}
+	missing := primitive.NewObjectID()
+
+	cfg := newTestConfig()
+	cfg.ProductBatch.MaxGet = 3
+	h := newTestHandlers(t, uc, cfg)
+
+	query := fmt.Sprintf(`{
+		a: product(id: %q) { id name }
+		b: product(id: %q) { id name }
+		again: product(id: %q) { id }
+		list: products(ids: [%q, %q]) { id name }
+	}`, ids[0].Hex(), ids[1].Hex(), ids[0].Hex(), ids[2].Hex(), missing.Hex())
+	req := &graphQLRequest{Query: query}
+	doc, _, errs := h.prepare(req)
+	if errs != nil {
+		t.Fatalf("prepare: %v", errs)
+	}
+
+	result := h.execute(context.Background(), doc, req)
+	if result.HasErrors() {
+		t.Fatalf("execute errors: %v", result.Errors)
+	}
+	if len(uc.batches) != 2 || len(uc.batches[0]) != 3 || len(uc.batches[1]) != 1 {
+		t.Fatalf("BatchGet batches %v, want 4 distinct ids in batches of at most 3", uc.batches)
+	}
+
+	data := result.Data.(map[string]interface{})
+	if got := data["a"].(map[string]interface{})["name"]; got != "product 0" {
+		t.Fatalf("a name = %v, want product 0", got)
+	}
+	list := data["list"].([]interface{})
+	if len(list) != 2 || list[0].(map[string]interface{})["name"] != "product 2" || list[1] != nil {
+		t.Fatalf("list = %v, want product 2 and null of missing product", list)
+	}
+}
@@ -0,0 +1,213 @@
+package graphql
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Yangiboev/golang-with-curiosity/internal/models"
+	grpcErrors "github.com/Yangiboev/golang-with-curiosity/pkg/grpc_errors"
+	productErrors "github.com/Yangiboev/golang-with-curiosity/pkg/product_errors"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/utils"
+
+	gql "github.com/graphql-go/graphql"
+	"github.com/opentracing/opentracing-go"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// resolverError error of resolver with gRPC status code name and reason of error as extensions
+type resolverError struct {
+	error
+}
+
+// Error client message of typed error, messages of internal errors are not exposed
+func (e resolverError) Error() string {
+	domainErr := productErrors.Parse(e.error)
+	if domainErr.Kind == productErrors.Internal {
+		return productErrors.ErrInternal.Message
+	}
+	return domainErr.Message
+}
+
+func (e resolverError) Extensions() map[string]interface{} {
+	return map[string]interface{}{
+		"code":   grpcErrors.ParseGRPCErrStatusCode(e.error).String(),
+		"reason": productErrors.Parse(e.error).Reason,
+	}
+}
+
+func (h *productGraphQLHandlers) resolveProduct(p gql.ResolveParams) (interface{}, error) {
+	prodID, err := primitive.ObjectIDFromHex(p.Args["id"].(string))
+	if err != nil {
+		return nil, resolverError{err}
+	}
+	return loaderFromContext(p.Context).Load(p.Context, prodID), nil
+}
+
+func (h *productGraphQLHandlers) resolveProducts(p gql.ResolveParams) (interface{}, error) {
+	ids := p.Args["ids"].([]interface{})
+	if len(ids) > h.batch.MaxGet {
+		return nil, resolverError{productErrors.ErrInvalidBatch.WithMessage(fmt.Sprintf("at most %d ids", h.batch.MaxGet))}
+	}
+
+	loader := loaderFromContext(p.Context)
+	products := make([]interface{}, 0, len(ids))
+	for _, id := range ids {
+		prodID, err := primitive.ObjectIDFromHex(id.(string))
+		if err != nil {
+			return nil, resolverError{err}
+		}
+		products = append(products, loader.Load(p.Context, prodID))
+	}
+	return products, nil
+}
+
+func (h *productGraphQLHandlers) resolveSearchProducts(p gql.ResolveParams) (interface{}, error) {
+	span, ctx := opentracing.StartSpanFromContext(p.Context, "productGraphQLHandlers.SearchProducts")
+	defer span.Finish()
+
+	pq := utils.NewPaginationQuery(p.Args["size"].(int), p.Args["page"].(int))
+	result, err := h.productUC.Search(ctx, p.Args["search"].(string), pq)
+	if err != nil {
+		h.log.Errorf("productUC.Search: %v", err)
+		return nil, resolverError{err}
+	}
+	return result, nil
+}
+
+func (h *productGraphQLHandlers) resolveCreateProduct(p gql.ResolveParams) (interface{}, error) {
+	span, ctx := opentracing.StartSpanFromContext(p.Context, "productGraphQLHandlers.CreateProduct")
+	defer span.Finish()
+
+	prod, err := h.productInput(ctx, p.Args["input"].(map[string]interface{}))
+	if err != nil {
+		return nil, resolverError{err}
+	}
+
+	created, err := h.productUC.Create(ctx, prod)
+	if err != nil {
+		h.log.Errorf("productUC.Create: %v", err)
+		return nil, resolverError{err}
+	}
+	return created, nil
+}
+
+func (h *productGraphQLHandlers) resolveUpdateProduct(p gql.ResolveParams) (interface{}, error) {
+	span, ctx := opentracing.StartSpanFromContext(p.Context, "productGraphQLHandlers.UpdateProduct")
+	defer span.Finish()
+
+	prodID, err := primitive.ObjectIDFromHex(p.Args["id"].(string))
+	if err != nil {
+		return nil, resolverError{err}
+	}
+	prod, err := h.productInput(ctx, p.Args["input"].(map[string]interface{}))
+	if err != nil {
+		return nil, resolverError{err}
+	}
+	prod.ProductID = prodID
+
+	updated, err := h.productUC.Update(ctx, prod)
+	if err != nil {
+		h.log.Errorf("productUC.Update: %v", err)
+		return nil, resolverError{err}
+	}
+	return updated, nil
+}
+
+// subscribeProductChanged watch product changes until subscription context is done, watch errors are delivered
+// as last event
+func (h *productGraphQLHandlers) subscribeProductChanged(p gql.ResolveParams) (interface{}, error) {
+	filter, err := h.watchFilter(p.Args)
+	if err != nil {
+		return nil, resolverError{err}
+	}
+
+	events := make(chan interface{})
+	go func() {
+		defer close(events)
+		err := h.productUC.Watch(p.Context, filter, p.Args["resumeToken"].(string), func(event *models.ProductChangeEvent) error {
+			return send(p.Context, events, event)
+		})
+		if p.Context.Err() == nil {
+			h.log.Errorf("productUC.Watch: %v", err)
+			_ = send(p.Context, events, resolverError{err})
+		}
+	}()
+	return events, nil
+}
+
+func resolveProductChanged(p gql.ResolveParams) (interface{}, error) {
+	if err, ok := p.Source.(error); ok {
+		return nil, err
+	}
+	return p.Source, nil
+}
+
+// watchFilter filter of subscription arguments, product ids or category are required
+func (h *productGraphQLHandlers) watchFilter(args map[string]interface{}) (*models.WatchFilter, error) {
+	ids, _ := args["productIds"].([]interface{})
+	categoryID, _ := args["categoryId"].(string)
+	if len(ids) == 0 && categoryID == "" {
+		return nil, productErrors.ErrInvalidWatchFilter.WithMessage("product ids or category id required")
+	}
+	if len(ids) > h.maxWatchIDs {
+		return nil, productErrors.ErrInvalidWatchFilter.WithMessage(fmt.Sprintf("at most %d product ids", h.maxWatchIDs))
+	}
+
+	filter := &models.WatchFilter{ProductIDs: make(map[primitive.ObjectID]bool, len(ids))}
+	for _, id := range ids {
+		prodID, err := primitive.ObjectIDFromHex(id.(string))
+		if err != nil {
+			return nil, productErrors.ErrInvalidWatchFilter.WithMessage(fmt.Sprintf("product id %q is not object id hex", id))
+		}
+		filter.ProductIDs[prodID] = true
+	}
+	if categoryID != "" {
+		catID, err := primitive.ObjectIDFromHex(categoryID)
+		if err != nil {
+			return nil, productErrors.ErrInvalidWatchFilter.WithMessage(fmt.Sprintf("category id %q is not object id hex", categoryID))
+		}
+		filter.CategoryID = catID
+	}
+	return filter, nil
+}
+
+// productInput validated product of ProductInput argument
+func (h *productGraphQLHandlers) productInput(ctx context.Context, input map[string]interface{}) (*models.Product, error) {
+	catID, err := primitive.ObjectIDFromHex(input["categoryId"].(string))
+	if err != nil {
+		return nil, err
+	}
+
+	prod := &models.Product{
+		CategoryID:  catID,
+		Name:        input["name"].(string),
+		Description: input["description"].(string),
+		Price:       input["price"].(float64),
+		Quantity:    int64(input["quantity"].(int)),
+		Rating:      input["rating"].(int),
+	}
+	if imageURL, ok := input["imageUrl"].(string); ok {
+		prod.ImageURL = &imageURL
+	}
+	if photos, ok := input["photos"].([]interface{}); ok {
+		prod.Photos = make([]string, 0, len(photos))
+		for _, photo := range photos {
+			prod.Photos = append(prod.Photos, photo.(string))
+		}
+	}
+
+	if err := h.validate.StructCtx(ctx, prod); err != nil {
+		return nil, err
+	}
+	return prod, nil
+}
+
+// send event to subscription events unless subscription is done
+func send(ctx context.Context, events chan<- interface{}, event interface{}) error {
+	select {
+	case events <- event:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
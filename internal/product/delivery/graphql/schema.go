@@ -0,0 +1,196 @@
+package graphql
+
+import (
+	"github.com/Yangiboev/golang-with-curiosity/internal/models"
+
+	gql "github.com/graphql-go/graphql"
+	"github.com/pkg/errors"
+)
+
+// category products category, categories are known only by their id
+type category struct {
+	ID string `json:"id"`
+}
+
+// newSchema graphql schema of product domain. Product domain stores products only, variants, reviews and category
+// details have no model, repository or use case, so schema exposes products and category ids of products only
+func (h *productGraphQLHandlers) newSchema() (gql.Schema, error) {
+	categoryType := gql.NewObject(gql.ObjectConfig{
+		Name:        "Category",
+		Description: "Category of product, known only by its id until categories are stored by product domain",
+		Fields: gql.Fields{
+			"id": &gql.Field{Type: gql.NewNonNull(gql.ID)},
+		},
+	})
+
+	productType := gql.NewObject(gql.ObjectConfig{
+		Name:        "Product",
+		Description: "Product, variants and reviews of products are not stored by product domain yet",
+		Fields: gql.Fields{
+			"id": &gql.Field{
+				Type: gql.NewNonNull(gql.ID),
+				Resolve: func(p gql.ResolveParams) (interface{}, error) {
+					return p.Source.(*models.Product).ProductID.Hex(), nil
+				},
+			},
+			"category": &gql.Field{
+				Type: categoryType,
+				Resolve: func(p gql.ResolveParams) (interface{}, error) {
+					prod := p.Source.(*models.Product)
+					if prod.CategoryID.IsZero() {
+						return nil, nil
+					}
+					return &category{ID: prod.CategoryID.Hex()}, nil
+				},
+			},
+			"name":        &gql.Field{Type: gql.NewNonNull(gql.String)},
+			"description": &gql.Field{Type: gql.String},
+			"price":       &gql.Field{Type: gql.NewNonNull(gql.Float)},
+			"imageUrl":    &gql.Field{Type: gql.String},
+			"photos":      &gql.Field{Type: gql.NewList(gql.NewNonNull(gql.String))},
+			"quantity":    &gql.Field{Type: gql.NewNonNull(gql.Int)},
+			"rating":      &gql.Field{Type: gql.NewNonNull(gql.Int)},
+			"createdAt":   &gql.Field{Type: gql.DateTime},
+			"updatedAt":   &gql.Field{Type: gql.DateTime},
+		},
+	})
+
+	productsListType := gql.NewObject(gql.ObjectConfig{
+		Name: "ProductsList",
+		Fields: gql.Fields{
+			"totalCount": &gql.Field{Type: gql.NewNonNull(gql.Int)},
+			"totalPages": &gql.Field{Type: gql.NewNonNull(gql.Int)},
+			"page":       &gql.Field{Type: gql.NewNonNull(gql.Int)},
+			"size":       &gql.Field{Type: gql.NewNonNull(gql.Int)},
+			"hasMore":    &gql.Field{Type: gql.NewNonNull(gql.Boolean)},
+			"products":   &gql.Field{Type: gql.NewNonNull(gql.NewList(gql.NewNonNull(productType)))},
+		},
+	})
+
+	productChangeTypeEnum := gql.NewEnum(gql.EnumConfig{
+		Name: "ProductChangeType",
+		Values: gql.EnumValueConfigMap{
+			"CREATED": &gql.EnumValueConfig{Value: models.ProductChangeCreated},
+			"UPDATED": &gql.EnumValueConfig{Value: models.ProductChangeUpdated},
+			"DELETED": &gql.EnumValueConfig{Value: models.ProductChangeDeleted},
+		},
+	})
+
+	productChangeType := gql.NewObject(gql.ObjectConfig{
+		Name:        "ProductChange",
+		Description: "Product change, deleted products come without product",
+		Fields: gql.Fields{
+			"resumeToken": &gql.Field{
+				Type: gql.NewNonNull(gql.String),
+				Resolve: func(p gql.ResolveParams) (interface{}, error) {
+					return p.Source.(*models.ProductChangeEvent).Token, nil
+				},
+			},
+			"type": &gql.Field{Type: gql.NewNonNull(productChangeTypeEnum)},
+			"productId": &gql.Field{
+				Type: gql.NewNonNull(gql.ID),
+				Resolve: func(p gql.ResolveParams) (interface{}, error) {
+					return p.Source.(*models.ProductChangeEvent).ProductID.Hex(), nil
+				},
+			},
+			"product": &gql.Field{
+				Type: productType,
+				Resolve: func(p gql.ResolveParams) (interface{}, error) {
+					if after := p.Source.(*models.ProductChangeEvent).After; after != nil {
+						return after, nil
+					}
+					return nil, nil
+				},
+			},
+			"time": &gql.Field{Type: gql.NewNonNull(gql.DateTime)},
+		},
+	})
+
+	productInputType := gql.NewInputObject(gql.InputObjectConfig{
+		Name: "ProductInput",
+		Fields: gql.InputObjectConfigFieldMap{
+			"categoryId":  &gql.InputObjectFieldConfig{Type: gql.NewNonNull(gql.ID)},
+			"name":        &gql.InputObjectFieldConfig{Type: gql.NewNonNull(gql.String)},
+			"description": &gql.InputObjectFieldConfig{Type: gql.NewNonNull(gql.String)},
+			"price":       &gql.InputObjectFieldConfig{Type: gql.NewNonNull(gql.Float)},
+			"imageUrl":    &gql.InputObjectFieldConfig{Type: gql.String},
+			"photos":      &gql.InputObjectFieldConfig{Type: gql.NewList(gql.NewNonNull(gql.String))},
+			"quantity":    &gql.InputObjectFieldConfig{Type: gql.NewNonNull(gql.Int)},
+			"rating":      &gql.InputObjectFieldConfig{Type: gql.NewNonNull(gql.Int)},
+		},
+	})
+
+	query := gql.NewObject(gql.ObjectConfig{
+		Name: "Query",
+		Fields: gql.Fields{
+			"product": &gql.Field{
+				Type:    productType,
+				Args:    gql.FieldConfigArgument{"id": &gql.ArgumentConfig{Type: gql.NewNonNull(gql.ID)}},
+				Resolve: h.resolveProduct,
+			},
+			"products": &gql.Field{
+				Type:        gql.NewNonNull(gql.NewList(productType)),
+				Description: "Products by ids in ids order, missing products are null",
+				Args: gql.FieldConfigArgument{
+					"ids": &gql.ArgumentConfig{Type: gql.NewNonNull(gql.NewList(gql.NewNonNull(gql.ID)))},
+				},
+				Resolve: h.resolveProducts,
+			},
+			"searchProducts": &gql.Field{
+				Type: gql.NewNonNull(productsListType),
+				Args: gql.FieldConfigArgument{
+					"search": &gql.ArgumentConfig{Type: gql.String, DefaultValue: ""},
+					"page":   &gql.ArgumentConfig{Type: gql.Int, DefaultValue: 1},
+					"size":   &gql.ArgumentConfig{Type: gql.Int, DefaultValue: 10},
+				},
+				Resolve: h.resolveSearchProducts,
+			},
+		},
+	})
+
+	mutation := gql.NewObject(gql.ObjectConfig{
+		Name: "Mutation",
+		Fields: gql.Fields{
+			"createProduct": &gql.Field{
+				Type:    gql.NewNonNull(productType),
+				Args:    gql.FieldConfigArgument{"input": &gql.ArgumentConfig{Type: gql.NewNonNull(productInputType)}},
+				Resolve: h.resolveCreateProduct,
+			},
+			"updateProduct": &gql.Field{
+				Type: gql.NewNonNull(productType),
+				Args: gql.FieldConfigArgument{
+					"id":    &gql.ArgumentConfig{Type: gql.NewNonNull(gql.ID)},
+					"input": &gql.ArgumentConfig{Type: gql.NewNonNull(productInputType)},
+				},
+				Resolve: h.resolveUpdateProduct,
+			},
+		},
+	})
+
+	subscription := gql.NewObject(gql.ObjectConfig{
+		Name: "Subscription",
+		Fields: gql.Fields{
+			"productChanged": &gql.Field{
+				Type:        productChangeType,
+				Description: "Changes of listed products or products in category, resumed after resumeToken when given",
+				Args: gql.FieldConfigArgument{
+					"productIds":  &gql.ArgumentConfig{Type: gql.NewList(gql.NewNonNull(gql.ID))},
+					"categoryId":  &gql.ArgumentConfig{Type: gql.ID},
+					"resumeToken": &gql.ArgumentConfig{Type: gql.String, DefaultValue: ""},
+				},
+				Subscribe: h.subscribeProductChanged,
+				Resolve:   resolveProductChanged,
+			},
+		},
+	})
+
+	schema, err := gql.NewSchema(gql.SchemaConfig{
+		Query:        query,
+		Mutation:     mutation,
+		Subscription: subscription,
+	})
+	if err != nil {
+		return gql.Schema{}, errors.Wrap(err, "graphql.NewSchema")
+	}
+	return schema, nil
+}
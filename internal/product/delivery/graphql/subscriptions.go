@@ -0,0 +1,305 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Yangiboev/golang-with-curiosity/pkg/events"
+
+	"github.com/gorilla/websocket"
+	gql "github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/labstack/echo/v4"
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+)
+
+// graphQLTransportWS websocket subprotocol of GraphQL over WebSocket protocol,
+// https://github.com/enisdenjo/graphql-ws/blob/master/PROTOCOL.md
+const graphQLTransportWS = "graphql-transport-ws"
+
+const (
+	msgConnectionInit = "connection_init"
+	msgConnectionAck  = "connection_ack"
+	msgPing           = "ping"
+	msgPong           = "pong"
+	msgSubscribe      = "subscribe"
+	msgNext           = "next"
+	msgError          = "error"
+	msgComplete       = "complete"
+)
+
+const (
+	closeBadRequest       = 4400
+	closeUnauthorized     = 4401
+	closeInitTimeout      = 4408
+	closeSubscriberExists = 4409
+	closeTooManyInit      = 4429
+)
+
+var (
+	errSubscriberExists     = errors.New("subscriber already exists")
+	errTooManySubscriptions = errors.New("too many subscriptions of connection")
+)
+
+type wsMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// wsConnection graphql-transport-ws connection, writes are serialized by mutex,
+// subscriptions are cancelled by client complete messages or on disconnect
+type wsConnection struct {
+	h             *productGraphQLHandlers
+	conn          *websocket.Conn
+	correlationID string
+	writeMu       sync.Mutex
+	subsMu        sync.Mutex
+	subs          map[string]context.CancelFunc
+	wg            sync.WaitGroup
+}
+
+// serveWebSocket upgrade request to graphql-transport-ws connection and serve it until disconnect
+func (h *productGraphQLHandlers) serveWebSocket(c echo.Context) error {
+	conn, err := h.upgrader.Upgrade(c.Response(), c.Request(), nil)
+	if err != nil {
+		// upgrader already replied with error response
+		h.log.Errorf("upgrader.Upgrade: %v", err)
+		return nil
+	}
+
+	ws := &wsConnection{
+		h:             h,
+		conn:          conn,
+		correlationID: c.Response().Header().Get(echo.HeaderXRequestID),
+		subs:          make(map[string]context.CancelFunc),
+	}
+	if conn.Subprotocol() != graphQLTransportWS {
+		ws.close(websocket.CloseProtocolError, "Subprotocol not acceptable")
+		return conn.Close()
+	}
+
+	ws.serve(c.Request().Context())
+	return nil
+}
+
+func (ws *wsConnection) serve(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer func() {
+		cancel()
+		ws.wg.Wait()
+		ws.conn.Close()
+	}()
+
+	messages := make(chan *wsMessage)
+	go ws.read(ctx, messages)
+
+	initTimer := time.NewTimer(ws.h.cfg.InitTimeout)
+	defer initTimer.Stop()
+	keepAlive := time.NewTicker(ws.h.cfg.KeepAlive)
+	defer keepAlive.Stop()
+
+	acknowledged := false
+	for {
+		select {
+		case <-initTimer.C:
+			ws.close(closeInitTimeout, "Connection initialisation timeout")
+			return
+
+		case <-keepAlive.C:
+			if err := ws.write(&wsMessage{Type: msgPing}); err != nil {
+				return
+			}
+
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+
+			switch msg.Type {
+			case msgConnectionInit:
+				if acknowledged {
+					ws.close(closeTooManyInit, "Too many initialisation requests")
+					return
+				}
+				acknowledged = true
+				initTimer.Stop()
+				if err := ws.write(&wsMessage{Type: msgConnectionAck}); err != nil {
+					return
+				}
+
+			case msgPing:
+				if err := ws.write(&wsMessage{Type: msgPong}); err != nil {
+					return
+				}
+
+			case msgPong:
+
+			case msgSubscribe:
+				if !acknowledged {
+					ws.close(closeUnauthorized, "Unauthorized")
+					return
+				}
+				var req graphQLRequest
+				if err := json.Unmarshal(msg.Payload, &req); err != nil || msg.ID == "" || req.Query == "" {
+					ws.close(closeBadRequest, "Invalid subscribe message")
+					return
+				}
+				switch ws.subscribe(ctx, msg.ID, &req) {
+				case errSubscriberExists:
+					ws.close(closeSubscriberExists, fmt.Sprintf("Subscriber for %s already exists", msg.ID))
+					return
+				case errTooManySubscriptions:
+					payload, _ := json.Marshal(gqlerrors.FormatErrors(errTooManySubscriptions))
+					if err := ws.write(&wsMessage{ID: msg.ID, Type: msgError, Payload: payload}); err != nil {
+						return
+					}
+				}
+
+			case msgComplete:
+				ws.unsubscribe(msg.ID)
+
+			default:
+				ws.close(closeBadRequest, "Invalid message received")
+				return
+			}
+		}
+	}
+}
+
+// read client messages until connection is closed, invalid messages are delivered with empty type
+func (ws *wsConnection) read(ctx context.Context, messages chan<- *wsMessage) {
+	defer close(messages)
+	for {
+		_, data, err := ws.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		msg := &wsMessage{}
+		if err := json.Unmarshal(data, msg); err != nil {
+			msg = &wsMessage{}
+		}
+		select {
+		case messages <- msg:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// subscribe execute operation of subscribe message id, returns errSubscriberExists when id is already in use and
+// errTooManySubscriptions while connection runs max subscriptions operations
+func (ws *wsConnection) subscribe(ctx context.Context, id string, req *graphQLRequest) error {
+	ws.subsMu.Lock()
+	defer ws.subsMu.Unlock()
+
+	if _, ok := ws.subs[id]; ok {
+		return errSubscriberExists
+	}
+	if len(ws.subs) >= ws.h.cfg.MaxSubscriptions {
+		return errTooManySubscriptions
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	ws.subs[id] = cancel
+
+	ws.wg.Add(1)
+	go func() {
+		defer ws.wg.Done()
+		defer ws.unsubscribe(id)
+		ws.execute(ctx, id, req)
+	}()
+	return nil
+}
+
+// unsubscribe cancel operation of id, no messages of operation are sent afterwards
+func (ws *wsConnection) unsubscribe(id string) {
+	ws.subsMu.Lock()
+	defer ws.subsMu.Unlock()
+
+	if cancel, ok := ws.subs[id]; ok {
+		cancel()
+		delete(ws.subs, id)
+	}
+}
+
+// execute query, mutation or subscription sending results as next messages until operation completes
+func (ws *wsConnection) execute(ctx context.Context, id string, req *graphQLRequest) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "productGraphQLHandlers.Subscribe")
+	defer span.Finish()
+	ctx = events.WithCorrelationID(ctx, ws.correlationID)
+
+	doc, op, errs := ws.h.prepare(req)
+	if errs != nil {
+		errorRequests.Inc()
+		payload, _ := json.Marshal(errs)
+		_ = ws.write(&wsMessage{ID: id, Type: msgError, Payload: payload})
+		return
+	}
+
+	failed := false
+	if op.Operation == ast.OperationTypeSubscription {
+		activeSubscriptions.Inc()
+		defer activeSubscriptions.Dec()
+
+		results := gql.ExecuteSubscription(gql.ExecuteParams{
+			Schema:        ws.h.schema,
+			AST:           doc,
+			OperationName: req.OperationName,
+			Args:          req.Variables,
+			Context:       withLoader(ctx, newProductLoader(ws.h.productUC, ws.h.batch.MaxGet)),
+		})
+		// results are drained until closed so subscription goroutines exit
+		for result := range results {
+			failed = failed || result.HasErrors()
+			ws.next(ctx, id, result)
+		}
+	} else {
+		result := ws.h.execute(ctx, doc, req)
+		failed = result.HasErrors()
+		ws.next(ctx, id, result)
+	}
+
+	if failed {
+		errorRequests.Inc()
+	} else {
+		successRequests.Inc()
+	}
+	if ctx.Err() == nil {
+		_ = ws.write(&wsMessage{ID: id, Type: msgComplete})
+	}
+}
+
+// next send result of operation id unless operation is cancelled
+func (ws *wsConnection) next(ctx context.Context, id string, result *gql.Result) {
+	if ctx.Err() != nil {
+		return
+	}
+	payload, err := json.Marshal(result)
+	if err != nil {
+		ws.h.log.Errorf("json.Marshal: %v", err)
+		return
+	}
+	if err := ws.write(&wsMessage{ID: id, Type: msgNext, Payload: payload}); err != nil {
+		ws.h.log.Errorf("ws.write: %v", err)
+	}
+}
+
+func (ws *wsConnection) write(msg *wsMessage) error {
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+
+	if err := ws.conn.SetWriteDeadline(time.Now().Add(ws.h.cfg.KeepAlive)); err != nil {
+		return err
+	}
+	return ws.conn.WriteJSON(msg)
+}
+
+func (ws *wsConnection) close(code int, text string) {
+	_ = ws.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(time.Second))
+}
@@ -0,0 +1,94 @@
+package grpc
+
+import (
+	"context"
+
+	"github.com/Yangiboev/golang-with-curiosity/internal/models"
+	"github.com/Yangiboev/golang-with-curiosity/internal/product"
+	grpcErrors "github.com/Yangiboev/golang-with-curiosity/pkg/grpc_errors"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/logger"
+	productsService "github.com/Yangiboev/golang-with-curiosity/proto/product"
+	"github.com/go-playground/validator/v10"
+	"github.com/opentracing/opentracing-go"
+)
+
+// consumerAdminService gRPC Service
+type consumerAdminService struct {
+	log      logger.Logger
+	admin    product.ConsumerAdmin
+	validate *validator.Validate
+}
+
+// NewConsumerAdminService consumerAdminService constructor
+func NewConsumerAdminService(log logger.Logger, admin product.ConsumerAdmin, validate *validator.Validate) *consumerAdminService {
+	return &consumerAdminService{log: log, admin: admin, validate: validate}
+}
+
+// ListConsumerGroups list consumer groups running on this instance
+func (a *consumerAdminService) ListConsumerGroups(ctx context.Context, req *productsService.ListConsumerGroupsReq) (*productsService.ListConsumerGroupsRes, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "consumerAdminService.ListConsumerGroups")
+	defer span.Finish()
+
+	groups, err := a.admin.ConsumerGroups(ctx)
+	if err != nil {
+		a.log.Errorf("admin.ConsumerGroups: %v", err)
+		return nil, grpcErrors.ErrorResponse(err)
+	}
+
+	res := &productsService.ListConsumerGroupsRes{ConsumerGroups: make([]*productsService.ConsumerGroup, 0, len(groups))}
+	for _, group := range groups {
+		res.ConsumerGroups = append(res.ConsumerGroups, group.ToProto())
+	}
+	return res, nil
+}
+
+// PauseConsumerGroup pause consumer group
+func (a *consumerAdminService) PauseConsumerGroup(ctx context.Context, req *productsService.PauseConsumerGroupReq) (*productsService.PauseConsumerGroupRes, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "consumerAdminService.PauseConsumerGroup")
+	defer span.Finish()
+
+	group, err := a.admin.PauseConsumerGroup(ctx, req.GetGroupID())
+	if err != nil {
+		a.log.Errorf("admin.PauseConsumerGroup: %v", err)
+		return nil, grpcErrors.ErrorResponse(err)
+	}
+
+	return &productsService.PauseConsumerGroupRes{ConsumerGroup: group.ToProto()}, nil
+}
+
+// ResumeConsumerGroup resume paused consumer group
+func (a *consumerAdminService) ResumeConsumerGroup(ctx context.Context, req *productsService.ResumeConsumerGroupReq) (*productsService.ResumeConsumerGroupRes, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "consumerAdminService.ResumeConsumerGroup")
+	defer span.Finish()
+
+	group, err := a.admin.ResumeConsumerGroup(ctx, req.GetGroupID())
+	if err != nil {
+		a.log.Errorf("admin.ResumeConsumerGroup: %v", err)
+		return nil, grpcErrors.ErrorResponse(err)
+	}
+
+	return &productsService.ResumeConsumerGroupRes{ConsumerGroup: group.ToProto()}, nil
+}
+
+// ResetConsumerGroupOffsets reset paused consumer group offsets
+func (a *consumerAdminService) ResetConsumerGroupOffsets(ctx context.Context, req *productsService.ResetConsumerGroupOffsetsReq) (*productsService.ResetConsumerGroupOffsetsRes, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "consumerAdminService.ResetConsumerGroupOffsets")
+	defer span.Finish()
+
+	reset := models.OffsetReset{To: req.GetTo()}
+	if req.GetTimestamp() != nil {
+		reset.Timestamp = req.GetTimestamp().AsTime()
+	}
+	if err := a.validate.StructCtx(ctx, &reset); err != nil {
+		a.log.Errorf("validate.StructCtx: %v", err)
+		return nil, grpcErrors.ErrorResponse(err)
+	}
+
+	offsets, err := a.admin.ResetConsumerGroupOffsets(ctx, req.GetGroupID(), reset)
+	if err != nil {
+		a.log.Errorf("admin.ResetConsumerGroupOffsets: %v", err)
+		return nil, grpcErrors.ErrorResponse(err)
+	}
+
+	return &productsService.ResetConsumerGroupOffsetsRes{Offsets: models.PartitionOffsetsToProto(offsets)}, nil
+}
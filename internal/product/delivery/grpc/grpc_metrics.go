@@ -30,4 +30,24 @@ var (
 		Name: "products_search_incoming_grpc_requests_total",
 		Help: "The total number of incoming search products gRPC messages",
 	})
+	deleteMessages = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "products_delete_incoming_grpc_requests_total",
+		Help: "The total number of incoming delete product gRPC messages",
+	})
+	watchMessages = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "products_watch_incoming_grpc_requests_total",
+		Help: "The total number of incoming watch products gRPC messages",
+	})
+	batchGetMessages = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "products_batch_get_incoming_grpc_requests_total",
+		Help: "The total number of incoming batch get products gRPC messages",
+	})
+	batchCreateMessages = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "products_batch_create_incoming_grpc_requests_total",
+		Help: "The total number of incoming batch create products gRPC messages",
+	})
+	batchUpdateMessages = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "products_batch_update_incoming_grpc_requests_total",
+		Help: "The total number of incoming batch update products gRPC messages",
+	})
 )
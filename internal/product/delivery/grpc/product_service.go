@@ -2,28 +2,34 @@ package grpc
 
 import (
 	"context"
+	"fmt"
 
+	"github.com/Yangiboev/golang-with-curiosity/config"
 	"github.com/Yangiboev/golang-with-curiosity/internal/models"
 	"github.com/Yangiboev/golang-with-curiosity/internal/product"
 	grpcErrors "github.com/Yangiboev/golang-with-curiosity/pkg/grpc_errors"
 	"github.com/Yangiboev/golang-with-curiosity/pkg/logger"
+	productErrors "github.com/Yangiboev/golang-with-curiosity/pkg/product_errors"
 	"github.com/Yangiboev/golang-with-curiosity/pkg/utils"
 	productsService "github.com/Yangiboev/golang-with-curiosity/proto/product"
 	"github.com/go-playground/validator/v10"
 	"github.com/opentracing/opentracing-go"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/status"
 )
 
 // productService gRPC Service
 type productService struct {
-	log       logger.Logger
-	productUC product.UseCase
-	validate  *validator.Validate
+	log         logger.Logger
+	productUC   product.UseCase
+	validate    *validator.Validate
+	maxWatchIDs int
+	batch       config.ProductBatch
 }
 
 // NewProductService productService constructor
-func NewProductService(log logger.Logger, productUC product.UseCase, validate *validator.Validate) *productService {
-	return &productService{log: log, productUC: productUC, validate: validate}
+func NewProductService(log logger.Logger, productUC product.UseCase, validate *validator.Validate, cfg config.Config) *productService {
+	return &productService{log: log, productUC: productUC, validate: validate, maxWatchIDs: cfg.ProductWatch.MaxProductIDs, batch: cfg.ProductBatch}
 }
 
 // Create create new product
@@ -32,29 +38,23 @@ func (p *productService) Create(ctx context.Context, req *productsService.Create
 	defer span.Finish()
 	createMessages.Inc()
 
-	catID, err := primitive.ObjectIDFromHex(req.GetCategoryID())
+	prod, err := productFromCreateReq(req)
 	if err != nil {
 		errorMessages.Inc()
 		p.log.Errorf("primitive.ObjectIDFromHex: %v", err)
-		return nil, grpcErrors.ErrorResponse(err, err.Error())
+		return nil, grpcErrors.ErrorResponse(err)
 	}
-
-	prod := &models.Product{
-		CategoryID:  catID,
-		Name:        req.GetName(),
-		Description: req.GetDescription(),
-		Price:       req.GetPrice(),
-		ImageURL:    &req.ImageURL,
-		Photos:      req.GetPhotos(),
-		Quantity:    req.GetQuantity(),
-		Rating:      int(req.GetRating()),
+	if err := p.validate.StructCtx(ctx, prod); err != nil {
+		errorMessages.Inc()
+		p.log.Errorf("validate.StructCtx: %v", err)
+		return nil, grpcErrors.ErrorResponse(err)
 	}
 
 	created, err := p.productUC.Create(ctx, prod)
 	if err != nil {
 		errorMessages.Inc()
 		p.log.Errorf("productUC.Create: %v", err)
-		return nil, grpcErrors.ErrorResponse(err, err.Error())
+		return nil, grpcErrors.ErrorResponse(err)
 	}
 
 	successMessages.Inc()
@@ -67,36 +67,23 @@ func (p *productService) Update(ctx context.Context, req *productsService.Update
 	defer span.Finish()
 	updateMessages.Inc()
 
-	prodID, err := primitive.ObjectIDFromHex(req.GetProductID())
+	prod, err := productFromUpdateReq(req)
 	if err != nil {
 		errorMessages.Inc()
 		p.log.Errorf("primitive.ObjectIDFromHex: %v", err)
-		return nil, grpcErrors.ErrorResponse(err, err.Error())
+		return nil, grpcErrors.ErrorResponse(err)
 	}
-	catID, err := primitive.ObjectIDFromHex(req.GetCategoryID())
-	if err != nil {
+	if err := p.validate.StructCtx(ctx, prod); err != nil {
 		errorMessages.Inc()
-		p.log.Errorf("primitive.ObjectIDFromHex: %v", err)
-		return nil, grpcErrors.ErrorResponse(err, err.Error())
-	}
-
-	prod := &models.Product{
-		ProductID:   prodID,
-		CategoryID:  catID,
-		Name:        req.GetName(),
-		Description: req.GetDescription(),
-		Price:       req.GetPrice(),
-		ImageURL:    &req.ImageURL,
-		Photos:      req.GetPhotos(),
-		Quantity:    req.GetQuantity(),
-		Rating:      int(req.GetRating()),
+		p.log.Errorf("validate.StructCtx: %v", err)
+		return nil, grpcErrors.ErrorResponse(err)
 	}
 
 	update, err := p.productUC.Update(ctx, prod)
 	if err != nil {
 		errorMessages.Inc()
 		p.log.Errorf("productUC.Update: %v", err)
-		return nil, grpcErrors.ErrorResponse(err, err.Error())
+		return nil, grpcErrors.ErrorResponse(err)
 	}
 
 	successMessages.Inc()
@@ -113,20 +100,43 @@ func (p *productService) GetByID(ctx context.Context, req *productsService.GetBy
 	if err != nil {
 		errorMessages.Inc()
 		p.log.Errorf("primitive.ObjectIDFromHex: %v", err)
-		return nil, grpcErrors.ErrorResponse(err, err.Error())
+		return nil, grpcErrors.ErrorResponse(err)
 	}
 
 	prod, err := p.productUC.GetByID(ctx, prodID)
 	if err != nil {
 		errorMessages.Inc()
 		p.log.Errorf("productUC.GetByID: %v", err)
-		return nil, grpcErrors.ErrorResponse(err, err.Error())
+		return nil, grpcErrors.ErrorResponse(err)
 	}
 
 	successMessages.Inc()
 	return &productsService.GetByIDRes{Product: prod.ToProto()}, nil
 }
 
+// Delete Delete single product by id
+func (p *productService) Delete(ctx context.Context, req *productsService.DeleteReq) (*productsService.DeleteRes, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "productService.Delete")
+	defer span.Finish()
+	deleteMessages.Inc()
+
+	prodID, err := primitive.ObjectIDFromHex(req.GetProductID())
+	if err != nil {
+		errorMessages.Inc()
+		p.log.Errorf("primitive.ObjectIDFromHex: %v", err)
+		return nil, grpcErrors.ErrorResponse(err)
+	}
+
+	if err := p.productUC.Delete(ctx, prodID); err != nil {
+		errorMessages.Inc()
+		p.log.Errorf("productUC.Delete: %v", err)
+		return nil, grpcErrors.ErrorResponse(err)
+	}
+
+	successMessages.Inc()
+	return &productsService.DeleteRes{}, nil
+}
+
 // Search Search products
 func (p *productService) Search(ctx context.Context, req *productsService.SearchReq) (*productsService.SearchRes, error) {
 	span, ctx := opentracing.StartSpanFromContext(ctx, "productService.Search")
@@ -137,7 +147,7 @@ func (p *productService) Search(ctx context.Context, req *productsService.Search
 	if err != nil {
 		errorMessages.Inc()
 		p.log.Errorf("productUC.Search: %v", err)
-		return nil, grpcErrors.ErrorResponse(err, err.Error())
+		return nil, grpcErrors.ErrorResponse(err)
 	}
 
 	successMessages.Inc()
@@ -150,3 +160,277 @@ func (p *productService) Search(ctx context.Context, req *productsService.Search
 		Products:   products.ToProtoList(),
 	}, nil
 }
+
+// WatchProducts stream changes of listed products or products of category, resuming after resume token when given
+func (p *productService) WatchProducts(req *productsService.WatchProductsReq, stream productsService.ProductsService_WatchProductsServer) error {
+	span, ctx := opentracing.StartSpanFromContext(stream.Context(), "productService.WatchProducts")
+	defer span.Finish()
+	watchMessages.Inc()
+
+	filter, err := p.watchFilter(req)
+	if err != nil {
+		errorMessages.Inc()
+		p.log.Errorf("watchFilter: %v", err)
+		return grpcErrors.ErrorResponse(err)
+	}
+
+	err = p.productUC.Watch(ctx, filter, req.GetResumeToken(), func(event *models.ProductChangeEvent) error {
+		return stream.Send(event.ToProto())
+	})
+	if ctx.Err() != nil {
+		successMessages.Inc()
+		return nil
+	}
+	errorMessages.Inc()
+	p.log.Errorf("productUC.Watch: %v", err)
+	return grpcErrors.ErrorResponse(err)
+}
+
+// watchFilter filter of watch request, product ids or category are required
+func (p *productService) watchFilter(req *productsService.WatchProductsReq) (*models.WatchFilter, error) {
+	if len(req.GetProductIDs()) == 0 && req.GetCategoryID() == "" {
+		return nil, productErrors.ErrInvalidWatchFilter.WithMessage("product ids or category id required")
+	}
+	if len(req.GetProductIDs()) > p.maxWatchIDs {
+		return nil, productErrors.ErrInvalidWatchFilter.WithMessage(fmt.Sprintf("at most %d product ids", p.maxWatchIDs))
+	}
+
+	filter := &models.WatchFilter{ProductIDs: make(map[primitive.ObjectID]bool, len(req.GetProductIDs()))}
+	for _, id := range req.GetProductIDs() {
+		prodID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			return nil, productErrors.ErrInvalidWatchFilter.WithMessage(fmt.Sprintf("product id %q is not object id hex", id))
+		}
+		filter.ProductIDs[prodID] = true
+	}
+	if req.GetCategoryID() != "" {
+		catID, err := primitive.ObjectIDFromHex(req.GetCategoryID())
+		if err != nil {
+			return nil, productErrors.ErrInvalidWatchFilter.WithMessage(fmt.Sprintf("category id %q is not object id hex", req.GetCategoryID()))
+		}
+		filter.CategoryID = catID
+	}
+	return filter, nil
+}
+
+// BatchGetProducts Get products by ids, products which can not be returned get error results
+func (p *productService) BatchGetProducts(ctx context.Context, req *productsService.BatchGetProductsReq) (*productsService.BatchGetProductsRes, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "productService.BatchGetProducts")
+	defer span.Finish()
+	batchGetMessages.Inc()
+
+	if err := p.checkBatchSize(len(req.GetProductIDs()), p.batch.MaxGet); err != nil {
+		errorMessages.Inc()
+		return nil, err
+	}
+
+	results := make([]*productsService.ProductResult, len(req.GetProductIDs()))
+	ids := make([]primitive.ObjectID, 0, len(req.GetProductIDs()))
+	indexes := make([]int, 0, len(req.GetProductIDs()))
+	for i, id := range req.GetProductIDs() {
+		prodID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			results[i] = productResultToProto(&models.ProductResult{Err: err})
+			results[i].ProductID = id
+			continue
+		}
+		ids = append(ids, prodID)
+		indexes = append(indexes, i)
+	}
+
+	found, err := p.productUC.BatchGet(ctx, ids)
+	if err != nil {
+		errorMessages.Inc()
+		p.log.Errorf("productUC.BatchGet: %v", err)
+		return nil, grpcErrors.ErrorResponse(err)
+	}
+	for i, res := range found {
+		results[indexes[i]] = productResultToProto(res)
+	}
+
+	successMessages.Inc()
+	return &productsService.BatchGetProductsRes{Results: results}, nil
+}
+
+// BatchCreate create products in one batch, invalid products get error results and are not created
+func (p *productService) BatchCreate(ctx context.Context, req *productsService.BatchCreateReq) (*productsService.BatchCreateRes, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "productService.BatchCreate")
+	defer span.Finish()
+	batchCreateMessages.Inc()
+
+	if err := p.checkBatchSize(len(req.GetProducts()), p.batch.MaxWrite); err != nil {
+		errorMessages.Inc()
+		return nil, err
+	}
+
+	products := make([]*models.Product, 0, len(req.GetProducts()))
+	invalid := make([]error, len(req.GetProducts()))
+	for i, createReq := range req.GetProducts() {
+		prod, err := productFromCreateReq(createReq)
+		if err == nil {
+			err = p.validate.StructCtx(ctx, prod)
+		}
+		invalid[i] = err
+		products = append(products, prod)
+	}
+
+	results, err := p.batchWrite(ctx, products, nil, invalid, p.productUC.BatchCreate)
+	if err != nil {
+		errorMessages.Inc()
+		p.log.Errorf("productUC.BatchCreate: %v", err)
+		return nil, grpcErrors.ErrorResponse(err)
+	}
+
+	successMessages.Inc()
+	return &productsService.BatchCreateRes{Results: results}, nil
+}
+
+// BatchUpdate update products in one batch, invalid products get error results and are not updated
+func (p *productService) BatchUpdate(ctx context.Context, req *productsService.BatchUpdateReq) (*productsService.BatchUpdateRes, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "productService.BatchUpdate")
+	defer span.Finish()
+	batchUpdateMessages.Inc()
+
+	if err := p.checkBatchSize(len(req.GetProducts()), p.batch.MaxWrite); err != nil {
+		errorMessages.Inc()
+		return nil, err
+	}
+
+	products := make([]*models.Product, 0, len(req.GetProducts()))
+	requestIDs := make([]string, 0, len(req.GetProducts()))
+	invalid := make([]error, len(req.GetProducts()))
+	for i, updateReq := range req.GetProducts() {
+		prod, err := productFromUpdateReq(updateReq)
+		if err == nil {
+			err = p.validate.StructCtx(ctx, prod)
+		}
+		invalid[i] = err
+		products = append(products, prod)
+		requestIDs = append(requestIDs, updateReq.GetProductID())
+	}
+
+	results, err := p.batchWrite(ctx, products, requestIDs, invalid, p.productUC.BatchUpdate)
+	if err != nil {
+		errorMessages.Inc()
+		p.log.Errorf("productUC.BatchUpdate: %v", err)
+		return nil, grpcErrors.ErrorResponse(err)
+	}
+
+	successMessages.Inc()
+	return &productsService.BatchUpdateRes{Results: results}, nil
+}
+
+// batchWrite write valid products with write, results of invalid products hold their validation errors and product
+// id of request item, products of items which failed to convert are nil. requestIDs is nil when items have no id
+func (p *productService) batchWrite(
+	ctx context.Context,
+	products []*models.Product,
+	requestIDs []string,
+	invalid []error,
+	write func(ctx context.Context, products []*models.Product) ([]*models.ProductResult, error),
+) ([]*productsService.ProductResult, error) {
+	results := make([]*productsService.ProductResult, len(products))
+	valid := make([]*models.Product, 0, len(products))
+	indexes := make([]int, 0, len(products))
+	for i, prod := range products {
+		if invalid[i] != nil {
+			results[i] = productResultToProto(&models.ProductResult{Err: invalid[i]})
+			if requestIDs != nil {
+				results[i].ProductID = requestIDs[i]
+			}
+			continue
+		}
+		valid = append(valid, prod)
+		indexes = append(indexes, i)
+	}
+	if len(valid) == 0 {
+		return results, nil
+	}
+
+	written, err := write(ctx, valid)
+	if err != nil {
+		return nil, err
+	}
+	for i, res := range written {
+		results[indexes[i]] = productResultToProto(res)
+	}
+	return results, nil
+}
+
+// checkBatchSize batch holds between one and max items
+func (p *productService) checkBatchSize(size, max int) error {
+	if size == 0 || size > max {
+		err := productErrors.ErrInvalidBatch.WithMessage(fmt.Sprintf("batch size %d must be between 1 and %d", size, max))
+		return grpcErrors.ErrorResponse(err)
+	}
+	return nil
+}
+
+// productResultToProto convert batch product result to proto
+func productResultToProto(res *models.ProductResult) *productsService.ProductResult {
+	result := &productsService.ProductResult{}
+	if !res.ProductID.IsZero() {
+		result.ProductID = res.ProductID.Hex()
+	}
+	if res.Err != nil {
+		st := status.Convert(grpcErrors.ErrorResponse(res.Err))
+		result.Error = &productsService.BatchError{
+			Code:    int32(st.Code()),
+			Message: st.Message(),
+		}
+		return result
+	}
+	result.Product = res.Product.ToProto()
+	return result
+}
+
+// invalidObjectID validation error of request field which is not object id hex
+func invalidObjectID(field string) error {
+	return productErrors.NewValidationError("invalid "+field, productErrors.FieldViolation{
+		Field:       field,
+		Description: "must be object id hex",
+	})
+}
+
+// productFromCreateReq product of create request
+func productFromCreateReq(req *productsService.CreateReq) (*models.Product, error) {
+	catID, err := primitive.ObjectIDFromHex(req.GetCategoryID())
+	if err != nil {
+		return nil, invalidObjectID("categoryID")
+	}
+
+	return &models.Product{
+		CategoryID:  catID,
+		Name:        req.GetName(),
+		Description: req.GetDescription(),
+		Price:       req.GetPrice(),
+		ImageURL:    &req.ImageURL,
+		Photos:      req.GetPhotos(),
+		Quantity:    req.GetQuantity(),
+		Rating:      int(req.GetRating()),
+	}, nil
+}
+
+// productFromUpdateReq product of update request
+func productFromUpdateReq(req *productsService.UpdateReq) (*models.Product, error) {
+	prodID, err := primitive.ObjectIDFromHex(req.GetProductID())
+	if err != nil {
+		return nil, invalidObjectID("productID")
+	}
+	catID, err := primitive.ObjectIDFromHex(req.GetCategoryID())
+	if err != nil {
+		return nil, invalidObjectID("categoryID")
+	}
+
+	return &models.Product{
+		ProductID:   prodID,
+		CategoryID:  catID,
+		Name:        req.GetName(),
+		Description: req.GetDescription(),
+		Price:       req.GetPrice(),
+		ImageURL:    &req.ImageURL,
+		Photos:      req.GetPhotos(),
+		Quantity:    req.GetQuantity(),
+		Rating:      int(req.GetRating()),
+	}, nil
+}
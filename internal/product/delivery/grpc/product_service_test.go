@@ -0,0 +1,142 @@
+package grpc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/Yangiboev/golang-with-curiosity/config"
+	"github.com/Yangiboev/golang-with-curiosity/internal/models"
+	"github.com/Yangiboev/golang-with-curiosity/internal/product"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/logger"
+	productErrors "github.com/Yangiboev/golang-with-curiosity/pkg/product_errors"
+	productsService "github.com/Yangiboev/golang-with-curiosity/proto/product"
+)
+
+// fakeUseCase writes every product of batch it is given and deletes every product once
+type fakeUseCase struct {
+	product.UseCase
+
+	written []*models.Product
+	deleted []primitive.ObjectID
+}
+
+func (f *fakeUseCase) Delete(ctx context.Context, productID primitive.ObjectID) error {
+	for _, id := range f.deleted {
+		if id == productID {
+			return productErrors.ErrProductNotFound
+		}
+	}
+	f.deleted = append(f.deleted, productID)
+	return nil
+}
+
+func (f *fakeUseCase) BatchUpdate(ctx context.Context, products []*models.Product) ([]*models.ProductResult, error) {
+	f.written = append(f.written, products...)
+	results := make([]*models.ProductResult, 0, len(products))
+	for _, prod := range products {
+		results = append(results, &models.ProductResult{ProductID: prod.ProductID, Product: prod})
+	}
+	return results, nil
+}
+
+func newTestProductService(uc product.UseCase) *productService {
+	cfg := config.Config{}
+	cfg.Logger.Level = "fatal"
+	cfg.Logger.Encoding = "console"
+	cfg.ProductBatch = config.ProductBatch{MaxGet: 10, MaxWrite: 10}
+	appLogger := logger.NewApiLogger(cfg)
+	appLogger.InitLogger()
+	return NewProductService(appLogger, uc, validator.New(), cfg)
+}
+
+func TestBatchUpdateReportsItemWithBadHexAndWritesOthers(t *testing.T) {
+	uc := &fakeUseCase{}
+	svc := newTestProductService(uc)
+	validID := primitive.NewObjectID().Hex()
+	item := func(productID, categoryID string) *productsService.UpdateReq {
+		return &productsService.UpdateReq{
+			ProductID:   productID,
+			CategoryID:  categoryID,
+			Name:        "product",
+			Description: "description",
+			Price:       10,
+			Quantity:    1,
+			Rating:      5,
+		}
+	}
+
+	res, err := svc.BatchUpdate(context.Background(), &productsService.BatchUpdateReq{Products: []*productsService.UpdateReq{
+		item("not-hex", primitive.NewObjectID().Hex()),
+		item(validID, "bad-category"),
+		item(validID, primitive.NewObjectID().Hex()),
+	}})
+	if err != nil {
+		t.Fatalf("BatchUpdate: %v", err)
+	}
+
+	results := res.GetResults()
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3", len(results))
+	}
+	for i, want := range []string{"not-hex", validID} {
+		if results[i].GetError() == nil || codes.Code(results[i].GetError().GetCode()) != codes.InvalidArgument {
+			t.Fatalf("result %d error %v, want InvalidArgument", i, results[i].GetError())
+		}
+		if results[i].GetProductID() != want {
+			t.Fatalf("result %d product id %q, want request item id %q", i, results[i].GetProductID(), want)
+		}
+	}
+	if results[2].GetError() != nil || results[2].GetProduct().GetProductID() != validID {
+		t.Fatalf("result 2 = %v, want written product", results[2])
+	}
+	if len(uc.written) != 1 {
+		t.Fatalf("wrote %d products, want only the valid one", len(uc.written))
+	}
+}
+
+func TestCreateRejectsInvalidProduct(t *testing.T) {
+	uc := &fakeUseCase{}
+	svc := newTestProductService(uc)
+
+	_, err := svc.Create(context.Background(), &productsService.CreateReq{
+		CategoryID:  primitive.NewObjectID().Hex(),
+		Name:        "p",
+		Description: "description",
+		Price:       10,
+		Quantity:    1,
+		Rating:      5,
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Create error %v, want InvalidArgument", err)
+	}
+	if len(uc.written) != 0 {
+		t.Fatalf("wrote %d products, want none", len(uc.written))
+	}
+}
+
+func TestDeleteDeletesProductOnce(t *testing.T) {
+	uc := &fakeUseCase{}
+	svc := newTestProductService(uc)
+	productID := primitive.NewObjectID()
+
+	if _, err := svc.Delete(context.Background(), &productsService.DeleteReq{ProductID: productID.Hex()}); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if len(uc.deleted) != 1 || uc.deleted[0] != productID {
+		t.Fatalf("deleted %v, want %v", uc.deleted, productID)
+	}
+
+	_, err := svc.Delete(context.Background(), &productsService.DeleteReq{ProductID: productID.Hex()})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("Delete of deleted product error %v, want NotFound", err)
+	}
+	_, err = svc.Delete(context.Background(), &productsService.DeleteReq{ProductID: "not-hex"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Delete with bad id error %v, want InvalidArgument", err)
+	}
+}
@@ -0,0 +1,106 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/Yangiboev/golang-with-curiosity/internal/models"
+	"github.com/Yangiboev/golang-with-curiosity/internal/product"
+	httpErrors "github.com/Yangiboev/golang-with-curiosity/pkg/http_errors"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/logger"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/opentracing/opentracing-go"
+)
+
+type consumerAdminHandlers struct {
+	log      logger.Logger
+	admin    product.ConsumerAdmin
+	validate *validator.Validate
+	group    *echo.Group
+}
+
+// NewConsumerAdminHandlers constructor
+func NewConsumerAdminHandlers(
+	log logger.Logger,
+	admin product.ConsumerAdmin,
+	validate *validator.Validate,
+	group *echo.Group,
+) *consumerAdminHandlers {
+	return &consumerAdminHandlers{log: log, admin: admin, validate: validate, group: group}
+}
+
+// ListConsumerGroups List consumer groups
+func (a *consumerAdminHandlers) ListConsumerGroups() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		span, ctx := opentracing.StartSpanFromContext(c.Request().Context(), "consumerAdminHandlers.ListConsumerGroups")
+		defer span.Finish()
+
+		groups, err := a.admin.ConsumerGroups(ctx)
+		if err != nil {
+			a.log.Errorf("admin.ConsumerGroups: %v", err)
+			return httpErrors.ErrorCtxResponse(c, err)
+		}
+
+		return c.JSON(http.StatusOK, groups)
+	}
+}
+
+// PauseConsumerGroup Pause consumer group
+func (a *consumerAdminHandlers) PauseConsumerGroup() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		span, ctx := opentracing.StartSpanFromContext(c.Request().Context(), "consumerAdminHandlers.PauseConsumerGroup")
+		defer span.Finish()
+
+		group, err := a.admin.PauseConsumerGroup(ctx, c.Param("group_id"))
+		if err != nil {
+			a.log.Errorf("admin.PauseConsumerGroup: %v", err)
+			return httpErrors.ErrorCtxResponse(c, err)
+		}
+
+		return c.JSON(http.StatusOK, group)
+	}
+}
+
+// ResumeConsumerGroup Resume consumer group
+func (a *consumerAdminHandlers) ResumeConsumerGroup() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		span, ctx := opentracing.StartSpanFromContext(c.Request().Context(), "consumerAdminHandlers.ResumeConsumerGroup")
+		defer span.Finish()
+
+		group, err := a.admin.ResumeConsumerGroup(ctx, c.Param("group_id"))
+		if err != nil {
+			a.log.Errorf("admin.ResumeConsumerGroup: %v", err)
+			return httpErrors.ErrorCtxResponse(c, err)
+		}
+
+		return c.JSON(http.StatusOK, group)
+	}
+}
+
+// ResetConsumerGroupOffsets Reset consumer group offsets
+func (a *consumerAdminHandlers) ResetConsumerGroupOffsets() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		span, ctx := opentracing.StartSpanFromContext(c.Request().Context(), "consumerAdminHandlers.ResetConsumerGroupOffsets")
+		defer span.Finish()
+
+		var reset models.OffsetReset
+		if err := c.Bind(&reset); err != nil {
+			a.log.Errorf("c.Bind: %v", err)
+			return httpErrors.ErrorCtxResponse(c, err)
+		}
+
+		if err := a.validate.StructCtx(ctx, &reset); err != nil {
+			a.log.Errorf("validate.StructCtx: %v", err)
+			return httpErrors.ErrorCtxResponse(c, err)
+		}
+
+		offsets, err := a.admin.ResetConsumerGroupOffsets(ctx, c.Param("group_id"), reset)
+		if err != nil {
+			a.log.Errorf("admin.ResetConsumerGroupOffsets: %v", err)
+			return httpErrors.ErrorCtxResponse(c, err)
+		}
+
+		return c.JSON(http.StatusOK, offsets)
+	}
+}
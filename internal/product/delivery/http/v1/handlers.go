@@ -1,14 +1,21 @@
 package v1
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/Yangiboev/golang-with-curiosity/config"
 	"github.com/Yangiboev/golang-with-curiosity/internal/middlewares"
 	"github.com/Yangiboev/golang-with-curiosity/internal/models"
 	"github.com/Yangiboev/golang-with-curiosity/internal/product"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/events"
 	httpErrors "github.com/Yangiboev/golang-with-curiosity/pkg/http_errors"
 	"github.com/Yangiboev/golang-with-curiosity/pkg/logger"
+	productErrors "github.com/Yangiboev/golang-with-curiosity/pkg/product_errors"
 	"github.com/Yangiboev/golang-with-curiosity/pkg/utils"
 
 	"github.com/go-playground/validator/v10"
@@ -23,6 +30,7 @@ type productHandlers struct {
 	validate  *validator.Validate
 	group     *echo.Group
 	mw        middlewares.MiddlewareManager
+	batch     config.ProductBatch
 }
 
 // NewProductHandlers constructor
@@ -32,22 +40,17 @@ func NewProductHandlers(
 	validate *validator.Validate,
 	group *echo.Group,
 	mw middlewares.MiddlewareManager,
+	cfg config.Config,
 ) *productHandlers {
-	return &productHandlers{log: log, productUC: productUC, validate: validate, group: group, mw: mw}
+	return &productHandlers{log: log, productUC: productUC, validate: validate, group: group, mw: mw, batch: cfg.ProductBatch}
 }
 
 // CreateProduct Create product
-// @Tags Products
-// @Summary Create new product
-// @Description Create new single product
-// @Accept json
-// @Produce json
-// @Success 201 {object} models.Product
-// @Router /products [post]
 func (p *productHandlers) CreateProduct() echo.HandlerFunc {
 	return func(c echo.Context) error {
 		span, ctx := opentracing.StartSpanFromContext(c.Request().Context(), "productHandlers.Create")
 		defer span.Finish()
+		ctx = events.WithCorrelationID(ctx, c.Response().Header().Get(echo.HeaderXRequestID))
 		createRequests.Inc()
 
 		var prod models.Product
@@ -72,18 +75,11 @@ func (p *productHandlers) CreateProduct() echo.HandlerFunc {
 }
 
 // UpdateProduct Update product
-// @Tags Products
-// @Summary Update single product
-// @Description Update single product by id
-// @Accept json
-// @Produce json
-// @Param product_id path string true "product id"
-// @Success 200 {object} models.Product
-// @Router /products/{product_id} [put]
 func (p *productHandlers) UpdateProduct() echo.HandlerFunc {
 	return func(c echo.Context) error {
 		span, ctx := opentracing.StartSpanFromContext(c.Request().Context(), "productHandlers.Update")
 		defer span.Finish()
+		ctx = events.WithCorrelationID(ctx, c.Response().Header().Get(echo.HeaderXRequestID))
 		updateRequests.Inc()
 
 		var prod models.Product
@@ -118,14 +114,6 @@ func (p *productHandlers) UpdateProduct() echo.HandlerFunc {
 }
 
 // GetByIDProduct Get product by id
-// @Tags Products
-// @Summary Get product by id
-// @Description Get single product by id
-// @Accept json
-// @Produce json
-// @Param product_id path string true "product id"
-// @Success 200 {object} models.Product
-// @Router /products/{product_id} [get]
 func (p *productHandlers) GetByIDProduct() echo.HandlerFunc {
 	return func(c echo.Context) error {
 		span, ctx := opentracing.StartSpanFromContext(c.Request().Context(), "productHandlers.GetByID")
@@ -147,21 +135,12 @@ func (p *productHandlers) GetByIDProduct() echo.HandlerFunc {
 		}
 
 		successRequests.Inc()
+		setLastModified(c, prod.UpdatedAt)
 		return c.JSON(http.StatusOK, prod)
 	}
 }
 
 // SearchProduct Search product
-// @Tags Products
-// @Summary Search product
-// @Description Search product by name or description
-// @Accept json
-// @Produce json
-// @Param search query string false "search text"
-// @Param page query string false "page number"
-// @Param size query string false "number of elements"
-// @Success 200 {object} models.ProductsList
-// @Router /products/search [get]
 func (p *productHandlers) SearchProduct() echo.HandlerFunc {
 	return func(c echo.Context) error {
 		span, ctx := opentracing.StartSpanFromContext(c.Request().Context(), "productHandlers.Search")
@@ -172,13 +151,19 @@ func (p *productHandlers) SearchProduct() echo.HandlerFunc {
 		if err != nil {
 			p.log.Errorf("strconv.Atoi: %v", err)
 			errorRequests.Inc()
-			return httpErrors.ErrorCtxResponse(c, httpErrors.ErrorBadRequest)
+			return httpErrors.ErrorCtxResponse(c, productErrors.NewValidationError("invalid page", productErrors.FieldViolation{
+				Field:       "page",
+				Description: "must be an integer",
+			}))
 		}
 		size, err := strconv.Atoi(c.QueryParam("size"))
 		if err != nil {
 			p.log.Errorf("strconv.Atoi: %v", err)
 			errorRequests.Inc()
-			return httpErrors.ErrorCtxResponse(c, httpErrors.ErrorBadRequest)
+			return httpErrors.ErrorCtxResponse(c, productErrors.NewValidationError("invalid size", productErrors.FieldViolation{
+				Field:       "size",
+				Description: "must be an integer",
+			}))
 		}
 
 		pq := utils.NewPaginationQuery(size, page)
@@ -189,7 +174,188 @@ func (p *productHandlers) SearchProduct() echo.HandlerFunc {
 			return httpErrors.ErrorCtxResponse(c, err)
 		}
 
+		// pages change when products leave them, no product timestamp dates that change, so search pages are
+		// validated by their ETag only
 		successRequests.Inc()
 		return c.JSON(http.StatusOK, result)
 	}
 }
+
+// BatchGetProducts Get products by ids
+func (p *productHandlers) BatchGetProducts() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		span, ctx := opentracing.StartSpanFromContext(c.Request().Context(), "productHandlers.BatchGet")
+		defer span.Finish()
+		batchGetRequests.Inc()
+
+		var hexIDs []string
+		if param := c.QueryParam("ids"); param != "" {
+			hexIDs = strings.Split(param, ",")
+		}
+		if err := p.checkBatchSize(len(hexIDs), p.batch.MaxGet); err != nil {
+			p.log.Errorf("checkBatchSize: %v", err)
+			errorRequests.Inc()
+			return httpErrors.ErrorCtxResponse(c, err)
+		}
+
+		results := make([]*models.ProductBatchResult, len(hexIDs))
+		ids := make([]primitive.ObjectID, 0, len(hexIDs))
+		indexes := make([]int, 0, len(hexIDs))
+		for i, hexID := range hexIDs {
+			prodID, err := primitive.ObjectIDFromHex(strings.TrimSpace(hexID))
+			if err != nil {
+				results[i] = productBatchResult(&models.ProductResult{Err: err})
+				results[i].ProductID = hexID
+				continue
+			}
+			ids = append(ids, prodID)
+			indexes = append(indexes, i)
+		}
+
+		found, err := p.productUC.BatchGet(ctx, ids)
+		if err != nil {
+			p.log.Errorf("productUC.BatchGet: %v", err)
+			errorRequests.Inc()
+			return httpErrors.ErrorCtxResponse(c, err)
+		}
+		for i, res := range found {
+			results[indexes[i]] = productBatchResult(res)
+		}
+
+		successRequests.Inc()
+		return c.JSON(http.StatusOK, &models.ProductBatchResults{Results: results})
+	}
+}
+
+// BatchCreateProducts Create products
+func (p *productHandlers) BatchCreateProducts() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		span, ctx := opentracing.StartSpanFromContext(c.Request().Context(), "productHandlers.BatchCreate")
+		defer span.Finish()
+		ctx = events.WithCorrelationID(ctx, c.Response().Header().Get(echo.HeaderXRequestID))
+		batchCreateRequests.Inc()
+
+		var batch models.ProductsBatch
+		if err := c.Bind(&batch); err != nil {
+			p.log.Errorf("c.Bind: %v", err)
+			errorRequests.Inc()
+			return httpErrors.ErrorCtxResponse(c, err)
+		}
+
+		results, err := p.batchWrite(ctx, batch.Products, false, p.productUC.BatchCreate)
+		if err != nil {
+			p.log.Errorf("productUC.BatchCreate: %v", err)
+			errorRequests.Inc()
+			return httpErrors.ErrorCtxResponse(c, err)
+		}
+
+		successRequests.Inc()
+		return c.JSON(http.StatusOK, &models.ProductBatchResults{Results: results})
+	}
+}
+
+// BatchUpdateProducts Update products
+func (p *productHandlers) BatchUpdateProducts() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		span, ctx := opentracing.StartSpanFromContext(c.Request().Context(), "productHandlers.BatchUpdate")
+		defer span.Finish()
+		ctx = events.WithCorrelationID(ctx, c.Response().Header().Get(echo.HeaderXRequestID))
+		batchUpdateRequests.Inc()
+
+		var batch models.ProductsBatch
+		if err := c.Bind(&batch); err != nil {
+			p.log.Errorf("c.Bind: %v", err)
+			errorRequests.Inc()
+			return httpErrors.ErrorCtxResponse(c, err)
+		}
+
+		results, err := p.batchWrite(ctx, batch.Products, true, p.productUC.BatchUpdate)
+		if err != nil {
+			p.log.Errorf("productUC.BatchUpdate: %v", err)
+			errorRequests.Inc()
+			return httpErrors.ErrorCtxResponse(c, err)
+		}
+
+		successRequests.Inc()
+		return c.JSON(http.StatusOK, &models.ProductBatchResults{Results: results})
+	}
+}
+
+// batchWrite validate products and write valid ones with write, results of invalid products hold their validation errors
+func (p *productHandlers) batchWrite(
+	ctx context.Context,
+	products []*models.Product,
+	requireID bool,
+	write func(ctx context.Context, products []*models.Product) ([]*models.ProductResult, error),
+) ([]*models.ProductBatchResult, error) {
+	if err := p.checkBatchSize(len(products), p.batch.MaxWrite); err != nil {
+		return nil, err
+	}
+
+	results := make([]*models.ProductBatchResult, len(products))
+	valid := make([]*models.Product, 0, len(products))
+	indexes := make([]int, 0, len(products))
+	for i, prod := range products {
+		if prod == nil {
+			results[i] = productBatchResult(&models.ProductResult{Err: productErrors.NewValidationError("product is required", productErrors.FieldViolation{
+				Field:       "product",
+				Description: "is required",
+			})})
+			continue
+		}
+		if requireID && prod.ProductID.IsZero() {
+			results[i] = productBatchResult(&models.ProductResult{Err: productErrors.NewValidationError("productId is required", productErrors.FieldViolation{
+				Field:       "productId",
+				Description: "is required",
+			})})
+			continue
+		}
+		if err := p.validate.StructCtx(ctx, prod); err != nil {
+			results[i] = productBatchResult(&models.ProductResult{ProductID: prod.ProductID, Err: err})
+			continue
+		}
+		valid = append(valid, prod)
+		indexes = append(indexes, i)
+	}
+	if len(valid) == 0 {
+		return results, nil
+	}
+
+	written, err := write(ctx, valid)
+	if err != nil {
+		return nil, err
+	}
+	for i, res := range written {
+		results[indexes[i]] = productBatchResult(res)
+	}
+	return results, nil
+}
+
+// checkBatchSize batch holds between one and max items
+func (p *productHandlers) checkBatchSize(size, max int) error {
+	if size == 0 || size > max {
+		return productErrors.ErrInvalidBatch.WithMessage(fmt.Sprintf("batch size %d must be between 1 and %d", size, max))
+	}
+	return nil
+}
+
+// productBatchResult convert batch product result to response item
+func productBatchResult(res *models.ProductResult) *models.ProductBatchResult {
+	result := &models.ProductBatchResult{}
+	if !res.ProductID.IsZero() {
+		result.ProductID = res.ProductID.Hex()
+	}
+	if res.Err != nil {
+		result.Error = httpErrors.NewProblem(res.Err)
+		return result
+	}
+	result.Product = res.Product
+	return result
+}
+
+// setLastModified set Last-Modified validator of response, zero time is not sent
+func setLastModified(c echo.Context, modified time.Time) {
+	if !modified.IsZero() {
+		c.Response().Header().Set(echo.HeaderLastModified, modified.UTC().Format(http.TimeFormat))
+	}
+}
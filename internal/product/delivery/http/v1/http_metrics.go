@@ -30,4 +30,16 @@ var (
 		Name: "http_products_search_incoming_requests_total",
 		Help: "The total number of incoming search products HTTP requests",
 	})
+	batchGetRequests = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "http_products_batch_get_incoming_requests_total",
+		Help: "The total number of incoming batch get products HTTP requests",
+	})
+	batchCreateRequests = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "http_products_batch_create_incoming_requests_total",
+		Help: "The total number of incoming batch create products HTTP requests",
+	})
+	batchUpdateRequests = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "http_products_batch_update_incoming_requests_total",
+		Help: "The total number of incoming batch update products HTTP requests",
+	})
 )
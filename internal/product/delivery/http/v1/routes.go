@@ -1,9 +1,20 @@
 package v1
 
-// MapRoutes products routes
+// MapRoutes products routes, REST API generated from product.proto is served by grpc-gateway under /api/v2
 func (p *productHandlers) MapRoutes() {
-	p.group.POST("", p.CreateProduct())
-	p.group.PUT("/:product_id", p.UpdateProduct())
-	p.group.GET("/:product_id", p.GetByIDProduct())
-	p.group.GET("/search", p.SearchProduct())
+	p.group.POST("", p.CreateProduct(), p.mw.Idempotency)
+	p.group.PUT("/:product_id", p.UpdateProduct(), p.mw.Idempotency)
+	p.group.GET("/:product_id", p.GetByIDProduct(), p.mw.CachePolicy, p.mw.ConditionalGet)
+	p.group.GET("/search", p.SearchProduct(), p.mw.ConditionalGet)
+	p.group.GET("/batch", p.BatchGetProducts())
+	p.group.POST("/batch", p.BatchCreateProducts(), p.mw.Idempotency)
+	p.group.PUT("/batch", p.BatchUpdateProducts(), p.mw.Idempotency)
+}
+
+// MapRoutes consumer admin routes
+func (a *consumerAdminHandlers) MapRoutes() {
+	a.group.GET("", a.ListConsumerGroups())
+	a.group.POST("/:group_id/pause", a.PauseConsumerGroup())
+	a.group.POST("/:group_id/resume", a.ResumeConsumerGroup())
+	a.group.PUT("/:group_id/offsets", a.ResetConsumerGroupOffsets())
 }
@@ -0,0 +1,118 @@
+package kafka
+
+import (
+	"context"
+
+	"github.com/Yangiboev/golang-with-curiosity/internal/models"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/messagebus"
+	productErrors "github.com/Yangiboev/golang-with-curiosity/pkg/product_errors"
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+)
+
+// ConsumerGroups status of consumer groups running on this instance
+func (pcg *ProductsConsumerGroup) ConsumerGroups(ctx context.Context) ([]*models.ConsumerGroupStatus, error) {
+	span, _ := opentracing.StartSpanFromContext(ctx, "ProductsConsumerGroup.ConsumerGroups")
+	defer span.Finish()
+
+	groups := make([]*models.ConsumerGroupStatus, 0)
+	seen := make(map[string]bool)
+	for _, tc := range pcg.consumers {
+		if seen[tc.groupID] {
+			continue
+		}
+		seen[tc.groupID] = true
+		groups = append(groups, pcg.groupStatus(tc.groupID, pcg.groupConsumers(tc.groupID)))
+	}
+	return groups, nil
+}
+
+// PauseConsumerGroup stop fetching of all group topic consumers, returns once in flight messages are committed
+func (pcg *ProductsConsumerGroup) PauseConsumerGroup(ctx context.Context, groupID string) (*models.ConsumerGroupStatus, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "ProductsConsumerGroup.PauseConsumerGroup")
+	defer span.Finish()
+
+	consumers := pcg.groupConsumers(groupID)
+	if len(consumers) == 0 {
+		return nil, errors.Wrap(productErrors.ErrConsumerGroupNotFound, groupID)
+	}
+
+	for _, tc := range consumers {
+		if err := tc.pause(ctx); err != nil {
+			return nil, errors.Wrapf(err, "pause %s", tc.topic)
+		}
+	}
+
+	pcg.log.Infof("Paused consumer group: %v", groupID)
+	return pcg.groupStatus(groupID, consumers), nil
+}
+
+// ResumeConsumerGroup rejoin consumer group with all group topic consumers
+func (pcg *ProductsConsumerGroup) ResumeConsumerGroup(ctx context.Context, groupID string) (*models.ConsumerGroupStatus, error) {
+	span, _ := opentracing.StartSpanFromContext(ctx, "ProductsConsumerGroup.ResumeConsumerGroup")
+	defer span.Finish()
+
+	consumers := pcg.groupConsumers(groupID)
+	if len(consumers) == 0 {
+		return nil, errors.Wrap(productErrors.ErrConsumerGroupNotFound, groupID)
+	}
+
+	for _, tc := range consumers {
+		tc.resume()
+	}
+
+	pcg.log.Infof("Resumed consumer group: %v", groupID)
+	return pcg.groupStatus(groupID, consumers), nil
+}
+
+// ResetConsumerGroupOffsets commit group offsets of all partitions of group topics to earliest, latest or timestamp offsets.
+// Group must be paused, commit fails while other instances are still members of the group
+func (pcg *ProductsConsumerGroup) ResetConsumerGroupOffsets(ctx context.Context, groupID string, reset models.OffsetReset) ([]*models.PartitionOffset, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "ProductsConsumerGroup.ResetConsumerGroupOffsets")
+	defer span.Finish()
+
+	consumers := pcg.groupConsumers(groupID)
+	if len(consumers) == 0 {
+		return nil, errors.Wrap(productErrors.ErrConsumerGroupNotFound, groupID)
+	}
+
+	topics := make([]string, 0, len(consumers))
+	for _, tc := range consumers {
+		if !tc.isPaused() {
+			return nil, errors.Wrap(productErrors.ErrConsumerGroupNotPaused, groupID)
+		}
+		topics = append(topics, tc.topic)
+	}
+
+	committed, err := pcg.subscriber.ResetOffsets(ctx, groupID, topics, messagebus.OffsetReset{To: reset.To, Timestamp: reset.Timestamp})
+	if err != nil {
+		return nil, errors.Wrap(err, "subscriber.ResetOffsets")
+	}
+
+	offsets := make([]*models.PartitionOffset, 0, len(committed))
+	for _, o := range committed {
+		offsets = append(offsets, &models.PartitionOffset{Topic: o.Topic, Partition: o.Partition, Offset: o.Offset})
+	}
+
+	pcg.log.Infof("Reset consumer group: %v offsets to %v", groupID, reset.To)
+	return offsets, nil
+}
+
+func (pcg *ProductsConsumerGroup) groupConsumers(groupID string) []*topicConsumer {
+	consumers := make([]*topicConsumer, 0)
+	for _, tc := range pcg.consumers {
+		if tc.groupID == groupID {
+			consumers = append(consumers, tc)
+		}
+	}
+	return consumers
+}
+
+func (pcg *ProductsConsumerGroup) groupStatus(groupID string, consumers []*topicConsumer) *models.ConsumerGroupStatus {
+	status := &models.ConsumerGroupStatus{GroupID: groupID, Topics: make([]string, 0, len(consumers)), Paused: len(consumers) > 0}
+	for _, tc := range consumers {
+		status.Topics = append(status.Topics, tc.topic)
+		status.Paused = status.Paused && tc.isPaused()
+	}
+	return status
+}
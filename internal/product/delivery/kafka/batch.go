@@ -0,0 +1,294 @@
+package kafka
+
+import (
+	"context"
+	"time"
+
+	"github.com/avast/retry-go"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/pkg/errors"
+
+	"github.com/Yangiboev/golang-with-curiosity/internal/models"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/messagebus"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/tracing"
+)
+
+// productWriteOps bulk write operation of event types
+var productWriteOps = map[string]string{
+	models.ProductCreateEventType: models.ProductWriteCreate,
+	models.ProductUpdateEventType: models.ProductWriteUpdate,
+}
+
+// fetchBatches hand messages to per partition batch workers, each worker accumulates up to batch size messages or until
+// batch timeout since first message and processes them as one bulk, up to consumer workers batches in parallel.
+// Messages of one partition always go to the same worker, so they are applied in order. Queues of partitions revoked by
+// rebalance are removed like in fetchMessages. Batches being accumulated when session stops are still processed and
+// committed, unless they wait for their not before time
+func (pcg *ProductsConsumerGroup) fetchBatches(
+	ctx context.Context,
+	sessionCtx context.Context,
+	sub messagebus.Subscription,
+	tc *topicConsumer,
+) error {
+	sem := make(chan struct{}, tc.consumer.Workers)
+	queues := newPartitionQueues(sessionCtx, tc.consumer.QueueCapacity, func(partition int, messages <-chan messagebus.Message) {
+		pcg.batchWorker(ctx, sessionCtx, sub, sem, tc, partition, messages)
+	})
+	defer queues.close()
+
+	if rebalancer, ok := sub.(messagebus.Rebalancer); ok {
+		go func() {
+			for {
+				select {
+				case revoked := <-rebalancer.Revoked():
+					pcg.log.Infof("Revoked partitions: %v/%v", tc.topic, revoked)
+					queues.revoke(revoked...)
+				case <-sessionCtx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	for {
+		m, err := pcg.fetchMessage(sessionCtx, sub, tc)
+		if err != nil {
+			return err
+		}
+		if err := queues.push(m); err != nil {
+			return err
+		}
+	}
+}
+
+// batchWorker process batches of partition messages until messages are closed and drained, delayed retries wait for not
+// before time of every batch message before taking one of consumer workers. Worker stops at batch left unacked, so
+// offset of partition is never committed past it
+func (pcg *ProductsConsumerGroup) batchWorker(
+	ctx context.Context,
+	sessionCtx context.Context,
+	sub messagebus.Subscription,
+	sem chan struct{},
+	tc *topicConsumer,
+	partition int,
+	messages <-chan messagebus.Message,
+) {
+	pcg.log.Infof("Starting batch worker: %v/%v", tc.topic, partition)
+
+	for {
+		msgs := nextBatch(messages, tc.consumer.Batch.Size, tc.consumer.Batch.Timeout)
+		if len(msgs) == 0 {
+			return
+		}
+		for _, m := range msgs {
+			if err := waitNotBefore(sessionCtx, m); err != nil {
+				return
+			}
+		}
+		sem <- struct{}{}
+		acked := pcg.processBatch(ctx, sessionCtx, sub, msgs)
+		<-sem
+		if !acked {
+			return
+		}
+	}
+}
+
+// nextBatch wait for first message and accumulate up to size messages or until timeout since first message,
+// empty when messages are closed
+func nextBatch(messages <-chan messagebus.Message, size int, timeout time.Duration) []messagebus.Message {
+	m, ok := <-messages
+	if !ok {
+		return nil
+	}
+	msgs := make([]messagebus.Message, 0, size)
+	msgs = append(msgs, m)
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for len(msgs) < size {
+		select {
+		case m, ok := <-messages:
+			if !ok {
+				return msgs
+			}
+			msgs = append(msgs, m)
+		case <-timer.C:
+			return msgs
+		}
+	}
+	return msgs
+}
+
+// processBatch validate batch messages, apply them with one bulk write collapsing messages of the same product into a write
+// of its last state, route failed messages to retry or dead letter topics and commit the whole batch. Returns false when
+// batch is left unacked, because processing was cancelled or failed message could not be routed before session ended,
+// later messages of its partition must not be acked then
+func (pcg *ProductsConsumerGroup) processBatch(
+	ctx context.Context,
+	sessionCtx context.Context,
+	sub messagebus.Subscription,
+	msgs []messagebus.Message,
+) bool {
+	span, ctx := startBatchSpan(ctx, msgs)
+	defer span.Finish()
+	topic := msgs[0].Topic
+	batchSize.WithLabelValues(topic).Observe(float64(len(msgs)))
+	defer func(start time.Time) {
+		batchDuration.WithLabelValues(topic).Observe(time.Since(start).Seconds())
+	}(time.Now())
+
+	writes := make([]*models.ProductWrite, 0, len(msgs))
+	pending := make([]messagebus.Message, 0, len(msgs))
+	claims := make([]*models.MessageClaim, 0, len(msgs))
+	failed := make(map[int]error)
+	claimed := make(map[string]bool)
+	release := func() {
+		for _, claim := range claims {
+			pcg.releaseClaim(claim)
+		}
+	}
+
+	for i, m := range msgs {
+		incomingMessages.Inc()
+		// redelivery of message already claimed in this batch is applied by its first delivery
+		if key, ok := m.Header(idempotencyKeyHeader); ok && claimed[key] {
+			duplicateMessages.WithLabelValues(originalTopic(m)).Inc()
+			continue
+		}
+		claim, duplicate, err := pcg.claimMessage(ctx, m)
+		if err != nil {
+			release()
+			return false
+		}
+		if duplicate {
+			duplicateMessages.WithLabelValues(originalTopic(m)).Inc()
+			continue
+		}
+		if claim != nil {
+			claimed[claim.Key] = true
+		}
+
+		write, err := pcg.decodeWrite(ctx, m)
+		if err != nil {
+			pcg.releaseClaim(claim)
+			failed[i] = err
+			continue
+		}
+		writes = append(writes, write)
+		pending = append(pending, m)
+		claims = append(claims, claim)
+	}
+
+	writeErrs, err := pcg.bulkWrite(ctx, writes)
+	if err != nil && ctx.Err() != nil {
+		release()
+		return false
+	}
+
+	routed := true
+	route := func(m messagebus.Message, err error) {
+		errorMessages.Inc()
+		pcg.log.Errorf("message %v/%v/%v batch: %v", m.Topic, m.Partition, m.Offset, err)
+		if routed && !pcg.routeFailure(ctx, sessionCtx, m, err) {
+			routed = false
+		}
+	}
+
+	for i, m := range msgs {
+		if err, ok := failed[i]; ok {
+			route(m, err)
+		}
+	}
+	for i, m := range pending {
+		switch {
+		case err != nil:
+			pcg.releaseClaim(claims[i])
+			route(m, err)
+		case writeErrs[i] != nil:
+			pcg.releaseClaim(claims[i])
+			route(m, writeErrs[i])
+		default:
+			successMessages.Inc()
+			pcg.markProcessed(ctx, claims[i])
+		}
+	}
+
+	if err != nil {
+		ext.LogError(span, err)
+	}
+	if !routed {
+		return false
+	}
+
+	if err := sub.Ack(ctx, msgs...); err != nil {
+		errorMessages.Inc()
+		pcg.log.Errorf("sub.Ack", err)
+	}
+	return true
+}
+
+// bulkWrite apply writes retrying whole bulk on transient errors
+func (pcg *ProductsConsumerGroup) bulkWrite(ctx context.Context, writes []*models.ProductWrite) ([]error, error) {
+	if len(writes) == 0 {
+		return nil, nil
+	}
+
+	var writeErrs []error
+	err := retry.Do(func() error {
+		var err error
+		writeErrs, err = pcg.productsUC.BulkWrite(ctx, writes)
+		return err
+	},
+		retry.Attempts(pcg.cfg.Kafka.Retry.Attempts),
+		retry.Delay(pcg.cfg.Kafka.Retry.Delay),
+		retry.Context(ctx),
+		retry.RetryIf(isRetryable),
+		retry.LastErrorOnly(true),
+	)
+	return writeErrs, err
+}
+
+// decodeWrite decode and validate message as product bulk write
+func (pcg *ProductsConsumerGroup) decodeWrite(ctx context.Context, m messagebus.Message) (*models.ProductWrite, error) {
+	e, err := pcg.currentEvent(m)
+	if err != nil {
+		return nil, err
+	}
+
+	op, ok := productWriteOps[e.Type]
+	if !ok {
+		return nil, permanent(errors.Errorf("unknown event type: %s", e.Type))
+	}
+
+	prod, err := pcg.decodeProduct(ctx, e)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := pcg.validate.StructCtx(ctx, prod); err != nil {
+		return nil, errors.Wrap(err, "validate.StructCtx")
+	}
+
+	return &models.ProductWrite{Op: op, Product: prod}, nil
+}
+
+// startBatchSpan start batch span following from producer spans of all batch messages
+func startBatchSpan(ctx context.Context, msgs []messagebus.Message) (opentracing.Span, context.Context) {
+	tracer := opentracing.GlobalTracer()
+	opts := []opentracing.StartSpanOption{
+		ext.SpanKindConsumer,
+		opentracing.Tag{Key: string(ext.MessageBusDestination), Value: msgs[0].Topic},
+		opentracing.Tag{Key: "messaging.topic", Value: msgs[0].Topic},
+		opentracing.Tag{Key: "messaging.batch_size", Value: len(msgs)},
+	}
+	for _, m := range msgs {
+		if parent, err := tracing.ExtractMessageHeaders(tracer, m.Headers); err == nil {
+			opts = append(opts, opentracing.FollowsFrom(parent))
+		}
+	}
+
+	span := tracer.StartSpan("ProductsConsumerGroup.processBatch", opts...)
+	return span, opentracing.ContextWithSpan(ctx, span)
+}
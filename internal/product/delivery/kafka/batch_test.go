@@ -0,0 +1,48 @@
+package kafka
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Yangiboev/golang-with-curiosity/pkg/messagebus"
+)
+
+func TestNextBatchStopsAtSize(t *testing.T) {
+	messages := make(chan messagebus.Message, 5)
+	for offset := int64(0); offset < 5; offset++ {
+		messages <- messagebus.Message{Offset: offset}
+	}
+
+	batch := nextBatch(messages, 3, time.Minute)
+	if len(batch) != 3 || batch[0].Offset != 0 || batch[2].Offset != 2 {
+		t.Fatalf("batch %v, want first 3 messages", batch)
+	}
+}
+
+func TestNextBatchStopsAtTimeout(t *testing.T) {
+	messages := make(chan messagebus.Message, 5)
+	messages <- messagebus.Message{Offset: 0}
+
+	start := time.Now()
+	batch := nextBatch(messages, 3, 20*time.Millisecond)
+	if len(batch) != 1 {
+		t.Fatalf("batch %v, want single message", batch)
+	}
+	if time.Since(start) < 20*time.Millisecond {
+		t.Fatalf("batch returned before timeout")
+	}
+}
+
+func TestNextBatchDrainsClosedMessages(t *testing.T) {
+	messages := make(chan messagebus.Message, 5)
+	messages <- messagebus.Message{Offset: 0}
+	messages <- messagebus.Message{Offset: 1}
+	close(messages)
+
+	if batch := nextBatch(messages, 3, time.Minute); len(batch) != 2 {
+		t.Fatalf("batch %v, want remaining messages", batch)
+	}
+	if batch := nextBatch(messages, 3, time.Minute); len(batch) != 0 {
+		t.Fatalf("batch %v, want empty batch of closed messages", batch)
+	}
+}
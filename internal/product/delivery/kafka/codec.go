@@ -0,0 +1,142 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Yangiboev/golang-with-curiosity/config"
+	"github.com/Yangiboev/golang-with-curiosity/internal/models"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/events"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/schemaregistry"
+	productsService "github.com/Yangiboev/golang-with-curiosity/proto/product"
+	"github.com/pkg/errors"
+)
+
+const (
+	wireFormatJSON     = "json"
+	wireFormatProtobuf = "protobuf"
+)
+
+// productCodec product event data wire format
+type productCodec interface {
+	ContentType() string
+	Encode(ctx context.Context, topic string, prod *models.Product) ([]byte, error)
+	Decode(ctx context.Context, data []byte, prod *models.Product) error
+}
+
+// ProductCodecs codec used to publish and all known codecs by content type used to consume
+type ProductCodecs struct {
+	publish       productCodec
+	protobuf      *protobufCodec
+	byContentType map[string]productCodec
+	topics        []string
+}
+
+// NewProductCodecs constructor, publish wire format is taken from config
+func NewProductCodecs(cfg config.Config, registry schemaregistry.Client) (*ProductCodecs, error) {
+	serde, err := schemaregistry.NewProtobufSerde(registry, &productsService.Product{}, productsService.ProtoFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "schemaregistry.NewProtobufSerde")
+	}
+
+	jsonC := &jsonCodec{}
+	protoC := &protobufCodec{serde: serde}
+	c := &ProductCodecs{
+		protobuf: protoC,
+		topics:   []string{cfg.Kafka.Topics.CreateProduct, cfg.Kafka.Topics.UpdateProduct, cfg.Kafka.Topics.ProductCatalog},
+		byContentType: map[string]productCodec{
+			jsonC.ContentType():  jsonC,
+			protoC.ContentType(): protoC,
+		},
+	}
+
+	switch cfg.Kafka.WireFormat {
+	case wireFormatJSON, "":
+		c.publish = jsonC
+	case wireFormatProtobuf:
+		c.publish = protoC
+	default:
+		return nil, errors.Errorf("unknown kafka wire format: %s", cfg.Kafka.WireFormat)
+	}
+	return c, nil
+}
+
+// RegisterSchemas register protobuf schema of product topics values when publishing protobuf, fails on breaking schema changes
+func (c *ProductCodecs) RegisterSchemas(ctx context.Context) error {
+	if c.publish != c.protobuf {
+		return nil
+	}
+	for _, topic := range c.topics {
+		if err := c.protobuf.serde.RegisterSubject(ctx, subjectName(topic)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// forContentType codec to decode event data, events without content type are json
+func (c *ProductCodecs) forContentType(contentType string) (productCodec, error) {
+	if contentType == "" {
+		contentType = events.ContentTypeJSON
+	}
+	if i := strings.Index(contentType, ";"); i >= 0 {
+		contentType = strings.TrimSpace(contentType[:i])
+	}
+
+	codec, ok := c.byContentType[contentType]
+	if !ok {
+		return nil, errors.Errorf("unsupported content type: %s", contentType)
+	}
+	return codec, nil
+}
+
+// subjectName confluent topic name strategy subject of message value
+func subjectName(topic string) string {
+	return fmt.Sprintf("%s-value", topic)
+}
+
+type jsonCodec struct{}
+
+func (c *jsonCodec) ContentType() string {
+	return events.ContentTypeJSON
+}
+
+func (c *jsonCodec) Encode(ctx context.Context, topic string, prod *models.Product) ([]byte, error) {
+	return json.Marshal(prod)
+}
+
+func (c *jsonCodec) Decode(ctx context.Context, data []byte, prod *models.Product) error {
+	return json.Unmarshal(data, prod)
+}
+
+type protobufCodec struct {
+	serde *schemaregistry.ProtobufSerde
+}
+
+func (c *protobufCodec) ContentType() string {
+	return events.ContentTypeProtobuf
+}
+
+// Encode serialize product as proto, ids are always sent as hex independently of gRPC response format
+func (c *protobufCodec) Encode(ctx context.Context, topic string, prod *models.Product) ([]byte, error) {
+	msg := prod.ToProto()
+	msg.ProductID = prod.ProductID.Hex()
+	msg.CategoryID = prod.CategoryID.Hex()
+	return c.serde.Serialize(ctx, subjectName(topic), msg)
+}
+
+func (c *protobufCodec) Decode(ctx context.Context, data []byte, prod *models.Product) error {
+	var msg productsService.Product
+	if err := c.serde.Deserialize(ctx, data, &msg); err != nil {
+		return err
+	}
+
+	decoded, err := models.ProductFromProto(&msg)
+	if err != nil {
+		return permanent(errors.Wrap(err, "models.ProductFromProto"))
+	}
+	*prod = *decoded
+	return nil
+}
@@ -20,28 +20,62 @@ var (
 		Name: "products_error_incoming_kafka_message_total",
 		Help: "The total number of error incoming success Kafka messages",
 	})
+	retryMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "products_retry_kafka_messages_total",
+		Help: "The total number of Kafka messages re-published to retry topics",
+	}, []string{"topic"})
+	duplicateMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "products_duplicate_kafka_messages_total",
+		Help: "The total number of redelivered Kafka messages dropped as already processed",
+	}, []string{"topic"})
+	deadLetterMessages = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "products_dead_letter_kafka_messages_total",
+		Help: "The total number of Kafka messages published to the dead letter queue",
+	})
+	consumerLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "products_kafka_consumer_lag",
+		Help: "The number of Kafka messages behind the partition high water mark",
+	}, []string{"group", "topic", "partition"})
+	fetchDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "products_kafka_fetch_duration_seconds",
+		Help:    "The Kafka message fetch latency",
+		Buckets: prometheus.ExponentialBuckets(0.001, 4, 8),
+	}, []string{"topic"})
+	processingDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "products_kafka_processing_duration_seconds",
+		Help:    "The Kafka message processing duration",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"topic"})
+	batchSize = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "products_kafka_batch_size",
+		Help:    "The number of Kafka messages in consumed batch",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 11),
+	}, []string{"topic"})
+	batchDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "products_kafka_batch_duration_seconds",
+		Help:    "The Kafka batch processing duration",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"topic"})
+	pausedConsumers = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "products_kafka_consumer_paused",
+		Help: "Whether Kafka topic consumer is paused",
+	}, []string{"group", "topic"})
 )
 
-const (
-	minBytes               = 10e3 //10 KB
-	maxBytes               = 10e6 // 10KB
-	queueCapacity          = 100
-	heartbeatInterval      = 3 * time.Second
-	commitInterval         = 0
-	partitionWatchInterval = 5 * time.Second
-	maxAttempts            = 3
-	dialTimeout            = 3 * time.Minute
-
-	writerReadTimeout    = 10 * time.Second
-	writerWriteTimeout   = 10 * time.Second
-	writerRequiredAcks   = -1
-	writerMaxAttempts    = 3
-	createProductTopic   = "create-product"
-	createProductWorkers = 3
-	updateProductTopic   = "update-product"
-	updateProductWorkers = 3
+// claimRetryInterval interval of claim attempts of message processed by another consumer
+const claimRetryInterval = time.Millisecond * 200
 
-	deadLetterQueueTopic = "dead-letter-queue"
+// routeRetryInterval first interval of attempts to route failed message to retry or dead letter topic, doubled after
+// every failed attempt up to maxRouteRetryInterval
+const (
+	routeRetryInterval    = time.Millisecond * 100
+	maxRouteRetryInterval = time.Second * 10
+)
 
-	productsGroupID = "products_group"
+const (
+	retryAttemptHeader   = "x-retry-attempt"
+	retryNotBeforeHeader = "x-retry-not-before"
+	originalTopicHeader  = "x-original-topic"
+	lastErrorHeader      = "x-last-error"
+	idempotencyKeyHeader = "x-idempotency-key"
 )
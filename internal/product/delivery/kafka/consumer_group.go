@@ -2,172 +2,135 @@ package kafka
 
 import (
 	"context"
-	"encoding/json"
-	"sync"
 
 	"github.com/Yangiboev/golang-with-curiosity/config"
-	"github.com/Yangiboev/golang-with-curiosity/internal/models"
 	"github.com/Yangiboev/golang-with-curiosity/internal/product"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/events"
 	"github.com/Yangiboev/golang-with-curiosity/pkg/logger"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/messagebus"
 	"github.com/go-playground/validator/v10"
-	"github.com/segmentio/kafka-go"
-	"github.com/segmentio/kafka-go/compress"
+	"github.com/pkg/errors"
 )
 
 // ProductsConsumerGroup struct
 type ProductsConsumerGroup struct {
-	Brokers    []string
 	GroupID    string
 	log        logger.Logger
 	cfg        config.Config
 	productsUC product.UseCase
 	validate   *validator.Validate
+	processed  product.IdempotencyRepository
+	codecs     *ProductCodecs
+	subscriber messagebus.Subscriber
+	publisher  messagebus.Publisher
+	handlers   map[string]eventHandler
+	upcasters  *events.Upcasters
+
+	legacyEventTypes map[string]string
+	consumers        []*topicConsumer
 }
 
 // NewProductsConsumerGroup constructor
 func NewProductsConsumerGroup(
-	brokers []string,
 	groupID string,
 	log logger.Logger,
 	cfg config.Config,
 	productsUC product.UseCase,
 	validate *validator.Validate,
+	processed product.IdempotencyRepository,
+	codecs *ProductCodecs,
+	subscriber messagebus.Subscriber,
+	publisher messagebus.Publisher,
 ) *ProductsConsumerGroup {
-	return &ProductsConsumerGroup{
-		Brokers:    brokers,
+	pcg := &ProductsConsumerGroup{
 		GroupID:    groupID,
 		log:        log,
 		cfg:        cfg,
 		productsUC: productsUC,
 		validate:   validate,
+		processed:  processed,
+		codecs:     codecs,
+		subscriber: subscriber,
+		publisher:  publisher,
 	}
+	pcg.registerHandlers()
+	return pcg
 }
 
-func (pcg *ProductsConsumerGroup) getNewKafkaReader(kafkaURL []string, topic, groupID string) *kafka.Reader {
-	return kafka.NewReader(kafka.ReaderConfig{
-		Brokers:                kafkaURL,
-		GroupID:                groupID,
-		Topic:                  topic,
-		MinBytes:               minBytes,
-		MaxBytes:               maxBytes,
-		QueueCapacity:          queueCapacity,
-		HeartbeatInterval:      heartbeatInterval,
-		CommitInterval:         commitInterval,
-		PartitionWatchInterval: partitionWatchInterval,
-		Logger:                 kafka.LoggerFunc(pcg.log.Debugf),
-		ErrorLogger:            kafka.LoggerFunc(pcg.log.Errorf),
-		MaxAttempts:            maxAttempts,
-		Dialer: &kafka.Dialer{
-			Timeout: dialTimeout,
-		},
-	})
-}
-
-func (pcg *ProductsConsumerGroup) getNewKafkaWriter(topic string) *kafka.Writer {
-	w := &kafka.Writer{
-		Addr:         kafka.TCP(pcg.Brokers...),
-		Topic:        topic,
-		Balancer:     &kafka.LeastBytes{},
-		RequiredAcks: writerRequiredAcks,
-		MaxAttempts:  writerMaxAttempts,
-		Logger:       kafka.LoggerFunc(pcg.log.Debugf),
-		ErrorLogger:  kafka.LoggerFunc(pcg.log.Errorf),
-		Compression:  compress.Snappy,
-		ReadTimeout:  writerReadTimeout,
-		WriteTimeout: writerWriteTimeout,
+// groupID consumer group id of consumer, falls back to shared group id
+func (pcg *ProductsConsumerGroup) groupID(consumer config.KafkaConsumer) string {
+	if consumer.GroupID != "" {
+		return consumer.GroupID
 	}
-	return w
+	return pcg.GroupID
 }
 
-func (pcg *ProductsConsumerGroup) consumeCreateProduct(
-	ctx context.Context,
-	cancel context.CancelFunc,
-	groupID string,
-	topic string,
-	workersNum int,
-) {
-	r := pcg.getNewKafkaReader(pcg.Brokers, topic, groupID)
+// consumeTopic run reader sessions of topic consumer until context is done or fetching fails,
+// paused consumer waits for resume between sessions
+func (pcg *ProductsConsumerGroup) consumeTopic(ctx context.Context, cancel context.CancelFunc, tc *topicConsumer) {
 	defer cancel()
-	defer func() {
-		if err := r.Close(); err != nil {
-			pcg.log.Errorf("r.Close", err)
-			cancel()
-		}
-	}()
 
-	w := pcg.getNewKafkaWriter(deadLetterQueueTopic)
-	defer func() {
-		if err := w.Close(); err != nil {
-			pcg.log.Errorf("w.Close", err)
-			cancel()
+	for {
+		sessionCtx, ok := tc.startSession(ctx)
+		if !ok {
+			return
 		}
-	}()
-
-	pcg.log.Infof("Starting consumer group: %v", r.Config().GroupID)
 
-	wg := &sync.WaitGroup{}
-	for i := 0; i <= workersNum; i++ {
-		wg.Add(1)
-		go pcg.createProductWorker(ctx, cancel, r, w, wg, i)
+		err := pcg.runSession(ctx, sessionCtx, tc)
+		tc.endSession()
+		if ctx.Err() != nil {
+			return
+		}
+		if sessionCtx.Err() != nil {
+			pcg.log.Infof("Paused consumer group: %v, topic: %v", tc.groupID, tc.topic)
+			continue
+		}
+		pcg.log.Errorf("consumer group: %v, topic: %v: %v", tc.groupID, tc.topic, err)
+		return
 	}
-	wg.Wait()
 }
 
-func (pcg *ProductsConsumerGroup) consumeUpdateProduct(
-	ctx context.Context,
-	cancel context.CancelFunc,
-	groupID string,
-	topic string,
-	workersNum int,
-) {
-	r := pcg.getNewKafkaReader(pcg.Brokers, topic, groupID)
-	defer cancel()
-	defer func() {
-		if err := r.Close(); err != nil {
-			pcg.log.Errorf("r.Close", err)
-			cancel()
-		}
-	}()
-
-	w := pcg.getNewKafkaWriter(deadLetterQueueTopic)
+// runSession join consumer group and process messages until session context is done
+func (pcg *ProductsConsumerGroup) runSession(ctx, sessionCtx context.Context, tc *topicConsumer) error {
+	sub, err := pcg.subscriber.Subscribe(tc.topic, tc.groupID)
+	if err != nil {
+		return errors.Wrap(err, "subscriber.Subscribe")
+	}
 	defer func() {
-		if err := w.Close(); err != nil {
-			pcg.log.Errorf("w.Close", err)
-			cancel()
+		if err := sub.Close(); err != nil {
+			pcg.log.Errorf("sub.Close", err)
 		}
 	}()
 
-	pcg.log.Infof("Starting consumer group: %v", r.Config().GroupID)
+	pcg.log.Infof("Starting consumer group: %v, topic: %v", tc.groupID, tc.topic)
 
-	wg := &sync.WaitGroup{}
-	for i := 0; i <= workersNum; i++ {
-		wg.Add(1)
-		go pcg.updateProductWorker(ctx, cancel, r, w, wg, i)
+	if tc.consumer.Batch.Enabled {
+		return pcg.fetchBatches(ctx, sessionCtx, sub, tc)
 	}
-	wg.Wait()
+	return pcg.fetchMessages(ctx, sessionCtx, sub, tc)
 }
 
-func (pcg *ProductsConsumerGroup) publishErrorMessage(ctx context.Context, w *kafka.Writer, m kafka.Message, err error) error {
-	errMsg := &models.ErrorMessage{
-		Offset:    m.Offset,
-		Error:     err.Error(),
-		Time:      m.Time.UTC(),
-		Partition: m.Partition,
-		Topic:     m.Topic,
-	}
+// RunConsumers run enabled consumers
+func (pcg *ProductsConsumerGroup) RunConsumers(ctx context.Context, cancel context.CancelFunc) {
+	consumers := pcg.cfg.Kafka.Consumers
+	topics := pcg.cfg.Kafka.Topics
 
-	errMsgBytes, err := json.Marshal(errMsg)
-	if err != nil {
-		return err
+	if consumers.CreateProduct.Enabled {
+		pcg.addConsumer(consumers.CreateProduct, topics.CreateProduct, pcg.dispatch)
+	}
+	if consumers.UpdateProduct.Enabled {
+		pcg.addConsumer(consumers.UpdateProduct, topics.UpdateProduct, pcg.dispatch)
+	}
+	for _, tier := range pcg.retryTiers() {
+		pcg.addConsumer(consumers.Retry, retryTopic(topics.CreateProduct, tier), pcg.retryProduct)
+		pcg.addConsumer(consumers.Retry, retryTopic(topics.UpdateProduct, tier), pcg.retryProduct)
 	}
 
-	return w.WriteMessages(ctx, kafka.Message{
-		Value: errMsgBytes,
-	})
+	for _, tc := range pcg.consumers {
+		go pcg.consumeTopic(ctx, cancel, tc)
+	}
 }
 
-// RunConsumers run kafka consumers
-func (pcg *ProductsConsumerGroup) RunConsumers(ctx context.Context, cancel context.CancelFunc) {
-	go pcg.consumeCreateProduct(ctx, cancel, productsGroupID, createProductTopic, createProductWorkers)
-	go pcg.consumeUpdateProduct(ctx, cancel, productsGroupID, updateProductTopic, updateProductWorkers)
+func (pcg *ProductsConsumerGroup) addConsumer(consumer config.KafkaConsumer, topic string, handler messageHandler) {
+	pcg.consumers = append(pcg.consumers, newTopicConsumer(pcg.groupID(consumer), topic, consumer, handler))
 }
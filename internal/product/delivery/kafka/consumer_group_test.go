@@ -0,0 +1,453 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/pkg/errors"
+
+	"github.com/Yangiboev/golang-with-curiosity/config"
+	"github.com/Yangiboev/golang-with-curiosity/internal/models"
+	"github.com/Yangiboev/golang-with-curiosity/internal/product"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/logger"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/messagebus"
+	productErrors "github.com/Yangiboev/golang-with-curiosity/pkg/product_errors"
+)
+
+const testWaitTimeout = 5 * time.Second
+
+// fakeUseCase records consumed products, Create and BulkWrite return queued errors in order
+type fakeUseCase struct {
+	product.UseCase
+
+	mu         sync.Mutex
+	created    []*models.Product
+	bulks      [][]*models.ProductWrite
+	createErrs []error
+	bulkErrs   []error
+}
+
+func (f *fakeUseCase) Create(ctx context.Context, prod *models.Product) (*models.Product, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.createErrs) > 0 {
+		err := f.createErrs[0]
+		f.createErrs = f.createErrs[1:]
+		if err != nil {
+			return nil, err
+		}
+	}
+	f.created = append(f.created, prod)
+	return prod, nil
+}
+
+func (f *fakeUseCase) BulkWrite(ctx context.Context, writes []*models.ProductWrite) ([]error, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.bulkErrs) > 0 {
+		err := f.bulkErrs[0]
+		f.bulkErrs = f.bulkErrs[1:]
+		if err != nil {
+			return nil, err
+		}
+	}
+	f.bulks = append(f.bulks, writes)
+	return make([]error, len(writes)), nil
+}
+
+func (f *fakeUseCase) createdNames() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	names := make([]string, 0, len(f.created))
+	for _, prod := range f.created {
+		names = append(names, prod.Name)
+	}
+	return names
+}
+
+func (f *fakeUseCase) bulkWrites() [][]*models.ProductWrite {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([][]*models.ProductWrite(nil), f.bulks...)
+}
+
+// fakeIdempotency in memory idempotency store
+type fakeIdempotency struct {
+	mu     sync.Mutex
+	values map[string]string
+	tokens int
+}
+
+func (f *fakeIdempotency) Claim(ctx context.Context, key string) (*models.MessageClaim, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch value, ok := f.values[key]; {
+	case value == "processed":
+		return &models.MessageClaim{Key: key, Status: models.MessageProcessed}, nil
+	case ok:
+		return &models.MessageClaim{Key: key, Status: models.MessageInFlight}, nil
+	}
+	f.tokens++
+	token := strconv.Itoa(f.tokens)
+	f.values[key] = token
+	return &models.MessageClaim{Key: key, Token: token, Status: models.MessageClaimed}, nil
+}
+
+func (f *fakeIdempotency) MarkProcessed(ctx context.Context, claim *models.MessageClaim) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.values[claim.Key] = "processed"
+	return nil
+}
+
+func (f *fakeIdempotency) Release(ctx context.Context, claim *models.MessageClaim) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.values[claim.Key] == claim.Token {
+		delete(f.values, claim.Key)
+	}
+	return nil
+}
+
+type consumerHarness struct {
+	cfg config.Config
+	bus messagebus.Bus
+	uc  *fakeUseCase
+}
+
+func newTestConfig() config.Config {
+	consumer := config.KafkaConsumer{Enabled: true, Workers: 2, QueueCapacity: 10}
+
+	cfg := config.Config{}
+	cfg.Logger.Level = "fatal"
+	cfg.Logger.Encoding = "console"
+	cfg.Kafka.GroupID = "products_group"
+	cfg.Kafka.WireFormat = wireFormatJSON
+	cfg.Kafka.Topics = config.KafkaTopics{
+		CreateProduct:   "create-product",
+		UpdateProduct:   "update-product",
+		DeadLetterQueue: "dead-letter-queue",
+	}
+	cfg.Kafka.Retry = config.KafkaRetry{
+		Attempts: 1,
+		Delay:    time.Millisecond,
+		Tiers:    []config.KafkaRetryTier{{Suffix: "retry.1", Delay: 10 * time.Millisecond}},
+	}
+	cfg.Kafka.Consumers = config.KafkaConsumers{CreateProduct: consumer, UpdateProduct: consumer, Retry: consumer}
+	return cfg
+}
+
+// failingPublisher publisher failing first failures publishes
+type failingPublisher struct {
+	messagebus.Publisher
+
+	mu       sync.Mutex
+	failures int
+}
+
+func (p *failingPublisher) Publish(ctx context.Context, msgs ...messagebus.Message) error {
+	p.mu.Lock()
+	if p.failures > 0 {
+		p.failures--
+		p.mu.Unlock()
+		return errors.New("broker not available")
+	}
+	p.mu.Unlock()
+	return p.Publisher.Publish(ctx, msgs...)
+}
+
+// retryHeaders headers of message routed to retry topic waiting until not before
+func retryHeaders(cfg config.Config, notBefore time.Time) []messagebus.Header {
+	headers := messagebus.SetHeader(nil, originalTopicHeader, cfg.Kafka.Topics.CreateProduct)
+	headers = messagebus.SetHeader(headers, retryAttemptHeader, "1")
+	return messagebus.SetHeader(headers, retryNotBeforeHeader, strconv.FormatInt(notBefore.UnixNano()/int64(time.Millisecond), 10))
+}
+
+// startConsumers run consumer group on in memory bus until test ends
+func startConsumers(t *testing.T, cfg config.Config, uc *fakeUseCase) *consumerHarness {
+	t.Helper()
+	return startConsumersPublishingWith(t, cfg, uc, func(bus messagebus.Publisher) messagebus.Publisher { return bus })
+}
+
+// startConsumersPublishingWith run consumer group publishing retries and dead letters through publisher of bus
+func startConsumersPublishingWith(
+	t *testing.T,
+	cfg config.Config,
+	uc *fakeUseCase,
+	publisher func(bus messagebus.Publisher) messagebus.Publisher,
+) *consumerHarness {
+	t.Helper()
+
+	appLogger := logger.NewApiLogger(cfg)
+	appLogger.InitLogger()
+
+	jsonC := &jsonCodec{}
+	codecs := &ProductCodecs{publish: jsonC, byContentType: map[string]productCodec{jsonC.ContentType(): jsonC}}
+	processed := &fakeIdempotency{values: make(map[string]string)}
+	bus := messagebus.NewMemoryBus(2)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		cancel()
+		bus.Close()
+	})
+
+	pcg := NewProductsConsumerGroup(cfg.Kafka.GroupID, appLogger, cfg, uc, validator.New(), processed, codecs, bus, publisher(bus))
+	pcg.RunConsumers(ctx, cancel)
+	return &consumerHarness{cfg: cfg, bus: bus, uc: uc}
+}
+
+// publish plain product json to topic, key is used as idempotency key
+func (h *consumerHarness) publish(t *testing.T, topic, key, name string, headers ...messagebus.Header) {
+	t.Helper()
+
+	value, err := json.Marshal(&models.Product{
+		Name:        name,
+		Description: "description",
+		Price:       10,
+		Quantity:    1,
+		Rating:      5,
+	})
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+
+	headers = messagebus.SetHeader(headers, idempotencyKeyHeader, key)
+	if err := h.bus.Publish(context.Background(), messagebus.Message{Topic: topic, Value: value, Headers: headers}); err != nil {
+		t.Fatalf("bus.Publish: %v", err)
+	}
+}
+
+// fetch next message of topic read by separate consumer group
+func (h *consumerHarness) fetch(t *testing.T, topic string) messagebus.Message {
+	t.Helper()
+
+	sub, err := h.bus.Subscribe(topic, "test-"+topic)
+	if err != nil {
+		t.Fatalf("bus.Subscribe: %v", err)
+	}
+	defer sub.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), testWaitTimeout)
+	defer cancel()
+	m, err := sub.Fetch(ctx)
+	if err != nil {
+		t.Fatalf("sub.Fetch %s: %v", topic, err)
+	}
+	return m
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(testWaitTimeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestConsumerCreatesProduct(t *testing.T) {
+	h := startConsumers(t, newTestConfig(), &fakeUseCase{})
+
+	h.publish(t, h.cfg.Kafka.Topics.CreateProduct, "key-1", "first product")
+
+	waitFor(t, "created product", func() bool { return len(h.uc.createdNames()) == 1 })
+	if names := h.uc.createdNames(); names[0] != "first product" {
+		t.Fatalf("created %v, want first product", names)
+	}
+}
+
+func TestConsumerSkipsDuplicateMessage(t *testing.T) {
+	h := startConsumers(t, newTestConfig(), &fakeUseCase{})
+
+	h.publish(t, h.cfg.Kafka.Topics.CreateProduct, "key-1", "first product")
+	h.publish(t, h.cfg.Kafka.Topics.CreateProduct, "key-1", "first product")
+	h.publish(t, h.cfg.Kafka.Topics.CreateProduct, "key-2", "second product")
+
+	waitFor(t, "second product", func() bool {
+		for _, name := range h.uc.createdNames() {
+			if name == "second product" {
+				return true
+			}
+		}
+		return false
+	})
+	time.Sleep(50 * time.Millisecond)
+	if names := h.uc.createdNames(); len(names) != 2 {
+		t.Fatalf("created %v, want duplicate skipped", names)
+	}
+}
+
+func TestConsumerRoutesTransientFailureToRetryTopic(t *testing.T) {
+	h := startConsumers(t, newTestConfig(), &fakeUseCase{createErrs: []error{errors.New("connection reset")}})
+
+	h.publish(t, h.cfg.Kafka.Topics.CreateProduct, "key-1", "first product")
+
+	waitFor(t, "product created by retry consumer", func() bool { return len(h.uc.createdNames()) == 1 })
+
+	m := h.fetch(t, retryTopic(h.cfg.Kafka.Topics.CreateProduct, h.cfg.Kafka.Retry.Tiers[0]))
+	if attempt := retryAttempt(m); attempt != 1 {
+		t.Fatalf("retry attempt = %d, want 1", attempt)
+	}
+	if topic := originalTopic(m); topic != h.cfg.Kafka.Topics.CreateProduct {
+		t.Fatalf("original topic = %s, want %s", topic, h.cfg.Kafka.Topics.CreateProduct)
+	}
+	if _, ok := m.Header(retryNotBeforeHeader); !ok {
+		t.Fatalf("retry message without not before header")
+	}
+}
+
+func TestConsumerRetriesRoutingUntilPublished(t *testing.T) {
+	uc := &fakeUseCase{createErrs: []error{errors.New("connection reset")}}
+	h := startConsumersPublishingWith(t, newTestConfig(), uc, func(bus messagebus.Publisher) messagebus.Publisher {
+		return &failingPublisher{Publisher: bus, failures: 2}
+	})
+
+	h.publish(t, h.cfg.Kafka.Topics.CreateProduct, "key-1", "first product")
+
+	waitFor(t, "product created by retry consumer", func() bool { return len(h.uc.createdNames()) == 1 })
+	if m := h.fetch(t, retryTopic(h.cfg.Kafka.Topics.CreateProduct, h.cfg.Kafka.Retry.Tiers[0])); retryAttempt(m) != 1 {
+		t.Fatalf("retry attempt = %d, want 1", retryAttempt(m))
+	}
+}
+
+func TestRouteFailureStopsWithSession(t *testing.T) {
+	cfg := newTestConfig()
+	appLogger := logger.NewApiLogger(cfg)
+	appLogger.InitLogger()
+	bus := messagebus.NewMemoryBus(1)
+	defer bus.Close()
+	pcg := NewProductsConsumerGroup(cfg.Kafka.GroupID, appLogger, cfg, &fakeUseCase{}, validator.New(), nil, nil, bus,
+		&failingPublisher{Publisher: bus, failures: 1 << 30})
+
+	sessionCtx, cancel := context.WithTimeout(context.Background(), 3*routeRetryInterval)
+	defer cancel()
+	m := messagebus.Message{Topic: cfg.Kafka.Topics.CreateProduct, Value: []byte("{}")}
+	if pcg.routeFailure(context.Background(), sessionCtx, m, errors.New("connection reset")) {
+		t.Fatalf("routeFailure = true, want false when session ends before message is routed")
+	}
+}
+
+func TestConsumerRoutesPermanentFailureToDeadLetterQueue(t *testing.T) {
+	h := startConsumers(t, newTestConfig(), &fakeUseCase{createErrs: []error{productErrors.NewValidationError("bad product")}})
+
+	h.publish(t, h.cfg.Kafka.Topics.CreateProduct, "key-1", "first product")
+
+	m := h.fetch(t, h.cfg.Kafka.Topics.DeadLetterQueue)
+	var errMsg models.ErrorMessage
+	if err := json.Unmarshal(m.Value, &errMsg); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if errMsg.Topic != h.cfg.Kafka.Topics.CreateProduct || errMsg.Attempts != 1 {
+		t.Fatalf("dead letter %+v, want topic %s after 1 attempt", errMsg, h.cfg.Kafka.Topics.CreateProduct)
+	}
+	if names := h.uc.createdNames(); len(names) != 0 {
+		t.Fatalf("created %v, want none", names)
+	}
+}
+
+func TestConsumerRoutesExhaustedRetriesToDeadLetterQueue(t *testing.T) {
+	h := startConsumers(t, newTestConfig(), &fakeUseCase{createErrs: []error{errors.New("timeout"), errors.New("timeout")}})
+
+	h.publish(t, h.cfg.Kafka.Topics.CreateProduct, "key-1", "first product")
+
+	m := h.fetch(t, h.cfg.Kafka.Topics.DeadLetterQueue)
+	var errMsg models.ErrorMessage
+	if err := json.Unmarshal(m.Value, &errMsg); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+	if errMsg.Attempts != 2 {
+		t.Fatalf("dead letter attempts = %d, want 2", errMsg.Attempts)
+	}
+}
+
+func TestDelayedRetryDoesNotHoldWorker(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Kafka.Consumers.Retry.Workers = 1
+	h := startConsumers(t, cfg, &fakeUseCase{})
+
+	topic := retryTopic(cfg.Kafka.Topics.CreateProduct, cfg.Kafka.Retry.Tiers[0])
+	// messages without key go round robin, so delayed and ready messages land on different partitions
+	h.publish(t, topic, "key-1", "delayed product", retryHeaders(cfg, time.Now().Add(time.Hour))...)
+	h.publish(t, topic, "key-2", "ready product", retryHeaders(cfg, time.Now())...)
+
+	waitFor(t, "ready product", func() bool { return len(h.uc.createdNames()) == 1 })
+	if names := h.uc.createdNames(); names[0] != "ready product" {
+		t.Fatalf("created %v, want ready product", names)
+	}
+}
+
+func TestBatchConsumerWritesBulk(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Kafka.Consumers.CreateProduct.Batch = config.KafkaBatch{Enabled: true, Size: 10, Timeout: 20 * time.Millisecond}
+	h := startConsumers(t, cfg, &fakeUseCase{})
+
+	h.publish(t, cfg.Kafka.Topics.CreateProduct, "key-1", "first product")
+	h.publish(t, cfg.Kafka.Topics.CreateProduct, "key-2", "second product")
+	h.publish(t, cfg.Kafka.Topics.CreateProduct, "key-1", "first product")
+
+	var writes []*models.ProductWrite
+	waitFor(t, "bulk writes", func() bool {
+		writes = writes[:0]
+		for _, bulk := range h.uc.bulkWrites() {
+			writes = append(writes, bulk...)
+		}
+		return len(writes) >= 2
+	})
+	time.Sleep(50 * time.Millisecond)
+
+	writes = writes[:0]
+	for _, bulk := range h.uc.bulkWrites() {
+		writes = append(writes, bulk...)
+	}
+	if len(writes) != 2 {
+		t.Fatalf("bulk writes %d, want 2 with duplicate skipped", len(writes))
+	}
+	for _, write := range writes {
+		if write.Op != models.ProductWriteCreate {
+			t.Fatalf("bulk write op = %s, want %s", write.Op, models.ProductWriteCreate)
+		}
+	}
+	if names := h.uc.createdNames(); len(names) != 0 {
+		t.Fatalf("created %v, want batch to use bulk write only", names)
+	}
+}
+
+func TestBatchConsumerWaitsForRetryDelay(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Kafka.Consumers.Retry.Batch = config.KafkaBatch{Enabled: true, Size: 10, Timeout: 10 * time.Millisecond}
+	h := startConsumers(t, cfg, &fakeUseCase{})
+
+	notBefore := time.Now().Add(200 * time.Millisecond)
+	h.publish(t, retryTopic(cfg.Kafka.Topics.CreateProduct, cfg.Kafka.Retry.Tiers[0]), "key-1", "delayed product",
+		retryHeaders(cfg, notBefore)...)
+
+	waitFor(t, "bulk write of delayed product", func() bool { return len(h.uc.bulkWrites()) == 1 })
+	if time.Now().Before(notBefore) {
+		t.Fatalf("delayed product written before its not before time")
+	}
+}
+
+func TestBatchConsumerRetriesRoutingUntilPublished(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Kafka.Consumers.CreateProduct.Batch = config.KafkaBatch{Enabled: true, Size: 10, Timeout: 10 * time.Millisecond}
+	uc := &fakeUseCase{bulkErrs: []error{errors.New("connection reset")}}
+	h := startConsumersPublishingWith(t, cfg, uc, func(bus messagebus.Publisher) messagebus.Publisher {
+		return &failingPublisher{Publisher: bus, failures: 2}
+	})
+
+	h.publish(t, cfg.Kafka.Topics.CreateProduct, "key-1", "first product")
+
+	waitFor(t, "product created by retry consumer", func() bool { return len(h.uc.createdNames()) == 1 })
+	if m := h.fetch(t, retryTopic(cfg.Kafka.Topics.CreateProduct, cfg.Kafka.Retry.Tiers[0])); retryAttempt(m) != 1 {
+		t.Fatalf("retry attempt = %d, want 1", retryAttempt(m))
+	}
+}
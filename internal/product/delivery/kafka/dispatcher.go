@@ -0,0 +1,100 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Yangiboev/golang-with-curiosity/internal/models"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/events"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/messagebus"
+	"github.com/pkg/errors"
+)
+
+// eventHandler process single decoded event
+type eventHandler func(ctx context.Context, e *events.Event) error
+
+// registerHandlers map event types to handlers and schema upcasters, legacy topics to event types
+func (pcg *ProductsConsumerGroup) registerHandlers() {
+	pcg.handlers = map[string]eventHandler{
+		models.ProductCreateEventType: pcg.createProduct,
+		models.ProductUpdateEventType: pcg.updateProduct,
+	}
+
+	pcg.legacyEventTypes = map[string]string{
+		pcg.cfg.Kafka.Topics.CreateProduct: models.ProductCreateEventType,
+		pcg.cfg.Kafka.Topics.UpdateProduct: models.ProductUpdateEventType,
+	}
+
+	pcg.upcasters = events.NewUpcasters()
+	pcg.upcasters.Register(models.ProductCreateEventType, 0, upcastLegacyProduct)
+	pcg.upcasters.Register(models.ProductUpdateEventType, 0, upcastLegacyProduct)
+}
+
+// dispatch decode message envelope, upcast it to current schema version and run handler of its type
+func (pcg *ProductsConsumerGroup) dispatch(ctx context.Context, m messagebus.Message) error {
+	e, err := pcg.currentEvent(m)
+	if err != nil {
+		return err
+	}
+
+	handler, ok := pcg.handlers[e.Type]
+	if !ok {
+		return permanent(errors.Errorf("unknown event type: %s", e.Type))
+	}
+
+	return handler(ctx, e)
+}
+
+// currentEvent decode message envelope and upcast it to current schema version
+func (pcg *ProductsConsumerGroup) currentEvent(m messagebus.Message) (*events.Event, error) {
+	e, err := pcg.decodeEvent(m)
+	if err != nil {
+		return nil, permanent(errors.Wrap(err, "decodeEvent"))
+	}
+
+	if err := pcg.upcasters.Upcast(e); err != nil {
+		return nil, permanent(err)
+	}
+
+	if e.SchemaVersion != models.ProductEventSchemaVersion {
+		return nil, permanent(errors.Errorf("unsupported %s schema version: %d", e.Type, e.SchemaVersion))
+	}
+
+	return e, nil
+}
+
+// decodeEvent decode cloudevents envelope, plain messages are treated as schema version 0 events of their topic type
+func (pcg *ProductsConsumerGroup) decodeEvent(m messagebus.Message) (*events.Event, error) {
+	e, err := events.FromMessage(m)
+	if err == nil {
+		return e, nil
+	}
+	if !errors.Is(err, events.ErrNoEnvelope) {
+		return nil, err
+	}
+
+	eventType, ok := pcg.legacyEventTypes[originalTopic(m)]
+	if !ok {
+		return nil, errors.Errorf("no legacy event type for topic: %s", originalTopic(m))
+	}
+
+	return &events.Event{
+		ID:            fmt.Sprintf("%s-%d-%d", m.Topic, m.Partition, m.Offset),
+		Source:        models.ProductEventSource,
+		SpecVersion:   events.SpecVersion,
+		Type:          eventType,
+		Time:          m.Time,
+		SchemaVersion: 0,
+		Data:          m.Value,
+	}, nil
+}
+
+// upcastLegacyProduct v0 messages carry raw product json without envelope, which is v1 data as is
+func upcastLegacyProduct(e *events.Event) error {
+	if !json.Valid(e.Data) {
+		return errors.New("legacy product data is not valid json")
+	}
+	e.DataContentType = events.ContentTypeJSON
+	return nil
+}
@@ -0,0 +1,64 @@
+package kafka
+
+import (
+	"encoding/json"
+
+	productErrors "github.com/Yangiboev/golang-with-curiosity/pkg/product_errors"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/schemaregistry"
+	"github.com/go-playground/validator/v10"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// permanentError message processing error which will never succeed on retry
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// permanent mark error as not retryable
+func permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// isRetryable classify message processing error, permanent errors go straight to the dead letter queue
+func isRetryable(err error) bool {
+	var (
+		permanentErr  *permanentError
+		domainErr     *productErrors.Error
+		validationErr validator.ValidationErrors
+		syntaxErr     *json.SyntaxError
+		typeErr       *json.UnmarshalTypeError
+	)
+
+	switch {
+	case err == nil:
+		return false
+	case errors.As(err, &permanentErr):
+		return false
+	case errors.As(err, &validationErr):
+		return false
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+		return false
+	case errors.Is(err, productErrors.ErrObjectIDTypeConversion):
+		return false
+	case errors.As(err, &domainErr) && domainErr.Kind == productErrors.Validation:
+		return false
+	case mongo.IsDuplicateKeyError(err):
+		return false
+	case errors.Is(err, schemaregistry.ErrInvalidWireFormat), errors.Is(err, schemaregistry.ErrIncompatibleSchema), errors.Is(err, schemaregistry.ErrSchemaNotFound):
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,118 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Yangiboev/golang-with-curiosity/pkg/messagebus"
+)
+
+// partitionQueues message queues of consumer session partitions, each queue is drained by its own worker.
+// Queue of revoked partition is closed and removed, its worker finishes queued messages before worker of
+// the same partition assigned again starts, so messages of partition are never processed out of order
+type partitionQueues struct {
+	ctx      context.Context
+	capacity int
+	work     func(partition int, messages <-chan messagebus.Message)
+
+	mu      sync.Mutex
+	queues  map[int]*partitionQueue
+	retired map[int]chan struct{}
+	wg      sync.WaitGroup
+}
+
+type partitionQueue struct {
+	messages chan messagebus.Message
+	done     chan struct{}
+}
+
+func newPartitionQueues(ctx context.Context, capacity int, work func(partition int, messages <-chan messagebus.Message)) *partitionQueues {
+	return &partitionQueues{
+		ctx:      ctx,
+		capacity: capacity,
+		work:     work,
+		queues:   make(map[int]*partitionQueue),
+		retired:  make(map[int]chan struct{}),
+	}
+}
+
+// push queue message of partition, queue and its worker are started on first message of partition
+func (q *partitionQueues) push(m messagebus.Message) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	queue, ok := q.queues[m.Partition]
+	if !ok {
+		queue = q.start(m.Partition)
+	}
+	select {
+	case queue.messages <- m:
+		return nil
+	case <-q.ctx.Done():
+		return q.ctx.Err()
+	}
+}
+
+// revoke close and remove queues of partitions
+func (q *partitionQueues) revoke(partitions ...int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for p, done := range q.retired {
+		select {
+		case <-done:
+			delete(q.retired, p)
+		default:
+		}
+	}
+	for _, p := range partitions {
+		queue, ok := q.queues[p]
+		if !ok {
+			continue
+		}
+		close(queue.messages)
+		delete(q.queues, p)
+		q.retired[p] = queue.done
+	}
+}
+
+// close close all queues and wait for workers
+func (q *partitionQueues) close() {
+	q.mu.Lock()
+	for p, queue := range q.queues {
+		close(queue.messages)
+		delete(q.queues, p)
+	}
+	q.mu.Unlock()
+	q.wg.Wait()
+}
+
+// len number of partitions with queue
+func (q *partitionQueues) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.queues)
+}
+
+// start queue of partition, caller holds lock
+func (q *partitionQueues) start(partition int) *partitionQueue {
+	queue := &partitionQueue{messages: make(chan messagebus.Message, q.capacity), done: make(chan struct{})}
+	previous := q.retired[partition]
+	delete(q.retired, partition)
+	q.queues[partition] = queue
+
+	q.wg.Add(1)
+	go func() {
+		defer q.wg.Done()
+		defer close(queue.done)
+		if previous != nil {
+			select {
+			case <-previous:
+			case <-q.ctx.Done():
+				return
+			}
+		}
+		q.work(partition, queue.messages)
+	}()
+	return queue
+}
@@ -0,0 +1,75 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Yangiboev/golang-with-curiosity/pkg/messagebus"
+)
+
+func TestPartitionQueuesRevokeRemovesQueue(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	queues := newPartitionQueues(ctx, 10, func(partition int, messages <-chan messagebus.Message) {
+		for range messages {
+		}
+	})
+	defer queues.close()
+
+	for p := 0; p < 3; p++ {
+		if err := queues.push(messagebus.Message{Partition: p}); err != nil {
+			t.Fatalf("push: %v", err)
+		}
+	}
+	queues.revoke(0, 2)
+
+	if n := queues.len(); n != 1 {
+		t.Fatalf("queues = %d, want only queue of partition still assigned", n)
+	}
+}
+
+func TestPartitionQueuesReassignedPartitionKeepsOrder(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mu := sync.Mutex{}
+	processed := make([]int64, 0)
+	release := make(chan struct{})
+	queues := newPartitionQueues(ctx, 10, func(partition int, messages <-chan messagebus.Message) {
+		for m := range messages {
+			if m.Offset == 0 {
+				<-release
+			}
+			mu.Lock()
+			processed = append(processed, m.Offset)
+			mu.Unlock()
+		}
+	})
+
+	for offset := int64(0); offset < 3; offset++ {
+		if err := queues.push(messagebus.Message{Partition: 1, Offset: offset}); err != nil {
+			t.Fatalf("push: %v", err)
+		}
+	}
+	queues.revoke(1)
+	if err := queues.push(messagebus.Message{Partition: 1, Offset: 3}); err != nil {
+		t.Fatalf("push: %v", err)
+	}
+
+	// worker of reassigned partition must not overtake messages queued before revoke
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	queues.close()
+
+	for i, offset := range processed {
+		if offset != int64(i) {
+			t.Fatalf("processed offsets %v, want in order", processed)
+		}
+	}
+	if len(processed) != 4 {
+		t.Fatalf("processed offsets %v, want all 4", processed)
+	}
+}
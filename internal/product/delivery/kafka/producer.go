@@ -4,65 +4,91 @@ import (
 	"context"
 
 	"github.com/Yangiboev/golang-with-curiosity/config"
+	"github.com/Yangiboev/golang-with-curiosity/internal/models"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/events"
 	"github.com/Yangiboev/golang-with-curiosity/pkg/logger"
-	"github.com/segmentio/kafka-go"
-	"github.com/segmentio/kafka-go/compress"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/messagebus"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/pkg/errors"
 )
 
 type ProductsProducer interface {
-	PublishCreate(ctx context.Context, msg ...kafka.Message) error
-	PublishUpdate(ctx context.Context, msgs ...kafka.Message) error
-	Close()
-	Run()
-	GetNewKafkaWriter(topic string) *kafka.Writer
+	PublishCreate(ctx context.Context, products ...*models.Product) error
+	PublishUpdate(ctx context.Context, products ...*models.Product) error
+	PublishChanges(ctx context.Context, changes ...*models.ProductChange) error
 }
 
 type productsProducer struct {
-	log          logger.Logger
-	cfg          config.Config
-	createWriter *kafka.Writer
-	updateWriter *kafka.Writer
+	log       logger.Logger
+	cfg       config.Config
+	codecs    *ProductCodecs
+	publisher messagebus.Publisher
 }
 
-func NewProductsProducer(log logger.Logger, cfg config.Config) *productsProducer {
-	return &productsProducer{log: log, cfg: cfg}
+// NewProductsProducer constructor
+func NewProductsProducer(log logger.Logger, cfg config.Config, codecs *ProductCodecs, publisher messagebus.Publisher) *productsProducer {
+	return &productsProducer{log: log, cfg: cfg, codecs: codecs, publisher: publisher}
 }
 
-// GetNewKafkaWriter Create new kafka writer
-func (p *productsProducer) GetNewKafkaWriter(topic string) *kafka.Writer {
-	w := &kafka.Writer{
-		Addr:         kafka.TCP(p.cfg.Kafka.Brokers...),
-		Topic:        topic,
-		Balancer:     &kafka.LeastBytes{},
-		RequiredAcks: writerRequiredAcks,
-		MaxAttempts:  writerMaxAttempts,
-		Logger:       kafka.LoggerFunc(p.log.Debugf),
-		ErrorLogger:  kafka.LoggerFunc(p.log.Errorf),
-		Compression:  compress.Snappy,
-		ReadTimeout:  writerReadTimeout,
-		WriteTimeout: writerWriteTimeout,
+// PublishCreate publish create product events to create topic
+func (p *productsProducer) PublishCreate(ctx context.Context, products ...*models.Product) error {
+	span, ctx := p.startProducerSpan(ctx, "productsProducer.PublishCreate", p.cfg.Kafka.Topics.CreateProduct)
+	defer span.Finish()
+
+	msgs, err := p.toMessages(ctx, models.ProductCreateEventType, p.cfg.Kafka.Topics.CreateProduct, products)
+	if err != nil {
+		return err
 	}
-	return w
+	return p.publisher.Publish(ctx, msgs...)
 }
 
-// Run init producers writers
-func (p *productsProducer) Run() {
-	p.createWriter = p.GetNewKafkaWriter(createProductTopic)
-	p.updateWriter = p.GetNewKafkaWriter(updateProductTopic)
-}
+// PublishUpdate publish update product events to update topic
+func (p *productsProducer) PublishUpdate(ctx context.Context, products ...*models.Product) error {
+	span, ctx := p.startProducerSpan(ctx, "productsProducer.PublishUpdate", p.cfg.Kafka.Topics.UpdateProduct)
+	defer span.Finish()
 
-// Close close writers
-func (p productsProducer) Close() {
-	p.createWriter.Close()
-	p.updateWriter.Close()
+	msgs, err := p.toMessages(ctx, models.ProductUpdateEventType, p.cfg.Kafka.Topics.UpdateProduct, products)
+	if err != nil {
+		return err
+	}
+	return p.publisher.Publish(ctx, msgs...)
 }
 
-// PublishCreate publish messages to create topic
-func (p *productsProducer) PublishCreate(ctx context.Context, msgs ...kafka.Message) error {
-	return p.createWriter.WriteMessages(ctx, msgs...)
+// startProducerSpan start span whose context is propagated to consumers in message headers
+func (p *productsProducer) startProducerSpan(ctx context.Context, operationName, topic string) (opentracing.Span, context.Context) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, operationName)
+	ext.SpanKindProducer.Set(span)
+	ext.MessageBusDestination.Set(span, topic)
+	return span, ctx
 }
 
-// PublishUpdate publish messages to update topic
-func (p *productsProducer) PublishUpdate(ctx context.Context, msgs ...kafka.Message) error {
-	return p.updateWriter.WriteMessages(ctx, msgs...)
+// toMessages encode products in configured wire format and wrap them in events of configured content mode,
+// messages are keyed by product id so all events of a product land on the same partition, event id is used as message idempotency key
+func (p *productsProducer) toMessages(ctx context.Context, eventType, topic string, products []*models.Product) ([]messagebus.Message, error) {
+	msgs := make([]messagebus.Message, 0, len(products))
+	for _, prod := range products {
+		data, err := p.codecs.publish.Encode(ctx, topic, prod)
+		if err != nil {
+			return nil, errors.Wrap(err, "codec.Encode")
+		}
+
+		var subject string
+		if !prod.ProductID.IsZero() {
+			subject = prod.ProductID.Hex()
+		}
+
+		e, err := events.NewRawEvent(ctx, eventType, models.ProductEventSource, subject, models.ProductEventSchemaVersion, p.codecs.publish.ContentType(), data)
+		if err != nil {
+			return nil, errors.Wrap(err, "events.NewRawEvent")
+		}
+
+		msg, err := p.toEventMessage(ctx, topic, e)
+		if err != nil {
+			return nil, err
+		}
+		msg.Headers = messagebus.SetHeader(msg.Headers, idempotencyKeyHeader, e.ID)
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
 }
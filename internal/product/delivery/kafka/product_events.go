@@ -0,0 +1,124 @@
+package kafka
+
+import (
+	"context"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+
+	"github.com/Yangiboev/golang-with-curiosity/internal/models"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/events"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/messagebus"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/tracing"
+)
+
+// PublishChanges publish domain events of product changes to product events topic and latest product states to compacted
+// catalog topic, deleted products are published as catalog tombstones. Messages are keyed by product id to keep product order
+func (p *productsProducer) PublishChanges(ctx context.Context, changes ...*models.ProductChange) error {
+	span, ctx := p.startProducerSpan(ctx, "productsProducer.PublishChanges", p.cfg.Kafka.Topics.ProductEvents)
+	defer span.Finish()
+
+	msgs := make([]messagebus.Message, 0, len(changes)*2)
+	for _, change := range changes {
+		eventMsgs, err := p.toEventMessages(ctx, change)
+		if err != nil {
+			return err
+		}
+		catalogMsg, err := p.toCatalogMessage(ctx, change)
+		if err != nil {
+			return err
+		}
+		msgs = append(msgs, eventMsgs...)
+		msgs = append(msgs, catalogMsg)
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	return p.publisher.Publish(ctx, msgs...)
+}
+
+// toEventMessages domain events of product change, updates also raise stock and price change events
+func (p *productsProducer) toEventMessages(ctx context.Context, change *models.ProductChange) ([]messagebus.Message, error) {
+	id := change.ProductID()
+	type domainEvent struct {
+		eventType string
+		data      interface{}
+	}
+
+	var domainEvents []domainEvent
+	switch {
+	case change.Before == nil:
+		domainEvents = append(domainEvents, domainEvent{models.ProductCreatedEventType, change.After})
+	case change.After == nil:
+		domainEvents = append(domainEvents, domainEvent{models.ProductDeletedEventType, &models.ProductDeleted{ProductID: id}})
+	default:
+		domainEvents = append(domainEvents, domainEvent{models.ProductUpdatedEventType, change.After})
+		if change.Before.Quantity != change.After.Quantity {
+			domainEvents = append(domainEvents, domainEvent{models.ProductStockChangedEventType, &models.StockChanged{
+				ProductID:   id,
+				OldQuantity: change.Before.Quantity,
+				NewQuantity: change.After.Quantity,
+			}})
+		}
+		if change.Before.Price != change.After.Price {
+			domainEvents = append(domainEvents, domainEvent{models.ProductPriceChangedEventType, &models.PriceChanged{
+				ProductID: id,
+				OldPrice:  change.Before.Price,
+				NewPrice:  change.After.Price,
+			}})
+		}
+	}
+
+	msgs := make([]messagebus.Message, 0, len(domainEvents))
+	for _, de := range domainEvents {
+		e, err := events.NewEvent(ctx, de.eventType, models.ProductEventSource, id.Hex(), models.ProductDomainEventSchemaVersion, de.data)
+		if err != nil {
+			return nil, errors.Wrap(err, "events.NewEvent")
+		}
+		msg, err := p.toEventMessage(ctx, p.cfg.Kafka.Topics.ProductEvents, e)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+// toCatalogMessage latest product state encoded in configured wire format, tombstone without value for deleted product
+func (p *productsProducer) toCatalogMessage(ctx context.Context, change *models.ProductChange) (messagebus.Message, error) {
+	topic := p.cfg.Kafka.Topics.ProductCatalog
+	id := change.ProductID()
+
+	if change.After == nil {
+		msg := messagebus.Message{Topic: topic, Key: []byte(id.Hex()), Time: time.Now().UTC()}
+		if span := opentracing.SpanFromContext(ctx); span != nil {
+			msg.Headers = tracing.InjectMessageHeaders(span, msg.Headers)
+		}
+		return msg, nil
+	}
+
+	data, err := p.codecs.publish.Encode(ctx, topic, change.After)
+	if err != nil {
+		return messagebus.Message{}, errors.Wrap(err, "codec.Encode")
+	}
+	e, err := events.NewRawEvent(ctx, models.ProductCatalogEventType, models.ProductEventSource, id.Hex(), models.ProductDomainEventSchemaVersion, p.codecs.publish.ContentType(), data)
+	if err != nil {
+		return messagebus.Message{}, errors.Wrap(err, "events.NewRawEvent")
+	}
+	return p.toEventMessage(ctx, topic, e)
+}
+
+// toEventMessage wrap event in configured content mode, keyed by event subject
+func (p *productsProducer) toEventMessage(ctx context.Context, topic string, e *events.Event) (messagebus.Message, error) {
+	msg, err := events.ToMessage(e, events.Mode(p.cfg.Kafka.EventMode))
+	if err != nil {
+		return messagebus.Message{}, errors.Wrap(err, "events.ToMessage")
+	}
+	msg.Topic = topic
+	msg.Key = []byte(e.Subject)
+	if span := opentracing.SpanFromContext(ctx); span != nil {
+		msg.Headers = tracing.InjectMessageHeaders(span, msg.Headers)
+	}
+	return msg, nil
+}
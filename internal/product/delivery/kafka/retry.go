@@ -0,0 +1,169 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Yangiboev/golang-with-curiosity/config"
+	"github.com/Yangiboev/golang-with-curiosity/internal/models"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/messagebus"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/tracing"
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+)
+
+// retryTiers configured retry tiers, none when retry consumers are disabled
+func (pcg *ProductsConsumerGroup) retryTiers() []config.KafkaRetryTier {
+	return enabledRetryTiers(pcg.cfg.Kafka)
+}
+
+// enabledRetryTiers configured retry tiers, none when retry consumers are disabled
+func enabledRetryTiers(cfg config.Kafka) []config.KafkaRetryTier {
+	if !cfg.Consumers.Retry.Enabled {
+		return nil
+	}
+	return cfg.Retry.Tiers
+}
+
+// retryTopic delayed retry topic name for source topic and tier
+func retryTopic(topic string, tier config.KafkaRetryTier) string {
+	return fmt.Sprintf("%s.%s", topic, tier.Suffix)
+}
+
+// retryAttempt number of delayed retries message already went through
+func retryAttempt(m messagebus.Message) int {
+	v, ok := m.Header(retryAttemptHeader)
+	if !ok {
+		return 0
+	}
+	attempt, err := strconv.Atoi(v)
+	if err != nil {
+		return 0
+	}
+	return attempt
+}
+
+// originalTopic topic message was first published to
+func originalTopic(m messagebus.Message) string {
+	if topic, ok := m.Header(originalTopicHeader); ok {
+		return topic
+	}
+	return m.Topic
+}
+
+// waitNotBefore block until message not before timestamp or context done
+func waitNotBefore(ctx context.Context, m messagebus.Message) error {
+	v, ok := m.Header(retryNotBeforeHeader)
+	if !ok {
+		return nil
+	}
+	notBefore, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return nil
+	}
+
+	delay := time.Until(time.Unix(0, notBefore*int64(time.Millisecond)))
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// routeFailure route failed message with handleFailure, attempts are repeated with backoff until message is routed.
+// Returns false when session ended before message was routed, then neither message nor later messages of its
+// partition may be acked in session, so committed offset never passes message
+func (pcg *ProductsConsumerGroup) routeFailure(ctx context.Context, sessionCtx context.Context, m messagebus.Message, err error) bool {
+	interval := routeRetryInterval
+	for {
+		routeErr := pcg.handleFailure(ctx, m, err)
+		if routeErr == nil {
+			return true
+		}
+		pcg.log.Errorf("message %v/%v/%v handleFailure, retrying in %v: %v", m.Topic, m.Partition, m.Offset, interval, routeErr)
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-sessionCtx.Done():
+			timer.Stop()
+			return false
+		case <-timer.C:
+		}
+		if interval *= 2; interval > maxRouteRetryInterval {
+			interval = maxRouteRetryInterval
+		}
+	}
+}
+
+// handleFailure publish failed message to next retry tier, or to the dead letter queue for permanent errors and exhausted retries
+func (pcg *ProductsConsumerGroup) handleFailure(ctx context.Context, m messagebus.Message, err error) error {
+	tiers := pcg.retryTiers()
+	attempt := retryAttempt(m)
+
+	if !isRetryable(err) || attempt >= len(tiers) {
+		deadLetterMessages.Inc()
+		return pcg.publishErrorMessage(ctx, m, err)
+	}
+
+	tier := tiers[attempt]
+	topic := retryTopic(originalTopic(m), tier)
+	notBefore := time.Now().Add(tier.Delay).UnixNano() / int64(time.Millisecond)
+
+	headers := make([]messagebus.Header, 0, len(m.Headers)+4)
+	headers = append(headers, m.Headers...)
+	headers = messagebus.SetHeader(headers, originalTopicHeader, originalTopic(m))
+	headers = messagebus.SetHeader(headers, retryAttemptHeader, strconv.Itoa(attempt+1))
+	headers = messagebus.SetHeader(headers, retryNotBeforeHeader, strconv.FormatInt(notBefore, 10))
+	headers = messagebus.SetHeader(headers, lastErrorHeader, err.Error())
+	if span := opentracing.SpanFromContext(ctx); span != nil {
+		headers = tracing.InjectMessageHeaders(span, headers)
+	}
+
+	if err := pcg.publisher.Publish(ctx, messagebus.Message{
+		Topic:   topic,
+		Key:     m.Key,
+		Value:   m.Value,
+		Headers: headers,
+		Time:    time.Now().UTC(),
+	}); err != nil {
+		return errors.Wrap(err, "publisher.Publish")
+	}
+
+	retryMessages.WithLabelValues(topic).Inc()
+	pcg.log.Warnf("message %v/%v/%v scheduled for retry to %s in %v: %v", m.Topic, m.Partition, m.Offset, topic, tier.Delay, err)
+	return nil
+}
+
+func (pcg *ProductsConsumerGroup) publishErrorMessage(ctx context.Context, m messagebus.Message, err error) error {
+	errMsg := &models.ErrorMessage{
+		Offset:    m.Offset,
+		Error:     err.Error(),
+		Time:      m.Time.UTC(),
+		Partition: m.Partition,
+		Topic:     originalTopic(m),
+		Attempts:  retryAttempt(m) + 1,
+		Value:     m.Value,
+	}
+
+	errMsgBytes, err := json.Marshal(errMsg)
+	if err != nil {
+		return err
+	}
+
+	return pcg.publisher.Publish(ctx, messagebus.Message{
+		Topic:   pcg.cfg.Kafka.Topics.DeadLetterQueue,
+		Key:     m.Key,
+		Value:   errMsgBytes,
+		Headers: m.Headers,
+	})
+}
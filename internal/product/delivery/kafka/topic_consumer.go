@@ -0,0 +1,100 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Yangiboev/golang-with-curiosity/config"
+)
+
+// topicConsumer consumer group member of single topic which can be paused and resumed,
+// each reader session lives between start and pause
+type topicConsumer struct {
+	groupID  string
+	topic    string
+	consumer config.KafkaConsumer
+	handler  messageHandler
+
+	mu      sync.Mutex
+	paused  bool
+	resumed chan struct{}
+	stop    context.CancelFunc
+	stopped chan struct{}
+}
+
+func newTopicConsumer(groupID, topic string, consumer config.KafkaConsumer, handler messageHandler) *topicConsumer {
+	return &topicConsumer{groupID: groupID, topic: topic, consumer: consumer, handler: handler}
+}
+
+// startSession wait while consumer is paused and start new reader session, false when context is done
+func (tc *topicConsumer) startSession(ctx context.Context) (context.Context, bool) {
+	for {
+		tc.mu.Lock()
+		if !tc.paused {
+			sessionCtx, stop := context.WithCancel(ctx)
+			tc.stop = stop
+			tc.stopped = make(chan struct{})
+			tc.mu.Unlock()
+			return sessionCtx, true
+		}
+		resumed := tc.resumed
+		tc.mu.Unlock()
+
+		select {
+		case <-resumed:
+		case <-ctx.Done():
+			return nil, false
+		}
+	}
+}
+
+// endSession release session context and notify pause waiting for session to stop
+func (tc *topicConsumer) endSession() {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	tc.stop()
+	close(tc.stopped)
+}
+
+// pause stop fetching, wait until in flight messages are committed and reader left the group
+func (tc *topicConsumer) pause(ctx context.Context) error {
+	tc.mu.Lock()
+	if !tc.paused {
+		tc.paused = true
+		tc.resumed = make(chan struct{})
+		if tc.stop != nil {
+			tc.stop()
+		}
+		pausedConsumers.WithLabelValues(tc.groupID, tc.topic).Set(1)
+	}
+	stopped := tc.stopped
+	tc.mu.Unlock()
+
+	if stopped == nil {
+		return nil
+	}
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// resume start new reader session of paused consumer
+func (tc *topicConsumer) resume() {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	if !tc.paused {
+		return
+	}
+	tc.paused = false
+	close(tc.resumed)
+	pausedConsumers.WithLabelValues(tc.groupID, tc.topic).Set(0)
+}
+
+func (tc *topicConsumer) isPaused() bool {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	return tc.paused
+}
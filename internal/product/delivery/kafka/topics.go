@@ -0,0 +1,85 @@
+package kafka
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/Yangiboev/golang-with-curiosity/config"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/logger"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/messagebus"
+)
+
+const onDivergenceFail = "fail"
+
+var errTopicsDiverge = errors.New("topics diverge from declaration")
+
+// ProductTopics topics products producers and consumers depend on, with their declared settings
+func ProductTopics(cfg config.Kafka) []messagebus.TopicSpec {
+	specs := []messagebus.TopicSpec{
+		topicSpec(cfg.Topics.CreateProduct, cfg.Provisioning.Topics.CreateProduct),
+		topicSpec(cfg.Topics.UpdateProduct, cfg.Provisioning.Topics.UpdateProduct),
+		topicSpec(cfg.Topics.DeadLetterQueue, cfg.Provisioning.Topics.DeadLetterQueue),
+		topicSpec(cfg.Topics.ProductEvents, cfg.Provisioning.Topics.ProductEvents),
+		topicSpec(cfg.Topics.ProductCatalog, cfg.Provisioning.Topics.ProductCatalog),
+	}
+	for _, tier := range enabledRetryTiers(cfg) {
+		for _, topic := range []string{cfg.Topics.CreateProduct, cfg.Topics.UpdateProduct} {
+			specs = append(specs, topicSpec(retryTopic(topic, tier), cfg.Provisioning.Topics.Retry))
+		}
+	}
+	return specs
+}
+
+// topicSpec map topic config to broker topic configs, zero settings keep broker defaults
+func topicSpec(name string, spec config.KafkaTopicSpec) messagebus.TopicSpec {
+	configs := make(map[string]string)
+	switch {
+	case spec.Retention < 0:
+		configs["retention.ms"] = "-1"
+	case spec.Retention > 0:
+		configs["retention.ms"] = strconv.FormatInt(int64(spec.Retention/time.Millisecond), 10)
+	}
+	if spec.CleanupPolicy != "" {
+		configs["cleanup.policy"] = spec.CleanupPolicy
+	}
+	if spec.MinInSyncReplicas > 0 {
+		configs["min.insync.replicas"] = strconv.Itoa(spec.MinInSyncReplicas)
+	}
+	return messagebus.TopicSpec{
+		Name:              name,
+		Partitions:        spec.Partitions,
+		ReplicationFactor: spec.ReplicationFactor,
+		Configs:           configs,
+	}
+}
+
+// ProvisionTopics create missing product topics, divergent existing topics fail startup or are logged depending on config
+func ProvisionTopics(ctx context.Context, cfg config.Kafka, log logger.Logger, provisioner messagebus.Provisioner) error {
+	if !cfg.Provisioning.Enabled {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, cfg.Provisioning.Timeout)
+	defer cancel()
+
+	divergences, err := provisioner.EnsureTopics(ctx, ProductTopics(cfg)...)
+	if err != nil {
+		return errors.Wrap(err, "provisioner.EnsureTopics")
+	}
+	if len(divergences) == 0 {
+		return nil
+	}
+
+	descriptions := make([]string, 0, len(divergences))
+	for _, d := range divergences {
+		log.Warnf("Topic diverges from declaration: %v", d)
+		descriptions = append(descriptions, d.String())
+	}
+	if cfg.Provisioning.OnDivergence == onDivergenceFail {
+		return errors.Wrap(errTopicsDiverge, strings.Join(descriptions, "; "))
+	}
+	return nil
+}
@@ -2,161 +2,318 @@ package kafka
 
 import (
 	"context"
-	"encoding/json"
-	"sync"
+	"strconv"
 	"time"
 
 	"github.com/avast/retry-go"
+	"github.com/pkg/errors"
 
 	"github.com/Yangiboev/golang-with-curiosity/internal/models"
-	"github.com/segmentio/kafka-go"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/events"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/messagebus"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/tracing"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
 )
 
-const (
-	retryAttempts = 1
-	retryDelay    = 1 * time.Second
-)
+// messageHandler process single kafka message
+type messageHandler func(ctx context.Context, m messagebus.Message) error
 
-func (pcg *ProductsConsumerGroup) createProductWorker(
+// fetchMessages fetch messages of all assigned partitions and hand them to per partition workers,
+// messages of one partition are processed sequentially, up to consumer workers partitions in parallel.
+// Queues of partitions revoked by rebalance are removed, their workers finish queued messages before worker of
+// partition assigned again starts. Fetching stops with session context, messages already being processed
+// finish with parent context
+func (pcg *ProductsConsumerGroup) fetchMessages(
 	ctx context.Context,
-	cancel context.CancelFunc,
-	r *kafka.Reader,
-	w *kafka.Writer,
-	wg *sync.WaitGroup,
-	workerID int,
-) {
-	defer wg.Done()
-	defer cancel()
+	sessionCtx context.Context,
+	sub messagebus.Subscription,
+	tc *topicConsumer,
+) error {
+	sem := make(chan struct{}, tc.consumer.Workers)
+	queues := newPartitionQueues(sessionCtx, tc.consumer.QueueCapacity, func(partition int, messages <-chan messagebus.Message) {
+		pcg.partitionWorker(ctx, sessionCtx, sub, sem, tc, partition, messages)
+	})
+	defer queues.close()
+
+	if rebalancer, ok := sub.(messagebus.Rebalancer); ok {
+		go func() {
+			for {
+				select {
+				case revoked := <-rebalancer.Revoked():
+					pcg.log.Infof("Revoked partitions: %v/%v", tc.topic, revoked)
+					queues.revoke(revoked...)
+				case <-sessionCtx.Done():
+					return
+				}
+			}
+		}()
+	}
+
 	for {
-		m, err := r.FetchMessage(ctx)
+		m, err := pcg.fetchMessage(sessionCtx, sub, tc)
 		if err != nil {
-			pcg.log.Errorf("FetchMessage", err)
+			return err
+		}
+		if err := queues.push(m); err != nil {
+			return err
+		}
+	}
+}
+
+// fetchMessage fetch next message recording fetch latency and partition lag
+func (pcg *ProductsConsumerGroup) fetchMessage(ctx context.Context, sub messagebus.Subscription, tc *topicConsumer) (messagebus.Message, error) {
+	start := time.Now()
+	m, err := sub.Fetch(ctx)
+	if err != nil {
+		return m, errors.Wrap(err, "sub.Fetch")
+	}
+	fetchDuration.WithLabelValues(m.Topic).Observe(time.Since(start).Seconds())
+	consumerLag.WithLabelValues(tc.groupID, m.Topic, strconv.Itoa(m.Partition)).Set(float64(m.HighWaterMark - m.Offset - 1))
+	return m, nil
+}
+
+// partitionWorker process messages of partition in order, delayed retries wait for their not before time
+// before taking one of consumer workers. Worker stops at message left unacked, so offset of partition is never
+// committed past it
+func (pcg *ProductsConsumerGroup) partitionWorker(
+	ctx context.Context,
+	sessionCtx context.Context,
+	sub messagebus.Subscription,
+	sem chan struct{},
+	tc *topicConsumer,
+	partition int,
+	messages <-chan messagebus.Message,
+) {
+	pcg.log.Infof("Starting partition worker: %v/%v", tc.topic, partition)
+
+	for m := range messages {
+		if sessionCtx.Err() != nil {
 			return
 		}
-		pcg.log.Infof(
-			"WORKER: %v, message at topic/partition/offset %v/%v/%v: %s = %s\n",
-			workerID,
-			m.Topic,
-			m.Partition,
-			m.Offset,
-			string(m.Key),
-			string(m.Value),
-		)
-		incomingMessages.Inc()
-		var prod models.Product
-		if err := json.Unmarshal(m.Value, &prod); err != nil {
-			errorMessages.Inc()
-			pcg.log.Errorf("json.Unmarshal", err)
-			continue
+		if err := waitNotBefore(sessionCtx, m); err != nil {
+			return
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-sessionCtx.Done():
+			return
+		}
+		routed := pcg.processMessage(ctx, sessionCtx, sub, m, tc.handler)
+		<-sem
+		if !routed {
+			return
 		}
+	}
+}
 
-		if err := pcg.validate.StructCtx(ctx, prod); err != nil {
+// processMessage handle message and ack it, failed message is acked once routed to retry or dead letter topic.
+// Returns false when message is left unacked, because processing was cancelled or failed message could not be
+// routed before session ended, later messages of its partition must not be acked then
+func (pcg *ProductsConsumerGroup) processMessage(
+	ctx context.Context,
+	sessionCtx context.Context,
+	sub messagebus.Subscription,
+	m messagebus.Message,
+	handler messageHandler,
+) bool {
+	span, ctx := startConsumerSpan(ctx, m)
+	defer span.Finish()
+	defer func(start time.Time) {
+		processingDuration.WithLabelValues(m.Topic).Observe(time.Since(start).Seconds())
+	}(time.Now())
+
+	pcg.log.Infof(
+		"message at topic/partition/offset %v/%v/%v: %s = %s\n",
+		m.Topic,
+		m.Partition,
+		m.Offset,
+		string(m.Key),
+		string(m.Value),
+	)
+	incomingMessages.Inc()
+
+	claim, duplicate, err := pcg.claimMessage(ctx, m)
+	if err != nil {
+		return false
+	}
+	if duplicate {
+		duplicateMessages.WithLabelValues(originalTopic(m)).Inc()
+		pcg.log.Infof("message %v/%v/%v already processed, skipping", m.Topic, m.Partition, m.Offset)
+		if err := sub.Ack(ctx, m); err != nil {
 			errorMessages.Inc()
-			pcg.log.Errorf("validate.StructCtx", err)
-			continue
+			pcg.log.Errorf("sub.Ack", err)
 		}
-		if err := retry.Do(func() error {
-			created, err := pcg.productsUC.Create(ctx, &prod)
-			if err != nil {
-				return err
-			}
-			pcg.log.Infof("created product: %v", created)
-			return nil
-		},
-			retry.Attempts(retryAttempts),
-			retry.Delay(retryDelay),
-			retry.Context(ctx),
-		); err != nil {
-			errorMessages.Inc()
+		return true
+	}
 
-			if err := pcg.publishErrorMessage(ctx, w, m, err); err != nil {
-				pcg.log.Errorf("publishErrorMessage", err)
-				continue
-			}
-			pcg.log.Errorf("productsUC.Create.publishErrorMessage", err)
-			continue
+	if err := handler(ctx, m); err != nil {
+		pcg.releaseClaim(claim)
+		if ctx.Err() != nil {
+			return false
 		}
-		if err := r.CommitMessages(ctx, m); err != nil {
-			errorMessages.Inc()
-			pcg.log.Errorf("CommitMessages", err)
-			continue
+		errorMessages.Inc()
+		ext.LogError(span, err)
+		pcg.log.Errorf("message %v/%v/%v handler: %v", m.Topic, m.Partition, m.Offset, err)
+
+		if !pcg.routeFailure(ctx, sessionCtx, m, err) {
+			return false
 		}
+	} else {
 		successMessages.Inc()
+		pcg.markProcessed(ctx, claim)
+	}
 
+	if err := sub.Ack(ctx, m); err != nil {
+		errorMessages.Inc()
+		pcg.log.Errorf("sub.Ack", err)
+	}
+	return true
+}
+
+// startConsumerSpan start span following from producer span context propagated in message headers
+func startConsumerSpan(ctx context.Context, m messagebus.Message) (opentracing.Span, context.Context) {
+	tracer := opentracing.GlobalTracer()
+	opts := []opentracing.StartSpanOption{
+		ext.SpanKindConsumer,
+		opentracing.Tag{Key: string(ext.MessageBusDestination), Value: m.Topic},
+		opentracing.Tag{Key: "messaging.topic", Value: m.Topic},
+		opentracing.Tag{Key: "messaging.partition", Value: m.Partition},
+		opentracing.Tag{Key: "messaging.offset", Value: m.Offset},
+	}
+	if parent, err := tracing.ExtractMessageHeaders(tracer, m.Headers); err == nil {
+		opts = append(opts, opentracing.FollowsFrom(parent))
 	}
 
+	span := tracer.StartSpan("ProductsConsumerGroup.processMessage", opts...)
+	return span, opentracing.ContextWithSpan(ctx, span)
 }
 
-func (pcg *ProductsConsumerGroup) updateProductWorker(
-	ctx context.Context,
-	cancel context.CancelFunc,
-	r *kafka.Reader,
-	w *kafka.Writer,
-	wg *sync.WaitGroup,
-	workerID int,
-) {
-	defer wg.Done()
-	defer cancel()
+// claimMessage claim message idempotency key before processing, waits while another consumer processes the message.
+// Messages without key and messages which could not be claimed because of store errors are processed without claim,
+// error is returned only when context is done while waiting
+func (pcg *ProductsConsumerGroup) claimMessage(ctx context.Context, m messagebus.Message) (*models.MessageClaim, bool, error) {
+	key, ok := m.Header(idempotencyKeyHeader)
+	if !ok {
+		return nil, false, nil
+	}
 
 	for {
-		m, err := r.FetchMessage(ctx)
+		claim, err := pcg.processed.Claim(ctx, key)
 		if err != nil {
-			pcg.log.Errorf("FetchMessage", err)
-			return
+			if ctx.Err() != nil {
+				return nil, false, ctx.Err()
+			}
+			pcg.log.Errorf("processed.Claim: %v", err)
+			return nil, false, nil
 		}
 
-		pcg.log.Infof(
-			"WORKER: %v, message at topic/partition/offset %v/%v/%v: %s = %s\n",
-			workerID,
-			m.Topic,
-			m.Partition,
-			m.Offset,
-			string(m.Key),
-			string(m.Value),
-		)
-		incomingMessages.Inc()
-
-		var prod models.Product
-		if err := json.Unmarshal(m.Value, &prod); err != nil {
-			errorMessages.Inc()
-			pcg.log.Errorf("json.Unmarshal", err)
-			continue
+		switch claim.Status {
+		case models.MessageClaimed:
+			return claim, false, nil
+		case models.MessageProcessed:
+			return nil, true, nil
 		}
 
-		if err := pcg.validate.StructCtx(ctx, prod); err != nil {
-			errorMessages.Inc()
-			pcg.log.Errorf("validate.StructCtx", err)
-			continue
+		timer := time.NewTimer(claimRetryInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, false, ctx.Err()
+		case <-timer.C:
 		}
+	}
+}
 
-		if err := retry.Do(func() error {
-			updated, err := pcg.productsUC.Update(ctx, &prod)
-			if err != nil {
-				return err
-			}
-			pcg.log.Debugf("updated product: %v", updated)
-			return nil
-		},
-			retry.Attempts(retryAttempts),
-			retry.Delay(retryDelay),
-			retry.Context(ctx),
-		); err != nil {
-			errorMessages.Inc()
+// markProcessed mark claimed message processed, so its redeliveries are skipped
+func (pcg *ProductsConsumerGroup) markProcessed(ctx context.Context, claim *models.MessageClaim) {
+	if claim == nil {
+		return
+	}
 
-			if err := pcg.publishErrorMessage(ctx, w, m, err); err != nil {
-				pcg.log.Errorf("publishErrorMessage", err)
-				continue
-			}
-			pcg.log.Errorf("productsUC.Create.publishErrorMessage", err)
-			continue
+	if err := pcg.processed.MarkProcessed(ctx, claim); err != nil {
+		pcg.log.Errorf("processed.MarkProcessed: %v", err)
+	}
+}
+
+// releaseClaim release claim of failed message, released even when processing was cancelled
+func (pcg *ProductsConsumerGroup) releaseClaim(claim *models.MessageClaim) {
+	if claim == nil {
+		return
+	}
+
+	if err := pcg.processed.Release(context.Background(), claim); err != nil {
+		pcg.log.Errorf("processed.Release: %v", err)
+	}
+}
+
+func (pcg *ProductsConsumerGroup) createProduct(ctx context.Context, e *events.Event) error {
+	prod, err := pcg.decodeProduct(ctx, e)
+	if err != nil {
+		return err
+	}
+
+	if err := pcg.validate.StructCtx(ctx, prod); err != nil {
+		return errors.Wrap(err, "validate.StructCtx")
+	}
+
+	return retry.Do(func() error {
+		created, err := pcg.productsUC.Create(ctx, prod)
+		if err != nil {
+			return err
 		}
+		pcg.log.Infof("created product: %v", created)
+		return nil
+	},
+		retry.Attempts(pcg.cfg.Kafka.Retry.Attempts),
+		retry.Delay(pcg.cfg.Kafka.Retry.Delay),
+		retry.Context(ctx),
+		retry.RetryIf(isRetryable),
+		retry.LastErrorOnly(true),
+	)
+}
 
-		if err := r.CommitMessages(ctx, m); err != nil {
-			errorMessages.Inc()
-			pcg.log.Errorf("CommitMessages", err)
-			continue
+func (pcg *ProductsConsumerGroup) updateProduct(ctx context.Context, e *events.Event) error {
+	prod, err := pcg.decodeProduct(ctx, e)
+	if err != nil {
+		return err
+	}
+
+	if err := pcg.validate.StructCtx(ctx, prod); err != nil {
+		return errors.Wrap(err, "validate.StructCtx")
+	}
+
+	return retry.Do(func() error {
+		updated, err := pcg.productsUC.Update(ctx, prod)
+		if err != nil {
+			return err
 		}
+		pcg.log.Debugf("updated product: %v", updated)
+		return nil
+	},
+		retry.Attempts(pcg.cfg.Kafka.Retry.Attempts),
+		retry.Delay(pcg.cfg.Kafka.Retry.Delay),
+		retry.Context(ctx),
+		retry.RetryIf(isRetryable),
+		retry.LastErrorOnly(true),
+	)
+}
 
-		successMessages.Inc()
+// decodeProduct decode event data with codec of its content type
+func (pcg *ProductsConsumerGroup) decodeProduct(ctx context.Context, e *events.Event) (*models.Product, error) {
+	codec, err := pcg.codecs.forContentType(e.DataContentType)
+	if err != nil {
+		return nil, permanent(err)
 	}
+
+	var prod models.Product
+	if err := codec.Decode(ctx, e.Data, &prod); err != nil {
+		return nil, errors.Wrap(err, "codec.Decode")
+	}
+	return &prod, nil
+}
+
+// retryProduct dispatch message again, partition worker already waited until message not before time
+func (pcg *ProductsConsumerGroup) retryProduct(ctx context.Context, m messagebus.Message) error {
+	return pcg.dispatch(ctx, m)
 }
@@ -2,6 +2,7 @@ package product
 
 import (
 	"context"
+	"time"
 
 	"github.com/Yangiboev/golang-with-curiosity/internal/models"
 	"github.com/Yangiboev/golang-with-curiosity/pkg/utils"
@@ -13,12 +14,59 @@ type MongoRepository interface {
 	Create(ctx context.Context, product *models.Product) (*models.Product, error)
 	Update(ctx context.Context, product *models.Product) (*models.Product, error)
 	GetByID(ctx context.Context, productID primitive.ObjectID) (*models.Product, error)
+	GetByIDs(ctx context.Context, productIDs []primitive.ObjectID) ([]*models.Product, error)
+	Delete(ctx context.Context, productID primitive.ObjectID) (*models.Product, error)
 	Search(ctx context.Context, search string, pagination *utils.Pagination) (*models.ProductsList, error)
+	BulkWrite(ctx context.Context, writes []*models.ProductWrite) ([]error, error)
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
 }
 
-// RedisRepository Product
+// OutboxRepository product changes stored in the same transaction as product writes. Single relay holding the relay
+// lease publishes pending changes in store order and removes them once published
+type OutboxRepository interface {
+	AppendChanges(ctx context.Context, changes ...*models.ProductChange) error
+	AcquireRelay(ctx context.Context, owner string, lease time.Duration) (bool, error)
+	PendingChanges(ctx context.Context, limit int) ([]*models.ProductOutboxEntry, error)
+	RemoveChanges(ctx context.Context, ids []primitive.ObjectID) error
+}
+
+// RedisRepository Product, GetProductByID returns ErrCacheMiss for products not cached. Set and Delete methods store
+// product writes, Fill methods store products read from database
 type RedisRepository interface {
-	SetProduct(ctx context.Context, product *models.Product) error
-	GetProductByID(ctx context.Context, productID primitive.ObjectID) (*models.Product, error)
+	SetProduct(ctx context.Context, product *models.Product, delta time.Duration) error
+	SetNotFound(ctx context.Context, productID primitive.ObjectID) error
+	FillProduct(ctx context.Context, product *models.Product, delta time.Duration) error
+	FillNotFound(ctx context.Context, productID primitive.ObjectID) error
+	FillProducts(ctx context.Context, products []*models.Product, missing []primitive.ObjectID, delta time.Duration) error
+	GetProducts(ctx context.Context, productIDs []primitive.ObjectID) (map[primitive.ObjectID]*models.CachedProduct, error)
+	GetProductByID(ctx context.Context, productID primitive.ObjectID) (*models.CachedProduct, error)
 	DeleteProduct(ctx context.Context, productID primitive.ObjectID) error
 }
+
+// SearchCacheRepository cached search result pages, invalidated by product changes
+type SearchCacheRepository interface {
+	GetSearch(ctx context.Context, search string, pagination *utils.Pagination) (*models.ProductsList, int64, error)
+	SetSearch(ctx context.Context, search string, pagination *utils.Pagination, list *models.ProductsList, generation int64) error
+	InvalidateProducts(ctx context.Context, changes ...*models.ProductChange) error
+}
+
+// IdempotencyRepository processed kafka messages keys, message key is claimed before processing so concurrent
+// redeliveries are applied once, claim is marked processed on success and released on failure
+type IdempotencyRepository interface {
+	Claim(ctx context.Context, key string) (*models.MessageClaim, error)
+	MarkProcessed(ctx context.Context, claim *models.MessageClaim) error
+	Release(ctx context.Context, claim *models.MessageClaim) error
+}
+
+// ChangeFeedRepository product changes shared by instances, subscriptions replay changes after resume token
+// before live changes
+type ChangeFeedRepository interface {
+	AppendChanges(ctx context.Context, changes ...*models.ProductChange) error
+	Subscribe(ctx context.Context, after string, match func(*models.ProductChangeEvent) bool) (ChangeSubscription, error)
+}
+
+// ChangeSubscription product changes in resume token order
+type ChangeSubscription interface {
+	Next(ctx context.Context) (*models.ProductChangeEvent, error)
+	Close()
+}
@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	searchCacheHits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "products_search_cache_hits_total",
+		Help: "The total number of search pages served from cache",
+	}, []string{"class"})
+	searchCacheMisses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "products_search_cache_misses_total",
+		Help: "The total number of search pages not found in cache",
+	}, []string{"class"})
+	searchCacheInvalidations = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "products_search_cache_invalidations_total",
+		Help: "The total number of cached search pages invalidated by product changes",
+	})
+)
+
+var (
+	productCacheHits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "products_cache_hits_total",
+		Help: "The total number of products found in cache by tier",
+	}, []string{"tier"})
+	productCacheMisses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "products_cache_misses_total",
+		Help: "The total number of products not found in cache by tier",
+	}, []string{"tier"})
+	productCacheEvictions = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "products_local_cache_evictions_total",
+		Help: "The total number of products evicted from full local cache",
+	})
+	productCacheInvalidations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "products_local_cache_invalidations_total",
+		Help: "The total number of local cache invalidations by direction",
+	}, []string{"direction"})
+	productCacheSize = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "products_local_cache_entries",
+		Help: "The number of products held in local cache",
+	})
+)
@@ -0,0 +1,21 @@
+package repository
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	watchSubscriptions = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "products_watch_subscriptions",
+		Help: "The number of product watches subscribed to live changes",
+	})
+	watchDelivered = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "products_watch_delivered_total",
+		Help: "The total number of product changes fanned out to watches",
+	})
+	watchOverflows = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "products_watch_overflows_total",
+		Help: "The total number of product watches closed for falling too far behind",
+	})
+)
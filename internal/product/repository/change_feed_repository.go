@@ -0,0 +1,416 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+
+	"github.com/Yangiboev/golang-with-curiosity/config"
+	"github.com/Yangiboev/golang-with-curiosity/internal/models"
+	"github.com/Yangiboev/golang-with-curiosity/internal/product"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/logger"
+	productErrors "github.com/Yangiboev/golang-with-curiosity/pkg/product_errors"
+)
+
+const (
+	changeField = "change"
+	firstID     = "0-0"
+)
+
+// productChangeFeedRepository product changes log in redis stream shared by instances. Every instance tails the stream
+// once and fans changes out to its subscriptions, stream entry ids are subscription resume tokens
+type productChangeFeedRepository struct {
+	log     logger.Logger
+	redis   redis.UniversalClient
+	cfg     config.ProductWatch
+	mu      sync.Mutex
+	subs    map[*changeSubscription]struct{}
+	stopped bool
+}
+
+// NewProductChangeFeedRepository constructor
+func NewProductChangeFeedRepository(log logger.Logger, redis redis.UniversalClient, cfg config.Config) *productChangeFeedRepository {
+	return &productChangeFeedRepository{
+		log:   log,
+		redis: redis,
+		cfg:   cfg.ProductWatch,
+		subs:  make(map[*changeSubscription]struct{}),
+	}
+}
+
+// AppendChanges append product changes to stream trimmed to about max len changes
+func (r *productChangeFeedRepository) AppendChanges(ctx context.Context, changes ...*models.ProductChange) error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "productChangeFeedRepository.AppendChanges")
+	defer span.Finish()
+
+	now := time.Now().UTC()
+	_, err := r.redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, change := range changes {
+			changeBytes, err := json.Marshal(models.NewProductChangeEvent(change, now))
+			if err != nil {
+				return errors.Wrap(err, "json.Marshal")
+			}
+			pipe.XAdd(ctx, &redis.XAddArgs{
+				Stream: r.cfg.Stream,
+				MaxLen: r.cfg.MaxLen,
+				Approx: true,
+				Values: map[string]interface{}{changeField: changeBytes},
+			})
+		}
+		return nil
+	})
+	return errors.Wrap(err, "productChangeFeedRepository.redis.Pipelined")
+}
+
+// Subscribe changes matching match, changes after resume token are replayed before live changes.
+// Empty token subscribes to live changes only. Resuming subscription receives live changes only once its replay
+// reached the last change at subscribe time, so live changes do not fill its buffer while it replays
+func (r *productChangeFeedRepository) Subscribe(ctx context.Context, after string, match func(*models.ProductChangeEvent) bool) (product.ChangeSubscription, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "productChangeFeedRepository.Subscribe")
+	defer span.Finish()
+
+	sub := &changeSubscription{
+		repo:   r,
+		match:  match,
+		events: make(chan *models.ProductChangeEvent, r.cfg.Buffer),
+		closed: make(chan struct{}),
+		last:   after,
+	}
+
+	if after == "" {
+		if err := r.register(sub); err != nil {
+			return nil, err
+		}
+		return sub, nil
+	}
+
+	tail, err := r.checkToken(ctx, after)
+	if err != nil {
+		return nil, err
+	}
+	sub.catchUp = tail
+	sub.replaying = true
+	return sub, nil
+}
+
+// register subscription for live changes
+func (r *productChangeFeedRepository) register(sub *changeSubscription) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.stopped || sub.unsubscribed {
+		return productErrors.ErrWatchClosed
+	}
+	r.subs[sub] = struct{}{}
+	sub.registered = true
+	watchSubscriptions.Inc()
+	return nil
+}
+
+// Run tail stream fanning changes out to subscriptions until context is done, then close subscriptions
+func (r *productChangeFeedRepository) Run(ctx context.Context) {
+	defer r.closeAll(productErrors.ErrWatchClosed)
+
+	last := ""
+	for {
+		if last == "" {
+			id, err := r.lastID(ctx)
+			if err != nil {
+				if !r.retry(ctx, err) {
+					return
+				}
+				continue
+			}
+			last = id
+		}
+
+		streams, err := r.redis.XRead(ctx, &redis.XReadArgs{
+			Streams: []string{r.cfg.Stream, last},
+			Count:   r.cfg.ReadBatch,
+			Block:   r.cfg.Block,
+		}).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			if !r.retry(ctx, err) {
+				return
+			}
+			continue
+		}
+
+		for _, stream := range streams {
+			for _, msg := range stream.Messages {
+				last = msg.ID
+				event, err := decodeChange(msg)
+				if err != nil {
+					r.log.Errorf("decodeChange: %v", err)
+					continue
+				}
+				r.broadcast(event)
+			}
+		}
+	}
+}
+
+// retry log tail error and wait before retrying, false when context is done
+func (r *productChangeFeedRepository) retry(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	r.log.Errorf("productChangeFeedRepository.Run: %v", err)
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(resubscribeDelay):
+		return true
+	}
+}
+
+// broadcast deliver change to matching subscriptions, subscriptions with full buffer are closed
+// and resume from their last delivered change on reconnect
+func (r *productChangeFeedRepository) broadcast(event *models.ProductChangeEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for sub := range r.subs {
+		if !sub.match(event) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+			watchDelivered.Inc()
+		default:
+			watchOverflows.Inc()
+			r.remove(sub, productErrors.ErrWatchTooSlow)
+		}
+	}
+}
+
+func (r *productChangeFeedRepository) closeAll(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.stopped = true
+	for sub := range r.subs {
+		r.remove(sub, err)
+	}
+}
+
+// remove unregister and close subscription, must be called with lock held
+func (r *productChangeFeedRepository) remove(sub *changeSubscription, err error) {
+	if _, ok := r.subs[sub]; !ok {
+		return
+	}
+	delete(r.subs, sub)
+	watchSubscriptions.Dec()
+	sub.err = err
+	close(sub.closed)
+}
+
+// checkToken resume token is a stream id still in stream, tokens older than stream head were trimmed
+// and tokens newer than stream tail belong to stream which no longer exists. Returns id of stream tail
+func (r *productChangeFeedRepository) checkToken(ctx context.Context, token string) (string, error) {
+	if _, _, err := parseStreamID(token); err != nil {
+		return "", err
+	}
+
+	var head, tail *redis.XMessageSliceCmd
+	_, err := r.redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		head = pipe.XRangeN(ctx, r.cfg.Stream, "-", "+", 1)
+		tail = pipe.XRevRangeN(ctx, r.cfg.Stream, "+", "-", 1)
+		return nil
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "productChangeFeedRepository.redis.Pipelined")
+	}
+
+	if len(head.Val()) == 0 || compareStreamIDs(head.Val()[0].ID, token) > 0 || compareStreamIDs(token, tail.Val()[0].ID) > 0 {
+		return "", productErrors.ErrResumeTokenExpired
+	}
+	return tail.Val()[0].ID, nil
+}
+
+// changesAfter up to count changes following token
+func (r *productChangeFeedRepository) changesAfter(ctx context.Context, token string, count int64) ([]*models.ProductChangeEvent, error) {
+	start, err := nextStreamID(token)
+	if err != nil {
+		return nil, err
+	}
+
+	msgs, err := r.redis.XRangeN(ctx, r.cfg.Stream, start, "+", count).Result()
+	if err != nil {
+		return nil, errors.Wrap(err, "productChangeFeedRepository.redis.XRangeN")
+	}
+
+	events := make([]*models.ProductChangeEvent, 0, len(msgs))
+	for _, msg := range msgs {
+		event, err := decodeChange(msg)
+		if err != nil {
+			r.log.Errorf("decodeChange: %v", err)
+			continue
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// lastID id of last change in stream, live changes are read after it
+func (r *productChangeFeedRepository) lastID(ctx context.Context) (string, error) {
+	msgs, err := r.redis.XRevRangeN(ctx, r.cfg.Stream, "+", "-", 1).Result()
+	if err != nil {
+		return "", errors.Wrap(err, "productChangeFeedRepository.redis.XRevRangeN")
+	}
+	if len(msgs) == 0 {
+		return firstID, nil
+	}
+	return msgs[0].ID, nil
+}
+
+// changeSubscription replays changes from stream, then serves live changes skipping those already replayed.
+// Replaying subscription registers for live changes once it replayed up to catchUp, and replays until stream end
+// after that, so changes appended meanwhile are not missed
+type changeSubscription struct {
+	repo         *productChangeFeedRepository
+	match        func(*models.ProductChangeEvent) bool
+	events       chan *models.ProductChangeEvent
+	closed       chan struct{}
+	err          error
+	last         string
+	catchUp      string
+	replaying    bool
+	pending      []*models.ProductChangeEvent
+	registered   bool
+	unsubscribed bool
+}
+
+// Next change of subscription, blocks until change arrives, context is done or subscription is closed
+func (s *changeSubscription) Next(ctx context.Context) (*models.ProductChangeEvent, error) {
+	for s.replaying {
+		if !s.registered && compareStreamIDs(s.last, s.catchUp) >= 0 {
+			if err := s.repo.register(s); err != nil {
+				return nil, err
+			}
+		}
+
+		if len(s.pending) == 0 {
+			events, err := s.repo.changesAfter(ctx, s.last, s.repo.cfg.ReadBatch)
+			if err != nil {
+				return nil, err
+			}
+			if len(events) == 0 && !s.registered {
+				if err := s.repo.register(s); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if len(events) == 0 {
+				s.replaying = false
+				break
+			}
+			s.pending = events
+		}
+
+		event := s.pending[0]
+		s.pending = s.pending[1:]
+		s.last = event.Token
+		if s.match(event) {
+			return event, nil
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-s.closed:
+			return nil, s.err
+		case event := <-s.events:
+			if s.last != "" && compareStreamIDs(event.Token, s.last) <= 0 {
+				continue
+			}
+			s.last = event.Token
+			return event, nil
+		}
+	}
+}
+
+// Close unsubscribe from live changes, replaying subscription is never registered
+func (s *changeSubscription) Close() {
+	s.repo.mu.Lock()
+	defer s.repo.mu.Unlock()
+	s.unsubscribed = true
+	s.repo.remove(s, productErrors.ErrWatchClosed)
+}
+
+func decodeChange(msg redis.XMessage) (*models.ProductChangeEvent, error) {
+	value, ok := msg.Values[changeField].(string)
+	if !ok {
+		return nil, fmt.Errorf("stream entry %s without change", msg.ID)
+	}
+
+	var event models.ProductChangeEvent
+	if err := json.Unmarshal([]byte(value), &event); err != nil {
+		return nil, errors.Wrap(err, "json.Unmarshal")
+	}
+	event.Token = msg.ID
+	return &event, nil
+}
+
+// parseStreamID milliseconds and sequence number of stream id
+func parseStreamID(id string) (uint64, uint64, error) {
+	parts := strings.SplitN(id, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, productErrors.ErrInvalidResumeToken
+	}
+	ms, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return 0, 0, productErrors.ErrInvalidResumeToken
+	}
+	seq, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return 0, 0, productErrors.ErrInvalidResumeToken
+	}
+	return ms, seq, nil
+}
+
+// compareStreamIDs -1, 0 or 1 as stream id a is before, same as or after b, ids are assumed valid
+func compareStreamIDs(a, b string) int {
+	aMs, aSeq, _ := parseStreamID(a)
+	bMs, bSeq, _ := parseStreamID(b)
+	switch {
+	case aMs < bMs || aMs == bMs && aSeq < bSeq:
+		return -1
+	case aMs == bMs && aSeq == bSeq:
+		return 0
+	default:
+		return 1
+	}
+}
+
+// nextStreamID smallest stream id after id, for exclusive ranges redis before 6.2 lacks
+func nextStreamID(id string) (string, error) {
+	ms, seq, err := parseStreamID(id)
+	if err != nil {
+		return "", err
+	}
+	if seq == ^uint64(0) {
+		return fmt.Sprintf("%d-0", ms+1), nil
+	}
+	return fmt.Sprintf("%d-%d", ms, seq+1), nil
+}
+
+// NewChangeFeedRepository product change feed tailed until context is done
+func NewChangeFeedRepository(ctx context.Context, log logger.Logger, redis redis.UniversalClient, cfg config.Config) product.ChangeFeedRepository {
+	changeFeed := NewProductChangeFeedRepository(log, redis, cfg)
+	go changeFeed.Run(ctx)
+	return changeFeed
+}
@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/Yangiboev/golang-with-curiosity/config"
+	"github.com/Yangiboev/golang-with-curiosity/internal/models"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/logger"
+)
+
+func newTestChangeFeed(t *testing.T) *productChangeFeedRepository {
+	t.Helper()
+	_, client := newTestRedis(t)
+
+	cfg := config.Config{}
+	cfg.Logger.Level = "fatal"
+	cfg.Logger.Encoding = "console"
+	cfg.ProductWatch = config.ProductWatch{Stream: "products:changes", MaxLen: 1000, ReadBatch: 2, Buffer: 2}
+	appLogger := logger.NewApiLogger(cfg)
+	appLogger.InitLogger()
+	return NewProductChangeFeedRepository(appLogger, client, cfg)
+}
+
+// appendAndBroadcast append changes to stream and broadcast them as stream tail would
+func appendAndBroadcast(t *testing.T, feed *productChangeFeedRepository, n int) {
+	t.Helper()
+	ctx := context.Background()
+	last, err := feed.lastID(ctx)
+	if err != nil {
+		t.Fatalf("lastID: %v", err)
+	}
+	appendChanges(t, feed, n)
+
+	events, err := feed.changesAfter(ctx, last, int64(n))
+	if err != nil {
+		t.Fatalf("changesAfter: %v", err)
+	}
+	for _, event := range events {
+		feed.broadcast(event)
+	}
+}
+
+func appendChanges(t *testing.T, feed *productChangeFeedRepository, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		change := &models.ProductChange{After: &models.Product{ProductID: primitive.NewObjectID()}}
+		if err := feed.AppendChanges(context.Background(), change); err != nil {
+			t.Fatalf("AppendChanges: %v", err)
+		}
+	}
+}
+
+func TestResumingSubscriptionIsNotOverflowedByLiveChangesWhileReplaying(t *testing.T) {
+	feed := newTestChangeFeed(t)
+	ctx := context.Background()
+	appendChanges(t, feed, 1)
+	token, err := feed.lastID(ctx)
+	if err != nil {
+		t.Fatalf("lastID: %v", err)
+	}
+	appendChanges(t, feed, 5)
+
+	sub, err := feed.Subscribe(ctx, token, func(*models.ProductChangeEvent) bool { return true })
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	defer sub.Close()
+
+	appendAndBroadcast(t, feed, 5)
+	last := token
+	for i := 0; i < 4; i++ {
+		event, err := sub.Next(ctx)
+		if err != nil {
+			t.Fatalf("Next %d: %v", i, err)
+		}
+		last = event.Token
+	}
+	appendAndBroadcast(t, feed, 5)
+
+	for i := 4; i < 15; i++ {
+		event, err := sub.Next(ctx)
+		if err != nil {
+			t.Fatalf("Next %d: %v", i, err)
+		}
+		if compareStreamIDs(event.Token, last) <= 0 {
+			t.Fatalf("change %s delivered after %s, want changes once and in order", event.Token, last)
+		}
+		last = event.Token
+	}
+
+	tail, err := feed.lastID(ctx)
+	if err != nil {
+		t.Fatalf("lastID: %v", err)
+	}
+	if last != tail {
+		t.Fatalf("last delivered change %s, want stream tail %s", last, tail)
+	}
+
+	appendAndBroadcast(t, feed, 1)
+	event, err := sub.Next(ctx)
+	if err != nil {
+		t.Fatalf("Next live: %v", err)
+	}
+	if compareStreamIDs(event.Token, last) <= 0 {
+		t.Fatalf("live change %s, want change after %s", event.Token, last)
+	}
+}
@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+
+	"github.com/Yangiboev/golang-with-curiosity/internal/models"
+)
+
+const (
+	processedPrefix     = "processed_messages"
+	processedExpiration = time.Hour * 24
+	processedValue      = "processed"
+	claimPrefix         = "claim:"
+	claimExpiration     = time.Minute * 5
+)
+
+// claimScript claim free key with token, returns stored value of taken key.
+// KEYS[1] message key, ARGV claim value, claim expiration in milliseconds
+var claimScript = redis.NewScript(`
+local stored = redis.call('GET', KEYS[1])
+if stored then
+  return stored
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return false
+`)
+
+// releaseScript delete claim of token. KEYS[1] message key, ARGV claim value. Returns 1 when claim was deleted
+var releaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+  return 0
+end
+redis.call('DEL', KEYS[1])
+return 1
+`)
+
+type idempotencyRedisRepository struct {
+	prefix string
+	redis  redis.UniversalClient
+}
+
+// NewIdempotencyRedisRepository constructor
+func NewIdempotencyRedisRepository(redis redis.UniversalClient) *idempotencyRedisRepository {
+	return &idempotencyRedisRepository{redis: redis, prefix: processedPrefix}
+}
+
+// Claim atomically claim message idempotency key for processing unless it is processed or claimed by another
+// consumer. Claims of consumers which died while processing expire
+func (i *idempotencyRedisRepository) Claim(ctx context.Context, key string) (*models.MessageClaim, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "idempotencyRedisRepository.Claim")
+	defer span.Finish()
+
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, errors.Wrap(err, "rand.Read")
+	}
+	claim := &models.MessageClaim{Key: key, Token: hex.EncodeToString(token), Status: models.MessageClaimed}
+
+	stored, err := claimScript.Run(ctx, i.redis, []string{i.createKey(key)}, claimPrefix+claim.Token, claimExpiration.Milliseconds()).Text()
+	if errors.Is(err, redis.Nil) {
+		return claim, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "idempotencyRedisRepository.claimScript.Run")
+	}
+
+	claim.Token = ""
+	claim.Status = models.MessageInFlight
+	if stored == processedValue {
+		claim.Status = models.MessageProcessed
+	}
+	return claim, nil
+}
+
+// MarkProcessed store message idempotency key until it can no longer be redelivered
+func (i *idempotencyRedisRepository) MarkProcessed(ctx context.Context, claim *models.MessageClaim) error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "idempotencyRedisRepository.MarkProcessed")
+	defer span.Finish()
+
+	if err := i.redis.SetEX(ctx, i.createKey(claim.Key), processedValue, processedExpiration).Err(); err != nil {
+		return errors.Wrap(err, "idempotencyRedisRepository.redis.SetEX")
+	}
+	return nil
+}
+
+// Release delete claim of failed message, so its retry or redelivery is processed again
+func (i *idempotencyRedisRepository) Release(ctx context.Context, claim *models.MessageClaim) error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "idempotencyRedisRepository.Release")
+	defer span.Finish()
+
+	if err := releaseScript.Run(ctx, i.redis, []string{i.createKey(claim.Key)}, claimPrefix+claim.Token).Err(); err != nil {
+		return errors.Wrap(err, "idempotencyRedisRepository.releaseScript.Run")
+	}
+	return nil
+}
+
+func (i *idempotencyRedisRepository) createKey(key string) string {
+	return fmt.Sprintf("%s:%s", i.prefix, key)
+}
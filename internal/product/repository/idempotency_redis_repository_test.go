@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+
+	"github.com/Yangiboev/golang-with-curiosity/internal/models"
+)
+
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, redis.UniversalClient) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return mr, client
+}
+
+func TestIdempotencyClaimIsExclusive(t *testing.T) {
+	_, client := newTestRedis(t)
+	repo := NewIdempotencyRedisRepository(client)
+	ctx := context.Background()
+
+	const consumers = 10
+	statuses := make(chan models.MessageClaimStatus, consumers)
+	wg := sync.WaitGroup{}
+	for i := 0; i < consumers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			claim, err := repo.Claim(ctx, "key")
+			if err != nil {
+				t.Errorf("Claim: %v", err)
+				return
+			}
+			statuses <- claim.Status
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	claimed := 0
+	for status := range statuses {
+		switch status {
+		case models.MessageClaimed:
+			claimed++
+		case models.MessageInFlight:
+		default:
+			t.Errorf("status = %v, want claimed or in flight", status)
+		}
+	}
+	if claimed != 1 {
+		t.Fatalf("claimed %d times, want once", claimed)
+	}
+}
+
+func TestIdempotencyMarkProcessed(t *testing.T) {
+	_, client := newTestRedis(t)
+	repo := NewIdempotencyRedisRepository(client)
+	ctx := context.Background()
+
+	claim, err := repo.Claim(ctx, "key")
+	if err != nil {
+		t.Fatalf("Claim: %v", err)
+	}
+	if err := repo.MarkProcessed(ctx, claim); err != nil {
+		t.Fatalf("MarkProcessed: %v", err)
+	}
+
+	redelivered, err := repo.Claim(ctx, "key")
+	if err != nil {
+		t.Fatalf("Claim: %v", err)
+	}
+	if redelivered.Status != models.MessageProcessed {
+		t.Fatalf("status = %v, want processed", redelivered.Status)
+	}
+}
+
+func TestIdempotencyReleaseOwnClaimOnly(t *testing.T) {
+	mr, client := newTestRedis(t)
+	repo := NewIdempotencyRedisRepository(client)
+	ctx := context.Background()
+
+	expired, err := repo.Claim(ctx, "key")
+	if err != nil {
+		t.Fatalf("Claim: %v", err)
+	}
+	mr.FastForward(claimExpiration)
+
+	current, err := repo.Claim(ctx, "key")
+	if err != nil {
+		t.Fatalf("Claim: %v", err)
+	}
+	if current.Status != models.MessageClaimed {
+		t.Fatalf("status = %v, want expired claim to be taken over", current.Status)
+	}
+
+	if err := repo.Release(ctx, expired); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	other, err := repo.Claim(ctx, "key")
+	if err != nil {
+		t.Fatalf("Claim: %v", err)
+	}
+	if other.Status != models.MessageInFlight {
+		t.Fatalf("status = %v, want release of expired claim to keep current claim", other.Status)
+	}
+
+	if err := repo.Release(ctx, current); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	retried, err := repo.Claim(ctx, "key")
+	if err != nil {
+		t.Fatalf("Claim: %v", err)
+	}
+	if retried.Status != models.MessageClaimed {
+		t.Fatalf("status = %v, want released message to be claimed again", retried.Status)
+	}
+}
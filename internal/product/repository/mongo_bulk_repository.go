@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/Yangiboev/golang-with-curiosity/internal/models"
+	productErrors "github.com/Yangiboev/golang-with-curiosity/pkg/product_errors"
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// BulkWrite apply product writes with one unordered bulk write. Writes of the same product are collapsed into a single
+// write of its last state, which is a create when the first of them is, and share its error. Updates of missing products
+// fail with not found. Returns write errors by write index
+func (p *productMongoRepo) BulkWrite(ctx context.Context, writes []*models.ProductWrite) ([]error, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "productMongoRepo.BulkWrite")
+	defer span.Finish()
+
+	collection := p.mongoDB.Database(productsDB).Collection(productsCollection)
+
+	for _, w := range writes {
+		if w.Op == models.ProductWriteCreate && w.Product.ProductID.IsZero() {
+			w.Product.ProductID = primitive.NewObjectID()
+		}
+	}
+
+	collapsed, collapsedIndex := collapseWrites(writes)
+	existing, err := p.existingProductIDs(ctx, collection, collapsed)
+	if err != nil {
+		return nil, err
+	}
+
+	collapsedErrs := make([]error, len(collapsed))
+	writeModels := make([]mongo.WriteModel, 0, len(collapsed))
+	indexes := make([]int, 0, len(collapsed))
+	for i, w := range collapsed {
+		if w.Op == models.ProductWriteUpdate && !existing[w.Product.ProductID] {
+			collapsedErrs[i] = errors.Wrap(productErrors.ErrProductNotFound, w.Product.ProductID.Hex())
+			continue
+		}
+		model, err := productWriteModel(w)
+		if err != nil {
+			collapsedErrs[i] = err
+			continue
+		}
+		writeModels = append(writeModels, model)
+		indexes = append(indexes, i)
+	}
+
+	if len(writeModels) > 0 {
+		_, err := collection.BulkWrite(ctx, writeModels, options.BulkWrite().SetOrdered(false))
+		var bulkErr mongo.BulkWriteException
+		switch {
+		case err == nil:
+		case !errors.As(err, &bulkErr) || len(bulkErr.WriteErrors) == 0:
+			return nil, errors.Wrap(err, "BulkWrite")
+		default:
+			for _, writeErr := range bulkErr.WriteErrors {
+				collapsedErrs[indexes[writeErr.Index]] = errors.Wrap(mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{writeErr}}, "BulkWrite")
+			}
+		}
+	}
+
+	writeErrs := make([]error, len(writes))
+	for i := range writes {
+		writeErrs[i] = collapsedErrs[collapsedIndex[i]]
+	}
+	return writeErrs, nil
+}
+
+// existingProductIDs stored ids of products updated by writes
+func (p *productMongoRepo) existingProductIDs(
+	ctx context.Context,
+	collection *mongo.Collection,
+	writes []*models.ProductWrite,
+) (map[primitive.ObjectID]bool, error) {
+	ids := make([]primitive.ObjectID, 0, len(writes))
+	for _, w := range writes {
+		if w.Op == models.ProductWriteUpdate {
+			ids = append(ids, w.Product.ProductID)
+		}
+	}
+	existing := make(map[primitive.ObjectID]bool, len(ids))
+	if len(ids) == 0 {
+		return existing, nil
+	}
+
+	cursor, err := collection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}}, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, errors.Wrap(err, "Find")
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var doc struct {
+			ProductID primitive.ObjectID `bson:"_id"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, errors.Wrap(err, "Decode")
+		}
+		existing[doc.ProductID] = true
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, errors.Wrap(err, "cursor.Err")
+	}
+	return existing, nil
+}
+
+// collapseWrites collapse writes of the same product into one write of its last state in order of first write of product,
+// returns collapsed writes and index of collapsed write by write index
+func collapseWrites(writes []*models.ProductWrite) ([]*models.ProductWrite, []int) {
+	collapsed := make([]*models.ProductWrite, 0, len(writes))
+	collapsedIndex := make([]int, len(writes))
+	byProduct := make(map[primitive.ObjectID]int, len(writes))
+	for i, w := range writes {
+		j, ok := byProduct[w.Product.ProductID]
+		if !ok {
+			byProduct[w.Product.ProductID] = len(collapsed)
+			collapsedIndex[i] = len(collapsed)
+			collapsed = append(collapsed, &models.ProductWrite{Op: w.Op, Product: w.Product})
+			continue
+		}
+		collapsed[j].Product = w.Product
+		collapsedIndex[i] = j
+	}
+	return collapsed, collapsedIndex
+}
+
+func productWriteModel(w *models.ProductWrite) (mongo.WriteModel, error) {
+	switch w.Op {
+	case models.ProductWriteCreate:
+		w.Product.CreatedAt = time.Now().UTC()
+		w.Product.UpdatedAt = time.Now().UTC()
+		return mongo.NewInsertOneModel().SetDocument(w.Product), nil
+	case models.ProductWriteUpdate:
+		w.Product.UpdatedAt = time.Now().UTC()
+		return mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": w.Product.ProductID}).
+			SetUpdate(bson.M{"$set": w.Product}), nil
+	default:
+		return nil, errors.Errorf("unknown product write: %s", w.Op)
+	}
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/Yangiboev/golang-with-curiosity/internal/models"
+)
+
+func TestCollapseWritesKeepsLastStateOfProduct(t *testing.T) {
+	first, second := primitive.NewObjectID(), primitive.NewObjectID()
+	writes := []*models.ProductWrite{
+		{Op: models.ProductWriteCreate, Product: &models.Product{ProductID: first, Name: "created"}},
+		{Op: models.ProductWriteUpdate, Product: &models.Product{ProductID: second, Name: "second"}},
+		{Op: models.ProductWriteUpdate, Product: &models.Product{ProductID: first, Name: "updated"}},
+		{Op: models.ProductWriteUpdate, Product: &models.Product{ProductID: first, Name: "last"}},
+	}
+
+	collapsed, collapsedIndex := collapseWrites(writes)
+
+	if len(collapsed) != 2 {
+		t.Fatalf("collapsed %d writes, want one write per product", len(collapsed))
+	}
+	if collapsed[0].Op != models.ProductWriteCreate || collapsed[0].Product.Name != "last" {
+		t.Fatalf("collapsed write %s %q, want create of last state", collapsed[0].Op, collapsed[0].Product.Name)
+	}
+	if collapsed[1].Product.ProductID != second {
+		t.Fatalf("collapsed writes out of first write order")
+	}
+	if want := []int{0, 1, 0, 0}; !equalInts(collapsedIndex, want) {
+		t.Fatalf("collapsed index %v, want %v", collapsedIndex, want)
+	}
+	if writes[0].Product.Name != "created" {
+		t.Fatalf("collapse modified original write")
+	}
+}
+
+func TestProductWriteModelUpdateBumpsUpdatedAtWithoutUpsert(t *testing.T) {
+	stale := time.Date(2021, time.March, 1, 12, 0, 0, 0, time.UTC)
+	w := &models.ProductWrite{Op: models.ProductWriteUpdate, Product: &models.Product{ProductID: primitive.NewObjectID(), UpdatedAt: stale}}
+
+	model, err := productWriteModel(w)
+	if err != nil {
+		t.Fatalf("productWriteModel: %v", err)
+	}
+
+	update, ok := model.(*mongo.UpdateOneModel)
+	if !ok {
+		t.Fatalf("write model %T, want update one model", model)
+	}
+	if update.Upsert != nil && *update.Upsert {
+		t.Fatalf("update upserts, want update of missing product to match nothing")
+	}
+	if !w.Product.UpdatedAt.After(stale) {
+		t.Fatalf("updatedAt = %v, want bumped to write time", w.Product.UpdatedAt)
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -62,6 +62,8 @@ func (p *productMongoRepo) Update(ctx context.Context, product *models.Product)
 
 	collection := p.mongoDB.Database(productsDB).Collection(productsCollection)
 
+	product.UpdatedAt = time.Now().UTC()
+
 	ops := options.FindOneAndUpdate()
 	ops.SetReturnDocument(options.After)
 	ops.SetUpsert(true)
@@ -83,6 +85,48 @@ func (p *productMongoRepo) GetByID(ctx context.Context, productID primitive.Obje
 
 	var prod models.Product
 	if err := collection.FindOne(ctx, bson.M{"_id": productID}).Decode(&prod); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errors.Wrap(productErrors.ErrProductNotFound, productID.Hex())
+		}
+		return nil, errors.Wrap(err, "Decode")
+	}
+
+	return &prod, nil
+}
+
+// GetByIDs Get products by ids, missing products are skipped
+func (p *productMongoRepo) GetByIDs(ctx context.Context, productIDs []primitive.ObjectID) ([]*models.Product, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "productMongoRepo.GetByIDs")
+	defer span.Finish()
+
+	collection := p.mongoDB.Database(productsDB).Collection(productsCollection)
+
+	cursor, err := collection.Find(ctx, bson.M{"_id": bson.M{"$in": productIDs}})
+	if err != nil {
+		return nil, errors.Wrap(err, "Find")
+	}
+	defer cursor.Close(ctx)
+
+	products := make([]*models.Product, 0, len(productIDs))
+	if err := cursor.All(ctx, &products); err != nil {
+		return nil, errors.Wrap(err, "cursor.All")
+	}
+
+	return products, nil
+}
+
+// Delete Delete single product, returns deleted product
+func (p *productMongoRepo) Delete(ctx context.Context, productID primitive.ObjectID) (*models.Product, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "productMongoRepo.Delete")
+	defer span.Finish()
+
+	collection := p.mongoDB.Database(productsDB).Collection(productsCollection)
+
+	var prod models.Product
+	if err := collection.FindOneAndDelete(ctx, bson.M{"_id": productID}).Decode(&prod); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errors.Wrap(productErrors.ErrProductNotFound, productID.Hex())
+		}
 		return nil, errors.Wrap(err, "Decode")
 	}
 
@@ -157,3 +201,21 @@ func (p *productMongoRepo) Search(ctx context.Context, search string, pagination
 		Products:   products,
 	}, nil
 }
+
+// WithTransaction run fn in transaction, reads and writes made with fn context are committed together. fn is run again
+// on transient transaction errors, transactions need replica set deployment
+func (p *productMongoRepo) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "productMongoRepo.WithTransaction")
+	defer span.Finish()
+
+	session, err := p.mongoDB.StartSession()
+	if err != nil {
+		return errors.Wrap(err, "StartSession")
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sessCtx)
+	})
+	return err
+}
@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/Yangiboev/golang-with-curiosity/internal/models"
+)
+
+const (
+	outboxCollection      = "products_outbox"
+	outboxLeaseCollection = "outbox_leases"
+	outboxRelayLease      = "products_outbox_relay"
+)
+
+// outboxMongoRepo product changes outbox stored next to products, so changes are appended in product write transactions
+type outboxMongoRepo struct {
+	mongoDB *mongo.Client
+}
+
+// NewOutboxMongoRepo outboxMongoRepo constructor
+func NewOutboxMongoRepo(mongoDB *mongo.Client) *outboxMongoRepo {
+	return &outboxMongoRepo{mongoDB: mongoDB}
+}
+
+// AppendChanges store product changes, called with transaction context of product writes
+func (o *outboxMongoRepo) AppendChanges(ctx context.Context, changes ...*models.ProductChange) error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "outboxMongoRepo.AppendChanges")
+	defer span.Finish()
+
+	if len(changes) == 0 {
+		return nil
+	}
+
+	collection := o.mongoDB.Database(productsDB).Collection(outboxCollection)
+
+	now := time.Now().UTC()
+	docs := make([]interface{}, 0, len(changes))
+	for _, change := range changes {
+		docs = append(docs, &models.ProductOutboxEntry{
+			ID:        primitive.NewObjectID(),
+			Before:    change.Before,
+			After:     change.After,
+			CreatedAt: now,
+		})
+	}
+
+	if _, err := collection.InsertMany(ctx, docs); err != nil {
+		return errors.Wrap(err, "InsertMany")
+	}
+	return nil
+}
+
+// AcquireRelay take or extend relay lease for owner, false when another owner holds unexpired lease
+func (o *outboxMongoRepo) AcquireRelay(ctx context.Context, owner string, lease time.Duration) (bool, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "outboxMongoRepo.AcquireRelay")
+	defer span.Finish()
+
+	collection := o.mongoDB.Database(productsDB).Collection(outboxLeaseCollection)
+
+	now := time.Now().UTC()
+	filter := bson.M{
+		"_id": outboxRelayLease,
+		"$or": bson.A{
+			bson.M{"owner": owner},
+			bson.M{"expiresAt": bson.M{"$lte": now}},
+		},
+	}
+	update := bson.M{"$set": bson.M{"owner": owner, "expiresAt": now.Add(lease)}}
+
+	// lease held by another owner does not match filter, so upsert inserts lease id again and fails with duplicate key
+	_, err := collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	switch {
+	case err == nil:
+		return true, nil
+	case mongo.IsDuplicateKeyError(err):
+		return false, nil
+	default:
+		return false, errors.Wrap(err, "UpdateOne")
+	}
+}
+
+// PendingChanges oldest stored product changes up to limit in ID order
+func (o *outboxMongoRepo) PendingChanges(ctx context.Context, limit int) ([]*models.ProductOutboxEntry, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "outboxMongoRepo.PendingChanges")
+	defer span.Finish()
+
+	collection := o.mongoDB.Database(productsDB).Collection(outboxCollection)
+
+	cursor, err := collection.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"_id": 1}).SetLimit(int64(limit)))
+	if err != nil {
+		return nil, errors.Wrap(err, "Find")
+	}
+	defer cursor.Close(ctx)
+
+	entries := make([]*models.ProductOutboxEntry, 0, limit)
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, errors.Wrap(err, "cursor.All")
+	}
+	return entries, nil
+}
+
+// RemoveChanges remove published product changes
+func (o *outboxMongoRepo) RemoveChanges(ctx context.Context, ids []primitive.ObjectID) error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "outboxMongoRepo.RemoveChanges")
+	defer span.Finish()
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	collection := o.mongoDB.Database(productsDB).Collection(outboxCollection)
+
+	if _, err := collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}}); err != nil {
+		return errors.Wrap(err, "DeleteMany")
+	}
+	return nil
+}
@@ -6,7 +6,10 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/Yangiboev/golang-with-curiosity/config"
 	"github.com/Yangiboev/golang-with-curiosity/internal/models"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/cache"
+	productErrors "github.com/Yangiboev/golang-with-curiosity/pkg/product_errors"
 	"github.com/go-redis/redis/v8"
 	"github.com/opentracing/opentracing-go"
 	"github.com/pkg/errors"
@@ -14,46 +17,198 @@ import (
 )
 
 const (
-	prefix     = "products"
-	expiration = time.Second * 3600
+	prefix = "products"
+	// keyVersion version of cached entry encoding, bump it on incompatible CachedProduct changes so entries
+	// written by previous releases are never decoded and expire on their own
+	keyVersion = "v2"
+	// missingVersion version of not found entries of products read missing from database
+	missingVersion = 0
 )
 
+// storeScript store entry unless stored entry of the key has newer version, so entries read before a product was
+// changed or deleted do not replace entries of the change. KEYS[1] product key, ARGV entry, entry version,
+// key expiration in milliseconds. Returns 1 when entry was stored
+var storeScript = redis.NewScript(`
+local stored = redis.call('GET', KEYS[1])
+if stored then
+  local ok, entry = pcall(cjson.decode, stored)
+  if ok and type(entry) == 'table' and tonumber(entry.version) and tonumber(entry.version) > tonumber(ARGV[2]) then
+    return 0
+  end
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[3])
+return 1
+`)
+
 type productRedisRepository struct {
 	prefix string
-	redis  *redis.Client
+	redis  redis.UniversalClient
+	cfg    config.ProductCache
 }
 
 // NewProductRedisRepository constructor
-func NewProductRedisRepository(redis *redis.Client) *productRedisRepository {
-	return &productRedisRepository{redis: redis, prefix: prefix}
+func NewProductRedisRepository(redis redis.UniversalClient, cfg config.Config) *productRedisRepository {
+	return &productRedisRepository{redis: redis, prefix: prefix, cfg: cfg.ProductCache}
 }
 
-func (p *productRedisRepository) SetProduct(ctx context.Context, product *models.Product) error {
+// SetProduct cache product fresh for jittered TTL and kept stale TTL longer, delta is how long loading it took,
+// zero delta disables early expiration of the entry. Entries of newer product versions or later deletions are kept
+func (p *productRedisRepository) SetProduct(ctx context.Context, product *models.Product, delta time.Duration) error {
 	span, ctx := opentracing.StartSpanFromContext(ctx, "productRedisRepository.SetProduct")
 	defer span.Finish()
 
-	prodBytes, err := json.Marshal(product)
+	prodBytes, ttl, err := p.productEntry(product, delta)
 	if err != nil {
-		return errors.Wrap(err, "productRedisRepository.Marshal")
+		return err
 	}
 
-	return p.redis.SetEX(ctx, p.createKey(product.ProductID), string(prodBytes), expiration).Err()
+	err = storeScript.Run(ctx, p.redis, []string{p.createKey(product.ProductID)}, prodBytes, productVersion(product), ttl.Milliseconds()).Err()
+	return errors.Wrap(err, "productRedisRepository.storeScript.Run")
+}
+
+// FillProduct cache product read from database, stored like written product
+func (p *productRedisRepository) FillProduct(ctx context.Context, product *models.Product, delta time.Duration) error {
+	return p.SetProduct(ctx, product, delta)
+}
+
+// FillNotFound remember product read from database does not exist. Entry has zero version, so it never replaces
+// product entry written by create that raced the read and any product entry replaces it
+func (p *productRedisRepository) FillNotFound(ctx context.Context, productID primitive.ObjectID) error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "productRedisRepository.FillNotFound")
+	defer span.Finish()
+
+	return p.storeNotFound(ctx, productID, missingVersion)
+}
+
+// FillProducts cache products and not found entries of missing products in one pipeline, keeping newer entries
+func (p *productRedisRepository) FillProducts(ctx context.Context, products []*models.Product, missing []primitive.ObjectID, delta time.Duration) error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "productRedisRepository.FillProducts")
+	defer span.Finish()
+
+	_, err := p.redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, product := range products {
+			prodBytes, ttl, err := p.productEntry(product, delta)
+			if err != nil {
+				return err
+			}
+			storeScript.Eval(ctx, pipe, []string{p.createKey(product.ProductID)}, prodBytes, productVersion(product), ttl.Milliseconds())
+		}
+		if p.cfg.NegativeTTL == 0 {
+			return nil
+		}
+		for _, productID := range missing {
+			entryBytes, err := p.notFoundEntry(missingVersion)
+			if err != nil {
+				return err
+			}
+			storeScript.Eval(ctx, pipe, []string{p.createKey(productID)}, entryBytes, missingVersion, p.cfg.NegativeTTL.Milliseconds())
+		}
+		return nil
+	})
+	return errors.Wrap(err, "productRedisRepository.redis.Pipelined")
+}
+
+// SetNotFound remember deleted product does not exist for negative TTL, entry is versioned by deletion time.
+// No-op when negative caching is disabled
+func (p *productRedisRepository) SetNotFound(ctx context.Context, productID primitive.ObjectID) error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "productRedisRepository.SetNotFound")
+	defer span.Finish()
+
+	return p.storeNotFound(ctx, productID, time.Now().UnixMilli())
 }
 
-func (p *productRedisRepository) GetProductByID(ctx context.Context, productID primitive.ObjectID) (*models.Product, error) {
+// storeNotFound store not found entry of version unless newer entry is stored
+func (p *productRedisRepository) storeNotFound(ctx context.Context, productID primitive.ObjectID, version int64) error {
+	if p.cfg.NegativeTTL == 0 {
+		return nil
+	}
+
+	entryBytes, err := p.notFoundEntry(version)
+	if err != nil {
+		return err
+	}
+
+	err = storeScript.Run(ctx, p.redis, []string{p.createKey(productID)}, entryBytes, version, p.cfg.NegativeTTL.Milliseconds()).Err()
+	return errors.Wrap(err, "productRedisRepository.storeScript.Run")
+}
+
+// GetProductByID cached product entry, may be past its soft expiration or be a not found entry,
+// returns ErrCacheMiss when product is not cached
+func (p *productRedisRepository) GetProductByID(ctx context.Context, productID primitive.ObjectID) (*models.CachedProduct, error) {
 	span, ctx := opentracing.StartSpanFromContext(ctx, "productRedisRepository.GetProductByID")
 	defer span.Finish()
 
-	result, err := p.redis.Get(ctx, p.createKey(productID)).Bytes()
+	result, err := p.redis.Get(ctx, p.createKey(productID)).Result()
 	if err != nil {
+		if err == redis.Nil {
+			return nil, productErrors.ErrCacheMiss
+		}
 		return nil, errors.Wrap(err, "productRedisRepository.redis.Get")
 	}
 
-	var res models.Product
-	if err := json.Unmarshal(result, &res); err != nil {
-		return nil, errors.Wrap(err, "json.Unmarshal")
+	return decodeCachedProduct(result)
+}
+
+// GetProducts cached entries of products by id in one MGET, products not cached are absent from result.
+// Cluster keys of different slots can not be read with one MGET, there entries are read in one pipeline of GETs
+func (p *productRedisRepository) GetProducts(ctx context.Context, productIDs []primitive.ObjectID) (map[primitive.ObjectID]*models.CachedProduct, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "productRedisRepository.GetProducts")
+	defer span.Finish()
+
+	entries := make(map[primitive.ObjectID]*models.CachedProduct, len(productIDs))
+	if len(productIDs) == 0 {
+		return entries, nil
 	}
-	return &res, nil
+
+	keys := make([]string, 0, len(productIDs))
+	for _, productID := range productIDs {
+		keys = append(keys, p.createKey(productID))
+	}
+
+	values, err := p.getMany(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, value := range values {
+		result, ok := value.(string)
+		if !ok {
+			continue
+		}
+		entry, err := decodeCachedProduct(result)
+		if err != nil {
+			continue
+		}
+		entries[productIDs[i]] = entry
+	}
+	return entries, nil
+}
+
+// getMany values of keys, nil for missing keys
+func (p *productRedisRepository) getMany(ctx context.Context, keys []string) ([]interface{}, error) {
+	if _, ok := p.redis.(*redis.ClusterClient); !ok {
+		values, err := p.redis.MGet(ctx, keys...).Result()
+		return values, errors.Wrap(err, "productRedisRepository.redis.MGet")
+	}
+
+	cmds := make([]*redis.StringCmd, 0, len(keys))
+	_, err := p.redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range keys {
+			cmds = append(cmds, pipe.Get(ctx, key))
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, errors.Wrap(err, "productRedisRepository.redis.Pipelined")
+	}
+
+	values := make([]interface{}, len(keys))
+	for i, cmd := range cmds {
+		if value, err := cmd.Result(); err == nil {
+			values[i] = value
+		}
+	}
+	return values, nil
 }
 
 func (p *productRedisRepository) DeleteProduct(ctx context.Context, productID primitive.ObjectID) error {
@@ -63,6 +218,51 @@ func (p *productRedisRepository) DeleteProduct(ctx context.Context, productID pr
 	return p.redis.Del(ctx, p.createKey(productID)).Err()
 }
 
+// productEntry encoded product entry and its key TTL
+func (p *productRedisRepository) productEntry(product *models.Product, delta time.Duration) (string, time.Duration, error) {
+	ttl := cache.JitteredTTL(p.cfg.TTL, p.cfg.Jitter)
+	prodBytes, err := json.Marshal(&models.CachedProduct{
+		Product:   product,
+		ExpiresAt: time.Now().Add(ttl),
+		Delta:     delta,
+		Version:   productVersion(product),
+	})
+	if err != nil {
+		return "", 0, errors.Wrap(err, "productRedisRepository.Marshal")
+	}
+	return string(prodBytes), ttl + p.cfg.StaleTTL, nil
+}
+
+// notFoundEntry encoded not found entry of version
+func (p *productRedisRepository) notFoundEntry(version int64) (string, error) {
+	entryBytes, err := json.Marshal(&models.CachedProduct{
+		NotFound:  true,
+		ExpiresAt: time.Now().Add(p.cfg.NegativeTTL),
+		Version:   version,
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "productRedisRepository.Marshal")
+	}
+	return string(entryBytes), nil
+}
+
+// productVersion version of product entry, product update time in milliseconds
+func productVersion(product *models.Product) int64 {
+	return product.UpdatedAt.UnixMilli()
+}
+
+// decodeCachedProduct cached entry, entries without product which are not not found entries are misses
+func decodeCachedProduct(value string) (*models.CachedProduct, error) {
+	var res models.CachedProduct
+	if err := json.Unmarshal([]byte(value), &res); err != nil {
+		return nil, errors.Wrap(err, "json.Unmarshal")
+	}
+	if res.Product == nil && !res.NotFound {
+		return nil, productErrors.ErrCacheMiss
+	}
+	return &res, nil
+}
+
 func (p *productRedisRepository) createKey(id primitive.ObjectID) string {
-	return fmt.Sprintf("%s: %s", p.prefix, id.String())
+	return fmt.Sprintf("%s:%s:%s", p.prefix, keyVersion, id.Hex())
 }
@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/Yangiboev/golang-with-curiosity/config"
+	"github.com/Yangiboev/golang-with-curiosity/internal/models"
+)
+
+func newTestProductRepository(t *testing.T) *productRedisRepository {
+	t.Helper()
+	_, client := newTestRedis(t)
+
+	cfg := config.Config{}
+	cfg.ProductCache = config.ProductCache{TTL: time.Hour, StaleTTL: time.Minute, NegativeTTL: time.Minute}
+	return NewProductRedisRepository(client, cfg)
+}
+
+func cachedProduct(t *testing.T, repo *productRedisRepository, productID primitive.ObjectID) *models.CachedProduct {
+	t.Helper()
+	cached, err := repo.GetProductByID(context.Background(), productID)
+	if err != nil {
+		t.Fatalf("GetProductByID: %v", err)
+	}
+	return cached
+}
+
+func TestSetProductKeepsNewerVersion(t *testing.T) {
+	repo := newTestProductRepository(t)
+	ctx := context.Background()
+	productID := primitive.NewObjectID()
+	updatedAt := time.Now().UTC()
+
+	updated := &models.Product{ProductID: productID, Name: "updated", UpdatedAt: updatedAt}
+	if err := repo.SetProduct(ctx, updated, 0); err != nil {
+		t.Fatalf("SetProduct: %v", err)
+	}
+	read := &models.Product{ProductID: productID, Name: "read before update", UpdatedAt: updatedAt.Add(-time.Second)}
+	if err := repo.FillProduct(ctx, read, time.Millisecond); err != nil {
+		t.Fatalf("FillProduct: %v", err)
+	}
+	if cached := cachedProduct(t, repo, productID); cached.Product == nil || cached.Product.Name != "updated" {
+		t.Fatalf("cached %+v, want updated product kept", cached)
+	}
+
+	newer := &models.Product{ProductID: productID, Name: "newer", UpdatedAt: updatedAt.Add(time.Second)}
+	if err := repo.FillProducts(ctx, []*models.Product{newer}, nil, time.Millisecond); err != nil {
+		t.Fatalf("FillProducts: %v", err)
+	}
+	if cached := cachedProduct(t, repo, productID); cached.Product == nil || cached.Product.Name != "newer" {
+		t.Fatalf("cached %+v, want newer product stored", cached)
+	}
+}
+
+func TestSetProductKeepsLaterDeletion(t *testing.T) {
+	repo := newTestProductRepository(t)
+	ctx := context.Background()
+	productID := primitive.NewObjectID()
+
+	read := &models.Product{ProductID: productID, Name: "read before delete", UpdatedAt: time.Now().Add(-time.Second)}
+	if err := repo.SetNotFound(ctx, productID); err != nil {
+		t.Fatalf("SetNotFound: %v", err)
+	}
+	if err := repo.FillProducts(ctx, []*models.Product{read}, nil, time.Millisecond); err != nil {
+		t.Fatalf("FillProducts: %v", err)
+	}
+	if err := repo.FillProduct(ctx, read, time.Millisecond); err != nil {
+		t.Fatalf("FillProduct: %v", err)
+	}
+
+	if cached := cachedProduct(t, repo, productID); !cached.NotFound {
+		t.Fatalf("cached %+v, want not found entry of deletion kept", cached)
+	}
+}
+
+func TestFillNotFoundKeepsCreatedProduct(t *testing.T) {
+	repo := newTestProductRepository(t)
+	ctx := context.Background()
+	created := &models.Product{ProductID: primitive.NewObjectID(), Name: "created", UpdatedAt: time.Now().UTC()}
+
+	if err := repo.SetProduct(ctx, created, 0); err != nil {
+		t.Fatalf("SetProduct: %v", err)
+	}
+	if err := repo.FillNotFound(ctx, created.ProductID); err != nil {
+		t.Fatalf("FillNotFound: %v", err)
+	}
+	if err := repo.FillProducts(ctx, nil, []primitive.ObjectID{created.ProductID}, time.Millisecond); err != nil {
+		t.Fatalf("FillProducts: %v", err)
+	}
+	if cached := cachedProduct(t, repo, created.ProductID); cached.Product == nil {
+		t.Fatalf("cached %+v, want created product kept", cached)
+	}
+
+	missing := primitive.NewObjectID()
+	if err := repo.FillNotFound(ctx, missing); err != nil {
+		t.Fatalf("FillNotFound: %v", err)
+	}
+	createdLater := &models.Product{ProductID: missing, Name: "created later", UpdatedAt: time.Now().UTC()}
+	if err := repo.SetProduct(ctx, createdLater, 0); err != nil {
+		t.Fatalf("SetProduct: %v", err)
+	}
+	if cached := cachedProduct(t, repo, missing); cached.Product == nil {
+		t.Fatalf("cached %+v, want not found entry replaced by created product", cached)
+	}
+}
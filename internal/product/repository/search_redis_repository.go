@@ -0,0 +1,424 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/Yangiboev/golang-with-curiosity/config"
+	"github.com/Yangiboev/golang-with-curiosity/internal/models"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/utils"
+)
+
+const (
+	searchPrefix = "products:search"
+
+	queryClassBrowse  = "browse"
+	queryClassTerm    = "term"
+	queryClassPattern = "pattern"
+	queryClassDeep    = "deep"
+
+	// queryGramLen length of grams plain text queries are indexed by, product text matching query contains its first gram
+	queryGramLen = 3
+)
+
+// searchRedisRepository search pages cache. Every page is tagged with its query, products and their categories,
+// tags are redis sets of page keys. Product changes drop pages tagged with the product or its categories and all pages
+// of cached queries matching the product before or after the change, as the change may move it in or out of their results.
+// Plain text queries are indexed by their first gram, so queries matching a product are looked up by grams of its text,
+// queries which can not be indexed that way are kept in scan index checked on every change. Every invalidation bumps
+// search generation, pages read from database before invalidation are not stored
+type searchRedisRepository struct {
+	prefix string
+	redis  redis.UniversalClient
+	cfg    config.SearchCache
+}
+
+// NewSearchRedisRepository constructor
+func NewSearchRedisRepository(redis redis.UniversalClient, cfg config.Config) *searchRedisRepository {
+	return &searchRedisRepository{redis: redis, cfg: cfg.SearchCache, prefix: searchPrefix}
+}
+
+// GetSearch cached search page, nil on cache miss, and search generation to store page read on miss with
+func (s *searchRedisRepository) GetSearch(ctx context.Context, search string, pagination *utils.Pagination) (*models.ProductsList, int64, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "searchRedisRepository.GetSearch")
+	defer span.Finish()
+
+	if !s.cfg.Enabled {
+		return nil, 0, nil
+	}
+	class := s.queryClass(search, pagination)
+
+	var page, generation *redis.StringCmd
+	_, err := s.redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		page = pipe.Get(ctx, s.pageKey(search, pagination))
+		generation = pipe.Get(ctx, s.generationKey())
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, 0, errors.Wrap(err, "searchRedisRepository.redis.Pipelined")
+	}
+
+	gen, err := generation.Int64()
+	if err != nil && err != redis.Nil {
+		return nil, 0, errors.Wrap(err, "searchRedisRepository.generation.Int64")
+	}
+
+	result, err := page.Bytes()
+	if err == redis.Nil {
+		searchCacheMisses.WithLabelValues(class).Inc()
+		return nil, gen, nil
+	}
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "searchRedisRepository.redis.Get")
+	}
+
+	var list models.ProductsList
+	if err := json.Unmarshal(result, &list); err != nil {
+		return nil, 0, errors.Wrap(err, "json.Unmarshal")
+	}
+	searchCacheHits.WithLabelValues(class).Inc()
+	return &list, gen, nil
+}
+
+// SetSearch cache search page for its query class TTL, tag it with query, products and categories and index its query.
+// Page is not stored when search generation changed since generation page was read at, page stored while it changes
+// is dropped again, so page missing product changes is never served longer than until the store completes
+func (s *searchRedisRepository) SetSearch(
+	ctx context.Context,
+	search string,
+	pagination *utils.Pagination,
+	list *models.ProductsList,
+	generation int64,
+) error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "searchRedisRepository.SetSearch")
+	defer span.Finish()
+
+	if !s.cfg.Enabled {
+		return nil
+	}
+
+	changed, err := s.generationChanged(ctx, generation)
+	if err != nil || changed {
+		return err
+	}
+
+	listBytes, err := json.Marshal(list)
+	if err != nil {
+		return errors.Wrap(err, "json.Marshal")
+	}
+
+	key := s.pageKey(search, pagination)
+	tags := []string{s.queryTag(search)}
+	for _, prod := range list.Products {
+		tags = append(tags, s.productTag(prod.ProductID))
+		if !prod.CategoryID.IsZero() {
+			tags = append(tags, s.categoryTag(prod.CategoryID))
+		}
+	}
+
+	indexKey := s.queryIndexKey(search)
+	_, err = s.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SetEX(ctx, key, listBytes, s.ttl(s.queryClass(search, pagination)))
+		for _, tag := range tags {
+			pipe.SAdd(ctx, tag, key)
+			pipe.Expire(ctx, tag, s.cfg.TTL.MaxTTL())
+		}
+		pipe.SAdd(ctx, indexKey, normalizeQuery(search))
+		pipe.Expire(ctx, indexKey, s.cfg.TTL.MaxTTL())
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "searchRedisRepository.redis.TxPipelined")
+	}
+
+	changed, err = s.generationChanged(ctx, generation)
+	if err != nil || !changed {
+		return err
+	}
+	return errors.Wrap(s.redis.Del(ctx, key).Err(), "searchRedisRepository.redis.Del")
+}
+
+// generationChanged whether search generation is other than generation
+func (s *searchRedisRepository) generationChanged(ctx context.Context, generation int64) (bool, error) {
+	current, err := s.redis.Get(ctx, s.generationKey()).Int64()
+	if err != nil && err != redis.Nil {
+		return false, errors.Wrap(err, "searchRedisRepository.redis.Get")
+	}
+	return current != generation, nil
+}
+
+// InvalidateProducts drop search pages affected by product changes
+func (s *searchRedisRepository) InvalidateProducts(ctx context.Context, changes ...*models.ProductChange) error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "searchRedisRepository.InvalidateProducts")
+	defer span.Finish()
+
+	if !s.cfg.Enabled || len(changes) == 0 {
+		return nil
+	}
+
+	// pages being read from database now may miss the changes, bump generation before dropping cached pages
+	if err := s.redis.Incr(ctx, s.generationKey()).Err(); err != nil {
+		return errors.Wrap(err, "searchRedisRepository.redis.Incr")
+	}
+
+	tags := make([]string, 0, len(changes)*3)
+	for _, change := range changes {
+		tags = append(tags, s.productTag(change.ProductID()))
+		for _, prod := range []*models.Product{change.Before, change.After} {
+			if prod != nil && !prod.CategoryID.IsZero() {
+				tags = append(tags, s.categoryTag(prod.CategoryID))
+			}
+		}
+	}
+
+	queryTags, err := s.matchingQueryTags(ctx, changes)
+	if err != nil {
+		return err
+	}
+	tags = append(tags, queryTags...)
+
+	keys, err := s.taggedKeys(ctx, tags)
+	if err != nil {
+		return err
+	}
+
+	// keys are deleted one by one, multi key commands fail in cluster mode when keys hash to different slots
+	_, err = s.redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range append(keys, tags...) {
+			pipe.Del(ctx, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "searchRedisRepository.redis.Pipelined")
+	}
+
+	searchCacheInvalidations.Add(float64(len(keys)))
+	return nil
+}
+
+// taggedKeys distinct page keys tagged with any of tags
+func (s *searchRedisRepository) taggedKeys(ctx context.Context, tags []string) ([]string, error) {
+	members := make([]*redis.StringSliceCmd, 0, len(tags))
+	_, err := s.redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, tag := range tags {
+			members = append(members, pipe.SMembers(ctx, tag))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "searchRedisRepository.redis.Pipelined")
+	}
+
+	keys := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, cmd := range members {
+		for _, key := range cmd.Val() {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys, nil
+}
+
+// matchingQueryTags tags of cached queries matching any changed product state. Candidate queries are read from index
+// sets of grams of changed products text and from scan index, queries without cached pages are dropped from index
+func (s *searchRedisRepository) matchingQueryTags(ctx context.Context, changes []*models.ProductChange) ([]string, error) {
+	grams := make(map[string]bool)
+	for _, change := range changes {
+		for _, prod := range []*models.Product{change.Before, change.After} {
+			if prod != nil {
+				textGrams(prod.Name, grams)
+				textGrams(prod.Description, grams)
+			}
+		}
+	}
+
+	indexKeys := make([]string, 0, len(grams)+1)
+	indexKeys = append(indexKeys, s.scanIndexKey())
+	for gram := range grams {
+		indexKeys = append(indexKeys, s.gramIndexKey(gram))
+	}
+
+	members := make([]*redis.StringSliceCmd, 0, len(indexKeys))
+	_, err := s.redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, indexKey := range indexKeys {
+			members = append(members, pipe.SMembers(ctx, indexKey))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "searchRedisRepository.redis.Pipelined")
+	}
+
+	searches := make([]string, 0)
+	for _, cmd := range members {
+		searches = append(searches, cmd.Val()...)
+	}
+
+	exists := make([]*redis.IntCmd, 0, len(searches))
+	_, err = s.redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, search := range searches {
+			exists = append(exists, pipe.Exists(ctx, s.queryTag(search)))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "searchRedisRepository.redis.Pipelined")
+	}
+
+	tags := make([]string, 0)
+	expired := make(map[string][]interface{})
+	for i, search := range searches {
+		if exists[i].Val() == 0 {
+			indexKey := s.queryIndexKey(search)
+			expired[indexKey] = append(expired[indexKey], search)
+			continue
+		}
+		if matchesAny(search, changes) {
+			tags = append(tags, s.queryTag(search))
+		}
+	}
+
+	if len(expired) > 0 {
+		_, err := s.redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for indexKey, expiredSearches := range expired {
+				pipe.SRem(ctx, indexKey, expiredSearches...)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "searchRedisRepository.redis.Pipelined")
+		}
+	}
+	return tags, nil
+}
+
+// queryGram gram plain text query is indexed by, false for patterns and queries shorter than gram
+func queryGram(search string) (string, bool) {
+	if regexp.QuoteMeta(search) != search {
+		return "", false
+	}
+	runes := []rune(strings.ToLower(search))
+	if len(runes) < queryGramLen {
+		return "", false
+	}
+	return string(runes[:queryGramLen]), true
+}
+
+// textGrams add distinct grams of lowercased text to grams
+func textGrams(text string, grams map[string]bool) {
+	runes := []rune(strings.ToLower(text))
+	for i := 0; i+queryGramLen <= len(runes); i++ {
+		grams[string(runes[i:i+queryGramLen])] = true
+	}
+}
+
+// matchesAny product state before or after any change matches search the way mongo case insensitive regex does,
+// patterns go regexp can not compile are treated as matching
+func matchesAny(search string, changes []*models.ProductChange) bool {
+	if search == "" {
+		return true
+	}
+	re, err := regexp.Compile("(?i)" + search)
+	if err != nil {
+		return true
+	}
+	for _, change := range changes {
+		for _, prod := range []*models.Product{change.Before, change.After} {
+			if prod != nil && (re.MatchString(prod.Name) || re.MatchString(prod.Description)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// queryClass class of search query which determines page TTL
+func (s *searchRedisRepository) queryClass(search string, pagination *utils.Pagination) string {
+	switch {
+	case pagination.GetPage() > s.cfg.DeepPage:
+		return queryClassDeep
+	case search == "":
+		return queryClassBrowse
+	case regexp.QuoteMeta(search) == search:
+		return queryClassTerm
+	default:
+		return queryClassPattern
+	}
+}
+
+func (s *searchRedisRepository) ttl(class string) time.Duration {
+	switch class {
+	case queryClassDeep:
+		return s.cfg.TTL.Deep
+	case queryClassBrowse:
+		return s.cfg.TTL.Browse
+	case queryClassTerm:
+		return s.cfg.TTL.Term
+	default:
+		return s.cfg.TTL.Pattern
+	}
+}
+
+// normalizeQuery plain text terms are lowercased as search is case insensitive, regex patterns are kept as is
+func normalizeQuery(search string) string {
+	if regexp.QuoteMeta(search) == search {
+		return strings.ToLower(search)
+	}
+	return search
+}
+
+func (s *searchRedisRepository) queryHash(search string) string {
+	sum := sha1.Sum([]byte(normalizeQuery(search)))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *searchRedisRepository) pageKey(search string, pagination *utils.Pagination) string {
+	return fmt.Sprintf("%s:page:%s:%d:%d", s.prefix, s.queryHash(search), pagination.GetPage(), pagination.GetSize())
+}
+
+func (s *searchRedisRepository) queryTag(search string) string {
+	return fmt.Sprintf("%s:tag:query:%s", s.prefix, s.queryHash(search))
+}
+
+func (s *searchRedisRepository) productTag(id primitive.ObjectID) string {
+	return fmt.Sprintf("%s:tag:product:%s", s.prefix, id.Hex())
+}
+
+func (s *searchRedisRepository) categoryTag(id primitive.ObjectID) string {
+	return fmt.Sprintf("%s:tag:category:%s", s.prefix, id.Hex())
+}
+
+// queryIndexKey index set of query, gram index for plain text queries and scan index for others
+func (s *searchRedisRepository) queryIndexKey(search string) string {
+	if gram, ok := queryGram(search); ok {
+		return s.gramIndexKey(gram)
+	}
+	return s.scanIndexKey()
+}
+
+func (s *searchRedisRepository) gramIndexKey(gram string) string {
+	return fmt.Sprintf("%s:index:gram:%s", s.prefix, gram)
+}
+
+func (s *searchRedisRepository) scanIndexKey() string {
+	return fmt.Sprintf("%s:index:scan", s.prefix)
+}
+
+func (s *searchRedisRepository) generationKey() string {
+	return fmt.Sprintf("%s:generation", s.prefix)
+}
@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/Yangiboev/golang-with-curiosity/config"
+	"github.com/Yangiboev/golang-with-curiosity/internal/models"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/utils"
+)
+
+func newTestSearchRepository(t *testing.T) *searchRedisRepository {
+	t.Helper()
+	_, client := newTestRedis(t)
+
+	cfg := config.Config{}
+	cfg.SearchCache = config.SearchCache{
+		Enabled:  true,
+		DeepPage: 5,
+		TTL:      config.SearchCacheTTL{Browse: time.Minute, Term: time.Minute, Pattern: time.Minute, Deep: time.Minute},
+	}
+	return NewSearchRedisRepository(client, cfg)
+}
+
+// cacheSearch cache empty page of search read at current generation
+func cacheSearch(t *testing.T, repo *searchRedisRepository, search string) {
+	t.Helper()
+	ctx := context.Background()
+	pagination := utils.NewPaginationQuery(10, 1)
+
+	_, generation, err := repo.GetSearch(ctx, search, pagination)
+	if err != nil {
+		t.Fatalf("GetSearch: %v", err)
+	}
+	if err := repo.SetSearch(ctx, search, pagination, &models.ProductsList{}, generation); err != nil {
+		t.Fatalf("SetSearch: %v", err)
+	}
+}
+
+func isCached(t *testing.T, repo *searchRedisRepository, search string) bool {
+	t.Helper()
+	list, _, err := repo.GetSearch(context.Background(), search, utils.NewPaginationQuery(10, 1))
+	if err != nil {
+		t.Fatalf("GetSearch: %v", err)
+	}
+	return list != nil
+}
+
+func TestSearchInvalidationDropsMatchingQueriesOnly(t *testing.T) {
+	repo := newTestSearchRepository(t)
+	searches := []string{"Phone", "pho", "ph", "laptop", "^iph.*", ""}
+	for _, search := range searches {
+		cacheSearch(t, repo, search)
+	}
+
+	created := &models.Product{ProductID: primitive.NewObjectID(), Name: "iPhone 13", Description: "smart device"}
+	if err := repo.InvalidateProducts(context.Background(), &models.ProductChange{After: created}); err != nil {
+		t.Fatalf("InvalidateProducts: %v", err)
+	}
+
+	want := map[string]bool{"Phone": false, "pho": false, "ph": false, "laptop": true, "^iph.*": false, "": false}
+	for search, cached := range want {
+		if got := isCached(t, repo, search); got != cached {
+			t.Fatalf("search %q cached = %v, want %v", search, got, cached)
+		}
+	}
+}
+
+func TestSearchInvalidationForgetsExpiredQueries(t *testing.T) {
+	repo := newTestSearchRepository(t)
+	ctx := context.Background()
+	cacheSearch(t, repo, "phone")
+
+	if err := repo.redis.Del(ctx, repo.queryTag("phone")).Err(); err != nil {
+		t.Fatalf("Del: %v", err)
+	}
+	changed := &models.Product{ProductID: primitive.NewObjectID(), Name: "phone"}
+	if err := repo.InvalidateProducts(ctx, &models.ProductChange{After: changed}); err != nil {
+		t.Fatalf("InvalidateProducts: %v", err)
+	}
+
+	members, err := repo.redis.SMembers(ctx, repo.queryIndexKey("phone")).Result()
+	if err != nil {
+		t.Fatalf("SMembers: %v", err)
+	}
+	if len(members) != 0 {
+		t.Fatalf("index members %v, want expired query removed", members)
+	}
+}
+
+func TestSetSearchSkipsPageReadBeforeInvalidation(t *testing.T) {
+	repo := newTestSearchRepository(t)
+	ctx := context.Background()
+	pagination := utils.NewPaginationQuery(10, 1)
+
+	_, generation, err := repo.GetSearch(ctx, "phone", pagination)
+	if err != nil {
+		t.Fatalf("GetSearch: %v", err)
+	}
+	changed := &models.Product{ProductID: primitive.NewObjectID(), Name: "phone"}
+	if err := repo.InvalidateProducts(ctx, &models.ProductChange{After: changed}); err != nil {
+		t.Fatalf("InvalidateProducts: %v", err)
+	}
+	if err := repo.SetSearch(ctx, "phone", pagination, &models.ProductsList{}, generation); err != nil {
+		t.Fatalf("SetSearch: %v", err)
+	}
+
+	if isCached(t, repo, "phone") {
+		t.Fatalf("page read before invalidation was cached")
+	}
+	cacheSearch(t, repo, "phone")
+	if !isCached(t, repo, "phone") {
+		t.Fatalf("page read after invalidation was not cached")
+	}
+}
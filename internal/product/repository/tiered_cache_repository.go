@@ -0,0 +1,285 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/Yangiboev/golang-with-curiosity/config"
+	"github.com/Yangiboev/golang-with-curiosity/internal/models"
+	"github.com/Yangiboev/golang-with-curiosity/internal/product"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/cache"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/logger"
+	productErrors "github.com/Yangiboev/golang-with-curiosity/pkg/product_errors"
+)
+
+const (
+	tierLocal = "local"
+	tierRedis = "redis"
+
+	invalidationSent     = "sent"
+	invalidationReceived = "received"
+
+	resubscribeDelay = time.Second
+)
+
+// productTieredCacheRepository in process LRU cache in front of redis product cache. Writes go to redis, drop the local
+// entry and publish invalidation so other instances drop theirs, next read fills local cache from redis. Fills of
+// products read from database change no product, they go to redis and drop the local entry without publishing.
+// Local entries live for local TTL at most, which bounds staleness when invalidations are lost
+type productTieredCacheRepository struct {
+	log        logger.Logger
+	redis      redis.UniversalClient
+	remote     product.RedisRepository
+	local      *cache.LRU
+	channel    string
+	instanceID string
+}
+
+// NewProductTieredCacheRepository constructor
+func NewProductTieredCacheRepository(log logger.Logger, redis redis.UniversalClient, remote product.RedisRepository, cfg config.Config) *productTieredCacheRepository {
+	return &productTieredCacheRepository{
+		log:    log,
+		redis:  redis,
+		remote: remote,
+		local: cache.NewLRU(cfg.ProductCache.Local.Size, cfg.ProductCache.Local.TTL, func(key string) {
+			productCacheEvictions.Inc()
+		}),
+		channel:    cfg.ProductCache.Local.Channel,
+		instanceID: primitive.NewObjectID().Hex(),
+	}
+}
+
+// GetProductByID product from local cache, or from redis filling local cache
+func (t *productTieredCacheRepository) GetProductByID(ctx context.Context, productID primitive.ObjectID) (*models.CachedProduct, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "productTieredCacheRepository.GetProductByID")
+	defer span.Finish()
+
+	if cached, ok := t.local.Get(productID.Hex()); ok {
+		productCacheHits.WithLabelValues(tierLocal).Inc()
+		return cached.(*models.CachedProduct), nil
+	}
+	productCacheMisses.WithLabelValues(tierLocal).Inc()
+
+	cached, err := t.remote.GetProductByID(ctx, productID)
+	if err != nil {
+		if errors.Is(err, productErrors.ErrCacheMiss) {
+			productCacheMisses.WithLabelValues(tierRedis).Inc()
+		}
+		return nil, err
+	}
+	productCacheHits.WithLabelValues(tierRedis).Inc()
+
+	t.local.Set(productID.Hex(), cached)
+	productCacheSize.Set(float64(t.local.Len()))
+	return cached, nil
+}
+
+// GetProducts products from local cache, local misses are read from redis in one read filling local cache
+func (t *productTieredCacheRepository) GetProducts(ctx context.Context, productIDs []primitive.ObjectID) (map[primitive.ObjectID]*models.CachedProduct, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "productTieredCacheRepository.GetProducts")
+	defer span.Finish()
+
+	entries := make(map[primitive.ObjectID]*models.CachedProduct, len(productIDs))
+	misses := make([]primitive.ObjectID, 0, len(productIDs))
+	for _, productID := range productIDs {
+		if cached, ok := t.local.Get(productID.Hex()); ok {
+			productCacheHits.WithLabelValues(tierLocal).Inc()
+			entries[productID] = cached.(*models.CachedProduct)
+			continue
+		}
+		productCacheMisses.WithLabelValues(tierLocal).Inc()
+		misses = append(misses, productID)
+	}
+	if len(misses) == 0 {
+		return entries, nil
+	}
+
+	remote, err := t.remote.GetProducts(ctx, misses)
+	if err != nil {
+		return nil, err
+	}
+	for _, productID := range misses {
+		cached, ok := remote[productID]
+		if !ok {
+			productCacheMisses.WithLabelValues(tierRedis).Inc()
+			continue
+		}
+		productCacheHits.WithLabelValues(tierRedis).Inc()
+		entries[productID] = cached
+		t.local.Set(productID.Hex(), cached)
+	}
+	productCacheSize.Set(float64(t.local.Len()))
+	return entries, nil
+}
+
+// FillProducts cache products and not found entries read from database in redis and drop their local entries,
+// other instances keep theirs as nothing changed
+func (t *productTieredCacheRepository) FillProducts(ctx context.Context, products []*models.Product, missing []primitive.ObjectID, delta time.Duration) error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "productTieredCacheRepository.FillProducts")
+	defer span.Finish()
+
+	if err := t.remote.FillProducts(ctx, products, missing, delta); err != nil {
+		return err
+	}
+
+	for _, product := range products {
+		t.dropLocal(product.ProductID)
+	}
+	t.dropLocal(missing...)
+	return nil
+}
+
+// FillProduct cache product read from database in redis and drop its local entry
+func (t *productTieredCacheRepository) FillProduct(ctx context.Context, product *models.Product, delta time.Duration) error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "productTieredCacheRepository.FillProduct")
+	defer span.Finish()
+
+	if err := t.remote.FillProduct(ctx, product, delta); err != nil {
+		return err
+	}
+	t.dropLocal(product.ProductID)
+	return nil
+}
+
+// FillNotFound cache not found entry of product missing from database in redis and drop its local entry
+func (t *productTieredCacheRepository) FillNotFound(ctx context.Context, productID primitive.ObjectID) error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "productTieredCacheRepository.FillNotFound")
+	defer span.Finish()
+
+	if err := t.remote.FillNotFound(ctx, productID); err != nil {
+		return err
+	}
+	t.dropLocal(productID)
+	return nil
+}
+
+// SetProduct cache product in redis and invalidate local caches
+func (t *productTieredCacheRepository) SetProduct(ctx context.Context, product *models.Product, delta time.Duration) error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "productTieredCacheRepository.SetProduct")
+	defer span.Finish()
+
+	if err := t.remote.SetProduct(ctx, product, delta); err != nil {
+		return err
+	}
+	return t.invalidate(ctx, product.ProductID)
+}
+
+// SetNotFound cache product not found entry in redis and invalidate local caches
+func (t *productTieredCacheRepository) SetNotFound(ctx context.Context, productID primitive.ObjectID) error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "productTieredCacheRepository.SetNotFound")
+	defer span.Finish()
+
+	if err := t.remote.SetNotFound(ctx, productID); err != nil {
+		return err
+	}
+	return t.invalidate(ctx, productID)
+}
+
+// DeleteProduct delete product from redis and invalidate local caches
+func (t *productTieredCacheRepository) DeleteProduct(ctx context.Context, productID primitive.ObjectID) error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "productTieredCacheRepository.DeleteProduct")
+	defer span.Finish()
+
+	if err := t.remote.DeleteProduct(ctx, productID); err != nil {
+		return err
+	}
+	return t.invalidate(ctx, productID)
+}
+
+// Run drop local entries of products invalidated by other instances until context is done.
+// Local cache is purged on every (re)subscription as invalidations published while disconnected are lost
+func (t *productTieredCacheRepository) Run(ctx context.Context) {
+	pubSub := t.redis.Subscribe(ctx, t.channel)
+	defer pubSub.Close()
+
+	for {
+		msg, err := pubSub.Receive(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			t.log.Errorf("pubSub.Receive: %v", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(resubscribeDelay):
+			}
+			continue
+		}
+
+		switch m := msg.(type) {
+		case *redis.Subscription:
+			t.local.Purge()
+			productCacheSize.Set(0)
+			t.log.Infof("Subscribed to product cache invalidations: %v", m.Channel)
+		case *redis.Message:
+			instanceID, productID, ok := parseInvalidation(m.Payload)
+			if !ok {
+				t.log.Errorf("invalid product cache invalidation: %v", m.Payload)
+				continue
+			}
+			if instanceID == t.instanceID {
+				continue
+			}
+			t.local.Delete(productID)
+			productCacheInvalidations.WithLabelValues(invalidationReceived).Inc()
+			productCacheSize.Set(float64(t.local.Len()))
+		}
+	}
+}
+
+// invalidate drop local entries and publish invalidations to other instances
+func (t *productTieredCacheRepository) invalidate(ctx context.Context, productIDs ...primitive.ObjectID) error {
+	if len(productIDs) == 0 {
+		return nil
+	}
+	t.dropLocal(productIDs...)
+
+	_, err := t.redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, productID := range productIDs {
+			pipe.Publish(ctx, t.channel, fmt.Sprintf("%s:%s", t.instanceID, productID.Hex()))
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "productTieredCacheRepository.redis.Pipelined")
+	}
+	productCacheInvalidations.WithLabelValues(invalidationSent).Add(float64(len(productIDs)))
+	return nil
+}
+
+// dropLocal drop local entries of products
+func (t *productTieredCacheRepository) dropLocal(productIDs ...primitive.ObjectID) {
+	for _, productID := range productIDs {
+		t.local.Delete(productID.Hex())
+	}
+	productCacheSize.Set(float64(t.local.Len()))
+}
+
+// parseInvalidation split invalidation payload into publishing instance id and product id
+func parseInvalidation(payload string) (string, string, bool) {
+	parts := strings.SplitN(payload, ":", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// NewProductCacheRepository product cache of configured tiers, local tier receives invalidations until context is done
+func NewProductCacheRepository(ctx context.Context, log logger.Logger, redis redis.UniversalClient, cfg config.Config) product.RedisRepository {
+	redisRepo := NewProductRedisRepository(redis, cfg)
+	if !cfg.ProductCache.Local.Enabled {
+		return redisRepo
+	}
+
+	tieredRepo := NewProductTieredCacheRepository(log, redis, redisRepo, cfg)
+	go tieredRepo.Run(ctx)
+	return tieredRepo
+}
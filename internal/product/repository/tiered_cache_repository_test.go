@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/Yangiboev/golang-with-curiosity/config"
+	"github.com/Yangiboev/golang-with-curiosity/internal/models"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/logger"
+)
+
+func TestTieredCachePublishesInvalidationsOfWritesOnly(t *testing.T) {
+	_, client := newTestRedis(t)
+	ctx := context.Background()
+
+	cfg := config.Config{}
+	cfg.Logger.Level = "fatal"
+	cfg.Logger.Encoding = "console"
+	cfg.ProductCache = config.ProductCache{
+		TTL:         time.Hour,
+		NegativeTTL: time.Minute,
+		Local:       config.LocalCache{Enabled: true, Size: 10, TTL: time.Minute, Channel: "products:invalidations"},
+	}
+	appLogger := logger.NewApiLogger(cfg)
+	appLogger.InitLogger()
+	repo := NewProductTieredCacheRepository(appLogger, client, NewProductRedisRepository(client, cfg), cfg)
+
+	pubSub := client.Subscribe(ctx, cfg.ProductCache.Local.Channel)
+	defer pubSub.Close()
+	if _, err := pubSub.Receive(ctx); err != nil {
+		t.Fatalf("Receive: %v", err)
+	}
+
+	read := &models.Product{ProductID: primitive.NewObjectID(), UpdatedAt: time.Now()}
+	if err := repo.FillProduct(ctx, read, time.Millisecond); err != nil {
+		t.Fatalf("FillProduct: %v", err)
+	}
+	if err := repo.FillProducts(ctx, []*models.Product{read}, []primitive.ObjectID{primitive.NewObjectID()}, time.Millisecond); err != nil {
+		t.Fatalf("FillProducts: %v", err)
+	}
+	if err := repo.FillNotFound(ctx, primitive.NewObjectID()); err != nil {
+		t.Fatalf("FillNotFound: %v", err)
+	}
+	written := &models.Product{ProductID: primitive.NewObjectID(), UpdatedAt: time.Now()}
+	if err := repo.SetProduct(ctx, written, 0); err != nil {
+		t.Fatalf("SetProduct: %v", err)
+	}
+
+	receiveCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	msg, err := pubSub.Receive(receiveCtx)
+	if err != nil {
+		t.Fatalf("Receive: %v", err)
+	}
+	if _, productID, _ := parseInvalidation(msg.(*redis.Message).Payload); productID != written.ProductID.Hex() {
+		t.Fatalf("first invalidation of product %v, want written product %v only", productID, written.ProductID.Hex())
+	}
+}
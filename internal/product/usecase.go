@@ -13,7 +13,13 @@ type UseCase interface {
 	Create(ctx context.Context, product *models.Product) (*models.Product, error)
 	Update(ctx context.Context, product *models.Product) (*models.Product, error)
 	GetByID(ctx context.Context, productID primitive.ObjectID) (*models.Product, error)
+	Delete(ctx context.Context, productID primitive.ObjectID) error
 	Search(ctx context.Context, search string, pagination *utils.Pagination) (*models.ProductsList, error)
+	BulkWrite(ctx context.Context, writes []*models.ProductWrite) ([]error, error)
+	BatchGet(ctx context.Context, productIDs []primitive.ObjectID) ([]*models.ProductResult, error)
+	BatchCreate(ctx context.Context, products []*models.Product) ([]*models.ProductResult, error)
+	BatchUpdate(ctx context.Context, products []*models.Product) ([]*models.ProductResult, error)
+	Watch(ctx context.Context, filter *models.WatchFilter, resumeToken string, send func(*models.ProductChangeEvent) error) error
 	PublishCreate(ctx context.Context, product *models.Product) error
 	PublishUpdate(ctx context.Context, product *models.Product) error
 }
@@ -0,0 +1,125 @@
+package usecase
+
+import (
+	"context"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/Yangiboev/golang-with-curiosity/config"
+	"github.com/Yangiboev/golang-with-curiosity/internal/models"
+	"github.com/Yangiboev/golang-with-curiosity/internal/product"
+	prodKafka "github.com/Yangiboev/golang-with-curiosity/internal/product/delivery/kafka"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/logger"
+)
+
+// outboxRelay publish product changes stored in outbox to product watches and product events topics. Changes are
+// removed only after both accepted them, so they are delivered at least once and in outbox order
+type outboxRelay struct {
+	outboxRepo   product.OutboxRepository
+	changeFeed   product.ChangeFeedRepository
+	prodProducer prodKafka.ProductsProducer
+	log          logger.Logger
+	cfg          config.ProductOutbox
+	owner        string
+	notify       chan struct{}
+}
+
+func newOutboxRelay(
+	outboxRepo product.OutboxRepository,
+	changeFeed product.ChangeFeedRepository,
+	prodProducer prodKafka.ProductsProducer,
+	log logger.Logger,
+	cfg config.ProductOutbox,
+) *outboxRelay {
+	return &outboxRelay{
+		outboxRepo:   outboxRepo,
+		changeFeed:   changeFeed,
+		prodProducer: prodProducer,
+		log:          log,
+		cfg:          cfg,
+		owner:        primitive.NewObjectID().Hex(),
+		notify:       make(chan struct{}, 1),
+	}
+}
+
+// wake relay changes right away instead of waiting for next poll
+func (r *outboxRelay) wake() {
+	select {
+	case r.notify <- struct{}{}:
+	default:
+	}
+}
+
+// run relay changes every poll interval and on wake until context is done
+func (r *outboxRelay) run(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.notify:
+		}
+
+		if err := r.relay(ctx); err != nil && ctx.Err() == nil {
+			r.log.Errorf("outboxRelay.relay: %v", err)
+		}
+	}
+}
+
+// relay publish pending changes batch by batch while holding relay lease
+func (r *outboxRelay) relay(ctx context.Context) error {
+	for {
+		acquired, err := r.outboxRepo.AcquireRelay(ctx, r.owner, r.cfg.Lease)
+		if err != nil {
+			return errors.Wrap(err, "outboxRepo.AcquireRelay")
+		}
+		if !acquired {
+			return nil
+		}
+
+		entries, err := r.outboxRepo.PendingChanges(ctx, r.cfg.BatchSize)
+		if err != nil {
+			return errors.Wrap(err, "outboxRepo.PendingChanges")
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+
+		if err := r.publish(ctx, entries); err != nil {
+			return err
+		}
+		if len(entries) < r.cfg.BatchSize {
+			return nil
+		}
+	}
+}
+
+// publish append changes of entries to change feed and publish them to kafka, then remove entries
+func (r *outboxRelay) publish(ctx context.Context, entries []*models.ProductOutboxEntry) error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "outboxRelay.publish")
+	defer span.Finish()
+
+	changes := make([]*models.ProductChange, 0, len(entries))
+	ids := make([]primitive.ObjectID, 0, len(entries))
+	for _, entry := range entries {
+		changes = append(changes, entry.Change())
+		ids = append(ids, entry.ID)
+	}
+
+	if err := r.changeFeed.AppendChanges(ctx, changes...); err != nil {
+		return errors.Wrap(err, "changeFeed.AppendChanges")
+	}
+	if err := r.prodProducer.PublishChanges(ctx, changes...); err != nil {
+		return errors.Wrap(err, "prodProducer.PublishChanges")
+	}
+	if err := r.outboxRepo.RemoveChanges(ctx, ids); err != nil {
+		return errors.Wrap(err, "outboxRepo.RemoveChanges")
+	}
+	return nil
+}
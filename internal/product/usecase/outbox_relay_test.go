@@ -0,0 +1,182 @@
+package usecase
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/Yangiboev/golang-with-curiosity/config"
+	"github.com/Yangiboev/golang-with-curiosity/internal/models"
+	"github.com/Yangiboev/golang-with-curiosity/internal/product"
+	prodKafka "github.com/Yangiboev/golang-with-curiosity/internal/product/delivery/kafka"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/logger"
+)
+
+// fakeOutbox in memory outbox, lease is held by first owner
+type fakeOutbox struct {
+	mu      sync.Mutex
+	entries []*models.ProductOutboxEntry
+	owner   string
+}
+
+func (f *fakeOutbox) AppendChanges(ctx context.Context, changes ...*models.ProductChange) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, change := range changes {
+		f.entries = append(f.entries, &models.ProductOutboxEntry{ID: primitive.NewObjectID(), Before: change.Before, After: change.After})
+	}
+	return nil
+}
+
+func (f *fakeOutbox) AcquireRelay(ctx context.Context, owner string, lease time.Duration) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.owner == "" {
+		f.owner = owner
+	}
+	return f.owner == owner, nil
+}
+
+func (f *fakeOutbox) PendingChanges(ctx context.Context, limit int) ([]*models.ProductOutboxEntry, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.entries) < limit {
+		limit = len(f.entries)
+	}
+	return append([]*models.ProductOutboxEntry(nil), f.entries[:limit]...), nil
+}
+
+func (f *fakeOutbox) RemoveChanges(ctx context.Context, ids []primitive.ObjectID) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	removed := make(map[primitive.ObjectID]bool, len(ids))
+	for _, id := range ids {
+		removed[id] = true
+	}
+	entries := f.entries[:0]
+	for _, entry := range f.entries {
+		if !removed[entry.ID] {
+			entries = append(entries, entry)
+		}
+	}
+	f.entries = entries
+	return nil
+}
+
+func (f *fakeOutbox) pending() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.entries)
+}
+
+// fakeChangeSink records changes appended to change feed and published to kafka, publishing fails while err is set
+type fakeChangeSink struct {
+	product.ChangeFeedRepository
+	prodKafka.ProductsProducer
+
+	mu        sync.Mutex
+	appended  []*models.ProductChange
+	published []*models.ProductChange
+	err       error
+}
+
+func (f *fakeChangeSink) AppendChanges(ctx context.Context, changes ...*models.ProductChange) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.appended = append(f.appended, changes...)
+	return nil
+}
+
+func (f *fakeChangeSink) PublishChanges(ctx context.Context, changes ...*models.ProductChange) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	f.published = append(f.published, changes...)
+	return nil
+}
+
+func newTestLogger() logger.Logger {
+	cfg := config.Config{}
+	cfg.Logger.Level = "fatal"
+	cfg.Logger.Encoding = "console"
+	appLogger := logger.NewApiLogger(cfg)
+	appLogger.InitLogger()
+	return appLogger
+}
+
+func newTestRelay(outbox *fakeOutbox, sink *fakeChangeSink, batchSize int) *outboxRelay {
+	cfg := config.ProductOutbox{PollInterval: time.Millisecond, BatchSize: batchSize, Lease: time.Second}
+	return newOutboxRelay(outbox, sink, sink, newTestLogger(), cfg)
+}
+
+func testChanges(n int) []*models.ProductChange {
+	changes := make([]*models.ProductChange, 0, n)
+	for i := 0; i < n; i++ {
+		changes = append(changes, &models.ProductChange{After: &models.Product{ProductID: primitive.NewObjectID()}})
+	}
+	return changes
+}
+
+func TestOutboxRelayPublishesPendingChangesInOrder(t *testing.T) {
+	outbox := &fakeOutbox{}
+	sink := &fakeChangeSink{}
+	changes := testChanges(5)
+	_ = outbox.AppendChanges(context.Background(), changes...)
+
+	if err := newTestRelay(outbox, sink, 2).relay(context.Background()); err != nil {
+		t.Fatalf("relay: %v", err)
+	}
+
+	if len(sink.published) != 5 || len(sink.appended) != 5 {
+		t.Fatalf("published %d and appended %d changes, want 5", len(sink.published), len(sink.appended))
+	}
+	for i, change := range sink.published {
+		if change.ProductID() != changes[i].ProductID() {
+			t.Fatalf("published change %d of product %v, want %v", i, change.ProductID(), changes[i].ProductID())
+		}
+	}
+	if pending := outbox.pending(); pending != 0 {
+		t.Fatalf("pending = %d, want 0", pending)
+	}
+}
+
+func TestOutboxRelayKeepsChangesWhenPublishFails(t *testing.T) {
+	outbox := &fakeOutbox{}
+	sink := &fakeChangeSink{err: errors.New("broker unavailable")}
+	_ = outbox.AppendChanges(context.Background(), testChanges(3)...)
+	relay := newTestRelay(outbox, sink, 10)
+
+	if err := relay.relay(context.Background()); err == nil {
+		t.Fatalf("relay error = nil, want publish error")
+	}
+	if pending := outbox.pending(); pending != 3 {
+		t.Fatalf("pending = %d, want 3 kept for next relay", pending)
+	}
+
+	sink.err = nil
+	if err := relay.relay(context.Background()); err != nil {
+		t.Fatalf("relay: %v", err)
+	}
+	if pending := outbox.pending(); pending != 0 || len(sink.published) != 3 {
+		t.Fatalf("pending = %d and published %d, want all 3 published", pending, len(sink.published))
+	}
+}
+
+func TestOutboxRelaySkipsWithoutLease(t *testing.T) {
+	outbox := &fakeOutbox{owner: "other instance"}
+	sink := &fakeChangeSink{}
+	_ = outbox.AppendChanges(context.Background(), testChanges(1)...)
+
+	if err := newTestRelay(outbox, sink, 10).relay(context.Background()); err != nil {
+		t.Fatalf("relay: %v", err)
+	}
+	if len(sink.published) != 0 || outbox.pending() != 1 {
+		t.Fatalf("published %d changes without lease, want none", len(sink.published))
+	}
+}
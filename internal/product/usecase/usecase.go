@@ -2,45 +2,93 @@ package usecase
 
 import (
 	"context"
-	"encoding/json"
 	"time"
 
+	"github.com/Yangiboev/golang-with-curiosity/config"
 	"github.com/Yangiboev/golang-with-curiosity/internal/models"
 	prodKafka "github.com/Yangiboev/golang-with-curiosity/internal/product/delivery/kafka"
-	"github.com/go-redis/redis/v8"
 	"github.com/opentracing/opentracing-go"
 	"github.com/pkg/errors"
-	"github.com/segmentio/kafka-go"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/sync/singleflight"
 
 	"github.com/Yangiboev/golang-with-curiosity/internal/product"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/cache"
 	"github.com/Yangiboev/golang-with-curiosity/pkg/logger"
+	productErrors "github.com/Yangiboev/golang-with-curiosity/pkg/product_errors"
 	"github.com/Yangiboev/golang-with-curiosity/pkg/utils"
 )
 
+// errWriteFailed aborts bulk write transaction when some of its writes failed
+var errWriteFailed = errors.New("product write failed")
+
 // productUC
 type productUC struct {
 	productRepo  product.MongoRepository
+	outboxRepo   product.OutboxRepository
 	redisRepo    product.RedisRepository
+	searchCache  product.SearchCacheRepository
+	changeFeed   product.ChangeFeedRepository
 	log          logger.Logger
 	prodProducer prodKafka.ProductsProducer
+	relay        *outboxRelay
+	loads        singleflight.Group
+	refreshes    singleflight.Group
 }
 
 // NewProductUC constructor
 func NewProductUC(
 	productRepo product.MongoRepository,
+	outboxRepo product.OutboxRepository,
 	redisRepo product.RedisRepository,
+	searchCache product.SearchCacheRepository,
+	changeFeed product.ChangeFeedRepository,
 	log logger.Logger,
 	prodProducer prodKafka.ProductsProducer,
+	cfg config.Config,
 ) *productUC {
-	return &productUC{productRepo: productRepo, redisRepo: redisRepo, log: log, prodProducer: prodProducer}
+	return &productUC{
+		productRepo:  productRepo,
+		outboxRepo:   outboxRepo,
+		redisRepo:    redisRepo,
+		searchCache:  searchCache,
+		changeFeed:   changeFeed,
+		log:          log,
+		prodProducer: prodProducer,
+		relay:        newOutboxRelay(outboxRepo, changeFeed, prodProducer, log, cfg.ProductOutbox),
+	}
+}
+
+// RelayChanges publish product changes stored in outbox until context is done
+func (p *productUC) RelayChanges(ctx context.Context) {
+	p.relay.run(ctx)
 }
 
 // Create Create new product
 func (p *productUC) Create(ctx context.Context, product *models.Product) (*models.Product, error) {
 	span, ctx := opentracing.StartSpanFromContext(ctx, "productUC.Create")
 	defer span.Finish()
-	return p.productRepo.Create(ctx, product)
+
+	var created *models.Product
+	err := p.productRepo.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		created, err = p.productRepo.Create(ctx, product)
+		if err != nil {
+			return err
+		}
+		return p.outboxRepo.AppendChanges(ctx, &models.ProductChange{After: created})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// product id may be allocated before create and looked up meanwhile, replace its not found entry
+	if err := p.redisRepo.SetProduct(ctx, created, 0); err != nil {
+		p.log.Errorf("redisRepo.SetProduct: %v", err)
+	}
+
+	p.changesStored(ctx, &models.ProductChange{After: created})
+	return created, nil
 }
 
 // Update single product
@@ -48,64 +96,481 @@ func (p *productUC) Update(ctx context.Context, product *models.Product) (*model
 	span, ctx := opentracing.StartSpanFromContext(ctx, "productUC.Update")
 	defer span.Finish()
 
-	prod, err := p.productRepo.Update(ctx, product)
+	var change *models.ProductChange
+	err := p.productRepo.WithTransaction(ctx, func(ctx context.Context) error {
+		before, err := p.currentStates(ctx, []primitive.ObjectID{product.ProductID})
+		if err != nil {
+			return err
+		}
+
+		prod, err := p.productRepo.Update(ctx, product)
+		if err != nil {
+			return errors.Wrap(err, "Update")
+		}
+
+		change = &models.ProductChange{Before: before[prod.ProductID], After: prod}
+		return p.outboxRepo.AppendChanges(ctx, change)
+	})
 	if err != nil {
-		return nil, errors.Wrap(err, "Update")
+		return nil, err
 	}
+	prod := change.After
 
-	if err := p.redisRepo.SetProduct(ctx, prod); err != nil {
+	if err := p.redisRepo.SetProduct(ctx, prod, 0); err != nil {
 		p.log.Errorf("redisRepo.SetProduct: %v", err)
 	}
 
+	p.changesStored(ctx, change)
 	return prod, nil
 }
 
-// GetByID Get single product by id
+// Delete single product
+func (p *productUC) Delete(ctx context.Context, productID primitive.ObjectID) error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "productUC.Delete")
+	defer span.Finish()
+
+	var deleted *models.Product
+	err := p.productRepo.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		deleted, err = p.productRepo.Delete(ctx, productID)
+		if err != nil {
+			return errors.Wrap(err, "Delete")
+		}
+		return p.outboxRepo.AppendChanges(ctx, &models.ProductChange{Before: deleted})
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := p.redisRepo.SetNotFound(ctx, productID); err != nil {
+		p.log.Errorf("redisRepo.SetNotFound: %v", err)
+	}
+
+	p.changesStored(ctx, &models.ProductChange{Before: deleted})
+	return nil
+}
+
+// GetByID Get single product by id, cache read behaviour follows call path cache policy from context
 func (p *productUC) GetByID(ctx context.Context, productID primitive.ObjectID) (*models.Product, error) {
 	span, ctx := opentracing.StartSpanFromContext(ctx, "productUC.GetByID")
 	defer span.Finish()
+	policy := cache.PolicyFromContext(ctx)
 
 	cached, err := p.redisRepo.GetProductByID(ctx, productID)
-	if err != nil && err != redis.Nil {
+	if err != nil && !errors.Is(err, productErrors.ErrCacheMiss) {
 		p.log.Errorf("redisRepo.GetProductByID: %v", err)
 	}
-	if cached != nil {
-		return cached, nil
+	if cached != nil && cached.NotFound && !cached.Expired(time.Now()) {
+		return nil, errors.Wrap(productErrors.ErrProductNotFound, productID.Hex())
+	}
+	if cached != nil && !cached.NotFound {
+		now := time.Now()
+		refreshEarly := policy.EarlyExpiration && cache.ShouldRefreshEarly(cached.ExpiresAt, cached.Delta, policy.Beta, now)
+		switch {
+		case !cached.Expired(now) && !refreshEarly:
+			return cached.Product, nil
+		case policy.StaleWhileRevalidate:
+			p.refreshProduct(ctx, productID, policy)
+			return cached.Product, nil
+		}
 	}
 
+	return p.loadProduct(ctx, productID, policy)
+}
+
+// loadProduct load product from database and cache it or remember it is missing, concurrent loads of the same product
+// share one database read when policy coalesces them. Shared read runs detached from the caller that started it
+// within load timeout, so that caller going away does not fail the others
+func (p *productUC) loadProduct(ctx context.Context, productID primitive.ObjectID, policy config.CachePolicy) (*models.Product, error) {
+	if !policy.Coalesce {
+		return p.fillProduct(ctx, productID)
+	}
+
+	loaded := p.loads.DoChan(productID.Hex(), func() (interface{}, error) {
+		loadCtx, done := detachedContext(ctx, "productUC.loadProduct", policy.LoadTimeout)
+		defer done()
+		return p.fillProduct(loadCtx, productID)
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-loaded:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.(*models.Product), nil
+	}
+}
+
+// refreshProduct reload product in background, at most one refresh of a product runs at a time
+func (p *productUC) refreshProduct(ctx context.Context, productID primitive.ObjectID, policy config.CachePolicy) {
+	p.refreshes.DoChan(productID.Hex(), func() (interface{}, error) {
+		refreshCtx, done := detachedContext(ctx, "productUC.refreshProduct", policy.RefreshTimeout)
+		defer done()
+
+		prod, err := p.fillProduct(refreshCtx, productID)
+		if err != nil {
+			p.log.Errorf("productUC.fillProduct: %v", err)
+		}
+		return prod, err
+	})
+}
+
+// fillProduct read product from database and cache it or remember it is missing. Cache keeps entries of newer
+// product versions and deletions written while the product was read
+func (p *productUC) fillProduct(ctx context.Context, productID primitive.ObjectID) (*models.Product, error) {
+	start := time.Now()
 	prod, err := p.productRepo.GetByID(ctx, productID)
 	if err != nil {
+		p.cacheNotFound(ctx, productID, err)
 		return nil, errors.Wrap(err, "GetByID")
 	}
 
-	if err := p.redisRepo.SetProduct(ctx, prod); err != nil {
-		p.log.Errorf("redisRepo.SetProduct: %v", err)
+	if err := p.redisRepo.FillProduct(ctx, prod, time.Since(start)); err != nil {
+		p.log.Errorf("redisRepo.FillProduct: %v", err)
 	}
-
 	return prod, nil
 }
 
+// detachedContext context not canceled with ctx, done within timeout, its span follows span of ctx.
+// Returned func cancels context and finishes span
+func detachedContext(ctx context.Context, operationName string, timeout time.Duration) (context.Context, func()) {
+	opts := make([]opentracing.StartSpanOption, 0, 1)
+	if parent := opentracing.SpanFromContext(ctx); parent != nil {
+		opts = append(opts, opentracing.FollowsFrom(parent.Context()))
+	}
+	span := opentracing.StartSpan(operationName, opts...)
+
+	detached, cancel := context.WithTimeout(opentracing.ContextWithSpan(context.Background(), span), timeout)
+	return detached, func() {
+		cancel()
+		span.Finish()
+	}
+}
+
+// cacheNotFound remember product is missing when database read failed because it does not exist
+func (p *productUC) cacheNotFound(ctx context.Context, productID primitive.ObjectID, err error) {
+	if !errors.Is(err, productErrors.ErrProductNotFound) {
+		return
+	}
+	if err := p.redisRepo.FillNotFound(ctx, productID); err != nil {
+		p.log.Errorf("redisRepo.FillNotFound: %v", err)
+	}
+}
+
 // Search Search products
 func (p *productUC) Search(ctx context.Context, search string, pagination *utils.Pagination) (*models.ProductsList, error) {
 	span, ctx := opentracing.StartSpanFromContext(ctx, "productUC.Search")
 	defer span.Finish()
-	return p.productRepo.Search(ctx, search, pagination)
+
+	cached, generation, err := p.searchCache.GetSearch(ctx, search, pagination)
+	if err != nil {
+		p.log.Errorf("searchCache.GetSearch: %v", err)
+	}
+	if cached != nil {
+		return cached, nil
+	}
+
+	list, err := p.productRepo.Search(ctx, search, pagination)
+	if err != nil {
+		return nil, errors.Wrap(err, "Search")
+	}
+
+	if err := p.searchCache.SetSearch(ctx, search, pagination, list, generation); err != nil {
+		p.log.Errorf("searchCache.SetSearch: %v", err)
+	}
+
+	return list, nil
+}
+
+// BulkWrite apply product writes in one bulk, returns write errors by write index,
+// written products are evicted from cache instead of being re-read, which also drops not found entries of created ones
+func (p *productUC) BulkWrite(ctx context.Context, writes []*models.ProductWrite) ([]error, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "productUC.BulkWrite")
+	defer span.Finish()
+
+	writeErrs, _, err := p.bulkWrite(ctx, writes)
+	return writeErrs, err
+}
+
+// BatchGet products by ids reading cache once and database once for cache misses, products loaded from database
+// and not found entries of missing products are cached in one pipeline. Returns result by id index
+func (p *productUC) BatchGet(ctx context.Context, productIDs []primitive.ObjectID) ([]*models.ProductResult, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "productUC.BatchGet")
+	defer span.Finish()
+
+	cached, err := p.redisRepo.GetProducts(ctx, productIDs)
+	if err != nil {
+		p.log.Errorf("redisRepo.GetProducts: %v", err)
+	}
+
+	now := time.Now()
+	found := make(map[primitive.ObjectID]*models.Product, len(productIDs))
+	missing := make(map[primitive.ObjectID]bool)
+	misses := make([]primitive.ObjectID, 0, len(productIDs))
+	for _, productID := range productIDs {
+		entry, ok := cached[productID]
+		switch {
+		case ok && !entry.Expired(now) && entry.NotFound:
+			missing[productID] = true
+		case ok && !entry.Expired(now):
+			found[productID] = entry.Product
+		case !missing[productID] && found[productID] == nil:
+			missing[productID] = true
+			misses = append(misses, productID)
+		}
+	}
+
+	if len(misses) > 0 {
+		start := time.Now()
+		loaded, err := p.productRepo.GetByIDs(ctx, misses)
+		if err != nil {
+			return nil, errors.Wrap(err, "GetByIDs")
+		}
+		for _, prod := range loaded {
+			found[prod.ProductID] = prod
+			delete(missing, prod.ProductID)
+		}
+
+		notFound := make([]primitive.ObjectID, 0, len(misses)-len(loaded))
+		for _, productID := range misses {
+			if missing[productID] {
+				notFound = append(notFound, productID)
+			}
+		}
+		if err := p.redisRepo.FillProducts(ctx, loaded, notFound, time.Since(start)); err != nil {
+			p.log.Errorf("redisRepo.FillProducts: %v", err)
+		}
+	}
+
+	results := make([]*models.ProductResult, 0, len(productIDs))
+	for _, productID := range productIDs {
+		res := &models.ProductResult{ProductID: productID, Product: found[productID]}
+		if res.Product == nil {
+			res.Err = errors.Wrap(productErrors.ErrProductNotFound, productID.Hex())
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+// BatchCreate create products in one bulk, returns result by product index
+func (p *productUC) BatchCreate(ctx context.Context, products []*models.Product) ([]*models.ProductResult, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "productUC.BatchCreate")
+	defer span.Finish()
+
+	return p.batchWrite(ctx, models.ProductWriteCreate, products)
+}
+
+// BatchUpdate update products in one bulk, returns result by product index
+func (p *productUC) BatchUpdate(ctx context.Context, products []*models.Product) ([]*models.ProductResult, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "productUC.BatchUpdate")
+	defer span.Finish()
+
+	return p.batchWrite(ctx, models.ProductWriteUpdate, products)
+}
+
+// batchWrite apply writes of op to products in one bulk, results hold stored products or written ones
+// when stored products could not be read back
+func (p *productUC) batchWrite(ctx context.Context, op string, products []*models.Product) ([]*models.ProductResult, error) {
+	writes := make([]*models.ProductWrite, 0, len(products))
+	for _, prod := range products {
+		writes = append(writes, &models.ProductWrite{Op: op, Product: prod})
+	}
+
+	writeErrs, after, err := p.bulkWrite(ctx, writes)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*models.ProductResult, 0, len(writes))
+	for i, w := range writes {
+		res := &models.ProductResult{ProductID: w.Product.ProductID, Err: writeErrs[i]}
+		if res.Err == nil {
+			res.Product = w.Product
+			if prod, ok := after[w.Product.ProductID]; ok {
+				res.Product = prod
+			}
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+// bulkWrite apply product writes in one bulk together with outbox changes of written products in one transaction,
+// returns write errors by write index and stored states of written products. Transaction aborts on first write error,
+// so failed writes are left out and remaining writes are applied again until a transaction commits
+func (p *productUC) bulkWrite(ctx context.Context, writes []*models.ProductWrite) ([]error, map[primitive.ObjectID]*models.Product, error) {
+	writeErrs := make([]error, len(writes))
+	pending := make([]int, 0, len(writes))
+	for i := range writes {
+		pending = append(pending, i)
+	}
+
+	for len(pending) > 0 {
+		batch := make([]*models.ProductWrite, 0, len(pending))
+		for _, i := range pending {
+			batch = append(batch, writes[i])
+		}
+
+		var (
+			batchErrs []error
+			after     map[primitive.ObjectID]*models.Product
+			changes   []*models.ProductChange
+		)
+		err := p.productRepo.WithTransaction(ctx, func(ctx context.Context) error {
+			var err error
+			batchErrs, after, changes, err = p.applyWrites(ctx, batch)
+			return err
+		})
+		if errors.Is(err, errWriteFailed) {
+			remaining := pending[:0]
+			for k, i := range pending {
+				if batchErrs[k] != nil {
+					writeErrs[i] = batchErrs[k]
+					continue
+				}
+				remaining = append(remaining, i)
+			}
+			pending = remaining
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, change := range changes {
+			if err := p.redisRepo.SetProduct(ctx, change.After, 0); err != nil {
+				p.log.Errorf("redisRepo.SetProduct: %v", err)
+			}
+		}
+		p.changesStored(ctx, changes...)
+		return writeErrs, after, nil
+	}
+
+	return writeErrs, map[primitive.ObjectID]*models.Product{}, nil
+}
+
+// applyWrites apply writes with transaction context and store changes of written products in outbox,
+// errWriteFailed is returned with write errors when any write failed
+func (p *productUC) applyWrites(
+	ctx context.Context,
+	writes []*models.ProductWrite,
+) ([]error, map[primitive.ObjectID]*models.Product, []*models.ProductChange, error) {
+	ids := make([]primitive.ObjectID, 0, len(writes))
+	for _, w := range writes {
+		if w.Op == models.ProductWriteUpdate {
+			ids = append(ids, w.Product.ProductID)
+		}
+	}
+	before, err := p.currentStates(ctx, ids)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	writeErrs, err := p.productRepo.BulkWrite(ctx, writes)
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "BulkWrite")
+	}
+	for _, writeErr := range writeErrs {
+		if writeErr != nil {
+			return writeErrs, nil, nil, errWriteFailed
+		}
+	}
+
+	written := make([]primitive.ObjectID, 0, len(writes))
+	seen := make(map[primitive.ObjectID]bool, len(writes))
+	for _, w := range writes {
+		if !seen[w.Product.ProductID] {
+			seen[w.Product.ProductID] = true
+			written = append(written, w.Product.ProductID)
+		}
+	}
+
+	after, err := p.currentStates(ctx, written)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	changes := make([]*models.ProductChange, 0, len(written))
+	for _, id := range written {
+		if prod, ok := after[id]; ok {
+			changes = append(changes, &models.ProductChange{Before: before[id], After: prod})
+		}
+	}
+	if err := p.outboxRepo.AppendChanges(ctx, changes...); err != nil {
+		return nil, nil, nil, errors.Wrap(err, "outboxRepo.AppendChanges")
+	}
+	return writeErrs, after, changes, nil
+}
+
+// currentStates stored products by id, missing products are absent from result
+func (p *productUC) currentStates(ctx context.Context, productIDs []primitive.ObjectID) (map[primitive.ObjectID]*models.Product, error) {
+	states := make(map[primitive.ObjectID]*models.Product, len(productIDs))
+	if len(productIDs) == 0 {
+		return states, nil
+	}
+
+	products, err := p.productRepo.GetByIDs(ctx, productIDs)
+	if err != nil {
+		return nil, errors.Wrap(err, "GetByIDs")
+	}
+	for _, prod := range products {
+		states[prod.ProductID] = prod
+	}
+	return states, nil
+}
+
+// invalidateSearch drop cached search pages affected by product changes, stale pages expire with their TTL on failure
+func (p *productUC) invalidateSearch(ctx context.Context, changes ...*models.ProductChange) {
+	if err := p.searchCache.InvalidateProducts(ctx, changes...); err != nil {
+		p.log.Errorf("searchCache.InvalidateProducts: %v", err)
+	}
+}
+
+// changesStored invalidate search cache and wake outbox relay to publish product changes committed with product writes,
+// stale search pages expire with their TTL when invalidation fails
+func (p *productUC) changesStored(ctx context.Context, changes ...*models.ProductChange) {
+	if len(changes) == 0 {
+		return
+	}
+	p.invalidateSearch(ctx, changes...)
+	p.relay.wake()
+}
+
+// Watch send changes of products matching filter until context is done or send fails,
+// changes after resume token are sent first
+func (p *productUC) Watch(ctx context.Context, filter *models.WatchFilter, resumeToken string, send func(*models.ProductChangeEvent) error) error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "productUC.Watch")
+	defer span.Finish()
+
+	sub, err := p.changeFeed.Subscribe(ctx, resumeToken, filter.Matches)
+	if err != nil {
+		return errors.Wrap(err, "changeFeed.Subscribe")
+	}
+	defer sub.Close()
+
+	for {
+		event, err := sub.Next(ctx)
+		if err != nil {
+			return errors.Wrap(err, "sub.Next")
+		}
+		if err := send(event); err != nil {
+			return errors.Wrap(err, "send")
+		}
+	}
 }
 
-// PublishCreate create new product
+// PublishCreate create new product, product id is allocated up front to key create and later updates alike
 func (p *productUC) PublishCreate(ctx context.Context, product *models.Product) error {
 	span, ctx := opentracing.StartSpanFromContext(ctx, "productUC.PublishCreate")
 	defer span.Finish()
 
-	prodBytes, err := json.Marshal(&product)
-	if err != nil {
-		return errors.Wrap(err, "json.Marshal")
+	if product.ProductID.IsZero() {
+		product.ProductID = primitive.NewObjectID()
 	}
 
-	return p.prodProducer.PublishCreate(ctx, kafka.Message{
-		Value: prodBytes,
-		Time:  time.Now().UTC(),
-	})
+	return p.prodProducer.PublishCreate(ctx, product)
 }
 
 // PublishUpdate update new product
@@ -113,13 +578,5 @@ func (p *productUC) PublishUpdate(ctx context.Context, product *models.Product)
 	span, ctx := opentracing.StartSpanFromContext(ctx, "productUC.PublishUpdate")
 	defer span.Finish()
 
-	prodBytes, err := json.Marshal(&product)
-	if err != nil {
-		return errors.Wrap(err, "json.Marshal")
-	}
-
-	return p.prodProducer.PublishUpdate(ctx, kafka.Message{
-		Value: prodBytes,
-		Time:  time.Now().UTC(),
-	})
+	return p.prodProducer.PublishUpdate(ctx, product)
 }
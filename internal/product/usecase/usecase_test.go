@@ -0,0 +1,271 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/Yangiboev/golang-with-curiosity/config"
+	"github.com/Yangiboev/golang-with-curiosity/internal/models"
+	"github.com/Yangiboev/golang-with-curiosity/internal/product"
+	prodKafka "github.com/Yangiboev/golang-with-curiosity/internal/product/delivery/kafka"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/events"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/messagebus"
+	productErrors "github.com/Yangiboev/golang-with-curiosity/pkg/product_errors"
+)
+
+// fakeProductRepo in memory products, transaction is rolled back when fn fails and bulk write stops at first failing
+// product like it does in transaction
+type fakeProductRepo struct {
+	product.MongoRepository
+
+	products  map[primitive.ObjectID]*models.Product
+	failing   map[primitive.ObjectID]error
+	bulkSizes []int
+	// reads signal started and block until released when set
+	started chan struct{}
+	reads   chan struct{}
+}
+
+func (f *fakeProductRepo) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	snapshot := make(map[primitive.ObjectID]*models.Product, len(f.products))
+	for id, prod := range f.products {
+		snapshot[id] = prod
+	}
+	if err := fn(ctx); err != nil {
+		f.products = snapshot
+		return err
+	}
+	return nil
+}
+
+func (f *fakeProductRepo) GetByID(ctx context.Context, productID primitive.ObjectID) (*models.Product, error) {
+	if f.started != nil {
+		f.started <- struct{}{}
+	}
+	if f.reads != nil {
+		select {
+		case <-f.reads:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	prod, ok := f.products[productID]
+	if !ok {
+		return nil, productErrors.ErrProductNotFound
+	}
+	return prod, nil
+}
+
+func (f *fakeProductRepo) GetByIDs(ctx context.Context, productIDs []primitive.ObjectID) ([]*models.Product, error) {
+	products := make([]*models.Product, 0, len(productIDs))
+	for _, id := range productIDs {
+		if prod, ok := f.products[id]; ok {
+			products = append(products, prod)
+		}
+	}
+	return products, nil
+}
+
+func (f *fakeProductRepo) BulkWrite(ctx context.Context, writes []*models.ProductWrite) ([]error, error) {
+	f.bulkSizes = append(f.bulkSizes, len(writes))
+	writeErrs := make([]error, len(writes))
+	for i, w := range writes {
+		if err, ok := f.failing[w.Product.ProductID]; ok {
+			writeErrs[i] = err
+			return writeErrs, nil
+		}
+		f.products[w.Product.ProductID] = w.Product
+	}
+	return writeErrs, nil
+}
+
+func (f *fakeProductRepo) Delete(ctx context.Context, productID primitive.ObjectID) (*models.Product, error) {
+	prod, ok := f.products[productID]
+	if !ok {
+		return nil, productErrors.ErrProductNotFound
+	}
+	delete(f.products, productID)
+	return prod, nil
+}
+
+type fakeCaches struct {
+	product.RedisRepository
+	product.SearchCacheRepository
+
+	// stored receives cached products when set
+	stored chan *models.Product
+	// written products written through to cache
+	written []*models.Product
+}
+
+func (f *fakeCaches) FillProduct(ctx context.Context, product *models.Product, delta time.Duration) error {
+	if f.stored != nil {
+		f.stored <- product
+	}
+	return nil
+}
+
+func (f *fakeCaches) SetProduct(ctx context.Context, product *models.Product, delta time.Duration) error {
+	f.written = append(f.written, product)
+	return nil
+}
+
+func (f *fakeCaches) SetNotFound(ctx context.Context, productID primitive.ObjectID) error {
+	return nil
+}
+
+func (f *fakeCaches) FillNotFound(ctx context.Context, productID primitive.ObjectID) error {
+	return nil
+}
+
+func (f *fakeCaches) DeleteProduct(ctx context.Context, productID primitive.ObjectID) error {
+	return nil
+}
+
+func (f *fakeCaches) InvalidateProducts(ctx context.Context, changes ...*models.ProductChange) error {
+	return nil
+}
+
+func TestBatchCreateLeavesOutFailedWritesAndStoresChangesOfOthers(t *testing.T) {
+	products := []*models.Product{
+		{ProductID: primitive.NewObjectID(), Name: "first"},
+		{ProductID: primitive.NewObjectID(), Name: "duplicate"},
+		{ProductID: primitive.NewObjectID(), Name: "third"},
+	}
+	writeErr := errors.New("duplicate key")
+	repo := &fakeProductRepo{
+		products: make(map[primitive.ObjectID]*models.Product),
+		failing:  map[primitive.ObjectID]error{products[1].ProductID: writeErr},
+	}
+	outbox := &fakeOutbox{}
+	caches := &fakeCaches{}
+	uc := &productUC{
+		productRepo: repo,
+		outboxRepo:  outbox,
+		redisRepo:   caches,
+		searchCache: caches,
+		log:         newTestLogger(),
+		relay:       newTestRelay(outbox, &fakeChangeSink{}, 10),
+	}
+
+	results, err := uc.BatchCreate(context.Background(), products)
+	if err != nil {
+		t.Fatalf("BatchCreate: %v", err)
+	}
+
+	if !errors.Is(results[1].Err, writeErr) || results[0].Err != nil || results[2].Err != nil {
+		t.Fatalf("results errors %v, %v, %v, want only second write failed", results[0].Err, results[1].Err, results[2].Err)
+	}
+	if len(repo.bulkSizes) != 2 || repo.bulkSizes[1] != 2 {
+		t.Fatalf("bulk sizes %v, want retry without failed write", repo.bulkSizes)
+	}
+	if _, ok := repo.products[products[0].ProductID]; !ok || len(repo.products) != 2 {
+		t.Fatalf("stored %d products, want first and third", len(repo.products))
+	}
+
+	entries, _ := outbox.PendingChanges(context.Background(), 10)
+	if len(entries) != 2 || entries[0].After.Name != "first" || entries[1].After.Name != "third" {
+		t.Fatalf("outbox has %d changes, want changes of first and third", len(entries))
+	}
+	if len(caches.written) != 2 || caches.written[0].Name != "first" || caches.written[1].Name != "third" {
+		t.Fatalf("written through %d products to cache, want first and third", len(caches.written))
+	}
+}
+
+func TestCoalescedLoadOutlivesCallerThatStartedIt(t *testing.T) {
+	prod := &models.Product{ProductID: primitive.NewObjectID(), Name: "product"}
+	repo := &fakeProductRepo{
+		products: map[primitive.ObjectID]*models.Product{prod.ProductID: prod},
+		started:  make(chan struct{}, 1),
+		reads:    make(chan struct{}),
+	}
+	caches := &fakeCaches{stored: make(chan *models.Product, 1)}
+	uc := &productUC{productRepo: repo, redisRepo: caches, log: newTestLogger()}
+	policy := config.CachePolicy{Coalesce: true, LoadTimeout: time.Second}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	loadErr := make(chan error, 1)
+	go func() {
+		_, err := uc.loadProduct(ctx, prod.ProductID, policy)
+		loadErr <- err
+	}()
+	<-repo.started
+	cancel()
+	if err := <-loadErr; !errors.Is(err, context.Canceled) {
+		t.Fatalf("loadProduct error = %v, want context.Canceled", err)
+	}
+	close(repo.reads)
+
+	select {
+	case stored := <-caches.stored:
+		if stored.ProductID != prod.ProductID {
+			t.Fatalf("cached product %v, want %v", stored.ProductID, prod.ProductID)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("load was canceled with its caller, want product read and cached for callers sharing it")
+	}
+}
+
+func TestDeletePublishesCatalogTombstone(t *testing.T) {
+	prod := &models.Product{ProductID: primitive.NewObjectID(), Name: "product"}
+	repo := &fakeProductRepo{products: map[primitive.ObjectID]*models.Product{prod.ProductID: prod}}
+	outbox := &fakeOutbox{}
+	caches := &fakeCaches{}
+
+	cfg := config.Config{}
+	cfg.Kafka.Topics.ProductEvents = "product-events"
+	cfg.Kafka.Topics.ProductCatalog = "product-catalog"
+	codecs, err := prodKafka.NewProductCodecs(cfg, nil)
+	if err != nil {
+		t.Fatalf("NewProductCodecs: %v", err)
+	}
+	bus := messagebus.NewMemoryBus(1)
+	defer bus.Close()
+	relay := newOutboxRelay(outbox, &fakeChangeSink{}, prodKafka.NewProductsProducer(newTestLogger(), cfg, codecs, bus), newTestLogger(),
+		config.ProductOutbox{PollInterval: time.Millisecond, BatchSize: 10, Lease: time.Second})
+	uc := &productUC{productRepo: repo, outboxRepo: outbox, redisRepo: caches, searchCache: caches, log: newTestLogger(), relay: relay}
+
+	if err := uc.Delete(context.Background(), prod.ProductID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := relay.relay(context.Background()); err != nil {
+		t.Fatalf("relay: %v", err)
+	}
+
+	catalog := fetchMessage(t, bus, cfg.Kafka.Topics.ProductCatalog)
+	if string(catalog.Key) != prod.ProductID.Hex() || catalog.Value != nil {
+		t.Fatalf("catalog message key %q value %q, want tombstone keyed by product id", catalog.Key, catalog.Value)
+	}
+	e, err := events.FromMessage(fetchMessage(t, bus, cfg.Kafka.Topics.ProductEvents))
+	if err != nil {
+		t.Fatalf("events.FromMessage: %v", err)
+	}
+	if e.Type != models.ProductDeletedEventType || e.Subject != prod.ProductID.Hex() {
+		t.Fatalf("event %s of %s, want %s of deleted product", e.Type, e.Subject, models.ProductDeletedEventType)
+	}
+
+	if err := uc.Delete(context.Background(), prod.ProductID); !errors.Is(err, productErrors.ErrProductNotFound) {
+		t.Fatalf("Delete of deleted product error = %v, want ErrProductNotFound", err)
+	}
+}
+
+func fetchMessage(t *testing.T, bus messagebus.Subscriber, topic string) messagebus.Message {
+	t.Helper()
+	sub, err := bus.Subscribe(topic, "test-"+topic)
+	if err != nil {
+		t.Fatalf("bus.Subscribe: %v", err)
+	}
+	defer sub.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	m, err := sub.Fetch(ctx)
+	if err != nil {
+		t.Fatalf("sub.Fetch %s: %v", topic, err)
+	}
+	return m
+}
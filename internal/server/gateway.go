@@ -0,0 +1,108 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/textproto"
+	"strings"
+
+	"github.com/Yangiboev/golang-with-curiosity/internal/interceptors"
+	httpErrors "github.com/Yangiboev/golang-with-curiosity/pkg/http_errors"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/idempotency"
+	productsService "github.com/Yangiboev/golang-with-curiosity/proto/product"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const gatewayPrefix = "/api/v2"
+
+// newGateway REST proxy of products and consumer admin gRPC services, generated from google.api.http annotations of
+// product.proto. Proxied calls go through gRPC server and pass the same interceptors as gRPC clients, consumer admin
+// calls need admin bearer token in Authorization header
+func (s *server) newGateway(ctx context.Context) (http.Handler, error) {
+	creds, err := credentials.NewClientTLSFromFile(s.cfg.Gateway.CAFile, s.cfg.Gateway.ServerName)
+	if err != nil {
+		return nil, errors.Wrap(err, "credentials.NewClientTLSFromFile")
+	}
+	endpoint := s.cfg.Gateway.Endpoint
+	if endpoint == "" {
+		endpoint = "localhost" + s.cfg.Server.Port
+	}
+
+	mux := runtime.NewServeMux(
+		runtime.WithIncomingHeaderMatcher(s.gatewayIncomingHeader),
+		runtime.WithOutgoingHeaderMatcher(gatewayOutgoingHeader),
+		runtime.WithErrorHandler(s.gatewayErrorHandler),
+		runtime.WithMetadata(s.gatewayMetadata),
+	)
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(creds)}
+	if err := productsService.RegisterProductsServiceHandlerFromEndpoint(ctx, mux, endpoint, opts); err != nil {
+		return nil, errors.Wrap(err, "RegisterProductsServiceHandlerFromEndpoint")
+	}
+	if err := productsService.RegisterConsumerAdminServiceHandlerFromEndpoint(ctx, mux, endpoint, opts); err != nil {
+		return nil, errors.Wrap(err, "RegisterConsumerAdminServiceHandlerFromEndpoint")
+	}
+	return mux, nil
+}
+
+// gatewayMetadata pass client IP read through trusted proxies to gRPC server
+func (s *server) gatewayMetadata(_ context.Context, r *http.Request) metadata.MD {
+	return metadata.Pairs(interceptors.ClientIPMetadataKey, s.echo.IPExtractor(r))
+}
+
+// gatewayIncomingHeader pass request id header as it is, idempotency key header as its metadata key, drop client IP
+// metadata set by clients, other headers as grpc-gateway does
+func (s *server) gatewayIncomingHeader(key string) (string, bool) {
+	switch textproto.CanonicalMIMEHeaderKey(key) {
+	case echo.HeaderXRequestID:
+		return key, true
+	case textproto.CanonicalMIMEHeaderKey(s.cfg.Idempotency.Header):
+		return s.cfg.Idempotency.MetadataKey, true
+	case textproto.CanonicalMIMEHeaderKey(runtime.MetadataHeaderPrefix + interceptors.ClientIPMetadataKey):
+		return "", false
+	}
+	return runtime.DefaultHeaderMatcher(key)
+}
+
+// gatewayOutgoingHeader return rate limit and idempotent replay metadata as plain headers, other metadata as
+// Grpc-Metadata-* headers
+func gatewayOutgoingHeader(key string) (string, bool) {
+	if strings.HasPrefix(key, "ratelimit-") || key == "retry-after" || key == strings.ToLower(idempotency.ReplayedHeader) {
+		return key, true
+	}
+	return runtime.MetadataHeaderPrefix + key, true
+}
+
+// gatewayErrorHandler write errors of proxied calls as problem details, response metadata is forwarded as headers
+func (s *server) gatewayErrorHandler(
+	ctx context.Context,
+	_ *runtime.ServeMux,
+	_ runtime.Marshaler,
+	w http.ResponseWriter,
+	r *http.Request,
+	err error,
+) {
+	if md, ok := runtime.ServerMetadataFromContext(ctx); ok {
+		for key, values := range md.HeaderMD {
+			header, ok := gatewayOutgoingHeader(key)
+			if !ok {
+				continue
+			}
+			for _, value := range values {
+				w.Header().Add(header, value)
+			}
+		}
+	}
+
+	problem := httpErrors.NewStatusProblem(status.Convert(err))
+	problem.Instance = r.URL.Path
+	if err := httpErrors.WriteProblem(w, problem); err != nil {
+		s.log.Errorf("httpErrors.WriteProblem: %v", err)
+	}
+}
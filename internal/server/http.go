@@ -8,6 +8,8 @@ import (
 	"github.com/labstack/echo/v4/middleware"
 
 	"github.com/Yangiboev/golang-with-curiosity/docs"
+	"github.com/Yangiboev/golang-with-curiosity/internal/middlewares"
+	httpErrors "github.com/Yangiboev/golang-with-curiosity/pkg/http_errors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	echoSwagger "github.com/swaggo/echo-swagger"
 )
@@ -20,12 +22,20 @@ func (s *server) runHttpServer() {
 	s.mapRoutes()
 }
 func (s *server) mapRoutes() {
-	docs.SwaggerInfo.Version = "1.0"
-	docs.SwaggerInfo.Title = "Products microservice"
-	docs.SwaggerInfo.Description = "Products REST API microservice."
-	docs.SwaggerInfo.Version = "1.0"
-	docs.SwaggerInfo.BasePath = "/api/v1"
+	if err := docs.Register(docs.Info{
+		Title:       "Products microservice",
+		Description: "Products REST API microservice.",
+		Version:     s.cfg.AppVersion,
+	}); err != nil {
+		s.log.Errorf("docs.Register: %v", err)
+	}
 
+	s.echo.HTTPErrorHandler = s.httpErrorHandler
+	trustedProxies, err := s.cfg.Server.TrustedProxyNets()
+	if err != nil {
+		s.log.Errorf("cfg.Server.TrustedProxyNets: %v", err)
+	}
+	s.echo.IPExtractor = middlewares.NewIPExtractor(trustedProxies)
 	s.echo.GET("/swagger/*", echoSwagger.WrapHandler)
 	s.echo.Use(middleware.Logger())
 	s.echo.Use(middleware.HTTPSRedirect())
@@ -48,3 +58,13 @@ func (s *server) mapRoutes() {
 	s.echo.Use(middleware.Secure())
 	s.echo.Use(middleware.BodyLimit(bodyLimit))
 }
+
+// httpErrorHandler write errors of routing and middlewares as problem details
+func (s *server) httpErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+	if err := httpErrors.ErrorCtxResponse(c, err); err != nil {
+		s.log.Errorf("httpErrors.ErrorCtxResponse: %v", err)
+	}
+}
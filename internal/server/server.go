@@ -12,15 +12,20 @@ import (
 	"github.com/Yangiboev/golang-with-curiosity/config"
 	"github.com/Yangiboev/golang-with-curiosity/internal/interceptors"
 	"github.com/Yangiboev/golang-with-curiosity/internal/middlewares"
+	productsGraphQL "github.com/Yangiboev/golang-with-curiosity/internal/product/delivery/graphql"
 	product "github.com/Yangiboev/golang-with-curiosity/internal/product/delivery/grpc"
 	productsHttpV1 "github.com/Yangiboev/golang-with-curiosity/internal/product/delivery/http/v1"
 	"github.com/Yangiboev/golang-with-curiosity/internal/product/delivery/kafka"
 	"github.com/Yangiboev/golang-with-curiosity/internal/product/repository"
 	"github.com/Yangiboev/golang-with-curiosity/internal/product/usecase"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/idempotency"
 	"github.com/Yangiboev/golang-with-curiosity/pkg/logger"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/messagebus"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/ratelimit"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/schemaregistry"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/utils"
 	productsService "github.com/Yangiboev/golang-with-curiosity/proto/product"
 
-	"github.com/go-playground/validator/v10"
 	"github.com/go-redis/redis/v8"
 	grpcrecovery "github.com/grpc-ecosystem/go-grpc-middleware/recovery"
 	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
@@ -46,34 +51,39 @@ const (
 	stackSize       = 1 << 10 //1kb
 	csrfTokenHeader = "X-CSRF-Token"
 	bodyLimit       = "2M"
-	kafkaGroupID    = "product_group"
 )
 
 type ServerOptions struct {
-	Log     logger.Logger
-	Config  config.Config
-	Tracer  opentracing.Tracer
-	MongoDB *mongo.Client
-	Echo    *echo.Echo
-	Redis   *redis.Client
+	Log            logger.Logger
+	Config         config.Config
+	Tracer         opentracing.Tracer
+	MongoDB        *mongo.Client
+	Echo           *echo.Echo
+	Redis          redis.UniversalClient
+	SchemaRegistry schemaregistry.Client
+	MessageBus     messagebus.Bus
 }
 type server struct {
-	log     logger.Logger
-	cfg     config.Config
-	tracer  opentracing.Tracer
-	mongoDB *mongo.Client
-	echo    *echo.Echo
-	redis   *redis.Client
+	log            logger.Logger
+	cfg            config.Config
+	tracer         opentracing.Tracer
+	mongoDB        *mongo.Client
+	echo           *echo.Echo
+	redis          redis.UniversalClient
+	schemaRegistry schemaregistry.Client
+	messageBus     messagebus.Bus
 }
 
 func NewServer(opts *ServerOptions) *server {
 	return &server{
-		log:     opts.Log,
-		cfg:     opts.Config,
-		tracer:  opts.Tracer,
-		mongoDB: opts.MongoDB,
-		echo:    echo.New(),
-		redis:   opts.Redis,
+		log:            opts.Log,
+		cfg:            opts.Config,
+		tracer:         opts.Tracer,
+		mongoDB:        opts.MongoDB,
+		echo:           echo.New(),
+		redis:          opts.Redis,
+		schemaRegistry: opts.SchemaRegistry,
+		messageBus:     opts.MessageBus,
 	}
 }
 
@@ -81,16 +91,32 @@ func NewServer(opts *ServerOptions) *server {
 func (s *server) Run() error {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-	validate := validator.New()
-	productsProducer := kafka.NewProductsProducer(s.log, s.cfg)
-	productsProducer.Run()
+	validate := utils.NewValidator()
+	productCodecs, err := kafka.NewProductCodecs(s.cfg, s.schemaRegistry)
+	if err != nil {
+		return errors.Wrap(err, "kafka.NewProductCodecs")
+	}
+	if err := productCodecs.RegisterSchemas(ctx); err != nil {
+		return errors.Wrap(err, "productCodecs.RegisterSchemas")
+	}
+	if err := kafka.ProvisionTopics(ctx, s.cfg.Kafka, s.log, s.messageBus); err != nil {
+		return errors.Wrap(err, "kafka.ProvisionTopics")
+	}
+	productsProducer := kafka.NewProductsProducer(s.log, s.cfg, productCodecs, s.messageBus)
 
 	productMongoRepo := repository.NewProductMongoRepo(s.mongoDB)
-	productRedisRepo := repository.NewProductRedisRepository(s.redis)
-	productUC := usecase.NewProductUC(productMongoRepo, productRedisRepo, s.log, productsProducer)
+	outboxMongoRepo := repository.NewOutboxMongoRepo(s.mongoDB)
+	productRedisRepo := repository.NewProductCacheRepository(ctx, s.log, s.redis, s.cfg)
+	searchRedisRepo := repository.NewSearchRedisRepository(s.redis, s.cfg)
+	changeFeedRepo := repository.NewChangeFeedRepository(ctx, s.log, s.redis, s.cfg)
+	idempotencyRedisRepo := repository.NewIdempotencyRedisRepository(s.redis)
+	productUC := usecase.NewProductUC(productMongoRepo, outboxMongoRepo, productRedisRepo, searchRedisRepo, changeFeedRepo, s.log, productsProducer, s.cfg)
+	go productUC.RelayChanges(ctx)
 
-	im := interceptors.NewInterceptorManager(s.log, s.cfg)
-	mw := middlewares.NewMiddlewareManager(s.log, s.cfg)
+	limiter := ratelimit.NewLimiter(s.log, s.redis, s.cfg)
+	idempotencyStore := idempotency.NewRedisStore(s.redis, s.cfg)
+	im := interceptors.NewInterceptorManager(s.log, s.cfg, limiter, idempotencyStore)
+	mw := middlewares.NewMiddlewareManager(s.log, s.cfg, limiter, idempotencyStore)
 	l, err := net.Listen("tcp", s.cfg.Server.Port)
 	if err != nil {
 		return errors.Wrap(err, "net.Listen")
@@ -114,17 +140,51 @@ func (s *server) Run() error {
 			grpc_prometheus.UnaryServerInterceptor,
 			grpcrecovery.UnaryServerInterceptor(),
 			im.Logger,
+			im.AdminAuth,
+			im.RateLimit,
+			im.Idempotency,
+			im.CachePolicy,
+		),
+		grpc.ChainStreamInterceptor(
+			grpc_ctxtags.StreamServerInterceptor(),
+			grpc_opentracing.StreamServerInterceptor(),
+			grpc_prometheus.StreamServerInterceptor,
+			grpcrecovery.StreamServerInterceptor(),
+			im.StreamLogger,
+			im.StreamAdminAuth,
+			im.StreamRateLimit,
 		),
 	)
-	productService := product.NewProductService(s.log, productUC, validate)
+	productCG := kafka.NewProductsConsumerGroup(s.cfg.Kafka.GroupID, s.log, s.cfg, productUC, validate, idempotencyRedisRepo, productCodecs, s.messageBus, s.messageBus)
+	productCG.RunConsumers(ctx, cancel)
+
+	productService := product.NewProductService(s.log, productUC, validate, s.cfg)
 	productsService.RegisterProductsServiceServer(grpcServer, productService)
+	consumerAdminService := product.NewConsumerAdminService(s.log, productCG, validate)
+	productsService.RegisterConsumerAdminServiceServer(grpcServer, consumerAdminService)
 	grpc_prometheus.Register(grpcServer)
-	v1 := s.echo.Group("/api/v1")
+	// v1 REST API is kept for existing clients as asynchronous write API, its writes are published to Kafka and
+	// applied by products consumer group. v2 gateway and GraphQL write synchronously, all of them through productUC
+	v1 := s.echo.Group("/api/v1", mw.RateLimit)
 
-	productHandlers := productsHttpV1.NewProductHandlers(s.log, productUC, validate, v1.Group("/products"), mw)
+	productHandlers := productsHttpV1.NewProductHandlers(s.log, productUC, validate, v1.Group("/products"), mw, s.cfg)
 	productHandlers.MapRoutes()
-	productCG := kafka.NewProductsConsumerGroup(s.cfg.Kafka.Brokers, kafkaGroupID, s.log, s.cfg, productUC, validate)
-	productCG.RunConsumers(ctx, cancel)
+	consumerAdminHandlers := productsHttpV1.NewConsumerAdminHandlers(s.log, productCG, validate, v1.Group("/admin/consumer-groups", mw.AdminAuth))
+	consumerAdminHandlers.MapRoutes()
+	if s.cfg.Gateway.Enabled {
+		gateway, err := s.newGateway(ctx)
+		if err != nil {
+			return errors.Wrap(err, "newGateway")
+		}
+		s.echo.Any(gatewayPrefix+"/*", echo.WrapHandler(gateway))
+	}
+	if s.cfg.GraphQL.Enabled {
+		graphQLHandlers, err := productsGraphQL.NewProductGraphQLHandlers(s.log, productUC, validate, s.echo.Group("/graphql", mw.RateLimit), s.cfg)
+		if err != nil {
+			return errors.Wrap(err, "NewProductGraphQLHandlers")
+		}
+		graphQLHandlers.MapRoutes()
+	}
 	go func() {
 		s.log.Infof("Server is listening on PORT: %s", s.cfg.Http.Port)
 		s.runHttpServer()
@@ -156,6 +216,8 @@ func (s *server) Run() error {
 	if err := metricsServer.Shutdown(ctx); err != nil {
 		s.log.Errorf("metricsServer.Shutdown: %v", err)
 	}
+	// watch streams never finish on their own, they are closed with change feed
+	cancel()
 	grpcServer.GracefulStop()
 	s.log.Info("Server Exited Properly")
 
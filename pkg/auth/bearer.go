@@ -0,0 +1,17 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"strings"
+)
+
+const bearerPrefix = "Bearer "
+
+// ValidBearer authorization value is "Bearer <token>" of token, empty token never matches
+func ValidBearer(authorization string, token string) bool {
+	if token == "" || !strings.HasPrefix(authorization, bearerPrefix) {
+		return false
+	}
+	given := strings.TrimPrefix(authorization, bearerPrefix)
+	return subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
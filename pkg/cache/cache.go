@@ -0,0 +1,41 @@
+package cache
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/Yangiboev/golang-with-curiosity/config"
+)
+
+type policyKey struct{}
+
+// WithPolicy put call path cache read policy into context
+func WithPolicy(ctx context.Context, policy config.CachePolicy) context.Context {
+	return context.WithValue(ctx, policyKey{}, policy)
+}
+
+// PolicyFromContext get cache read policy from context, zero policy is plain cache aside
+func PolicyFromContext(ctx context.Context) config.CachePolicy {
+	policy, _ := ctx.Value(policyKey{}).(config.CachePolicy)
+	return policy
+}
+
+// JitteredTTL ttl spread randomly by up to jitter fraction in both directions, so entries cached together expire apart
+func JitteredTTL(ttl time.Duration, jitter float64) time.Duration {
+	if jitter <= 0 {
+		return ttl
+	}
+	return ttl + time.Duration(float64(ttl)*jitter*(2*rand.Float64()-1))
+}
+
+// ShouldRefreshEarly probabilistic early expiration, entry which took delta to load is refreshed before expiration
+// with probability growing as expiration nears, beta above one favours earlier refreshes
+func ShouldRefreshEarly(expiresAt time.Time, delta time.Duration, beta float64, now time.Time) bool {
+	if delta <= 0 || beta <= 0 {
+		return false
+	}
+	gap := time.Duration(-float64(delta) * beta * math.Log(rand.Float64()))
+	return !now.Add(gap).Before(expiresAt)
+}
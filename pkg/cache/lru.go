@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// LRU size bounded least recently used cache with per cache entry TTL, safe for concurrent use
+type LRU struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	items   map[string]*list.Element
+	order   *list.List
+	onEvict func(key string)
+}
+
+type lruEntry struct {
+	key       string
+	value     interface{}
+	expiresAt time.Time
+}
+
+// NewLRU constructor, onEvict is called for entries evicted to stay within size and may be nil
+func NewLRU(size int, ttl time.Duration, onEvict func(key string)) *LRU {
+	return &LRU{
+		size:    size,
+		ttl:     ttl,
+		items:   make(map[string]*list.Element, size),
+		order:   list.New(),
+		onEvict: onEvict,
+	}
+}
+
+// Get value of not expired entry and mark it recently used
+func (l *LRU) Get(key string) (interface{}, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	el, ok := l.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*lruEntry)
+	if !time.Now().Before(entry.expiresAt) {
+		l.remove(el)
+		return nil, false
+	}
+	l.order.MoveToFront(el)
+	return entry.value, true
+}
+
+// Set add or replace entry, least recently used entries are evicted when cache is full
+func (l *LRU) Set(key string, value interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	expiresAt := time.Now().Add(l.ttl)
+	if el, ok := l.items[key]; ok {
+		entry := el.Value.(*lruEntry)
+		entry.value = value
+		entry.expiresAt = expiresAt
+		l.order.MoveToFront(el)
+		return
+	}
+
+	l.items[key] = l.order.PushFront(&lruEntry{key: key, value: value, expiresAt: expiresAt})
+	for l.order.Len() > l.size {
+		oldest := l.order.Back()
+		l.remove(oldest)
+		if l.onEvict != nil {
+			l.onEvict(oldest.Value.(*lruEntry).key)
+		}
+	}
+}
+
+// Delete remove entry
+func (l *LRU) Delete(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if el, ok := l.items[key]; ok {
+		l.remove(el)
+	}
+}
+
+// Purge remove all entries
+func (l *LRU) Purge() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.items = make(map[string]*list.Element, l.size)
+	l.order.Init()
+}
+
+// Len number of entries, including expired entries not yet removed
+func (l *LRU) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.order.Len()
+}
+
+func (l *LRU) remove(el *list.Element) {
+	l.order.Remove(el)
+	delete(l.items, el.Value.(*lruEntry).key)
+}
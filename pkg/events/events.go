@@ -0,0 +1,122 @@
+package events
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// SpecVersion CloudEvents spec version
+	SpecVersion = "1.0"
+
+	ContentTypeJSON            = "application/json"
+	ContentTypeProtobuf        = "application/x-protobuf"
+	ContentTypeCloudEventsJSON = "application/cloudevents+json"
+)
+
+// Mode CloudEvents Kafka protocol binding content mode
+type Mode string
+
+const (
+	// BinaryMode event attributes in kafka headers, data in message value
+	BinaryMode Mode = "binary"
+	// StructuredMode whole event json encoded in message value
+	StructuredMode Mode = "structured"
+)
+
+var (
+	ErrNoEnvelope       = errors.New("message has no cloudevents envelope")
+	ErrUnsupportedMode  = errors.New("unsupported cloudevents content mode")
+	ErrMissingAttribute = errors.New("missing required cloudevents attribute")
+)
+
+type correlationIDKey struct{}
+
+// WithCorrelationID put correlation id into context, events created with this context carry it
+func WithCorrelationID(ctx context.Context, correlationID string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, correlationID)
+}
+
+// CorrelationIDFromContext get correlation id from context
+func CorrelationIDFromContext(ctx context.Context) string {
+	correlationID, _ := ctx.Value(correlationIDKey{}).(string)
+	return correlationID
+}
+
+// Event CloudEvents v1.0 envelope with schemaversion and correlationid extensions
+type Event struct {
+	ID              string
+	Source          string
+	SpecVersion     string
+	Type            string
+	Subject         string
+	Time            time.Time
+	DataContentType string
+	SchemaVersion   int
+	CorrelationID   string
+	Data            []byte
+}
+
+// NewEvent create json data event, correlation id is taken from context or defaults to the event id
+func NewEvent(ctx context.Context, eventType, source, subject string, schemaVersion int, data interface{}) (*Event, error) {
+	dataBytes, err := json.Marshal(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "json.Marshal")
+	}
+	return NewRawEvent(ctx, eventType, source, subject, schemaVersion, ContentTypeJSON, dataBytes)
+}
+
+// NewRawEvent create event with already encoded data of content type
+func NewRawEvent(ctx context.Context, eventType, source, subject string, schemaVersion int, contentType string, data []byte) (*Event, error) {
+	id, err := NewID()
+	if err != nil {
+		return nil, errors.Wrap(err, "NewID")
+	}
+
+	correlationID := CorrelationIDFromContext(ctx)
+	if correlationID == "" {
+		correlationID = id
+	}
+
+	return &Event{
+		ID:              id,
+		Source:          source,
+		SpecVersion:     SpecVersion,
+		Type:            eventType,
+		Subject:         subject,
+		Time:            time.Now().UTC(),
+		DataContentType: contentType,
+		SchemaVersion:   schemaVersion,
+		CorrelationID:   correlationID,
+		Data:            data,
+	}, nil
+}
+
+// NewID random event id
+func NewID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Validate check required CloudEvents attributes
+func (e *Event) Validate() error {
+	switch {
+	case e.ID == "":
+		return errors.Wrap(ErrMissingAttribute, "id")
+	case e.Source == "":
+		return errors.Wrap(ErrMissingAttribute, "source")
+	case e.SpecVersion == "":
+		return errors.Wrap(ErrMissingAttribute, "specversion")
+	case e.Type == "":
+		return errors.Wrap(ErrMissingAttribute, "type")
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package events
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Yangiboev/golang-with-curiosity/pkg/messagebus"
+	"github.com/pkg/errors"
+)
+
+// CloudEvents Kafka protocol binding headers, used for all message bus drivers
+const (
+	headerID            = "ce_id"
+	headerSource        = "ce_source"
+	headerSpecVersion   = "ce_specversion"
+	headerType          = "ce_type"
+	headerSubject       = "ce_subject"
+	headerTime          = "ce_time"
+	headerSchemaVersion = "ce_schemaversion"
+	headerCorrelationID = "ce_correlationid"
+	headerContentType   = "content-type"
+)
+
+// structuredEvent json representation of structured mode event
+type structuredEvent struct {
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	SpecVersion     string          `json:"specversion"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            time.Time       `json:"time"`
+	DataContentType string          `json:"datacontenttype,omitempty"`
+	SchemaVersion   int             `json:"schemaversion"`
+	CorrelationID   string          `json:"correlationid,omitempty"`
+	Data            json.RawMessage `json:"data,omitempty"`
+	DataBase64      []byte          `json:"data_base64,omitempty"`
+}
+
+// ToMessage encode event to message in binary or structured mode
+func ToMessage(e *Event, mode Mode) (messagebus.Message, error) {
+	if err := e.Validate(); err != nil {
+		return messagebus.Message{}, err
+	}
+
+	switch mode {
+	case BinaryMode, "":
+		return toBinaryMessage(e), nil
+	case StructuredMode:
+		return toStructuredMessage(e)
+	default:
+		return messagebus.Message{}, errors.Wrap(ErrUnsupportedMode, string(mode))
+	}
+}
+
+func toBinaryMessage(e *Event) messagebus.Message {
+	headers := []messagebus.Header{
+		{Key: headerID, Value: []byte(e.ID)},
+		{Key: headerSource, Value: []byte(e.Source)},
+		{Key: headerSpecVersion, Value: []byte(e.SpecVersion)},
+		{Key: headerType, Value: []byte(e.Type)},
+		{Key: headerTime, Value: []byte(e.Time.Format(time.RFC3339Nano))},
+		{Key: headerSchemaVersion, Value: []byte(strconv.Itoa(e.SchemaVersion))},
+	}
+	if e.Subject != "" {
+		headers = append(headers, messagebus.Header{Key: headerSubject, Value: []byte(e.Subject)})
+	}
+	if e.CorrelationID != "" {
+		headers = append(headers, messagebus.Header{Key: headerCorrelationID, Value: []byte(e.CorrelationID)})
+	}
+	if e.DataContentType != "" {
+		headers = append(headers, messagebus.Header{Key: headerContentType, Value: []byte(e.DataContentType)})
+	}
+
+	return messagebus.Message{
+		Value:   e.Data,
+		Headers: headers,
+		Time:    e.Time,
+	}
+}
+
+func toStructuredMessage(e *Event) (messagebus.Message, error) {
+	se := structuredEvent{
+		ID:              e.ID,
+		Source:          e.Source,
+		SpecVersion:     e.SpecVersion,
+		Type:            e.Type,
+		Subject:         e.Subject,
+		Time:            e.Time,
+		DataContentType: e.DataContentType,
+		SchemaVersion:   e.SchemaVersion,
+		CorrelationID:   e.CorrelationID,
+	}
+	if isJSONContentType(e.DataContentType) {
+		se.Data = e.Data
+	} else {
+		se.DataBase64 = e.Data
+	}
+
+	value, err := json.Marshal(&se)
+	if err != nil {
+		return messagebus.Message{}, errors.Wrap(err, "json.Marshal")
+	}
+
+	return messagebus.Message{
+		Value:   value,
+		Headers: []messagebus.Header{{Key: headerContentType, Value: []byte(ContentTypeCloudEventsJSON)}},
+		Time:    e.Time,
+	}, nil
+}
+
+// FromMessage decode event from binary or structured mode message, returns ErrNoEnvelope for plain messages
+func FromMessage(m messagebus.Message) (*Event, error) {
+	contentType := header(m, headerContentType)
+	if strings.HasPrefix(contentType, ContentTypeCloudEventsJSON) {
+		return fromStructuredMessage(m)
+	}
+	if header(m, headerSpecVersion) != "" {
+		return fromBinaryMessage(m)
+	}
+	return nil, ErrNoEnvelope
+}
+
+func fromBinaryMessage(m messagebus.Message) (*Event, error) {
+	e := &Event{
+		ID:              header(m, headerID),
+		Source:          header(m, headerSource),
+		SpecVersion:     header(m, headerSpecVersion),
+		Type:            header(m, headerType),
+		Subject:         header(m, headerSubject),
+		DataContentType: header(m, headerContentType),
+		CorrelationID:   header(m, headerCorrelationID),
+		Data:            m.Value,
+		Time:            m.Time,
+	}
+
+	if v := header(m, headerTime); v != "" {
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return nil, errors.Wrap(err, "time.Parse")
+		}
+		e.Time = t
+	}
+	if v := header(m, headerSchemaVersion); v != "" {
+		schemaVersion, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, errors.Wrap(err, "strconv.Atoi")
+		}
+		e.SchemaVersion = schemaVersion
+	}
+
+	return e, e.Validate()
+}
+
+func fromStructuredMessage(m messagebus.Message) (*Event, error) {
+	var se structuredEvent
+	if err := json.Unmarshal(m.Value, &se); err != nil {
+		return nil, errors.Wrap(err, "json.Unmarshal")
+	}
+
+	e := &Event{
+		ID:              se.ID,
+		Source:          se.Source,
+		SpecVersion:     se.SpecVersion,
+		Type:            se.Type,
+		Subject:         se.Subject,
+		Time:            se.Time,
+		DataContentType: se.DataContentType,
+		SchemaVersion:   se.SchemaVersion,
+		CorrelationID:   se.CorrelationID,
+		Data:            []byte(se.Data),
+	}
+	if se.DataBase64 != nil {
+		e.Data = se.DataBase64
+	}
+
+	return e, e.Validate()
+}
+
+func header(m messagebus.Message, key string) string {
+	v, _ := m.Header(key)
+	return v
+}
+
+func isJSONContentType(contentType string) bool {
+	return contentType == "" || strings.HasPrefix(contentType, ContentTypeJSON) || strings.HasSuffix(contentType, "+json")
+}
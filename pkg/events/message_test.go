@@ -0,0 +1,92 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/Yangiboev/golang-with-curiosity/pkg/messagebus"
+)
+
+func TestMessageRoundTrip(t *testing.T) {
+	ctx := WithCorrelationID(context.Background(), "request-1")
+	jsonEvent, err := NewEvent(ctx, "product.created", "products", "1", 2, map[string]string{"name": "product"})
+	if err != nil {
+		t.Fatalf("NewEvent: %v", err)
+	}
+	protoEvent, err := NewRawEvent(ctx, "product.created", "products", "1", 2, ContentTypeProtobuf, []byte{0x0a, 0x01, 0xff})
+	if err != nil {
+		t.Fatalf("NewRawEvent: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		event *Event
+		mode  Mode
+	}{
+		{name: "binary json", event: jsonEvent, mode: BinaryMode},
+		{name: "binary protobuf", event: protoEvent, mode: BinaryMode},
+		{name: "structured json", event: jsonEvent, mode: StructuredMode},
+		{name: "structured protobuf", event: protoEvent, mode: StructuredMode},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := ToMessage(tt.event, tt.mode)
+			if err != nil {
+				t.Fatalf("ToMessage: %v", err)
+			}
+			got, err := FromMessage(m)
+			if err != nil {
+				t.Fatalf("FromMessage: %v", err)
+			}
+
+			want := tt.event
+			if got.ID != want.ID || got.Source != want.Source || got.SpecVersion != want.SpecVersion || got.Type != want.Type ||
+				got.Subject != want.Subject || !got.Time.Equal(want.Time) || got.DataContentType != want.DataContentType ||
+				got.SchemaVersion != want.SchemaVersion || got.CorrelationID != "request-1" {
+				t.Fatalf("decoded %+v, want %+v", got, want)
+			}
+			if !bytes.Equal(got.Data, want.Data) {
+				t.Fatalf("decoded data %q, want %q", got.Data, want.Data)
+			}
+		})
+	}
+}
+
+func TestFromMessageRejectsMessagesWithoutEnvelope(t *testing.T) {
+	tests := []struct {
+		name string
+		m    messagebus.Message
+		want error
+	}{
+		{name: "plain message", m: messagebus.Message{Value: []byte(`{"name":"product"}`)}, want: ErrNoEnvelope},
+		{
+			name: "binary message without type",
+			m: messagebus.Message{Headers: []messagebus.Header{
+				{Key: headerID, Value: []byte("1")},
+				{Key: headerSource, Value: []byte("products")},
+				{Key: headerSpecVersion, Value: []byte(SpecVersion)},
+			}},
+			want: ErrMissingAttribute,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := FromMessage(tt.m); !errors.Is(err, tt.want) {
+				t.Fatalf("FromMessage error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestToMessageRejectsUnknownMode(t *testing.T) {
+	e, err := NewEvent(context.Background(), "product.created", "products", "1", 1, nil)
+	if err != nil {
+		t.Fatalf("NewEvent: %v", err)
+	}
+	if _, err := ToMessage(e, "batched"); !errors.Is(err, ErrUnsupportedMode) {
+		t.Fatalf("ToMessage error = %v, want ErrUnsupportedMode", err)
+	}
+}
@@ -0,0 +1,49 @@
+package events
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Upcaster convert event of type from its schema version to the next one
+type Upcaster func(e *Event) error
+
+// Upcasters registry of schema upcasters by event type and source schema version
+type Upcasters struct {
+	mu        sync.RWMutex
+	upcasters map[string]map[int]Upcaster
+}
+
+// NewUpcasters constructor
+func NewUpcasters() *Upcasters {
+	return &Upcasters{upcasters: make(map[string]map[int]Upcaster)}
+}
+
+// Register upcaster from schema version fromVersion to fromVersion+1
+func (u *Upcasters) Register(eventType string, fromVersion int, upcaster Upcaster) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.upcasters[eventType] == nil {
+		u.upcasters[eventType] = make(map[int]Upcaster)
+	}
+	u.upcasters[eventType][fromVersion] = upcaster
+}
+
+// Upcast apply registered upcasters in order until event reaches the latest known schema version
+func (u *Upcasters) Upcast(e *Event) error {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	for {
+		upcaster, ok := u.upcasters[e.Type][e.SchemaVersion]
+		if !ok {
+			return nil
+		}
+		if err := upcaster(e); err != nil {
+			return errors.Wrapf(err, "upcast %s v%d", e.Type, e.SchemaVersion)
+		}
+		e.SchemaVersion++
+	}
+}
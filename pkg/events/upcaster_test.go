@@ -0,0 +1,88 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// renameField upcaster moving json data field from to field to
+func renameField(from, to string) Upcaster {
+	return func(e *Event) error {
+		var data map[string]interface{}
+		if err := json.Unmarshal(e.Data, &data); err != nil {
+			return err
+		}
+		data[to] = data[from]
+		delete(data, from)
+		b, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		e.Data = b
+		return nil
+	}
+}
+
+func TestUpcastAppliesUpcastersInOrder(t *testing.T) {
+	upcasters := NewUpcasters()
+	upcasters.Register("product.created", 1, renameField("title", "name"))
+	upcasters.Register("product.created", 2, renameField("name", "productName"))
+
+	e, err := NewEvent(context.Background(), "product.created", "products", "1", 1, map[string]string{"title": "product"})
+	if err != nil {
+		t.Fatalf("NewEvent: %v", err)
+	}
+	if err := upcasters.Upcast(e); err != nil {
+		t.Fatalf("Upcast: %v", err)
+	}
+
+	if e.SchemaVersion != 3 {
+		t.Fatalf("schema version = %d, want 3", e.SchemaVersion)
+	}
+	if string(e.Data) != `{"productName":"product"}` {
+		t.Fatalf("data = %s, want data of latest schema version", e.Data)
+	}
+}
+
+func TestUpcastLeavesLatestAndOtherEventsUnchanged(t *testing.T) {
+	upcasters := NewUpcasters()
+	upcasters.Register("product.created", 1, renameField("title", "name"))
+
+	tests := []struct {
+		name      string
+		eventType string
+		version   int
+	}{
+		{name: "latest version", eventType: "product.created", version: 2},
+		{name: "other event type", eventType: "product.updated", version: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &Event{Type: tt.eventType, SchemaVersion: tt.version, Data: []byte(`{"title":"product"}`)}
+			if err := upcasters.Upcast(e); err != nil {
+				t.Fatalf("Upcast: %v", err)
+			}
+			if e.SchemaVersion != tt.version || string(e.Data) != `{"title":"product"}` {
+				t.Fatalf("event v%d %s, want it unchanged", e.SchemaVersion, e.Data)
+			}
+		})
+	}
+}
+
+func TestUpcastStopsAtFailingUpcaster(t *testing.T) {
+	upcasterErr := errors.New("malformed data")
+	upcasters := NewUpcasters()
+	upcasters.Register("product.created", 1, renameField("title", "name"))
+	upcasters.Register("product.created", 2, func(e *Event) error { return upcasterErr })
+
+	e := &Event{Type: "product.created", SchemaVersion: 1, Data: []byte(`{"title":"product"}`)}
+	if err := upcasters.Upcast(e); !errors.Is(err, upcasterErr) {
+		t.Fatalf("Upcast error = %v, want upcaster error", err)
+	}
+	if e.SchemaVersion != 2 {
+		t.Fatalf("schema version = %d, want version failing upcaster started from", e.SchemaVersion)
+	}
+}
@@ -1,49 +1,39 @@
 package grpcErrors
 
 import (
-	"context"
-	"database/sql"
-	"fmt"
 	"net/http"
-	"strings"
 
-	"github.com/pkg/errors"
+	productErrors "github.com/Yangiboev/golang-with-curiosity/pkg/product_errors"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
 )
 
-var (
-	ErrNotFound         = errors.New("Not found")
-	ErrNoCtxMetaData    = errors.New("No ctx metadata")
-	ErrInvalidSessionId = errors.New("Invalid session id")
-	ErrEmailExists      = errors.New("Email already exists")
-)
+var kindCodes = map[productErrors.Kind]codes.Code{
+	productErrors.Internal:           codes.Internal,
+	productErrors.NotFound:           codes.NotFound,
+	productErrors.Conflict:           codes.AlreadyExists,
+	productErrors.Validation:         codes.InvalidArgument,
+	productErrors.FailedPrecondition: codes.FailedPrecondition,
+	productErrors.OutOfRange:         codes.OutOfRange,
+	productErrors.ResourceExhausted:  codes.ResourceExhausted,
+	productErrors.Unavailable:        codes.Unavailable,
+	productErrors.Canceled:           codes.Canceled,
+	productErrors.DeadlineExceeded:   codes.DeadlineExceeded,
+	productErrors.Unauthenticated:    codes.Unauthenticated,
+	productErrors.PermissionDenied:   codes.PermissionDenied,
+	productErrors.Unprocessable:      codes.InvalidArgument,
+	productErrors.Aborted:            codes.Aborted,
+}
 
-// ParseGRPCErrStatusCode Parse error and get code
+// ParseGRPCErrStatusCode Parse error and get code, gRPC status errors keep their code
 func ParseGRPCErrStatusCode(err error) codes.Code {
-	switch {
-	case errors.Is(err, sql.ErrNoRows):
-		return codes.NotFound
-	case errors.Is(err, context.Canceled):
-		return codes.Canceled
-	case errors.Is(err, context.DeadlineExceeded):
-		return codes.DeadlineExceeded
-	case errors.Is(err, ErrEmailExists):
-		return codes.AlreadyExists
-	case errors.Is(err, ErrNoCtxMetaData):
-		return codes.Unauthenticated
-	case errors.Is(err, ErrInvalidSessionId):
-		return codes.PermissionDenied
-	case strings.Contains(err.Error(), "Validate"):
-		return codes.InvalidArgument
-	case strings.Contains(err.Error(), "redis"):
-		return codes.NotFound
-	case errors.Is(err, context.Canceled):
-		return codes.Canceled
-	case errors.Is(err, context.DeadlineExceeded):
-		return codes.DeadlineExceeded
+	if st, ok := status.FromError(err); ok {
+		return st.Code()
 	}
-	return codes.Internal
+	return kindCode(productErrors.Parse(err).Kind)
 }
 
 // MapGRPCErrCodeToHttpStatus Map GRPC errors codes to http status
@@ -52,7 +42,7 @@ func MapGRPCErrCodeToHttpStatus(code codes.Code) int {
 	case codes.Unauthenticated:
 		return http.StatusUnauthorized
 	case codes.AlreadyExists:
-		return http.StatusBadRequest
+		return http.StatusConflict
 	case codes.NotFound:
 		return http.StatusNotFound
 	case codes.Internal:
@@ -63,13 +53,61 @@ func MapGRPCErrCodeToHttpStatus(code codes.Code) int {
 		return http.StatusRequestTimeout
 	case codes.DeadlineExceeded:
 		return http.StatusGatewayTimeout
-	case codes.InvalidArgument:
+	case codes.InvalidArgument, codes.OutOfRange:
 		return http.StatusBadRequest
+	case codes.FailedPrecondition, codes.Aborted:
+		return http.StatusConflict
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
 	}
 	return http.StatusInternalServerError
 }
 
-// ErrorResponse GRPC Error response
-func ErrorResponse(err error, msg string) error {
-	return status.Errorf(ParseGRPCErrStatusCode(err), fmt.Sprintf("%s: %v", msg, err))
+// ErrorResponse GRPC Error response, status carries ErrorInfo with error reason, BadRequest field violations of
+// validation errors and RetryInfo of rate limit errors as details. Status message is client message of typed error,
+// messages of internal errors are not exposed
+func ErrorResponse(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	domainErr := productErrors.Parse(err)
+	code := kindCode(domainErr.Kind)
+	msg := domainErr.Message
+	if code == codes.Internal {
+		msg = productErrors.ErrInternal.Message
+	}
+
+	st, detailsErr := status.New(code, msg).WithDetails(errorDetails(domainErr)...)
+	if detailsErr != nil {
+		return status.Error(code, msg)
+	}
+	return st.Err()
+}
+
+func errorDetails(err *productErrors.Error) []proto.Message {
+	details := []proto.Message{&errdetails.ErrorInfo{Reason: err.Reason, Domain: productErrors.ErrorDomain}}
+	if len(err.Fields) > 0 {
+		badRequest := &errdetails.BadRequest{}
+		for _, field := range err.Fields {
+			badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       field.Field,
+				Description: field.Description,
+			})
+		}
+		details = append(details, badRequest)
+	}
+	if err.RetryAfter > 0 {
+		details = append(details, &errdetails.RetryInfo{RetryDelay: durationpb.New(err.RetryAfter)})
+	}
+	return details
+}
+
+func kindCode(kind productErrors.Kind) codes.Code {
+	if code, ok := kindCodes[kind]; ok {
+		return code
+	}
+	return codes.Internal
 }
@@ -1,218 +1,146 @@
 package httpErrors
 
 import (
-	"context"
-	"database/sql"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"net/http"
-	"strings"
 
+	grpcErrors "github.com/Yangiboev/golang-with-curiosity/pkg/grpc_errors"
+	productErrors "github.com/Yangiboev/golang-with-curiosity/pkg/product_errors"
 	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
-const (
-	ErrBadRequest       = "Bad request"
-	ErrAlreadyExists    = "Already exists"
-	ErrNoSuchUser       = "User not found"
-	ErrWrongCredentials = "Wrong Credentials"
-	ErrNotFound         = "Not Found"
-	ErrUnauthorized     = "Unauthorized"
-	ErrForbidden        = "Forbidden"
-	ErrBadQueryParams   = "Invalid query params"
-	ErrRequestTimeout   = "Request Timeout"
-	ErrInvalidEmail     = "Invalid email"
-	ErrInvalidPassword  = "Invalid password"
-	ErrInvalidField     = "Invalid field"
-)
-
-var (
-	ErrorBadRequest            = errors.New("bad request")
-	ErrorWrongCredentials      = errors.New("wrong Credentials")
-	ErrorNotFound              = errors.New("not Found")
-	ErrorUnauthorized          = errors.New("unauthorized")
-	ErrorForbidden             = errors.New("forbidden")
-	ErrorPermissionDenied      = errors.New("permission Denied")
-	ErrorExpiredCSRFError      = errors.New("expired CSRF token")
-	ErrorWrongCSRFToken        = errors.New("wrong CSRF token")
-	ErrorCsrfNotPresented      = errors.New("cSRF not presented")
-	ErrorNotRequiredFields     = errors.New("no such required fields")
-	ErrorBadQueryParams        = errors.New("invalid query params")
-	ErrorInternalServerError   = errors.New("internal Server Error")
-	ErrorRequestTimeoutError   = errors.New("request Timeout")
-	ErrorExistsEmailError      = errors.New("user with given email already exists")
-	ErrorInvalidJWTToken       = errors.New("invalid JWT token")
-	ErrorInvalidJWTClaims      = errors.New("invalid JWT claims")
-	ErrorNotAllowedImageHeader = errors.New("not allowed image header")
-	ErrorNoCookie              = errors.New("not found cookie header")
-	ErrorInvalidUUID           = errors.New("invalid uuid")
-)
-
-// Rest error interface
-type RestErr interface {
-	Status() int
-	Error() string
-	Causes() interface{}
-	ErrBody() RestError
-}
-
-// Rest error struct
-type RestError struct {
-	ErrStatus int         `json:"status,omitempty"`
-	ErrError  string      `json:"error,omitempty"`
-	ErrCauses interface{} `json:"err_causes,omitempty"`
-}
-
-// Error body
-func (e RestError) ErrBody() RestError {
-	return e
-}
-
-// Error  Error() interface method
-func (e RestError) Error() string {
-	return fmt.Sprintf("status: %d - errors: %s - causes: %v", e.ErrStatus, e.ErrError, e.ErrCauses)
-}
-
-// Error status
-func (e RestError) Status() int {
-	return e.ErrStatus
-}
-
-// RestError Causes
-func (e RestError) Causes() interface{} {
-	return e.ErrCauses
-}
-
-// New Rest Error
-func NewRestError(status int, err string, causes interface{}) RestErr {
-	return RestError{
-		ErrStatus: status,
-		ErrError:  err,
-		ErrCauses: causes,
+// MIMEApplicationProblemJSON content type of problem details responses
+const MIMEApplicationProblemJSON = "application/problem+json"
+
+// problemTypeBlank problem type of problems described by their status, https://tools.ietf.org/html/rfc7807#section-4.2
+const problemTypeBlank = "about:blank"
+
+// Problem RFC 7807 problem details of error response, Reason and InvalidParams are extension members
+type Problem struct {
+	Type          string                         `json:"type"`
+	Title         string                         `json:"title"`
+	Status        int                            `json:"status"`
+	Detail        string                         `json:"detail,omitempty"`
+	Instance      string                         `json:"instance,omitempty"`
+	Reason        string                         `json:"reason,omitempty"`
+	InvalidParams []productErrors.FieldViolation `json:"invalidParams,omitempty"`
+}
+
+var kindStatuses = map[productErrors.Kind]int{
+	productErrors.Internal:           http.StatusInternalServerError,
+	productErrors.NotFound:           http.StatusNotFound,
+	productErrors.Conflict:           http.StatusConflict,
+	productErrors.Validation:         http.StatusBadRequest,
+	productErrors.FailedPrecondition: http.StatusConflict,
+	productErrors.OutOfRange:         http.StatusBadRequest,
+	productErrors.ResourceExhausted:  http.StatusTooManyRequests,
+	productErrors.Unavailable:        http.StatusServiceUnavailable,
+	productErrors.Canceled:           http.StatusRequestTimeout,
+	productErrors.DeadlineExceeded:   http.StatusGatewayTimeout,
+	productErrors.Unauthenticated:    http.StatusUnauthorized,
+	productErrors.PermissionDenied:   http.StatusForbidden,
+	productErrors.Unprocessable:      http.StatusUnprocessableEntity,
+	productErrors.Aborted:            http.StatusConflict,
+}
+
+// NewProblem problem details of error, echo HTTP errors keep their status, typed domain errors decide status and
+// reason. Details of internal errors are not exposed
+func NewProblem(err error) *Problem {
+	domainErr := productErrors.Parse(err)
+	problem := &Problem{
+		Type:          problemTypeBlank,
+		Status:        kindStatus(domainErr.Kind),
+		Detail:        domainErr.Message,
+		Reason:        domainErr.Reason,
+		InvalidParams: domainErr.Fields,
 	}
-}
 
-// New Rest Error With Message
-func NewRestErrorWithMessage(status int, err string, causes interface{}) RestErr {
-	return RestError{
-		ErrStatus: status,
-		ErrError:  err,
-		ErrCauses: causes,
+	var httpErr *echo.HTTPError
+	switch {
+	case errors.As(err, &httpErr):
+		problem.Status = httpErr.Code
+		problem.Detail = fmt.Sprint(httpErr.Message)
+		problem.Reason = ""
+		problem.InvalidParams = nil
+	case domainErr.Kind == productErrors.Internal:
+		problem.Detail = productErrors.ErrInternal.Message
 	}
+	problem.Title = http.StatusText(problem.Status)
+	return problem
 }
 
-// New Rest Error From Bytes
-func NewRestErrorFromBytes(bytes []byte) (RestErr, error) {
-	var apiErr RestError
-	if err := json.Unmarshal(bytes, &apiErr); err != nil {
-		return nil, errors.New("invalid json")
+// NewStatusProblem problem details of gRPC status, ErrorInfo and BadRequest details give reason and invalid params,
+// known reasons keep the status their domain error kind has
+func NewStatusProblem(st *status.Status) *Problem {
+	problem := &Problem{
+		Type:   problemTypeBlank,
+		Status: grpcErrors.MapGRPCErrCodeToHttpStatus(st.Code()),
+		Detail: st.Message(),
 	}
-	return apiErr, nil
-}
-
-// New Bad Request Error
-func NewBadRequestError(causes interface{}) RestErr {
-	return RestError{
-		ErrStatus: http.StatusBadRequest,
-		ErrError:  ErrorBadRequest.Error(),
-		ErrCauses: causes,
+	switch st.Code() {
+	case codes.Internal, codes.Unknown:
+		problem.Detail = productErrors.ErrInternal.Message
+	case codes.Unimplemented:
+		problem.Status = http.StatusNotImplemented
 	}
-}
 
-// New Not Found Error
-func NewNotFoundError(causes interface{}) RestErr {
-	return RestError{
-		ErrStatus: http.StatusNotFound,
-		ErrError:  ErrorNotFound.Error(),
-		ErrCauses: causes,
-	}
-}
-
-// New Unauthorized Error
-func NewUnauthorizedError(causes interface{}) RestErr {
-	return RestError{
-		ErrStatus: http.StatusUnauthorized,
-		ErrError:  ErrorUnauthorized.Error(),
-		ErrCauses: causes,
+	for _, detail := range st.Details() {
+		switch detail := detail.(type) {
+		case *errdetails.ErrorInfo:
+			problem.Reason = detail.GetReason()
+			if kind, ok := productErrors.KindOfReason(detail.GetReason()); ok && kind != productErrors.Internal {
+				problem.Status = kindStatus(kind)
+			}
+		case *errdetails.BadRequest:
+			for _, violation := range detail.GetFieldViolations() {
+				problem.InvalidParams = append(problem.InvalidParams, productErrors.FieldViolation{
+					Field:       violation.GetField(),
+					Description: violation.GetDescription(),
+				})
+			}
+		}
 	}
+	problem.Title = http.StatusText(problem.Status)
+	return problem
 }
 
-// New Forbidden Error
-func NewForbiddenError(causes interface{}) RestErr {
-	return RestError{
-		ErrStatus: http.StatusForbidden,
-		ErrError:  ErrorForbidden.Error(),
-		ErrCauses: causes,
+// WriteProblem write problem details response
+func WriteProblem(w http.ResponseWriter, problem *Problem) error {
+	body, err := json.Marshal(problem)
+	if err != nil {
+		return errors.Wrap(err, "json.Marshal")
 	}
+	w.Header().Set(echo.HeaderContentType, MIMEApplicationProblemJSON)
+	w.WriteHeader(problem.Status)
+	_, err = w.Write(body)
+	return err
 }
 
-// New Internal Server Error
-func NewInternalServerError(causes interface{}) RestErr {
-	result := RestError{
-		ErrStatus: http.StatusInternalServerError,
-		ErrError:  ErrorInternalServerError.Error(),
-		ErrCauses: causes,
-	}
-	return result
+// ErrorResponse Error response status and problem details
+func ErrorResponse(err error) (int, interface{}) {
+	problem := NewProblem(err)
+	return problem.Status, problem
 }
 
-// Parser of error string messages returns RestError
-func ParseErrors(err error) RestErr {
-	switch {
-	case errors.Is(err, sql.ErrNoRows):
-		return NewRestError(http.StatusNotFound, ErrNotFound, nil)
-	case errors.Is(err, context.DeadlineExceeded):
-		return NewRestError(http.StatusRequestTimeout, ErrRequestTimeout, nil)
-	case errors.Is(err, ErrorUnauthorized):
-		return NewRestError(http.StatusUnauthorized, ErrUnauthorized, nil)
-	case errors.Is(err, ErrorWrongCredentials):
-		return NewRestError(http.StatusUnauthorized, ErrUnauthorized, nil)
-	case strings.Contains(strings.ToLower(err.Error()), "sqlstate"):
-		return parseSqlErrors(err)
-	case strings.Contains(strings.ToLower(err.Error()), "field validation"):
-		return parseValidatorError(err)
-	case strings.Contains(strings.ToLower(err.Error()), "unmarshal"):
-		return NewRestError(http.StatusBadRequest, ErrBadRequest, err)
-	case strings.Contains(strings.ToLower(err.Error()), "uuid"):
-		return NewRestError(http.StatusBadRequest, ErrBadRequest, err)
-	case strings.Contains(strings.ToLower(err.Error()), "cookie"):
-		return NewRestError(http.StatusUnauthorized, ErrUnauthorized, err)
-	case strings.Contains(strings.ToLower(err.Error()), "token"):
-		return NewRestError(http.StatusUnauthorized, ErrUnauthorized, err)
-	case strings.Contains(strings.ToLower(err.Error()), "bcrypt"):
-		return NewRestError(http.StatusBadRequest, ErrBadRequest, nil)
-	default:
-		if restErr, ok := err.(RestErr); ok {
-			return restErr
-		}
-		return NewInternalServerError(err)
+// ErrorCtxResponse Error response as problem details of request path
+func ErrorCtxResponse(ctx echo.Context, err error) error {
+	problem := NewProblem(err)
+	problem.Instance = ctx.Request().URL.Path
+	body, err := json.Marshal(problem)
+	if err != nil {
+		return errors.Wrap(err, "json.Marshal")
 	}
+	return ctx.Blob(problem.Status, MIMEApplicationProblemJSON, body)
 }
 
-func parseSqlErrors(err error) RestErr {
-	return NewRestError(http.StatusBadRequest, ErrBadRequest, err)
-}
-
-func parseValidatorError(err error) RestErr {
-	if strings.Contains(err.Error(), "Password") {
-		return NewRestError(http.StatusBadRequest, ErrInvalidPassword, err)
-	}
-
-	if strings.Contains(err.Error(), "Email") {
-		return NewRestError(http.StatusBadRequest, ErrInvalidEmail, err)
+func kindStatus(kind productErrors.Kind) int {
+	if status, ok := kindStatuses[kind]; ok {
+		return status
 	}
-
-	return NewRestError(http.StatusBadRequest, ErrInvalidField, err)
-}
-
-// Error response
-func ErrorResponse(err error) (int, interface{}) {
-	return ParseErrors(err).Status(), ParseErrors(err)
-}
-
-// Error response object and status code
-func ErrorCtxResponse(ctx echo.Context, err error) error {
-	restErr := ParseErrors(err)
-	return ctx.JSON(restErr.Status(), restErr.ErrBody())
+	return http.StatusInternalServerError
 }
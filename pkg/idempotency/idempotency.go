@@ -0,0 +1,90 @@
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	productErrors "github.com/Yangiboev/golang-with-curiosity/pkg/product_errors"
+)
+
+// ReplayedHeader response header and metadata key marking replayed responses
+const ReplayedHeader = "Idempotent-Replayed"
+
+const (
+	resultExecuted = "executed"
+	resultReplayed = "replayed"
+	resultReused   = "reused"
+	resultInFlight = "in_flight"
+	resultFailed   = "failed"
+)
+
+var idempotencyRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "idempotency_requests_total",
+	Help: "The total number of requests with idempotency key by result",
+}, []string{"result"})
+
+// Record outcome of request with idempotency key. Record of in flight request holds Token of request holding the
+// key, completed record holds Status, ContentType, Header and Body of response to replay
+type Record struct {
+	Fingerprint string              `json:"fingerprint"`
+	Token       string              `json:"token,omitempty"`
+	Completed   bool                `json:"completed"`
+	Status      int                 `json:"status,omitempty"`
+	ContentType string              `json:"contentType,omitempty"`
+	Header      map[string][]string `json:"header,omitempty"`
+	Body        []byte              `json:"body,omitempty"`
+}
+
+// Store idempotency records by key. Begin returns completed record of key to replay, or in flight record locking key
+// for request which must be completed or released. Begin fails with ErrIdempotencyKeyReused when key was used by
+// request of other fingerprint and with ErrIdempotencyKeyInFlight while other request holds key
+type Store interface {
+	Begin(ctx context.Context, key string, fingerprint string) (*Record, error)
+	Complete(ctx context.Context, key string, record *Record) error
+	Release(ctx context.Context, key string, record *Record) error
+}
+
+// ScopedKey key of caller, callers using the same key do not share responses
+func ScopedKey(scope, caller, key string) string {
+	return scope + caller + ":" + key
+}
+
+// Replayable header or metadata key is replayed with stored response, headers describing single request or rate
+// limit state at request time are not
+func Replayable(key string) bool {
+	key = strings.ToLower(key)
+	switch key {
+	case "x-request-id", "content-length", "date", "retry-after", "set-cookie", strings.ToLower(ReplayedHeader):
+		return false
+	}
+	return !strings.HasPrefix(key, "ratelimit-")
+}
+
+// Fingerprint hash of request parts
+func Fingerprint(parts ...[]byte) string {
+	hash := sha256.New()
+	for _, part := range parts {
+		hash.Write([]byte(fmt.Sprintf("%d:", len(part))))
+		hash.Write(part)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// CheckKey key is printable ASCII of at most maxLength characters
+func CheckKey(key string, maxLength int) error {
+	if len(key) > maxLength {
+		return productErrors.ErrInvalidIdempotencyKey.WithMessage(fmt.Sprintf("key longer than %d characters", maxLength))
+	}
+	for _, r := range key {
+		if r < 0x21 || r > 0x7e {
+			return productErrors.ErrInvalidIdempotencyKey.WithMessage("key must be printable ASCII")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package idempotency
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+
+	"github.com/Yangiboev/golang-with-curiosity/config"
+	productErrors "github.com/Yangiboev/golang-with-curiosity/pkg/product_errors"
+)
+
+// beginScript lock free key with in flight record, returns stored record of taken key.
+// KEYS[1] record key, ARGV in flight record, lock timeout in milliseconds
+var beginScript = redis.NewScript(`
+local stored = redis.call('GET', KEYS[1])
+if stored then
+  return stored
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return false
+`)
+
+// completeScript replace in flight record of token with completed record.
+// KEYS[1] record key, ARGV token, completed record, window in milliseconds. Returns 1 when record was replaced
+var completeScript = redis.NewScript(`
+local stored = redis.call('GET', KEYS[1])
+if not stored or cjson.decode(stored).token ~= ARGV[1] then
+  return 0
+end
+redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+return 1
+`)
+
+// releaseScript delete in flight record of token. KEYS[1] record key, ARGV token. Returns 1 when record was deleted
+var releaseScript = redis.NewScript(`
+local stored = redis.call('GET', KEYS[1])
+if not stored or cjson.decode(stored).token ~= ARGV[1] then
+  return 0
+end
+redis.call('DEL', KEYS[1])
+return 1
+`)
+
+type redisStore struct {
+	redis redis.UniversalClient
+	cfg   config.Idempotency
+}
+
+// NewRedisStore constructor
+func NewRedisStore(redis redis.UniversalClient, cfg config.Config) *redisStore {
+	return &redisStore{redis: redis, cfg: cfg.Idempotency}
+}
+
+// Begin lock key for request of fingerprint unless key is taken
+func (s *redisStore) Begin(ctx context.Context, key string, fingerprint string) (*Record, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "redisStore.Begin")
+	defer span.Finish()
+
+	token, err := newToken()
+	if err != nil {
+		idempotencyRequests.WithLabelValues(resultFailed).Inc()
+		return nil, err
+	}
+	inFlight := &Record{Fingerprint: fingerprint, Token: token}
+	data, err := json.Marshal(inFlight)
+	if err != nil {
+		idempotencyRequests.WithLabelValues(resultFailed).Inc()
+		return nil, errors.Wrap(err, "json.Marshal")
+	}
+
+	stored, err := beginScript.Run(ctx, s.redis, []string{s.key(key)}, data, s.cfg.LockTimeout.Milliseconds()).Text()
+	if errors.Is(err, redis.Nil) {
+		idempotencyRequests.WithLabelValues(resultExecuted).Inc()
+		return inFlight, nil
+	}
+	if err != nil {
+		idempotencyRequests.WithLabelValues(resultFailed).Inc()
+		return nil, errors.Wrap(err, "beginScript.Run")
+	}
+
+	var record Record
+	if err := json.Unmarshal([]byte(stored), &record); err != nil {
+		idempotencyRequests.WithLabelValues(resultFailed).Inc()
+		return nil, errors.Wrap(err, "json.Unmarshal")
+	}
+	switch {
+	case record.Fingerprint != fingerprint:
+		idempotencyRequests.WithLabelValues(resultReused).Inc()
+		return nil, errors.Wrap(productErrors.ErrIdempotencyKeyReused, key)
+	case !record.Completed:
+		idempotencyRequests.WithLabelValues(resultInFlight).Inc()
+		return nil, errors.Wrap(productErrors.ErrIdempotencyKeyInFlight, key)
+	}
+	idempotencyRequests.WithLabelValues(resultReplayed).Inc()
+	return &record, nil
+}
+
+// Complete store response of in flight record for replay within window
+func (s *redisStore) Complete(ctx context.Context, key string, record *Record) error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "redisStore.Complete")
+	defer span.Finish()
+
+	completed := *record
+	completed.Token = ""
+	completed.Completed = true
+	data, err := json.Marshal(&completed)
+	if err != nil {
+		return errors.Wrap(err, "json.Marshal")
+	}
+
+	replaced, err := completeScript.Run(ctx, s.redis, []string{s.key(key)}, record.Token, data, s.cfg.Window.Milliseconds()).Int()
+	if err != nil {
+		return errors.Wrap(err, "completeScript.Run")
+	}
+	if replaced == 0 {
+		return errors.Errorf("idempotency key %s lock expired before request completed", key)
+	}
+	return nil
+}
+
+// Release unlock key of in flight record so request may be retried
+func (s *redisStore) Release(ctx context.Context, key string, record *Record) error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "redisStore.Release")
+	defer span.Finish()
+
+	if err := releaseScript.Run(ctx, s.redis, []string{s.key(key)}, record.Token).Err(); err != nil {
+		return errors.Wrap(err, "releaseScript.Run")
+	}
+	return nil
+}
+
+func (s *redisStore) key(key string) string {
+	return fmt.Sprintf("%s:%s", s.cfg.Prefix, key)
+}
+
+// newToken random token of in flight record
+func newToken() (string, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return "", errors.Wrap(err, "rand.Read")
+	}
+	return hex.EncodeToString(token), nil
+}
@@ -0,0 +1,439 @@
+package messagebus
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Yangiboev/golang-with-curiosity/config"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/logger"
+	"github.com/pkg/errors"
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/compress"
+)
+
+// rebalanceCheckInterval minimal interval between reader stats checks for rebalances
+const rebalanceCheckInterval = time.Second
+
+var (
+	compressionCodecs = map[string]kafka.Compression{
+		"none":   compress.None,
+		"gzip":   kafka.Gzip,
+		"snappy": kafka.Snappy,
+		"lz4":    kafka.Lz4,
+		"zstd":   kafka.Zstd,
+	}
+	requiredAcks = map[string]kafka.RequiredAcks{
+		"none": kafka.RequireNone,
+		"one":  kafka.RequireOne,
+		"all":  kafka.RequireAll,
+	}
+)
+
+// kafkaBus kafka message bus, one writer is shared by all topics, each subscription is a consumer group reader
+type kafkaBus struct {
+	cfg    config.Kafka
+	log    logger.Logger
+	writer *kafka.Writer
+}
+
+// NewKafkaBus constructor
+func NewKafkaBus(cfg config.Config, log logger.Logger) *kafkaBus {
+	return &kafkaBus{cfg: cfg.Kafka, log: log, writer: newKafkaWriter(cfg.Kafka, log, "")}
+}
+
+// Publish write messages to their topics
+func (b *kafkaBus) Publish(ctx context.Context, msgs ...Message) error {
+	kafkaMsgs := make([]kafka.Message, 0, len(msgs))
+	for _, m := range msgs {
+		if m.Topic == "" {
+			return ErrEmptyTopicName
+		}
+		kafkaMsgs = append(kafkaMsgs, toKafkaMessage(m))
+	}
+	return b.writer.WriteMessages(ctx, kafkaMsgs...)
+}
+
+// Subscribe join topic consumer group
+func (b *kafkaBus) Subscribe(topic, group string) (Subscription, error) {
+	if topic == "" {
+		return nil, ErrEmptyTopicName
+	}
+	return &kafkaSubscription{
+		reader:  newKafkaReader(b.cfg, b.log, topic, group),
+		revoked: make(chan []int, 1),
+		fetched: make(map[int]bool),
+	}, nil
+}
+
+// ResetOffsets commit group offsets of all partitions of topics to earliest, latest or timestamp offsets,
+// commit fails while group has active members
+func (b *kafkaBus) ResetOffsets(ctx context.Context, group string, topics []string, reset OffsetReset) ([]PartitionOffset, error) {
+	client := &kafka.Client{Addr: kafka.TCP(b.cfg.Brokers...), Timeout: b.cfg.Reader.DialTimeout}
+
+	offsets, err := b.resolveOffsets(ctx, client, topics, reset)
+	if err != nil {
+		return nil, err
+	}
+
+	commits := make(map[string][]kafka.OffsetCommit, len(topics))
+	for _, offset := range offsets {
+		commits[offset.Topic] = append(commits[offset.Topic], kafka.OffsetCommit{Partition: offset.Partition, Offset: offset.Offset})
+	}
+
+	res, err := client.OffsetCommit(ctx, &kafka.OffsetCommitRequest{
+		GroupID:      group,
+		GenerationID: -1,
+		Topics:       commits,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "client.OffsetCommit")
+	}
+	for topic, partitions := range res.Topics {
+		for _, p := range partitions {
+			if p.Error != nil {
+				return nil, errors.Wrapf(p.Error, "commit %s/%d", topic, p.Partition)
+			}
+		}
+	}
+	return offsets, nil
+}
+
+// resolveOffsets offsets of all topics partitions for reset target, timestamp after the last message resolves to latest offset
+func (b *kafkaBus) resolveOffsets(ctx context.Context, client *kafka.Client, topics []string, reset OffsetReset) ([]PartitionOffset, error) {
+	metadata, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: topics})
+	if err != nil {
+		return nil, errors.Wrap(err, "client.Metadata")
+	}
+
+	latest := make(map[string][]kafka.OffsetRequest, len(metadata.Topics))
+	requests := make(map[string][]kafka.OffsetRequest, len(metadata.Topics))
+	for _, t := range metadata.Topics {
+		if t.Error != nil {
+			return nil, errors.Wrapf(t.Error, "metadata %s", t.Name)
+		}
+		for _, p := range t.Partitions {
+			latest[t.Name] = append(latest[t.Name], kafka.LastOffsetOf(p.ID))
+			switch reset.To {
+			case OffsetEarliest:
+				requests[t.Name] = append(requests[t.Name], kafka.FirstOffsetOf(p.ID))
+			case OffsetLatest:
+				requests[t.Name] = append(requests[t.Name], kafka.LastOffsetOf(p.ID))
+			case OffsetTimestamp:
+				requests[t.Name] = append(requests[t.Name], kafka.TimeOffsetOf(p.ID, reset.Timestamp))
+			default:
+				return nil, errors.Wrap(ErrUnknownOffset, reset.To)
+			}
+		}
+	}
+
+	ends, err := client.ListOffsets(ctx, &kafka.ListOffsetsRequest{Topics: latest})
+	if err != nil {
+		return nil, errors.Wrap(err, "client.ListOffsets")
+	}
+	res, err := client.ListOffsets(ctx, &kafka.ListOffsetsRequest{Topics: requests})
+	if err != nil {
+		return nil, errors.Wrap(err, "client.ListOffsets")
+	}
+
+	lastOffsets := make(map[string]map[int]int64, len(ends.Topics))
+	for topic, partitions := range ends.Topics {
+		lastOffsets[topic] = make(map[int]int64, len(partitions))
+		for _, p := range partitions {
+			if p.Error != nil {
+				return nil, errors.Wrapf(p.Error, "list offsets %s/%d", topic, p.Partition)
+			}
+			lastOffsets[topic][p.Partition] = p.LastOffset
+		}
+	}
+
+	offsets := make([]PartitionOffset, 0)
+	for topic, partitions := range res.Topics {
+		for _, p := range partitions {
+			if p.Error != nil {
+				return nil, errors.Wrapf(p.Error, "list offsets %s/%d", topic, p.Partition)
+			}
+			offset := lastOffsets[topic][p.Partition]
+			switch reset.To {
+			case OffsetEarliest:
+				offset = p.FirstOffset
+			case OffsetTimestamp:
+				for o := range p.Offsets {
+					if o >= 0 {
+						offset = o
+					}
+				}
+			}
+			offsets = append(offsets, PartitionOffset{Topic: topic, Partition: p.Partition, Offset: offset})
+		}
+	}
+
+	sort.Slice(offsets, func(i, j int) bool {
+		if offsets[i].Topic != offsets[j].Topic {
+			return offsets[i].Topic < offsets[j].Topic
+		}
+		return offsets[i].Partition < offsets[j].Partition
+	})
+	return offsets, nil
+}
+
+// EnsureTopics create missing topics, compare partitions, replication factor and declared configs of existing topics.
+// Topic created concurrently by another instance is treated as existing
+func (b *kafkaBus) EnsureTopics(ctx context.Context, specs ...TopicSpec) ([]TopicDivergence, error) {
+	client := &kafka.Client{Addr: kafka.TCP(b.cfg.Brokers...), Timeout: b.cfg.Reader.DialTimeout}
+
+	names := make([]string, 0, len(specs))
+	for _, spec := range specs {
+		if spec.Name == "" {
+			return nil, ErrEmptyTopicName
+		}
+		names = append(names, spec.Name)
+	}
+
+	metadata, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: names})
+	if err != nil {
+		return nil, errors.Wrap(err, "client.Metadata")
+	}
+	existing := make(map[string]kafka.Topic, len(metadata.Topics))
+	for _, t := range metadata.Topics {
+		switch {
+		case t.Error == nil:
+			existing[t.Name] = t
+		case !errors.Is(t.Error, kafka.UnknownTopicOrPartition):
+			return nil, errors.Wrapf(t.Error, "metadata %s", t.Name)
+		}
+	}
+
+	missing := make([]kafka.TopicConfig, 0)
+	for _, spec := range specs {
+		if _, ok := existing[spec.Name]; ok {
+			continue
+		}
+		entries := make([]kafka.ConfigEntry, 0, len(spec.Configs))
+		for name, value := range spec.Configs {
+			entries = append(entries, kafka.ConfigEntry{ConfigName: name, ConfigValue: value})
+		}
+		missing = append(missing, kafka.TopicConfig{
+			Topic:             spec.Name,
+			NumPartitions:     spec.Partitions,
+			ReplicationFactor: spec.ReplicationFactor,
+			ConfigEntries:     entries,
+		})
+	}
+	if len(missing) > 0 {
+		res, err := client.CreateTopics(ctx, &kafka.CreateTopicsRequest{Topics: missing})
+		if err != nil {
+			return nil, errors.Wrap(err, "client.CreateTopics")
+		}
+		for topic, err := range res.Errors {
+			if err != nil && !errors.Is(err, kafka.TopicAlreadyExists) {
+				return nil, errors.Wrapf(err, "create topic %s", topic)
+			}
+		}
+		for _, t := range missing {
+			b.log.Infof("Created topic: %v partitions: %v replication factor: %v", t.Topic, t.NumPartitions, t.ReplicationFactor)
+		}
+	}
+
+	divergences := make([]TopicDivergence, 0)
+	resources := make([]kafka.DescribeConfigRequestResource, 0, len(existing))
+	for _, spec := range specs {
+		t, ok := existing[spec.Name]
+		if !ok {
+			continue
+		}
+		if len(t.Partitions) != spec.Partitions {
+			divergences = append(divergences, TopicDivergence{
+				Topic:    spec.Name,
+				Setting:  SettingPartitions,
+				Declared: strconv.Itoa(spec.Partitions),
+				Actual:   strconv.Itoa(len(t.Partitions)),
+			})
+		}
+		if len(t.Partitions) > 0 && len(t.Partitions[0].Replicas) != spec.ReplicationFactor {
+			divergences = append(divergences, TopicDivergence{
+				Topic:    spec.Name,
+				Setting:  SettingReplicationFactor,
+				Declared: strconv.Itoa(spec.ReplicationFactor),
+				Actual:   strconv.Itoa(len(t.Partitions[0].Replicas)),
+			})
+		}
+		if len(spec.Configs) == 0 {
+			continue
+		}
+		configNames := make([]string, 0, len(spec.Configs))
+		for name := range spec.Configs {
+			configNames = append(configNames, name)
+		}
+		sort.Strings(configNames)
+		resources = append(resources, kafka.DescribeConfigRequestResource{
+			ResourceType: kafka.ResourceTypeTopic,
+			ResourceName: spec.Name,
+			ConfigNames:  configNames,
+		})
+	}
+	if len(resources) == 0 {
+		return divergences, nil
+	}
+
+	res, err := client.DescribeConfigs(ctx, &kafka.DescribeConfigsRequest{Resources: resources})
+	if err != nil {
+		return nil, errors.Wrap(err, "client.DescribeConfigs")
+	}
+	declared := make(map[string]map[string]string, len(specs))
+	for _, spec := range specs {
+		declared[spec.Name] = spec.Configs
+	}
+	for _, resource := range res.Resources {
+		if resource.Error != nil {
+			return nil, errors.Wrapf(resource.Error, "describe configs %s", resource.ResourceName)
+		}
+		for _, entry := range resource.ConfigEntries {
+			value, ok := declared[resource.ResourceName][entry.ConfigName]
+			if ok && value != entry.ConfigValue {
+				divergences = append(divergences, TopicDivergence{
+					Topic:    resource.ResourceName,
+					Setting:  entry.ConfigName,
+					Declared: value,
+					Actual:   entry.ConfigValue,
+				})
+			}
+		}
+	}
+	return divergences, nil
+}
+
+// Close flush and close writer
+func (b *kafkaBus) Close() error {
+	return b.writer.Close()
+}
+
+// kafkaSubscription consumer group reader. Reader does not expose its partition assignment, so rebalance seen in
+// reader stats is reported as revoke of all partitions fetched before it
+type kafkaSubscription struct {
+	reader    *kafka.Reader
+	revoked   chan []int
+	fetched   map[int]bool
+	checkedAt time.Time
+}
+
+// Fetch next message of assigned partitions
+func (s *kafkaSubscription) Fetch(ctx context.Context) (Message, error) {
+	m, err := s.reader.FetchMessage(ctx)
+	if err != nil {
+		return Message{}, err
+	}
+	s.checkRebalance()
+	s.fetched[m.Partition] = true
+	return fromKafkaMessage(m), nil
+}
+
+// Revoked partitions possibly revoked from member by rebalances
+func (s *kafkaSubscription) Revoked() <-chan []int {
+	return s.revoked
+}
+
+// checkRebalance report fetched partitions as revoked when reader rebalanced since previous check,
+// called by fetching goroutine only
+func (s *kafkaSubscription) checkRebalance() {
+	if time.Since(s.checkedAt) < rebalanceCheckInterval {
+		return
+	}
+	s.checkedAt = time.Now()
+	if s.reader.Stats().Rebalances == 0 || len(s.fetched) == 0 {
+		return
+	}
+
+	revoked := make([]int, 0, len(s.fetched))
+	for p := range s.fetched {
+		revoked = append(revoked, p)
+	}
+	sort.Ints(revoked)
+	s.fetched = make(map[int]bool)
+
+	select {
+	case pending := <-s.revoked:
+		revoked = append(pending, revoked...)
+	default:
+	}
+	s.revoked <- revoked
+}
+
+// Ack commit offsets of messages
+func (s *kafkaSubscription) Ack(ctx context.Context, msgs ...Message) error {
+	kafkaMsgs := make([]kafka.Message, 0, len(msgs))
+	for _, m := range msgs {
+		kafkaMsgs = append(kafkaMsgs, kafka.Message{Topic: m.Topic, Partition: m.Partition, Offset: m.Offset})
+	}
+	return s.reader.CommitMessages(ctx, kafkaMsgs...)
+}
+
+// Close leave consumer group
+func (s *kafkaSubscription) Close() error {
+	return s.reader.Close()
+}
+
+func toKafkaMessage(m Message) kafka.Message {
+	headers := make([]kafka.Header, 0, len(m.Headers))
+	for _, h := range m.Headers {
+		headers = append(headers, kafka.Header{Key: h.Key, Value: h.Value})
+	}
+	return kafka.Message{Topic: m.Topic, Key: m.Key, Value: m.Value, Headers: headers, Time: m.Time}
+}
+
+func fromKafkaMessage(m kafka.Message) Message {
+	headers := make([]Header, 0, len(m.Headers))
+	for _, h := range m.Headers {
+		headers = append(headers, Header{Key: h.Key, Value: h.Value})
+	}
+	return Message{
+		Topic:         m.Topic,
+		Partition:     m.Partition,
+		Offset:        m.Offset,
+		HighWaterMark: m.HighWaterMark,
+		Key:           m.Key,
+		Value:         m.Value,
+		Headers:       headers,
+		Time:          m.Time,
+	}
+}
+
+// newKafkaReader create consumer group reader from config
+func newKafkaReader(cfg config.Kafka, log logger.Logger, topic, groupID string) *kafka.Reader {
+	return kafka.NewReader(kafka.ReaderConfig{
+		Brokers:                cfg.Brokers,
+		GroupID:                groupID,
+		Topic:                  topic,
+		MinBytes:               cfg.Reader.MinBytes,
+		MaxBytes:               cfg.Reader.MaxBytes,
+		QueueCapacity:          cfg.Reader.QueueCapacity,
+		HeartbeatInterval:      cfg.Reader.HeartbeatInterval,
+		CommitInterval:         cfg.Reader.CommitInterval,
+		PartitionWatchInterval: cfg.Reader.PartitionWatchInterval,
+		Logger:                 kafka.LoggerFunc(log.Debugf),
+		ErrorLogger:            kafka.LoggerFunc(log.Errorf),
+		MaxAttempts:            cfg.Reader.MaxAttempts,
+		Dialer: &kafka.Dialer{
+			Timeout: cfg.Reader.DialTimeout,
+		},
+	})
+}
+
+// newKafkaWriter create writer from config, with empty topic messages carry their own topic
+func newKafkaWriter(cfg config.Kafka, log logger.Logger, topic string) *kafka.Writer {
+	return &kafka.Writer{
+		Addr:         kafka.TCP(cfg.Brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		BatchSize:    cfg.Writer.BatchSize,
+		BatchTimeout: cfg.Writer.BatchTimeout,
+		RequiredAcks: requiredAcks[cfg.Writer.RequiredAcks],
+		MaxAttempts:  cfg.Writer.MaxAttempts,
+		Logger:       kafka.LoggerFunc(log.Debugf),
+		ErrorLogger:  kafka.LoggerFunc(log.Errorf),
+		Compression:  compressionCodecs[cfg.Writer.Compression],
+		ReadTimeout:  cfg.Writer.ReadTimeout,
+		WriteTimeout: cfg.Writer.WriteTimeout,
+	}
+}
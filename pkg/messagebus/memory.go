@@ -0,0 +1,367 @@
+package messagebus
+
+import (
+	"context"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const defaultMemoryPartitions = 3
+
+// memoryBus in process message bus with kafka like semantics: topics are split into partitions by message key,
+// consumer group members share topic partitions and resume from committed offsets after rebalance
+type memoryBus struct {
+	mu         sync.Mutex
+	partitions int
+	topics     map[string][][]Message
+	groups     map[string]*memoryGroup
+	changed    chan struct{}
+	roundRobin int
+	closed     bool
+}
+
+// memoryGroup committed offsets and members of consumer group by topic
+type memoryGroup struct {
+	committed map[string]map[int]int64
+	members   map[string][]*memorySubscription
+}
+
+// NewMemoryBus constructor, topics are created on first use with given number of partitions
+func NewMemoryBus(partitions int) *memoryBus {
+	if partitions <= 0 {
+		partitions = defaultMemoryPartitions
+	}
+	return &memoryBus{
+		partitions: partitions,
+		topics:     make(map[string][][]Message),
+		groups:     make(map[string]*memoryGroup),
+		changed:    make(chan struct{}),
+	}
+}
+
+// Publish append messages to partition of their key, messages without key are spread round robin
+func (b *memoryBus) Publish(ctx context.Context, msgs ...Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return ErrClosed
+	}
+
+	for _, m := range msgs {
+		if m.Topic == "" {
+			return ErrEmptyTopicName
+		}
+		partitions := b.topic(m.Topic)
+
+		p := b.partition(m.Key, len(partitions))
+		m.Partition = p
+		m.Offset = int64(len(partitions[p]))
+		m.Headers = append([]Header(nil), m.Headers...)
+		if m.Time.IsZero() {
+			m.Time = time.Now().UTC()
+		}
+		partitions[p] = append(partitions[p], m)
+	}
+
+	b.broadcast()
+	return nil
+}
+
+// Subscribe join topic consumer group, group partitions are reassigned between members
+func (b *memoryBus) Subscribe(topic, group string) (Subscription, error) {
+	if topic == "" {
+		return nil, ErrEmptyTopicName
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, ErrClosed
+	}
+
+	b.topic(topic)
+	g := b.group(group)
+	s := &memorySubscription{bus: b, topic: topic, group: group, revoked: make(chan []int, 1)}
+	g.members[topic] = append(g.members[topic], s)
+	b.rebalance(g, topic)
+	return s, nil
+}
+
+// ResetOffsets set group committed offsets of all partitions of topics, group must have no members on the topics
+func (b *memoryBus) ResetOffsets(ctx context.Context, group string, topics []string, reset OffsetReset) ([]PartitionOffset, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	g := b.group(group)
+	for _, topic := range topics {
+		if len(g.members[topic]) > 0 {
+			return nil, errors.Wrap(ErrGroupActive, group)
+		}
+	}
+
+	offsets := make([]PartitionOffset, 0)
+	for _, topic := range topics {
+		partitions, ok := b.topics[topic]
+		if !ok {
+			return nil, errors.Wrap(ErrUnknownTopic, topic)
+		}
+		for p, log := range partitions {
+			var offset int64
+			switch reset.To {
+			case OffsetEarliest:
+				offset = 0
+			case OffsetLatest:
+				offset = int64(len(log))
+			case OffsetTimestamp:
+				offset = int64(sort.Search(len(log), func(i int) bool { return !log[i].Time.Before(reset.Timestamp) }))
+			default:
+				return nil, errors.Wrap(ErrUnknownOffset, reset.To)
+			}
+			offsets = append(offsets, PartitionOffset{Topic: topic, Partition: p, Offset: offset})
+		}
+	}
+
+	for _, offset := range offsets {
+		g.commit(offset.Topic, offset.Partition, offset.Offset)
+	}
+	return offsets, nil
+}
+
+// Close stop all subscriptions
+func (b *memoryBus) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	b.broadcast()
+	return nil
+}
+
+// EnsureTopics create missing topics with declared number of partitions, replication and configs do not apply in process
+func (b *memoryBus) EnsureTopics(ctx context.Context, specs ...TopicSpec) ([]TopicDivergence, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, ErrClosed
+	}
+
+	divergences := make([]TopicDivergence, 0)
+	for _, spec := range specs {
+		if spec.Name == "" {
+			return nil, ErrEmptyTopicName
+		}
+		if spec.Partitions <= 0 {
+			spec.Partitions = b.partitions
+		}
+		partitions, ok := b.topics[spec.Name]
+		if !ok {
+			b.topics[spec.Name] = make([][]Message, spec.Partitions)
+			continue
+		}
+		if len(partitions) != spec.Partitions {
+			divergences = append(divergences, TopicDivergence{
+				Topic:    spec.Name,
+				Setting:  SettingPartitions,
+				Declared: strconv.Itoa(spec.Partitions),
+				Actual:   strconv.Itoa(len(partitions)),
+			})
+		}
+	}
+	return divergences, nil
+}
+
+func (b *memoryBus) topic(name string) [][]Message {
+	partitions, ok := b.topics[name]
+	if !ok {
+		partitions = make([][]Message, b.partitions)
+		b.topics[name] = partitions
+	}
+	return partitions
+}
+
+func (b *memoryBus) group(name string) *memoryGroup {
+	g, ok := b.groups[name]
+	if !ok {
+		g = &memoryGroup{committed: make(map[string]map[int]int64), members: make(map[string][]*memorySubscription)}
+		b.groups[name] = g
+	}
+	return g
+}
+
+func (b *memoryBus) partition(key []byte, partitions int) int {
+	if len(key) == 0 {
+		b.roundRobin++
+		return b.roundRobin % partitions
+	}
+	h := fnv.New32a()
+	_, _ = h.Write(key)
+	return int(h.Sum32() % uint32(partitions))
+}
+
+// rebalance drop fetch positions of topic members, so they resume from committed offsets of newly assigned partitions,
+// and notify members of partitions revoked from them
+func (b *memoryBus) rebalance(g *memoryGroup, topic string) {
+	members := g.members[topic]
+	partitions := len(b.topics[topic])
+	for index, s := range members {
+		assigned := make(map[int]bool)
+		for p := index; p < partitions; p += len(members) {
+			assigned[p] = true
+		}
+
+		revoked := make([]int, 0)
+		for p := range s.assigned {
+			if !assigned[p] {
+				revoked = append(revoked, p)
+			}
+		}
+		if len(revoked) > 0 {
+			sort.Ints(revoked)
+			s.notifyRevoked(revoked)
+		}
+		s.assigned = assigned
+		s.positions = make(map[int]int64)
+	}
+	b.broadcast()
+}
+
+// broadcast wake up fetches waiting for messages
+func (b *memoryBus) broadcast() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+func (g *memoryGroup) commit(topic string, partition int, offset int64) {
+	if g.committed[topic] == nil {
+		g.committed[topic] = make(map[int]int64)
+	}
+	g.committed[topic][partition] = offset
+}
+
+// memorySubscription consumer group member, partition p is assigned to member p mod members count
+type memorySubscription struct {
+	bus       *memoryBus
+	topic     string
+	group     string
+	positions map[int]int64
+	assigned  map[int]bool
+	revoked   chan []int
+	cursor    int
+	closed    bool
+}
+
+// Fetch next message of assigned partitions, waits for new messages or rebalance
+func (s *memorySubscription) Fetch(ctx context.Context) (Message, error) {
+	for {
+		s.bus.mu.Lock()
+		if s.closed || s.bus.closed {
+			s.bus.mu.Unlock()
+			return Message{}, ErrClosed
+		}
+		if m, ok := s.next(); ok {
+			s.bus.mu.Unlock()
+			return m, nil
+		}
+		changed := s.bus.changed
+		s.bus.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return Message{}, ctx.Err()
+		}
+	}
+}
+
+// Ack commit offsets following messages
+func (s *memorySubscription) Ack(ctx context.Context, msgs ...Message) error {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+
+	g := s.bus.group(s.group)
+	for _, m := range msgs {
+		if committed, ok := g.committed[m.Topic][m.Partition]; ok && committed > m.Offset {
+			continue
+		}
+		g.commit(m.Topic, m.Partition, m.Offset+1)
+	}
+	return nil
+}
+
+// Revoked partitions revoked from member by rebalances
+func (s *memorySubscription) Revoked() <-chan []int {
+	return s.revoked
+}
+
+// notifyRevoked queue revoked partitions, merged with revoked partitions not received yet. Caller holds bus lock,
+// so it is the only sender and send never blocks after pending notification was taken
+func (s *memorySubscription) notifyRevoked(partitions []int) {
+	select {
+	case pending := <-s.revoked:
+		partitions = append(pending, partitions...)
+	default:
+	}
+	s.revoked <- partitions
+}
+
+// Close leave consumer group
+func (s *memorySubscription) Close() error {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+
+	g := s.bus.group(s.group)
+	members := g.members[s.topic]
+	for i, member := range members {
+		if member == s {
+			g.members[s.topic] = append(members[:i], members[i+1:]...)
+			break
+		}
+	}
+	s.bus.rebalance(g, s.topic)
+	return nil
+}
+
+// next message of assigned partitions starting after partition fetched last, caller holds bus lock
+func (s *memorySubscription) next() (Message, bool) {
+	g := s.bus.group(s.group)
+	members := g.members[s.topic]
+	index := -1
+	for i, member := range members {
+		if member == s {
+			index = i
+		}
+	}
+	if index < 0 {
+		return Message{}, false
+	}
+
+	partitions := s.bus.topics[s.topic]
+	for i := 0; i < len(partitions); i++ {
+		p := (s.cursor + i) % len(partitions)
+		if p%len(members) != index {
+			continue
+		}
+		position, ok := s.positions[p]
+		if !ok {
+			position = g.committed[s.topic][p]
+		}
+		if position >= int64(len(partitions[p])) {
+			continue
+		}
+
+		m := partitions[p][position]
+		m.HighWaterMark = int64(len(partitions[p]))
+		s.positions[p] = position + 1
+		s.cursor = p + 1
+		return m, true
+	}
+	return Message{}, false
+}
@@ -0,0 +1,69 @@
+package messagebus
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMemoryBusRedeliversUnackedMessagesAfterRebalance(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	bus := NewMemoryBus(1)
+
+	if err := bus.Publish(ctx, Message{Topic: "topic", Value: []byte("1")}, Message{Topic: "topic", Value: []byte("2")}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+
+	first, err := bus.Subscribe("topic", "group")
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	m, err := first.Fetch(ctx)
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if err := first.Ack(ctx, m); err != nil {
+		t.Fatalf("Ack: %v", err)
+	}
+	if _, err := first.Fetch(ctx); err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if err := first.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	second, err := bus.Subscribe("topic", "group")
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	m, err = second.Fetch(ctx)
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if string(m.Value) != "2" {
+		t.Fatalf("fetched %q, want unacked message redelivered", m.Value)
+	}
+}
+
+func TestMemoryBusNotifiesRevokedPartitions(t *testing.T) {
+	bus := NewMemoryBus(4)
+
+	first, err := bus.Subscribe("topic", "group")
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	if _, err := bus.Subscribe("topic", "group"); err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+
+	select {
+	case revoked := <-first.(Rebalancer).Revoked():
+		if want := []int{1, 3}; !reflect.DeepEqual(revoked, want) {
+			t.Fatalf("revoked %v, want %v", revoked, want)
+		}
+	default:
+		t.Fatal("no partitions revoked from first member after second member joined")
+	}
+}
@@ -0,0 +1,124 @@
+package messagebus
+
+import (
+	"context"
+	"time"
+
+	"github.com/Yangiboev/golang-with-curiosity/config"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/logger"
+	"github.com/pkg/errors"
+)
+
+const (
+	DriverKafka  = "kafka"
+	DriverMemory = "memory"
+
+	OffsetEarliest  = "earliest"
+	OffsetLatest    = "latest"
+	OffsetTimestamp = "timestamp"
+)
+
+var (
+	ErrClosed         = errors.New("message bus closed")
+	ErrGroupActive    = errors.New("consumer group has active members")
+	ErrUnknownDriver  = errors.New("unknown message bus driver")
+	ErrUnknownOffset  = errors.New("unknown offset reset")
+	ErrUnknownTopic   = errors.New("unknown topic")
+	ErrEmptyTopicName = errors.New("empty topic name")
+)
+
+// Header message header
+type Header struct {
+	Key   string
+	Value []byte
+}
+
+// Message broker neutral message, partition, offset and high water mark are set on fetched messages
+type Message struct {
+	Topic         string
+	Partition     int
+	Offset        int64
+	HighWaterMark int64
+	Key           []byte
+	Value         []byte
+	Headers       []Header
+	Time          time.Time
+}
+
+// Header message header value by key
+func (m Message) Header(key string) (string, bool) {
+	for _, h := range m.Headers {
+		if h.Key == key {
+			return string(h.Value), true
+		}
+	}
+	return "", false
+}
+
+// SetHeader replace or append header
+func SetHeader(headers []Header, key, value string) []Header {
+	for i, h := range headers {
+		if h.Key == key {
+			headers[i].Value = []byte(value)
+			return headers
+		}
+	}
+	return append(headers, Header{Key: key, Value: []byte(value)})
+}
+
+// OffsetReset consumer group offsets reset target, timestamp is used only for timestamp target
+type OffsetReset struct {
+	To        string
+	Timestamp time.Time
+}
+
+// PartitionOffset consumer group offset of topic partition
+type PartitionOffset struct {
+	Topic     string
+	Partition int
+	Offset    int64
+}
+
+// Publisher publish messages to their topics, messages of the same key keep their order
+type Publisher interface {
+	Publish(ctx context.Context, msgs ...Message) error
+}
+
+// Subscription consumer group member of single topic, fetched messages are redelivered to the group until acked
+type Subscription interface {
+	Fetch(ctx context.Context) (Message, error)
+	Ack(ctx context.Context, msgs ...Message) error
+	Close() error
+}
+
+// Rebalancer subscription notifying partitions revoked from member by consumer group rebalances. Messages of revoked
+// partitions which were fetched but not acked are redelivered to their new owner
+type Rebalancer interface {
+	Revoked() <-chan []int
+}
+
+// Subscriber join topic consumer groups and manage their offsets
+type Subscriber interface {
+	Subscribe(topic, group string) (Subscription, error)
+	ResetOffsets(ctx context.Context, group string, topics []string, reset OffsetReset) ([]PartitionOffset, error)
+}
+
+// Bus publisher and subscriber of the same broker
+type Bus interface {
+	Publisher
+	Subscriber
+	Provisioner
+	Close() error
+}
+
+// NewMessageBus message bus of configured driver
+func NewMessageBus(cfg config.Config, log logger.Logger) (Bus, error) {
+	switch cfg.MessageBus.Driver {
+	case DriverKafka, "":
+		return NewKafkaBus(cfg, log), nil
+	case DriverMemory:
+		return NewMemoryBus(cfg.MessageBus.Partitions), nil
+	default:
+		return nil, errors.Wrap(ErrUnknownDriver, cfg.MessageBus.Driver)
+	}
+}
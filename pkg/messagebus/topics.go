@@ -0,0 +1,36 @@
+package messagebus
+
+import (
+	"context"
+	"fmt"
+)
+
+const (
+	SettingPartitions        = "partitions"
+	SettingReplicationFactor = "replication.factor"
+)
+
+// TopicSpec declared topic, configs are broker topic configs such as retention.ms or cleanup.policy
+type TopicSpec struct {
+	Name              string
+	Partitions        int
+	ReplicationFactor int
+	Configs           map[string]string
+}
+
+// TopicDivergence setting of existing topic which differs from declaration
+type TopicDivergence struct {
+	Topic    string
+	Setting  string
+	Declared string
+	Actual   string
+}
+
+func (d TopicDivergence) String() string {
+	return fmt.Sprintf("topic %s %s is %q, declared %q", d.Topic, d.Setting, d.Actual, d.Declared)
+}
+
+// Provisioner create missing topics, existing topics are left untouched and their divergences from declaration are returned
+type Provisioner interface {
+	EnsureTopics(ctx context.Context, specs ...TopicSpec) ([]TopicDivergence, error)
+}
@@ -1,7 +1,188 @@
 package pkg
 
-import "errors"
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrorDomain domain of typed errors reasons, reported in gRPC ErrorInfo details
+const ErrorDomain = "products"
+
+// Kind category of domain error, decides gRPC status code and HTTP status of error responses
+type Kind int
+
+const (
+	Internal Kind = iota
+	NotFound
+	Conflict
+	Validation
+	FailedPrecondition
+	OutOfRange
+	ResourceExhausted
+	Unavailable
+	Canceled
+	DeadlineExceeded
+	Unauthenticated
+	PermissionDenied
+	Unprocessable
+	Aborted
+)
+
+// FieldViolation invalid field of validation error
+type FieldViolation struct {
+	Field       string `json:"field"`
+	Description string `json:"description"`
+}
+
+// Error typed domain error, Reason is stable UPPER_SNAKE_CASE identifier of error for clients
+type Error struct {
+	Kind       Kind
+	Reason     string
+	Message    string
+	Fields     []FieldViolation
+	RetryAfter time.Duration
+	Err        error
+}
+
+// reasonKinds kinds of reasons of errors built with New
+var reasonKinds = make(map[string]Kind)
+
+// New typed error constructor, reason is registered for KindOfReason
+func New(kind Kind, reason string, message string) *Error {
+	reasonKinds[reason] = kind
+	return &Error{Kind: kind, Reason: reason, Message: message}
+}
+
+// KindOfReason kind of error reason, used to restore error kind of gRPC ErrorInfo reason
+func KindOfReason(reason string) (Kind, bool) {
+	kind, ok := reasonKinds[reason]
+	return kind, ok
+}
+
+// NewValidationError validation error of invalid fields
+func NewValidationError(message string, fields ...FieldViolation) *Error {
+	return &Error{Kind: Validation, Reason: ErrValidation.Reason, Message: message, Fields: fields}
+}
+
+// NewRateLimitError rate limit error of exceeded rule, client may retry after retryAfter
+func NewRateLimitError(rule string, retryAfter time.Duration) *Error {
+	return &Error{
+		Kind:       ResourceExhausted,
+		Reason:     ErrRateLimited.Reason,
+		Message:    fmt.Sprintf("rate limit %s exceeded, retry after %v", rule, retryAfter),
+		RetryAfter: retryAfter,
+	}
+}
+
+// WithMessage copy of typed error with message for clients, copy keeps kind and reason so it still matches e
+func (e *Error) WithMessage(message string) *Error {
+	return &Error{Kind: e.Kind, Reason: e.Reason, Message: message, Fields: e.Fields, RetryAfter: e.RetryAfter}
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is errors of same kind and reason are equal, so errors built from sentinel reason match the sentinel
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Kind == e.Kind && t.Reason == e.Reason
+}
 
 var (
-	ErrObjectIDTypeConversion = errors.New("object id type conversion")
+	ErrObjectIDTypeConversion = New(Internal, "OBJECT_ID_TYPE_CONVERSION", "object id type conversion")
+	ErrProductNotFound        = New(NotFound, "PRODUCT_NOT_FOUND", "product not found")
+	ErrProductExists          = New(Conflict, "PRODUCT_ALREADY_EXISTS", "product already exists")
+	ErrConsumerGroupNotFound  = New(NotFound, "CONSUMER_GROUP_NOT_FOUND", "consumer group not found")
+	ErrConsumerGroupNotPaused = New(FailedPrecondition, "CONSUMER_GROUP_NOT_PAUSED", "consumer group not paused")
+	ErrCacheMiss              = New(NotFound, "CACHE_MISS", "cache miss")
+	ErrValidation             = New(Validation, "VALIDATION_FAILED", "validation failed")
+	ErrInvalidWatchFilter     = New(Validation, "INVALID_WATCH_FILTER", "invalid watch filter")
+	ErrInvalidResumeToken     = New(Validation, "INVALID_RESUME_TOKEN", "invalid resume token")
+	ErrResumeTokenExpired     = New(OutOfRange, "RESUME_TOKEN_EXPIRED", "resume token expired")
+	ErrWatchTooSlow           = New(ResourceExhausted, "WATCH_TOO_SLOW", "watch fell too far behind")
+	ErrWatchClosed            = New(Unavailable, "WATCH_CLOSED", "watch closed")
+	ErrInvalidBatch           = New(Validation, "INVALID_BATCH", "invalid batch")
+	ErrRateLimited            = New(ResourceExhausted, "RATE_LIMITED", "rate limit exceeded")
+	ErrInvalidIdempotencyKey  = New(Validation, "INVALID_IDEMPOTENCY_KEY", "invalid idempotency key")
+	ErrIdempotencyKeyReused   = New(Unprocessable, "IDEMPOTENCY_KEY_REUSED", "idempotency key reused with different request")
+	ErrIdempotencyKeyInFlight = New(Aborted, "IDEMPOTENCY_KEY_IN_FLIGHT", "request with idempotency key is in flight")
+	ErrUnauthenticated        = New(Unauthenticated, "UNAUTHENTICATED", "missing or invalid credentials")
+	ErrCanceled               = New(Canceled, "CANCELED", "request canceled")
+	ErrDeadlineExceeded       = New(DeadlineExceeded, "DEADLINE_EXCEEDED", "deadline exceeded")
+	ErrInternal               = New(Internal, "INTERNAL", "internal error")
 )
+
+// Parse typed error of err, known driver, validation and context errors are mapped to their domain kind,
+// other errors are internal. Message of returned error is message of typed error or of its kind for clients,
+// messages of wrapping errors and driver errors are not exposed
+func Parse(err error) *Error {
+	var (
+		typedErr      *Error
+		validationErr validator.ValidationErrors
+		syntaxErr     *json.SyntaxError
+		typeErr       *json.UnmarshalTypeError
+	)
+
+	switch {
+	case errors.As(err, &typedErr):
+		return &Error{
+			Kind:       typedErr.Kind,
+			Reason:     typedErr.Reason,
+			Message:    typedErr.Message,
+			Fields:     typedErr.Fields,
+			RetryAfter: typedErr.RetryAfter,
+		}
+	case errors.As(err, &validationErr):
+		fields := make([]FieldViolation, 0, len(validationErr))
+		for _, fieldErr := range validationErr {
+			fields = append(fields, FieldViolation{
+				Field:       fieldName(fieldErr),
+				Description: fmt.Sprintf("failed on the '%s' rule", fieldErr.Tag()),
+			})
+		}
+		return &Error{Kind: Validation, Reason: ErrValidation.Reason, Message: ErrValidation.Message, Fields: fields}
+	case errors.As(err, &typeErr):
+		return &Error{
+			Kind:    Validation,
+			Reason:  ErrValidation.Reason,
+			Message: ErrValidation.Message,
+			Fields:  []FieldViolation{{Field: typeErr.Field, Description: "must be " + typeErr.Type.String()}},
+		}
+	case errors.As(err, &syntaxErr), errors.Is(err, primitive.ErrInvalidHex):
+		return &Error{Kind: Validation, Reason: ErrValidation.Reason, Message: ErrValidation.Message}
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return &Error{Kind: NotFound, Reason: ErrProductNotFound.Reason, Message: ErrProductNotFound.Message}
+	case mongo.IsDuplicateKeyError(err):
+		return &Error{Kind: Conflict, Reason: ErrProductExists.Reason, Message: ErrProductExists.Message}
+	case errors.Is(err, context.Canceled):
+		return &Error{Kind: Canceled, Reason: ErrCanceled.Reason, Message: ErrCanceled.Message}
+	case errors.Is(err, context.DeadlineExceeded):
+		return &Error{Kind: DeadlineExceeded, Reason: ErrDeadlineExceeded.Reason, Message: ErrDeadlineExceeded.Message}
+	}
+	return &Error{Kind: Internal, Reason: ErrInternal.Reason, Message: ErrInternal.Message}
+}
+
+// fieldName path of invalid field without name of validated struct, fields are named by validator tag name func
+func fieldName(fieldErr validator.FieldError) string {
+	namespace := fieldErr.Namespace()
+	if i := strings.Index(namespace, "."); i >= 0 {
+		return namespace[i+1:]
+	}
+	return namespace
+}
@@ -0,0 +1,45 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/Yangiboev/golang-with-curiosity/pkg/utils"
+)
+
+type testProduct struct {
+	CategoryID string `json:"categoryId" validate:"required"`
+	Name       string `json:"name,omitempty" validate:"required,min=3"`
+}
+
+func TestParseKeepsClientMessages(t *testing.T) {
+	wrapped := errors.Wrap(errors.Wrap(ErrProductNotFound, "5f0c8a7f0000000000000000"), "productMongoRepo.GetByID")
+	if got := Parse(wrapped).Message; got != ErrProductNotFound.Message {
+		t.Fatalf("message of wrapped typed error = %q, want %q", got, ErrProductNotFound.Message)
+	}
+
+	batchErr := ErrInvalidBatch.WithMessage("batch size 0 must be between 1 and 10")
+	if got := Parse(errors.Wrap(batchErr, "checkBatchSize")).Message; got != batchErr.Message {
+		t.Fatalf("message of typed error = %q, want %q", got, batchErr.Message)
+	}
+	if !errors.Is(batchErr, ErrInvalidBatch) {
+		t.Fatalf("errors.Is(%v, ErrInvalidBatch) = false, want true", batchErr)
+	}
+
+	if got := Parse(errors.New("mongo: connection refused to 10.0.0.5")).Message; got != ErrInternal.Message {
+		t.Fatalf("message of internal error = %q, want %q", got, ErrInternal.Message)
+	}
+}
+
+func TestParseNamesFieldViolationsByJSONName(t *testing.T) {
+	err := utils.NewValidator().Struct(&testProduct{Name: "p"})
+	parsed := Parse(errors.Wrap(err, "validate.Struct"))
+
+	if parsed.Kind != Validation || parsed.Message != ErrValidation.Message {
+		t.Fatalf("Parse = %+v, want validation error with message %q", parsed, ErrValidation.Message)
+	}
+	if len(parsed.Fields) != 2 || parsed.Fields[0].Field != "categoryId" || parsed.Fields[1].Field != "name" {
+		t.Fatalf("fields = %+v, want categoryId and name", parsed.Fields)
+	}
+}
@@ -0,0 +1,107 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/Yangiboev/golang-with-curiosity/config"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/cache"
+)
+
+// localAlgorithm in process counterpart of redis scripts limiting requests of this instance only,
+// state of least recently limited keys is dropped beyond size
+type localAlgorithm struct {
+	mu     sync.Mutex
+	states *cache.LRU
+}
+
+type slidingWindowState struct {
+	window   int64
+	count    float64
+	previous float64
+}
+
+type tokenBucketState struct {
+	tokens float64
+	ts     time.Time
+}
+
+func newLocalAlgorithm(size int, ttl time.Duration) *localAlgorithm {
+	return &localAlgorithm{states: cache.NewLRU(size, ttl, nil)}
+}
+
+func (l *localAlgorithm) take(ctx context.Context, key string, policy config.RateLimitPolicy) (*Result, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if policy.Algorithm == config.RateLimitTokenBucket {
+		return l.takeToken(key, policy, now), nil
+	}
+	return l.slideWindow(key, policy, now), nil
+}
+
+func (l *localAlgorithm) slideWindow(key string, policy config.RateLimitPolicy, now time.Time) *Result {
+	window := policy.Window.Milliseconds()
+	nowMs := now.UnixNano() / int64(time.Millisecond)
+	current := nowMs / window
+
+	state := &slidingWindowState{window: current}
+	if cached, ok := l.states.Get(key); ok {
+		stored := cached.(*slidingWindowState)
+		switch stored.window {
+		case current:
+			state = stored
+		case current - 1:
+			state.previous = stored.count
+		}
+	}
+
+	elapsed := nowMs - current*window
+	used := state.previous*float64(window-elapsed)/float64(window) + state.count
+	limit := float64(policy.Limit)
+
+	res := &Result{Reset: time.Duration(window-elapsed) * time.Millisecond}
+	switch {
+	case used+1 <= limit:
+		res.Allowed = true
+		state.count++
+		used++
+	case state.count+1 <= limit:
+		res.RetryAfter = time.Duration(math.Ceil((used+1-limit)*float64(window)/state.previous)) * time.Millisecond
+	default:
+		res.RetryAfter = res.Reset
+	}
+	res.Remaining = int(math.Max(0, math.Floor(limit-used)))
+
+	l.states.Set(key, state)
+	return res
+}
+
+func (l *localAlgorithm) takeToken(key string, policy config.RateLimitPolicy, now time.Time) *Result {
+	capacity := float64(policy.Capacity())
+	rate := refillRate(policy)
+
+	state := &tokenBucketState{tokens: capacity, ts: now}
+	if cached, ok := l.states.Get(key); ok {
+		state = cached.(*tokenBucketState)
+	}
+	elapsed := float64(now.Sub(state.ts)) / float64(time.Millisecond)
+	state.tokens = math.Min(capacity, state.tokens+math.Max(0, elapsed)*rate)
+	state.ts = now
+
+	res := &Result{}
+	if state.tokens >= 1 {
+		res.Allowed = true
+		state.tokens--
+	} else {
+		res.RetryAfter = time.Duration(math.Ceil((1-state.tokens)/rate)) * time.Millisecond
+	}
+	res.Remaining = int(state.tokens)
+	res.Reset = time.Duration(math.Ceil((capacity-state.tokens)/rate)) * time.Millisecond
+
+	l.states.Set(key, state)
+	return res
+}
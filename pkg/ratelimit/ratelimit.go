@@ -0,0 +1,205 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/Yangiboev/golang-with-curiosity/config"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/logger"
+)
+
+const (
+	resultAllowed = "allowed"
+	resultLimited = "limited"
+
+	backendRedis = "redis"
+	backendLocal = "local"
+)
+
+var errBreakerOpen = errors.New("rate limiter breaker is open")
+
+var (
+	rateLimitRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rate_limit_requests_total",
+		Help: "The total number of rate limited requests by rule and result",
+	}, []string{"rule", "result"})
+	rateLimitBackend = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rate_limit_decisions_total",
+		Help: "The total number of rate limit decisions by backend making them",
+	}, []string{"backend"})
+)
+
+// Request identity of limited request. Route is HTTP route or gRPC service, Method is HTTP method or gRPC full method,
+// Match is what rules are matched against, HTTP "METHOD /route" or gRPC full method. IP is client address read
+// through trusted proxies only, request headers a client chooses freely are never part of its identity
+type Request struct {
+	Match  string
+	IP     string
+	Route  string
+	Method string
+}
+
+// Result rate limit decision, Reset is time until the limit is fully available again and RetryAfter is time until
+// a denied request may be allowed
+type Result struct {
+	Allowed    bool
+	Rule       string
+	Policy     config.RateLimitPolicy
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// Limiter rate limits requests, nil result means request is not limited
+type Limiter interface {
+	Allow(ctx context.Context, req Request) (*Result, error)
+}
+
+// algorithm single rate limit backend, applies policy to request counted under key
+type algorithm interface {
+	take(ctx context.Context, key string, policy config.RateLimitPolicy) (*Result, error)
+}
+
+type limiter struct {
+	log    logger.Logger
+	cfg    config.RateLimit
+	rules  map[string]config.RateLimitRule
+	remote algorithm
+	local  algorithm
+	// openUntil unix nanoseconds until which redis is not tried after it failed, zero while redis works
+	openUntil int64
+}
+
+// NewLimiter constructor, requests are limited through redis and locally while redis is unavailable. After redis
+// fails requests are limited locally for breaker cooldown without waiting for redis, then one request tries it again
+func NewLimiter(log logger.Logger, redis redis.UniversalClient, cfg config.Config) *limiter {
+	rules := make(map[string]config.RateLimitRule)
+	for _, rule := range cfg.RateLimit.Rules {
+		for _, match := range rule.Match {
+			if _, ok := rules[match]; !ok {
+				rules[match] = rule
+			}
+		}
+	}
+
+	return &limiter{
+		log:    log,
+		cfg:    cfg.RateLimit,
+		rules:  rules,
+		remote: newRedisAlgorithm(redis),
+		local:  newLocalAlgorithm(cfg.RateLimit.LocalSize, 2*cfg.RateLimit.MaxWindow()),
+	}
+}
+
+// Allow apply rule matching request
+func (l *limiter) Allow(ctx context.Context, req Request) (*Result, error) {
+	if !l.cfg.Enabled {
+		return nil, nil
+	}
+
+	rule, ok := l.rules[req.Match]
+	if !ok {
+		rule = config.RateLimitRule{Name: config.RateLimitDefaultRule, Policy: l.cfg.Default}
+	}
+	if rule.Policy.Limit == 0 {
+		return nil, nil
+	}
+	key := l.key(rule, req)
+
+	res, err := l.takeRemote(ctx, key, rule.Policy)
+	if err != nil {
+		rateLimitBackend.WithLabelValues(backendLocal).Inc()
+		if res, err = l.local.take(ctx, key, rule.Policy); err != nil {
+			return nil, err
+		}
+	} else {
+		rateLimitBackend.WithLabelValues(backendRedis).Inc()
+	}
+
+	res.Rule = rule.Name
+	res.Policy = rule.Policy
+	if res.Allowed {
+		rateLimitRequests.WithLabelValues(rule.Name, resultAllowed).Inc()
+	} else {
+		rateLimitRequests.WithLabelValues(rule.Name, resultLimited).Inc()
+	}
+	return res, nil
+}
+
+// takeRemote apply policy through redis within timeout, fails right away while breaker is open
+func (l *limiter) takeRemote(ctx context.Context, key string, policy config.RateLimitPolicy) (*Result, error) {
+	if !l.remoteAvailable(time.Now()) {
+		return nil, errBreakerOpen
+	}
+
+	remoteCtx, cancel := context.WithTimeout(ctx, l.cfg.Timeout)
+	defer cancel()
+
+	res, err := l.remote.take(remoteCtx, key, policy)
+	if err != nil {
+		if atomic.SwapInt64(&l.openUntil, time.Now().Add(l.cfg.BreakerCooldown).UnixNano()) == 0 {
+			l.log.Errorf("rate limiter falls back to local limits: %v", err)
+		}
+		return nil, err
+	}
+	if atomic.SwapInt64(&l.openUntil, 0) != 0 {
+		l.log.Info("rate limiter recovered redis limits")
+	}
+	return res, nil
+}
+
+// remoteAvailable whether redis is tried, after cooldown of open breaker one request claims the next try and others
+// keep limiting locally for another cooldown unless it succeeds
+func (l *limiter) remoteAvailable(now time.Time) bool {
+	openUntil := atomic.LoadInt64(&l.openUntil)
+	if openUntil == 0 {
+		return true
+	}
+	if now.UnixNano() < openUntil {
+		return false
+	}
+	return atomic.CompareAndSwapInt64(&l.openUntil, openUntil, now.Add(l.cfg.BreakerCooldown).UnixNano())
+}
+
+// key counter key of request under rule
+func (l *limiter) key(rule config.RateLimitRule, req Request) string {
+	parts := []string{l.cfg.Prefix, rule.Name}
+	for _, part := range rule.Policy.KeyBy {
+		switch part {
+		case config.RateLimitKeyIP:
+			parts = append(parts, "ip="+req.IP)
+		case config.RateLimitKeyRoute:
+			parts = append(parts, "route="+req.Route)
+		case config.RateLimitKeyMethod:
+			parts = append(parts, "method="+req.Method)
+		}
+	}
+	return strings.Join(parts, ":")
+}
+
+// Headers RateLimit-* response headers of result, Retry-After is set for denied requests
+func Headers(res *Result) map[string]string {
+	headers := map[string]string{
+		"RateLimit-Limit":     strconv.Itoa(res.Policy.Capacity()),
+		"RateLimit-Remaining": strconv.Itoa(res.Remaining),
+		"RateLimit-Reset":     strconv.Itoa(seconds(res.Reset)),
+		"RateLimit-Policy":    strconv.Itoa(res.Policy.Limit) + ";w=" + strconv.Itoa(seconds(res.Policy.Window)),
+	}
+	if !res.Allowed {
+		headers["Retry-After"] = strconv.Itoa(seconds(res.RetryAfter))
+	}
+	return headers
+}
+
+// seconds duration rounded up to whole seconds
+func seconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,96 @@
+package ratelimit
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/Yangiboev/golang-with-curiosity/config"
+	"github.com/Yangiboev/golang-with-curiosity/pkg/logger"
+)
+
+// fakeAlgorithm counts takes, fails them while failing is set and allows others
+type fakeAlgorithm struct {
+	takes   int32
+	failing int32
+}
+
+func (f *fakeAlgorithm) take(ctx context.Context, key string, policy config.RateLimitPolicy) (*Result, error) {
+	atomic.AddInt32(&f.takes, 1)
+	if atomic.LoadInt32(&f.failing) == 1 {
+		return nil, errors.New("redis unavailable")
+	}
+	return &Result{Allowed: true}, nil
+}
+
+func newTestLimiter(remote algorithm, policy config.RateLimitPolicy) *limiter {
+	cfg := config.Config{}
+	cfg.Logger.Level = "fatal"
+	cfg.Logger.Encoding = "console"
+	appLogger := logger.NewApiLogger(cfg)
+	appLogger.InitLogger()
+
+	return &limiter{
+		log: appLogger,
+		cfg: config.RateLimit{
+			Enabled:         true,
+			Prefix:          "ratelimit",
+			Timeout:         10 * time.Millisecond,
+			BreakerCooldown: 50 * time.Millisecond,
+			Default:         policy,
+		},
+		rules:  map[string]config.RateLimitRule{},
+		remote: remote,
+		local:  newLocalAlgorithm(100, time.Minute),
+	}
+}
+
+func TestLimiterSkipsRedisWhileBreakerIsOpen(t *testing.T) {
+	remote := &fakeAlgorithm{failing: 1}
+	policy := config.RateLimitPolicy{Algorithm: config.RateLimitSlidingWindow, Limit: 100, Window: time.Second, KeyBy: []string{config.RateLimitKeyIP}}
+	l := newTestLimiter(remote, policy)
+	req := Request{Match: "GET /api/v1/products/:product_id", IP: "203.0.113.7"}
+
+	for i := 0; i < 5; i++ {
+		res, err := l.Allow(context.Background(), req)
+		if err != nil || !res.Allowed {
+			t.Fatalf("Allow = %+v, %v, want allowed by local limits", res, err)
+		}
+	}
+	if takes := atomic.LoadInt32(&remote.takes); takes != 1 {
+		t.Fatalf("redis tried %d times, want once before breaker opened", takes)
+	}
+
+	atomic.StoreInt32(&remote.failing, 0)
+	time.Sleep(60 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		if _, err := l.Allow(context.Background(), req); err != nil {
+			t.Fatalf("Allow: %v", err)
+		}
+	}
+	if takes := atomic.LoadInt32(&remote.takes); takes != 3 {
+		t.Fatalf("redis tried %d times, want tried again after cooldown and used once recovered", takes)
+	}
+}
+
+func TestLimiterCountsRequestsByIP(t *testing.T) {
+	remote := &fakeAlgorithm{failing: 1}
+	policy := config.RateLimitPolicy{Algorithm: config.RateLimitSlidingWindow, Limit: 1, Window: time.Minute, KeyBy: []string{config.RateLimitKeyIP}}
+	l := newTestLimiter(remote, policy)
+
+	first := Request{Match: "POST /api/v1/products", IP: "203.0.113.7"}
+	if res, err := l.Allow(context.Background(), first); err != nil || !res.Allowed {
+		t.Fatalf("Allow = %+v, %v, want first request allowed", res, err)
+	}
+	if res, err := l.Allow(context.Background(), first); err != nil || res.Allowed {
+		t.Fatalf("Allow = %+v, %v, want second request of the same IP limited", res, err)
+	}
+
+	other := Request{Match: "POST /api/v1/products", IP: "198.51.100.1"}
+	if res, err := l.Allow(context.Background(), other); err != nil || !res.Allowed {
+		t.Fatalf("Allow = %+v, %v, want request of other IP allowed", res, err)
+	}
+}
@@ -0,0 +1,123 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+
+	"github.com/Yangiboev/golang-with-curiosity/config"
+)
+
+// slidingWindowScript approximates sliding window by weighting previous fixed window count by its share of the window
+// still sliding over it. State is a hash of current window number and counts of current and previous windows.
+// KEYS[1] counter key, ARGV limit, window in milliseconds. Returns allowed, remaining, reset and retry after in milliseconds
+var slidingWindowScript = redis.NewScript(`
+redis.replicate_commands()
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local current = math.floor(now / window)
+
+local state = redis.call('HMGET', KEYS[1], 'window', 'count', 'previous')
+local stored = tonumber(state[1])
+local count = tonumber(state[2]) or 0
+local previous = tonumber(state[3]) or 0
+if stored == current - 1 then
+  previous = count
+  count = 0
+elseif stored ~= current then
+  previous = 0
+  count = 0
+end
+
+local elapsed = now - current * window
+local used = previous * (window - elapsed) / window + count
+local allowed = 0
+local retry = 0
+if used + 1 <= limit then
+  allowed = 1
+  count = count + 1
+  used = used + 1
+elseif count + 1 <= limit then
+  retry = math.ceil((used + 1 - limit) * window / previous)
+else
+  retry = window - elapsed
+end
+
+redis.call('HSET', KEYS[1], 'window', current, 'count', count, 'previous', previous)
+redis.call('PEXPIRE', KEYS[1], window * 2)
+return {allowed, math.max(0, math.floor(limit - used)), window - elapsed, retry}
+`)
+
+// tokenBucketScript bucket of capacity tokens refilled at rate tokens per millisecond, request takes one token.
+// State is a hash of tokens left and time they were counted at.
+// KEYS[1] bucket key, ARGV capacity, rate. Returns allowed, remaining, reset and retry after in milliseconds
+var tokenBucketScript = redis.NewScript(`
+redis.replicate_commands()
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or capacity
+local ts = tonumber(state[2]) or now
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * rate)
+
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+  allowed = 1
+  tokens = tokens - 1
+else
+  retry = math.ceil((1 - tokens) / rate)
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(capacity / rate) + 1000)
+return {allowed, math.floor(tokens), math.ceil((capacity - tokens) / rate), retry}
+`)
+
+// redisAlgorithm limits shared by all instances, every decision is a single atomic script run timed by redis clock,
+// scripts replicate their effects as reading the clock is not deterministic
+type redisAlgorithm struct {
+	redis redis.UniversalClient
+}
+
+func newRedisAlgorithm(redis redis.UniversalClient) *redisAlgorithm {
+	return &redisAlgorithm{redis: redis}
+}
+
+func (r *redisAlgorithm) take(ctx context.Context, key string, policy config.RateLimitPolicy) (*Result, error) {
+	var cmd *redis.Cmd
+	switch policy.Algorithm {
+	case config.RateLimitTokenBucket:
+		cmd = tokenBucketScript.Run(ctx, r.redis, []string{key}, policy.Capacity(), strconv.FormatFloat(refillRate(policy), 'g', -1, 64))
+	default:
+		cmd = slidingWindowScript.Run(ctx, r.redis, []string{key}, policy.Limit, policy.Window.Milliseconds())
+	}
+
+	values, err := cmd.Int64Slice()
+	if err != nil {
+		return nil, errors.Wrap(err, "redisAlgorithm.Run")
+	}
+	if len(values) != 4 {
+		return nil, errors.Errorf("redisAlgorithm.Run: unexpected script result %v", values)
+	}
+
+	return &Result{
+		Allowed:    values[0] == 1,
+		Remaining:  int(values[1]),
+		Reset:      time.Duration(values[2]) * time.Millisecond,
+		RetryAfter: time.Duration(values[3]) * time.Millisecond,
+	}, nil
+}
+
+// refillRate tokens per millisecond
+func refillRate(policy config.RateLimitPolicy) float64 {
+	return float64(policy.Limit) / float64(policy.Window.Milliseconds())
+}
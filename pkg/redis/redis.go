@@ -1,28 +1,93 @@
 package redis
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
 	"time"
 
 	"github.com/Yangiboev/golang-with-curiosity/config"
 	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
 )
 
-// NewRedisClient Returns new redis client
-func NewRedisClient(cfg config.Config) *redis.Client {
-	redisHost := cfg.Redis.RedisAddress
+// NewRedisClient Returns new redis client of configured topology, client is pinged before return
+func NewRedisClient(ctx context.Context, cfg config.Config) (redis.UniversalClient, error) {
+	tlsConfig, err := newTLSConfig(cfg.Redis.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &redis.UniversalOptions{
+		Addrs:            cfg.Redis.Addrs,
+		MasterName:       cfg.Redis.MasterName,
+		Username:         cfg.Redis.Username,
+		Password:         cfg.Redis.Password,
+		SentinelPassword: cfg.Redis.SentinelPassword,
+		DB:               cfg.Redis.DB,
+		MinIdleConns:     cfg.Redis.MinIdleConn,
+		PoolSize:         cfg.Redis.PoolSize,
+		PoolTimeout:      time.Duration(cfg.Redis.PoolTimeout) * time.Second,
+		TLSConfig:        tlsConfig,
+	}
 
-	if redisHost == "" {
-		redisHost = ":6379"
+	var client redis.UniversalClient
+	switch cfg.Redis.Mode {
+	case config.RedisSentinel:
+		failover := opts.Failover()
+		failover.SentinelUsername = cfg.Redis.SentinelUsername
+		client = redis.NewFailoverClient(failover)
+	case config.RedisCluster:
+		client = redis.NewClusterClient(opts.Cluster())
+	case config.RedisStandalone:
+		client = redis.NewClient(opts.Simple())
+	default:
+		return nil, fmt.Errorf("unknown redis mode %q", cfg.Redis.Mode)
 	}
 
-	client := redis.NewClient(&redis.Options{
-		Addr:         redisHost,
-		MinIdleConns: cfg.Redis.MinIdleConn,
-		PoolSize:     cfg.Redis.PoolSize,
-		PoolTimeout:  time.Duration(cfg.Redis.PoolTimeout) * time.Second,
-		Password:     cfg.Redis.Password, // no password set
-		DB:           cfg.Redis.DB,       // use default DB
-	})
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, errors.Wrap(err, "redis.Ping")
+	}
+	return client, nil
+}
+
+// newTLSConfig client TLS config, nil when TLS is disabled
+func newTLSConfig(cfg config.RedisTLS) (*tls.Config, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if cfg.CAFile != "" {
+		caCert, err := ioutil.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "ioutil.ReadFile")
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no certificates in redis ca file %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "tls.LoadX509KeyPair")
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
 
-	return client
+	return tlsConfig, nil
 }
@@ -0,0 +1,172 @@
+package schemaregistry
+
+import (
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Compatibility schema evolution rule checked on register
+type Compatibility string
+
+const (
+	// CompatibilityBackward consumers using new schema can read data produced with the latest one
+	CompatibilityBackward Compatibility = "BACKWARD"
+	// CompatibilityForward consumers using the latest schema can read data produced with new one
+	CompatibilityForward Compatibility = "FORWARD"
+	// CompatibilityFull both backward and forward
+	CompatibilityFull Compatibility = "FULL"
+	// CompatibilityNone no checks
+	CompatibilityNone Compatibility = "NONE"
+)
+
+// checkCompatibility check new schema against previous one according to compatibility rule, fields removed from previous
+// schema must have their numbers reserved by new one under every rule but none
+func checkCompatibility(compatibility Compatibility, previous, next *Schema) error {
+	if compatibility == CompatibilityNone || previous == nil {
+		return nil
+	}
+
+	prevFile, err := fileDescriptor(previous.Descriptor)
+	if err != nil {
+		return errors.Wrap(err, "previous schema")
+	}
+	nextFile, err := fileDescriptor(next.Descriptor)
+	if err != nil {
+		return errors.Wrap(err, "new schema")
+	}
+
+	if err := checkRemovedFields(prevFile, nextFile); err != nil {
+		return err
+	}
+
+	switch compatibility {
+	case CompatibilityBackward:
+		return canRead(nextFile, prevFile)
+	case CompatibilityForward:
+		return canRead(prevFile, nextFile)
+	case CompatibilityFull:
+		if err := canRead(nextFile, prevFile); err != nil {
+			return err
+		}
+		return canRead(prevFile, nextFile)
+	default:
+		return errors.Errorf("unknown compatibility: %s", compatibility)
+	}
+}
+
+// fileDescriptor build file descriptor from serialized FileDescriptorProto, well known imports are resolved from global registry
+func fileDescriptor(b []byte) (protoreflect.FileDescriptor, error) {
+	var fdp descriptorpb.FileDescriptorProto
+	if err := proto.Unmarshal(b, &fdp); err != nil {
+		return nil, errors.Wrap(err, "proto.Unmarshal")
+	}
+	return protodesc.NewFile(&fdp, protoregistry.GlobalFiles)
+}
+
+// canRead check every message written with writer schema can be decoded with reader schema
+func canRead(reader, writer protoreflect.FileDescriptor) error {
+	writerMessages := writer.Messages()
+	for i := 0; i < writerMessages.Len(); i++ {
+		wm := writerMessages.Get(i)
+		rm := reader.Messages().ByName(wm.Name())
+		if rm == nil {
+			return errors.Wrapf(ErrIncompatibleSchema, "message %s removed", wm.FullName())
+		}
+		if err := canReadMessage(rm, wm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func canReadMessage(reader, writer protoreflect.MessageDescriptor) error {
+	writerFields := writer.Fields()
+	for i := 0; i < writerFields.Len(); i++ {
+		wf := writerFields.Get(i)
+		rf := reader.Fields().ByNumber(wf.Number())
+		if byName := reader.Fields().ByName(wf.Name()); byName != nil && byName.Number() != wf.Number() {
+			return errors.Wrapf(ErrIncompatibleSchema, "field %s renumbered, number %d in writer schema and %d in reader schema", wf.FullName(), wf.Number(), byName.Number())
+		}
+		if rf == nil {
+			continue
+		}
+		if (rf.Cardinality() == protoreflect.Repeated) != (wf.Cardinality() == protoreflect.Repeated) {
+			return errors.Wrapf(ErrIncompatibleSchema, "field %s number %d changed cardinality", wf.FullName(), wf.Number())
+		}
+		if !wireCompatible(rf, wf) {
+			return errors.Wrapf(ErrIncompatibleSchema, "field %s number %d changed type from %s to %s", wf.FullName(), wf.Number(), wf.Kind(), rf.Kind())
+		}
+	}
+
+	nested := writer.Messages()
+	for i := 0; i < nested.Len(); i++ {
+		wm := nested.Get(i)
+		rm := reader.Messages().ByName(wm.Name())
+		if rm == nil {
+			return errors.Wrapf(ErrIncompatibleSchema, "message %s removed", wm.FullName())
+		}
+		if err := canReadMessage(rm, wm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkRemovedFields check numbers of fields removed from messages of previous file are reserved in new one, so they are
+// never reused with another type or meaning
+func checkRemovedFields(previous, next protoreflect.FileDescriptor) error {
+	return checkRemovedMessageFields(previous.Messages(), next.Messages())
+}
+
+func checkRemovedMessageFields(previous, next protoreflect.MessageDescriptors) error {
+	for i := 0; i < previous.Len(); i++ {
+		pm := previous.Get(i)
+		nm := next.ByName(pm.Name())
+		if nm == nil {
+			continue
+		}
+
+		fields := pm.Fields()
+		for j := 0; j < fields.Len(); j++ {
+			pf := fields.Get(j)
+			if nm.Fields().ByNumber(pf.Number()) == nil && !nm.ReservedRanges().Has(pf.Number()) {
+				return errors.Wrapf(ErrIncompatibleSchema, "field %s number %d removed without reserving its number", pf.FullName(), pf.Number())
+			}
+		}
+		if err := checkRemovedMessageFields(pm.Messages(), nm.Messages()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// wireCompatible fields of the same number decode each other's values
+func wireCompatible(reader, writer protoreflect.FieldDescriptor) bool {
+	if reader.Kind() == writer.Kind() {
+		if reader.Kind() == protoreflect.MessageKind || reader.Kind() == protoreflect.GroupKind {
+			return reader.Message().FullName() == writer.Message().FullName()
+		}
+		return true
+	}
+	return kindGroup(reader.Kind()) != "" && kindGroup(reader.Kind()) == kindGroup(writer.Kind())
+}
+
+func kindGroup(kind protoreflect.Kind) string {
+	switch kind {
+	case protoreflect.Int32Kind, protoreflect.Uint32Kind, protoreflect.Int64Kind, protoreflect.Uint64Kind, protoreflect.BoolKind, protoreflect.EnumKind:
+		return "varint"
+	case protoreflect.Sint32Kind, protoreflect.Sint64Kind:
+		return "zigzag"
+	case protoreflect.StringKind, protoreflect.BytesKind:
+		return "bytes"
+	case protoreflect.Fixed32Kind, protoreflect.Sfixed32Kind:
+		return "fixed32"
+	case protoreflect.Fixed64Kind, protoreflect.Sfixed64Kind:
+		return "fixed64"
+	}
+	return ""
+}
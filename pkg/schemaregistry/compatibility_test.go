@@ -0,0 +1,166 @@
+package schemaregistry
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func field(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type) *descriptorpb.FieldDescriptorProto {
+	return &descriptorpb.FieldDescriptorProto{
+		Name:     proto.String(name),
+		JsonName: proto.String(name),
+		Number:   proto.Int32(number),
+		Type:     typ.Enum(),
+		Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+	}
+}
+
+func repeated(f *descriptorpb.FieldDescriptorProto) *descriptorpb.FieldDescriptorProto {
+	f.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+	return f
+}
+
+// testSchema schema of file with single message of fields, reserved field numbers are reserved in message
+func testSchema(t *testing.T, message string, reserved []int32, fields ...*descriptorpb.FieldDescriptorProto) *Schema {
+	t.Helper()
+	md := &descriptorpb.DescriptorProto{Name: proto.String(message), Field: fields}
+	for _, number := range reserved {
+		md.ReservedRange = append(md.ReservedRange, &descriptorpb.DescriptorProto_ReservedRange{
+			Start: proto.Int32(number),
+			End:   proto.Int32(number + 1),
+		})
+	}
+	fdp := &descriptorpb.FileDescriptorProto{
+		Name:        proto.String("product.proto"),
+		Package:     proto.String("productsService"),
+		Syntax:      proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{md},
+	}
+	descriptor, err := proto.MarshalOptions{Deterministic: true}.Marshal(fdp)
+	if err != nil {
+		t.Fatalf("proto.Marshal: %v", err)
+	}
+	return &Schema{SchemaType: SchemaTypeProtobuf, Descriptor: descriptor}
+}
+
+func TestCheckCompatibility(t *testing.T) {
+	const (
+		typeString = descriptorpb.FieldDescriptorProto_TYPE_STRING
+		typeInt32  = descriptorpb.FieldDescriptorProto_TYPE_INT32
+		typeInt64  = descriptorpb.FieldDescriptorProto_TYPE_INT64
+		typeDouble = descriptorpb.FieldDescriptorProto_TYPE_DOUBLE
+	)
+	previous := testSchema(t, "Product", nil, field("name", 1, typeString), field("quantity", 2, typeInt32))
+
+	tests := []struct {
+		name          string
+		compatibility Compatibility
+		previous      *Schema
+		next          *Schema
+		wantErr       bool
+	}{
+		{name: "first version", compatibility: CompatibilityBackward, next: previous},
+		{name: "unchanged", compatibility: CompatibilityBackward, previous: previous, next: previous},
+		{
+			name:          "field added",
+			compatibility: CompatibilityFull,
+			previous:      previous,
+			next:          testSchema(t, "Product", nil, field("name", 1, typeString), field("quantity", 2, typeInt32), field("price", 3, typeDouble)),
+		},
+		{
+			name:          "field removed with reserved number",
+			compatibility: CompatibilityBackward,
+			previous:      previous,
+			next:          testSchema(t, "Product", []int32{2}, field("name", 1, typeString)),
+		},
+		{
+			name:          "field removed without reserved number",
+			compatibility: CompatibilityBackward,
+			previous:      previous,
+			next:          testSchema(t, "Product", nil, field("name", 1, typeString)),
+			wantErr:       true,
+		},
+		{
+			name:          "type widened within wire type",
+			compatibility: CompatibilityFull,
+			previous:      previous,
+			next:          testSchema(t, "Product", nil, field("name", 1, typeString), field("quantity", 2, typeInt64)),
+		},
+		{
+			name:          "type changed",
+			compatibility: CompatibilityBackward,
+			previous:      previous,
+			next:          testSchema(t, "Product", nil, field("name", 1, typeString), field("quantity", 2, typeString)),
+			wantErr:       true,
+		},
+		{
+			name:          "cardinality changed",
+			compatibility: CompatibilityBackward,
+			previous:      previous,
+			next:          testSchema(t, "Product", nil, field("name", 1, typeString), repeated(field("quantity", 2, typeInt32))),
+			wantErr:       true,
+		},
+		{
+			name:          "field renumbered",
+			compatibility: CompatibilityBackward,
+			previous:      previous,
+			next:          testSchema(t, "Product", []int32{2}, field("name", 1, typeString), field("quantity", 3, typeInt32)),
+			wantErr:       true,
+		},
+		{
+			name:          "message removed",
+			compatibility: CompatibilityBackward,
+			previous:      previous,
+			next:          testSchema(t, "Item", nil, field("name", 1, typeString), field("quantity", 2, typeInt32)),
+			wantErr:       true,
+		},
+		{
+			name:          "type changed without checks",
+			compatibility: CompatibilityNone,
+			previous:      previous,
+			next:          testSchema(t, "Product", nil, field("name", 1, typeString), field("quantity", 2, typeString)),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkCompatibility(tt.compatibility, tt.previous, tt.next)
+			if tt.wantErr && !errors.Is(err, ErrIncompatibleSchema) {
+				t.Fatalf("checkCompatibility error = %v, want ErrIncompatibleSchema", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("checkCompatibility: %v", err)
+			}
+		})
+	}
+}
+
+func TestFileRegistryRejectsBreakingSchemaChange(t *testing.T) {
+	const typeString = descriptorpb.FieldDescriptorProto_TYPE_STRING
+	ctx := context.Background()
+	registry, err := NewFileRegistry(filepath.Join(t.TempDir(), "registry.json"), CompatibilityBackward)
+	if err != nil {
+		t.Fatalf("NewFileRegistry: %v", err)
+	}
+
+	first, err := registry.Register(ctx, "products-value", testSchema(t, "Product", nil, field("name", 1, typeString), field("description", 2, typeString)))
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	_, err = registry.Register(ctx, "products-value", testSchema(t, "Product", nil, field("name", 1, typeString)))
+	if !errors.Is(err, ErrIncompatibleSchema) {
+		t.Fatalf("Register of breaking change error = %v, want ErrIncompatibleSchema", err)
+	}
+
+	latest, err := registry.Latest(ctx, "products-value")
+	if err != nil {
+		t.Fatalf("Latest: %v", err)
+	}
+	if latest.ID != first || latest.Version != 1 {
+		t.Fatalf("latest schema id %d version %d, want rejected change left out", latest.ID, latest.Version)
+	}
+}
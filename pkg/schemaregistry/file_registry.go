@@ -0,0 +1,166 @@
+package schemaregistry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// fileRegistryState persisted registry content
+type fileRegistryState struct {
+	NextID   int                  `json:"nextId"`
+	Subjects map[string][]*Schema `json:"subjects"`
+}
+
+// fileRegistry embedded schema registry persisted to a json file
+type fileRegistry struct {
+	mu            sync.RWMutex
+	path          string
+	compatibility Compatibility
+	state         fileRegistryState
+	byID          map[int]*Schema
+}
+
+// NewFileRegistry load or create file backed registry
+func NewFileRegistry(path string, compatibility Compatibility) (*fileRegistry, error) {
+	r := &fileRegistry{
+		path:          path,
+		compatibility: compatibility,
+		state:         fileRegistryState{NextID: 1, Subjects: make(map[string][]*Schema)},
+		byID:          make(map[int]*Schema),
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "ioutil.ReadFile")
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &r.state); err != nil {
+			return nil, errors.Wrap(err, "json.Unmarshal")
+		}
+	}
+
+	for _, versions := range r.state.Subjects {
+		for _, s := range versions {
+			r.byID[s.ID] = s
+		}
+	}
+	return r, nil
+}
+
+// Register register schema under subject, identical schema returns existing id
+func (r *fileRegistry) Register(ctx context.Context, subject string, schema *Schema) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	versions := r.state.Subjects[subject]
+	for _, s := range versions {
+		if bytes.Equal(s.Descriptor, schema.Descriptor) {
+			return s.ID, nil
+		}
+	}
+
+	var latest *Schema
+	if len(versions) > 0 {
+		latest = versions[len(versions)-1]
+	}
+	if err := checkCompatibility(r.compatibility, latest, schema); err != nil {
+		return 0, err
+	}
+
+	id := r.idOf(schema)
+	registered := &Schema{
+		ID:         id,
+		Subject:    subject,
+		Version:    len(versions) + 1,
+		SchemaType: schema.SchemaType,
+		Schema:     schema.Schema,
+		Descriptor: schema.Descriptor,
+	}
+	previous, shared := r.byID[id]
+	r.state.Subjects[subject] = append(versions, registered)
+	r.byID[id] = registered
+
+	if err := r.persist(); err != nil {
+		r.state.Subjects[subject] = versions
+		if shared {
+			r.byID[id] = previous
+		} else {
+			delete(r.byID, id)
+		}
+		return 0, err
+	}
+	return id, nil
+}
+
+// GetByID get schema by global id
+func (r *fileRegistry) GetByID(ctx context.Context, id int) (*Schema, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	s, ok := r.byID[id]
+	if !ok {
+		return nil, errors.Wrapf(ErrSchemaNotFound, "id %d", id)
+	}
+	return s, nil
+}
+
+// Latest get latest subject schema version
+func (r *fileRegistry) Latest(ctx context.Context, subject string) (*Schema, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	versions := r.state.Subjects[subject]
+	if len(versions) == 0 {
+		return nil, errors.Wrap(ErrSubjectNotFound, subject)
+	}
+	return versions[len(versions)-1], nil
+}
+
+// CheckCompatibility check schema against latest subject version
+func (r *fileRegistry) CheckCompatibility(ctx context.Context, subject string, schema *Schema) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	versions := r.state.Subjects[subject]
+	if len(versions) == 0 {
+		return nil
+	}
+	return checkCompatibility(r.compatibility, versions[len(versions)-1], schema)
+}
+
+// idOf same schema registered under different subjects shares id
+func (r *fileRegistry) idOf(schema *Schema) int {
+	for id, s := range r.byID {
+		if bytes.Equal(s.Descriptor, schema.Descriptor) {
+			return id
+		}
+	}
+	id := r.state.NextID
+	r.state.NextID++
+	return id
+}
+
+// persist write registry state atomically
+func (r *fileRegistry) persist() error {
+	data, err := json.MarshalIndent(&r.state, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "json.MarshalIndent")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return errors.Wrap(err, "os.MkdirAll")
+	}
+
+	tmp := r.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0o644); err != nil {
+		return errors.Wrap(err, "ioutil.WriteFile")
+	}
+	return os.Rename(tmp, r.path)
+}
@@ -0,0 +1,142 @@
+package schemaregistry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	contentTypeSchemaRegistry = "application/vnd.schemaregistry.v1+json"
+	defaultHttpTimeout        = 10 * time.Second
+
+	// confluent error codes
+	errCodeSubjectNotFound = 40401
+	errCodeSchemaNotFound  = 40403
+)
+
+// httpRegistry confluent schema registry REST client
+type httpRegistry struct {
+	baseURL string
+	client  *http.Client
+}
+
+type registerRequest struct {
+	Schema     string `json:"schema"`
+	SchemaType string `json:"schemaType,omitempty"`
+}
+
+type registryError struct {
+	ErrorCode int    `json:"error_code"`
+	Message   string `json:"message"`
+}
+
+// NewHttpRegistry constructor
+func NewHttpRegistry(baseURL string, timeout time.Duration) *httpRegistry {
+	if timeout == 0 {
+		timeout = defaultHttpTimeout
+	}
+	return &httpRegistry{baseURL: strings.TrimRight(baseURL, "/"), client: &http.Client{Timeout: timeout}}
+}
+
+// Register register schema under subject
+func (r *httpRegistry) Register(ctx context.Context, subject string, schema *Schema) (int, error) {
+	var res struct {
+		ID int `json:"id"`
+	}
+	path := fmt.Sprintf("/subjects/%s/versions", url.PathEscape(subject))
+	if err := r.do(ctx, http.MethodPost, path, &registerRequest{Schema: schema.Schema, SchemaType: schema.SchemaType}, &res); err != nil {
+		return 0, err
+	}
+	return res.ID, nil
+}
+
+// GetByID get schema by global id
+func (r *httpRegistry) GetByID(ctx context.Context, id int) (*Schema, error) {
+	var res struct {
+		Schema     string `json:"schema"`
+		SchemaType string `json:"schemaType"`
+	}
+	if err := r.do(ctx, http.MethodGet, fmt.Sprintf("/schemas/ids/%d", id), nil, &res); err != nil {
+		return nil, err
+	}
+	return &Schema{ID: id, Schema: res.Schema, SchemaType: res.SchemaType}, nil
+}
+
+// Latest get latest subject schema version
+func (r *httpRegistry) Latest(ctx context.Context, subject string) (*Schema, error) {
+	var res Schema
+	path := fmt.Sprintf("/subjects/%s/versions/latest", url.PathEscape(subject))
+	if err := r.do(ctx, http.MethodGet, path, nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// CheckCompatibility check schema against latest subject version using registry configured compatibility
+func (r *httpRegistry) CheckCompatibility(ctx context.Context, subject string, schema *Schema) error {
+	var res struct {
+		IsCompatible bool `json:"is_compatible"`
+	}
+	path := fmt.Sprintf("/compatibility/subjects/%s/versions/latest", url.PathEscape(subject))
+	err := r.do(ctx, http.MethodPost, path, &registerRequest{Schema: schema.Schema, SchemaType: schema.SchemaType}, &res)
+	if errors.Is(err, ErrSubjectNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !res.IsCompatible {
+		return errors.Wrap(ErrIncompatibleSchema, subject)
+	}
+	return nil
+}
+
+func (r *httpRegistry) do(ctx context.Context, method, path string, body, result interface{}) error {
+	var reqBody bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reqBody).Encode(body); err != nil {
+			return errors.Wrap(err, "json.Encode")
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, r.baseURL+path, &reqBody)
+	if err != nil {
+		return errors.Wrap(err, "http.NewRequestWithContext")
+	}
+	req.Header.Set("Accept", contentTypeSchemaRegistry)
+	if body != nil {
+		req.Header.Set("Content-Type", contentTypeSchemaRegistry)
+	}
+
+	res, err := r.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "client.Do")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= http.StatusBadRequest {
+		var regErr registryError
+		if err := json.NewDecoder(res.Body).Decode(&regErr); err != nil {
+			return errors.Errorf("schema registry %s %s: status %d", method, path, res.StatusCode)
+		}
+		switch {
+		case regErr.ErrorCode == errCodeSubjectNotFound:
+			return errors.Wrap(ErrSubjectNotFound, regErr.Message)
+		case regErr.ErrorCode == errCodeSchemaNotFound:
+			return errors.Wrap(ErrSchemaNotFound, regErr.Message)
+		case res.StatusCode == http.StatusConflict:
+			return errors.Wrap(ErrIncompatibleSchema, regErr.Message)
+		}
+		return errors.Errorf("schema registry %s %s: %d %s", method, path, regErr.ErrorCode, regErr.Message)
+	}
+
+	return json.NewDecoder(res.Body).Decode(result)
+}
@@ -0,0 +1,145 @@
+package schemaregistry
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// ProtobufSerde confluent wire format serializer and deserializer of one protobuf message type
+type ProtobufSerde struct {
+	client         Client
+	schema         *Schema
+	descriptor     protoreflect.MessageDescriptor
+	messageIndexes []int
+
+	mu         sync.RWMutex
+	subjectIDs map[string]int
+	readable   map[int]error
+}
+
+// NewProtobufSerde constructor, schemaText is the .proto source of message file sent to remote registries
+func NewProtobufSerde(client Client, msg proto.Message, schemaText string) (*ProtobufSerde, error) {
+	md := msg.ProtoReflect().Descriptor()
+	fdp := protodesc.ToFileDescriptorProto(md.ParentFile())
+	descriptor, err := proto.MarshalOptions{Deterministic: true}.Marshal(fdp)
+	if err != nil {
+		return nil, errors.Wrap(err, "proto.Marshal")
+	}
+
+	return &ProtobufSerde{
+		client: client,
+		schema: &Schema{
+			SchemaType: SchemaTypeProtobuf,
+			Schema:     schemaText,
+			Descriptor: descriptor,
+		},
+		descriptor:     md,
+		messageIndexes: messageIndexes(md),
+		subjectIDs:     make(map[string]int),
+		readable:       make(map[int]error),
+	}, nil
+}
+
+// Serialize register schema under subject on first use and encode message in wire format
+func (s *ProtobufSerde) Serialize(ctx context.Context, subject string, msg proto.Message) ([]byte, error) {
+	if msg.ProtoReflect().Descriptor().FullName() != s.descriptor.FullName() {
+		return nil, errors.Errorf("serde of %s can't serialize %s", s.descriptor.FullName(), msg.ProtoReflect().Descriptor().FullName())
+	}
+
+	id, err := s.schemaID(ctx, subject)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := proto.Marshal(msg)
+	if err != nil {
+		return nil, errors.Wrap(err, "proto.Marshal")
+	}
+	return EncodeWireFormat(id, s.messageIndexes, payload), nil
+}
+
+// Deserialize decode wire format payload, writer schema must be readable with local message schema
+func (s *ProtobufSerde) Deserialize(ctx context.Context, data []byte, msg proto.Message) error {
+	id, _, payload, err := DecodeWireFormat(data)
+	if err != nil {
+		return err
+	}
+
+	if err := s.checkReadable(ctx, id); err != nil {
+		return err
+	}
+
+	if err := proto.Unmarshal(payload, msg); err != nil {
+		return errors.Wrap(err, "proto.Unmarshal")
+	}
+	return nil
+}
+
+// RegisterSubject register schema under subject, fails on incompatible schema changes
+func (s *ProtobufSerde) RegisterSubject(ctx context.Context, subject string) error {
+	_, err := s.schemaID(ctx, subject)
+	return err
+}
+
+func (s *ProtobufSerde) schemaID(ctx context.Context, subject string) (int, error) {
+	s.mu.RLock()
+	id, ok := s.subjectIDs[subject]
+	s.mu.RUnlock()
+	if ok {
+		return id, nil
+	}
+
+	id, err := s.client.Register(ctx, subject, s.schema)
+	if err != nil {
+		return 0, errors.Wrapf(err, "register subject %s", subject)
+	}
+
+	s.mu.Lock()
+	s.subjectIDs[subject] = id
+	s.mu.Unlock()
+	return id, nil
+}
+
+// checkReadable verify writer schema against local one once per schema id
+func (s *ProtobufSerde) checkReadable(ctx context.Context, id int) error {
+	s.mu.RLock()
+	err, ok := s.readable[id]
+	s.mu.RUnlock()
+	if ok {
+		return err
+	}
+
+	writer, err := s.client.GetByID(ctx, id)
+	if err != nil {
+		return errors.Wrapf(err, "schema id %d", id)
+	}
+
+	// remote registries return only schema text, their compatibility was checked on register
+	if len(writer.Descriptor) > 0 {
+		err = checkCompatibility(CompatibilityBackward, writer, s.schema)
+	}
+
+	s.mu.Lock()
+	s.readable[id] = err
+	s.mu.Unlock()
+	return err
+}
+
+// messageIndexes path of message in its file, as used by confluent wire format
+func messageIndexes(md protoreflect.MessageDescriptor) []int {
+	var indexes []int
+	var d protoreflect.Descriptor = md
+	for {
+		indexes = append([]int{d.Index()}, indexes...)
+		parent, ok := d.Parent().(protoreflect.MessageDescriptor)
+		if !ok {
+			return indexes
+		}
+		d = parent
+	}
+}
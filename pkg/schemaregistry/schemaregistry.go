@@ -0,0 +1,57 @@
+package schemaregistry
+
+import (
+	"context"
+
+	"github.com/Yangiboev/golang-with-curiosity/config"
+	"github.com/pkg/errors"
+)
+
+const (
+	SchemaTypeProtobuf = "PROTOBUF"
+
+	defaultRegistryFile = "./schemas/registry.json"
+)
+
+var (
+	ErrSchemaNotFound     = errors.New("schema not found")
+	ErrSubjectNotFound    = errors.New("subject not found")
+	ErrIncompatibleSchema = errors.New("schema is incompatible with the latest registered version")
+	ErrInvalidWireFormat  = errors.New("invalid confluent wire format")
+)
+
+// Schema registered schema version, Descriptor is serialized FileDescriptorProto and is empty for schemas fetched from remote registry
+type Schema struct {
+	ID         int    `json:"id"`
+	Subject    string `json:"subject"`
+	Version    int    `json:"version"`
+	SchemaType string `json:"schemaType"`
+	Schema     string `json:"schema"`
+	Descriptor []byte `json:"descriptor,omitempty"`
+}
+
+// Client schema registry
+type Client interface {
+	Register(ctx context.Context, subject string, schema *Schema) (int, error)
+	GetByID(ctx context.Context, id int) (*Schema, error)
+	Latest(ctx context.Context, subject string) (*Schema, error)
+	CheckCompatibility(ctx context.Context, subject string, schema *Schema) error
+}
+
+// NewSchemaRegistry remote confluent registry when URL is configured, embedded file backed registry otherwise
+func NewSchemaRegistry(cfg config.Config) (Client, error) {
+	compatibility := Compatibility(cfg.SchemaRegistry.Compatibility)
+	if compatibility == "" {
+		compatibility = CompatibilityBackward
+	}
+
+	if cfg.SchemaRegistry.URL != "" {
+		return NewHttpRegistry(cfg.SchemaRegistry.URL, cfg.SchemaRegistry.Timeout), nil
+	}
+
+	file := cfg.SchemaRegistry.File
+	if file == "" {
+		file = defaultRegistryFile
+	}
+	return NewFileRegistry(file, compatibility)
+}
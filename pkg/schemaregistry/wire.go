@@ -0,0 +1,68 @@
+package schemaregistry
+
+import (
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	magicByte  = 0x0
+	headerSize = 5
+)
+
+// EncodeWireFormat confluent protobuf wire format: magic byte, big endian schema id, message indexes, payload
+func EncodeWireFormat(schemaID int, messageIndexes []int, payload []byte) []byte {
+	buf := make([]byte, headerSize, headerSize+binary.MaxVarintLen64*(len(messageIndexes)+1)+len(payload))
+	buf[0] = magicByte
+	binary.BigEndian.PutUint32(buf[1:headerSize], uint32(schemaID))
+
+	// first message in file is encoded as a single zero instead of [1, 0]
+	if len(messageIndexes) == 1 && messageIndexes[0] == 0 {
+		buf = append(buf, 0)
+	} else {
+		buf = appendVarint(buf, int64(len(messageIndexes)))
+		for _, idx := range messageIndexes {
+			buf = appendVarint(buf, int64(idx))
+		}
+	}
+
+	return append(buf, payload...)
+}
+
+// DecodeWireFormat parse confluent protobuf wire format
+func DecodeWireFormat(data []byte) (schemaID int, messageIndexes []int, payload []byte, err error) {
+	if len(data) < headerSize+1 || data[0] != magicByte {
+		return 0, nil, nil, ErrInvalidWireFormat
+	}
+	schemaID = int(binary.BigEndian.Uint32(data[1:headerSize]))
+	rest := data[headerSize:]
+
+	count, n := binary.Varint(rest)
+	if n <= 0 || count < 0 {
+		return 0, nil, nil, errors.Wrap(ErrInvalidWireFormat, "message indexes length")
+	}
+	rest = rest[n:]
+
+	if count == 0 {
+		return schemaID, []int{0}, rest, nil
+	}
+
+	messageIndexes = make([]int, 0, count)
+	for i := int64(0); i < count; i++ {
+		idx, n := binary.Varint(rest)
+		if n <= 0 || idx < 0 {
+			return 0, nil, nil, errors.Wrap(ErrInvalidWireFormat, "message index")
+		}
+		messageIndexes = append(messageIndexes, int(idx))
+		rest = rest[n:]
+	}
+
+	return schemaID, messageIndexes, rest, nil
+}
+
+func appendVarint(buf []byte, v int64) []byte {
+	tmp := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutVarint(tmp, v)
+	return append(buf, tmp[:n]...)
+}
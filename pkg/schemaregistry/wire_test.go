@@ -0,0 +1,80 @@
+package schemaregistry
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestWireFormatRoundTrip(t *testing.T) {
+	tests := []struct {
+		name           string
+		schemaID       int
+		messageIndexes []int
+		payload        []byte
+	}{
+		{name: "first message", schemaID: 1, messageIndexes: []int{0}, payload: []byte("payload")},
+		{name: "nested message", schemaID: 1 << 20, messageIndexes: []int{2, 1}, payload: []byte("payload")},
+		{name: "empty payload", schemaID: 42, messageIndexes: []int{0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := EncodeWireFormat(tt.schemaID, tt.messageIndexes, tt.payload)
+			if data[0] != magicByte {
+				t.Fatalf("magic byte = %#x, want %#x", data[0], magicByte)
+			}
+
+			schemaID, messageIndexes, payload, err := DecodeWireFormat(data)
+			if err != nil {
+				t.Fatalf("DecodeWireFormat: %v", err)
+			}
+			if schemaID != tt.schemaID || !equalInts(messageIndexes, tt.messageIndexes) || !bytes.Equal(payload, tt.payload) {
+				t.Fatalf("decoded %d %v %q, want %d %v %q", schemaID, messageIndexes, payload, tt.schemaID, tt.messageIndexes, tt.payload)
+			}
+		})
+	}
+}
+
+func TestEncodeWireFormatHeader(t *testing.T) {
+	data := EncodeWireFormat(258, []int{0}, []byte{0xaa})
+
+	// magic byte, big endian schema id, single zero for first message, payload
+	want := []byte{0x0, 0x0, 0x0, 0x1, 0x2, 0x0, 0xaa}
+	if !bytes.Equal(data, want) {
+		t.Fatalf("encoded % x, want % x", data, want)
+	}
+}
+
+func TestDecodeWireFormatRejectsInvalidData(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "empty", data: nil},
+		{name: "header only", data: []byte{0x0, 0x0, 0x0, 0x0, 0x1}},
+		{name: "unknown magic byte", data: []byte{0x1, 0x0, 0x0, 0x0, 0x1, 0x0}},
+		{name: "negative message indexes length", data: []byte{0x0, 0x0, 0x0, 0x0, 0x1, 0x1}},
+		{name: "truncated message indexes", data: []byte{0x0, 0x0, 0x0, 0x0, 0x1, 0x4, 0x2}},
+		{name: "malformed varint", data: []byte{0x0, 0x0, 0x0, 0x0, 0x1, 0x80}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, _, err := DecodeWireFormat(tt.data); !errors.Is(err, ErrInvalidWireFormat) {
+				t.Fatalf("DecodeWireFormat error = %v, want ErrInvalidWireFormat", err)
+			}
+		})
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
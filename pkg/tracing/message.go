@@ -0,0 +1,107 @@
+package tracing
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Yangiboev/golang-with-curiosity/pkg/messagebus"
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"github.com/uber/jaeger-client-go"
+)
+
+const (
+	// W3C trace context header
+	traceParentHeader  = "traceparent"
+	traceParentVersion = "00"
+	sampledFlag        = 0x01
+)
+
+var ErrNoTraceContext = errors.New("no trace context in message headers")
+
+// MessageHeadersCarrier opentracing TextMap carrier over message headers
+type MessageHeadersCarrier struct {
+	Headers []messagebus.Header
+}
+
+// Set replace or append header
+func (c *MessageHeadersCarrier) Set(key, val string) {
+	c.Headers = messagebus.SetHeader(c.Headers, key, val)
+}
+
+// ForeachKey iterate headers
+func (c *MessageHeadersCarrier) ForeachKey(handler func(key, val string) error) error {
+	for _, h := range c.Headers {
+		if err := handler(h.Key, string(h.Value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InjectMessageHeaders inject span context into headers in tracer format and as W3C traceparent
+func InjectMessageHeaders(span opentracing.Span, headers []messagebus.Header) []messagebus.Header {
+	carrier := &MessageHeadersCarrier{Headers: headers}
+	_ = span.Tracer().Inject(span.Context(), opentracing.TextMap, carrier)
+
+	if sc, ok := span.Context().(jaeger.SpanContext); ok {
+		carrier.Set(traceParentHeader, formatTraceParent(sc))
+	}
+	return carrier.Headers
+}
+
+// ExtractMessageHeaders extract span context from tracer format headers, falling back to W3C traceparent
+func ExtractMessageHeaders(tracer opentracing.Tracer, headers []messagebus.Header) (opentracing.SpanContext, error) {
+	carrier := &MessageHeadersCarrier{Headers: headers}
+	sc, err := tracer.Extract(opentracing.TextMap, carrier)
+	if err == nil {
+		return sc, nil
+	}
+
+	for _, h := range headers {
+		if h.Key == traceParentHeader {
+			return parseTraceParent(string(h.Value))
+		}
+	}
+	return nil, ErrNoTraceContext
+}
+
+func formatTraceParent(sc jaeger.SpanContext) string {
+	var flags byte
+	if sc.IsSampled() {
+		flags |= sampledFlag
+	}
+	return fmt.Sprintf("%s-%016x%016x-%016x-%02x", traceParentVersion, sc.TraceID().High, sc.TraceID().Low, uint64(sc.SpanID()), flags)
+}
+
+// parseTraceParent parse "version-traceid-parentid-flags"
+func parseTraceParent(v string) (jaeger.SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(v), "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return jaeger.SpanContext{}, errors.Errorf("invalid traceparent: %s", v)
+	}
+
+	high, err := strconv.ParseUint(parts[1][:16], 16, 64)
+	if err != nil {
+		return jaeger.SpanContext{}, errors.Wrap(err, "trace id")
+	}
+	low, err := strconv.ParseUint(parts[1][16:], 16, 64)
+	if err != nil {
+		return jaeger.SpanContext{}, errors.Wrap(err, "trace id")
+	}
+	spanID, err := strconv.ParseUint(parts[2], 16, 64)
+	if err != nil {
+		return jaeger.SpanContext{}, errors.Wrap(err, "parent id")
+	}
+	flags, err := strconv.ParseUint(parts[3], 16, 8)
+	if err != nil {
+		return jaeger.SpanContext{}, errors.Wrap(err, "flags")
+	}
+
+	traceID := jaeger.TraceID{High: high, Low: low}
+	if !traceID.IsValid() || spanID == 0 {
+		return jaeger.SpanContext{}, errors.Errorf("invalid traceparent: %s", v)
+	}
+	return jaeger.NewSpanContext(traceID, jaeger.SpanID(spanID), 0, flags&sampledFlag != 0, nil), nil
+}
@@ -0,0 +1,93 @@
+package tracing
+
+import (
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"github.com/uber/jaeger-client-go"
+
+	"github.com/Yangiboev/golang-with-curiosity/pkg/messagebus"
+)
+
+func newTestTracer(t *testing.T) opentracing.Tracer {
+	t.Helper()
+	tracer, closer := jaeger.NewTracer("products", jaeger.NewConstSampler(true), jaeger.NewNullReporter())
+	t.Cleanup(func() { _ = closer.Close() })
+	return tracer
+}
+
+func TestInjectedSpanContextIsExtracted(t *testing.T) {
+	tracer := newTestTracer(t)
+	span := tracer.StartSpan("productsProducer.PublishCreate")
+	defer span.Finish()
+
+	headers := InjectMessageHeaders(span, []messagebus.Header{{Key: "ce_type", Value: []byte("product.created")}})
+
+	m := messagebus.Message{Headers: headers}
+	if v, ok := m.Header("ce_type"); !ok || v != "product.created" {
+		t.Fatalf("ce_type header %q, want existing headers kept", v)
+	}
+	if _, ok := m.Header(traceParentHeader); !ok {
+		t.Fatalf("traceparent header missing")
+	}
+
+	sc, err := ExtractMessageHeaders(tracer, headers)
+	if err != nil {
+		t.Fatalf("ExtractMessageHeaders: %v", err)
+	}
+	want := span.Context().(jaeger.SpanContext)
+	if got := sc.(jaeger.SpanContext); got.TraceID() != want.TraceID() || got.SpanID() != want.SpanID() {
+		t.Fatalf("extracted trace %v span %v, want trace %v span %v", got.TraceID(), got.SpanID(), want.TraceID(), want.SpanID())
+	}
+}
+
+func TestExtractFallsBackToTraceParent(t *testing.T) {
+	tracer := newTestTracer(t)
+	headers := []messagebus.Header{{Key: traceParentHeader, Value: []byte("00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")}}
+
+	sc, err := ExtractMessageHeaders(tracer, headers)
+	if err != nil {
+		t.Fatalf("ExtractMessageHeaders: %v", err)
+	}
+
+	got := sc.(jaeger.SpanContext)
+	wantTraceID := jaeger.TraceID{High: 0x0af7651916cd43dd, Low: 0x8448eb211c80319c}
+	if got.TraceID() != wantTraceID || got.SpanID() != jaeger.SpanID(0xb7ad6b7169203331) || !got.IsSampled() {
+		t.Fatalf("extracted trace %v span %v sampled %v, want trace of traceparent", got.TraceID(), got.SpanID(), got.IsSampled())
+	}
+
+	span := tracer.StartSpan("ProductsConsumerGroup.processMessage", opentracing.FollowsFrom(sc))
+	defer span.Finish()
+	if child := span.Context().(jaeger.SpanContext); child.TraceID() != wantTraceID {
+		t.Fatalf("consumer span trace %v, want trace of producer %v", child.TraceID(), wantTraceID)
+	}
+}
+
+func TestExtractWithoutTraceContext(t *testing.T) {
+	tracer := newTestTracer(t)
+
+	if _, err := ExtractMessageHeaders(tracer, nil); !errors.Is(err, ErrNoTraceContext) {
+		t.Fatalf("ExtractMessageHeaders error = %v, want ErrNoTraceContext", err)
+	}
+}
+
+func TestParseTraceParentRejectsMalformedValues(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{name: "missing parts", value: "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331"},
+		{name: "short trace id", value: "00-0af7651916cd43dd-b7ad6b7169203331-01"},
+		{name: "non hex trace id", value: "00-0af7651916cd43dd8448eb211c80319z-b7ad6b7169203331-01"},
+		{name: "zero trace id", value: "00-00000000000000000000000000000000-b7ad6b7169203331-01"},
+		{name: "zero parent id", value: "00-0af7651916cd43dd8448eb211c80319c-0000000000000000-01"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseTraceParent(tt.value); err == nil {
+				t.Fatalf("parseTraceParent(%q) error = nil, want error", tt.value)
+			}
+		})
+	}
+}
@@ -0,0 +1,16 @@
+package productsService
+
+import (
+	_ "embed"
+	"regexp"
+)
+
+//go:embed product.proto
+var protoSource string
+
+// httpAnnotations google.api.http annotations and their import, they only drive grpc-gateway
+var httpAnnotations = regexp.MustCompile(`(?s)import "google/api/annotations\.proto";\n|\s*option \(google\.api\.http\) = \{.*?\};`)
+
+// ProtoFile product.proto source, registered in the schema registry for protobuf encoded kafka payloads.
+// HTTP annotations are left out, schema registries can't resolve google/api imports
+var ProtoFile = httpAnnotations.ReplaceAllString(protoSource, "")
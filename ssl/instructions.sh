@@ -27,7 +27,8 @@ openssl genrsa -passout pass:1111 -des3 -out server.key 4096
 openssl req -passin pass:1111 -new -key server.key -out server.csr -subj "/CN=${SERVER_CN}"
 
 # Step 4: Sign the certificate with the CA we created (it's called self signing) - server.crt
-openssl x509 -req -passin pass:1111 -days 3650 -in server.csr -CA ca.crt -CAkey ca.key -set_serial 01 -out server.crt
+# subjectAltName is required by Go TLS clients such as the grpc-gateway
+openssl x509 -req -passin pass:1111 -days 3650 -in server.csr -CA ca.crt -CAkey ca.key -set_serial 01 -out server.crt -extfile <(printf "subjectAltName=DNS:${SERVER_CN}")
 
 # Step 5: Convert the server certificate to .pem format (server.pem) - usable by grpc
 openssl pkcs8 -topk8 -nocrypt -passin pass:1111 -in server.key -out server.pem
\ No newline at end of file